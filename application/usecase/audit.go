@@ -0,0 +1,31 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// writeAudit 実行者をコンテキストから補って監査ログを書き込みます（書き込み失敗は操作自体の失敗にはしない）
+func writeAudit(ctx context.Context, as proxy.AuditSink, action, target string, err error) {
+	actor := model.ActorFromContext(ctx)
+	ev := &model.AuditEvent{
+		Time:      time.Now(),
+		Action:    action,
+		ActorSub:  actor.Sub,
+		Target:    target,
+		IP:        actor.IP,
+		UserAgent: actor.UserAgent,
+		Outcome:   model.AuditOutcomeSuccess,
+	}
+	if err != nil {
+		ev.Outcome = model.AuditOutcomeFailure
+		ev.Reason = err.Error()
+	}
+	if werr := as.Write(ctx, ev); werr != nil {
+		log.Default().Printf("%+v", werr)
+	}
+}
@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 通知メール送信のタイムアウト（レスポンスとは非同期に送る）
+const notifyTimeout = 30 * time.Second
+
+// 存在しないアカウントに返すダミーのセッションのバイト数
+const dummySessionSize = 384
+
+// サインアップ、パスワード忘れ、確認コード再送、パスワードレスログインの開始で、アカウントの有無によって応答と応答時間が変わらないようにします
+// 実際の結果は監査ログにのみ残し、既存のユーザにはメールで知らせます
+type enumerationSafeUsecase struct {
+	UserUsecase
+	mailer          proxy.Mailer
+	minResponseTime time.Duration
+}
+
+// NewEnumerationSafeUsecase UserUsecaseをアカウント列挙対策で修飾します
+//
+// 応答時間はminResponseTimeに揃えるため、通常の処理時間より長く設定してください。
+func NewEnumerationSafeUsecase(
+	uu UserUsecase,
+	mailer proxy.Mailer,
+	minResponseTime time.Duration,
+) UserUsecase {
+	return &enumerationSafeUsecase{uu, mailer, minResponseTime}
+}
+
+// Create アカウント新規作成（既に存在する場合は成功として扱い、本人にメールで知らせる）
+func (eu *enumerationSafeUsecase) Create(ctx context.Context, req *viewmodel.CreateReq) error {
+	defer eu.pad(ctx, time.Now())
+	err := eu.UserUsecase.Create(ctx, req)
+	if errors.Is(err, model.ErrUserAlreadyExists) {
+		eu.notify(&model.Mail{
+			To:      req.Email,
+			Subject: "Sign-up attempt for your account",
+			Body: "Someone tried to sign up with this email address, but you already have an account.\n" +
+				"If this was you, please sign in or reset your password. Otherwise you can ignore this email.\n",
+		})
+		return nil
+	}
+	return err
+}
+
+// ForgotPassword パスワード忘れ（存在しないアカウントでも成功として扱う）
+func (eu *enumerationSafeUsecase) ForgotPassword(ctx context.Context, req *viewmodel.ForgotPasswordReq) error {
+	defer eu.pad(ctx, time.Now())
+	err := eu.UserUsecase.ForgotPassword(ctx, req)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ResendConfirmationCode 確認コード再送（存在しない、確認済みのアカウントでも成功として扱う）
+func (eu *enumerationSafeUsecase) ResendConfirmationCode(ctx context.Context, req *viewmodel.ResendConfirmationCodeReq) error {
+	defer eu.pad(ctx, time.Now())
+	err := eu.UserUsecase.ResendConfirmationCode(ctx, req)
+	switch {
+	case errors.Is(err, model.ErrUserNotFound):
+		return nil
+	case errors.Is(err, model.ErrUserAlreadyConfirmed):
+		eu.notify(&model.Mail{
+			To:      req.Email,
+			Subject: "Your account is already confirmed",
+			Body: "A new confirmation code was requested for this email address, but your account is already confirmed.\n" +
+				"You can sign in, or reset your password if you have forgotten it.\n",
+		})
+		return nil
+	}
+	return err
+}
+
+// PasswordlessStart パスワードレスログインの開始（存在しないアカウントでもダミーのセッションを返す）
+func (eu *enumerationSafeUsecase) PasswordlessStart(ctx context.Context, req *viewmodel.PasswordlessStartReq) (*viewmodel.PasswordlessStartResp, error) {
+	defer eu.pad(ctx, time.Now())
+	resp, err := eu.UserUsecase.PasswordlessStart(ctx, req)
+	if errors.Is(err, model.ErrUserNotFound) {
+		// ダミーのセッションでの回答はCognitoで拒否され、誤ったコードと同じ応答になる
+		b := make([]byte, dummySessionSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &viewmodel.PasswordlessStartResp{Session: base64.RawURLEncoding.EncodeToString(b)}, nil
+	}
+	return resp, err
+}
+
+// pad 処理時間に関わらず、開始からminResponseTime経過するまで待ちます
+func (eu *enumerationSafeUsecase) pad(ctx context.Context, start time.Time) {
+	wait := time.Until(start.Add(eu.minResponseTime))
+	if wait <= 0 {
+		log.Default().Printf("response took longer than ENUMERATION_MIN_RESPONSE_TIME (%s)", eu.minResponseTime)
+		return
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// notify 応答時間に影響しないよう非同期に送信します
+func (eu *enumerationSafeUsecase) notify(m *model.Mail) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := eu.mailer.Send(ctx, m); err != nil {
+			log.Default().Printf("%+v", err)
+		}
+	}()
+}
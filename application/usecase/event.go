@@ -0,0 +1,20 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// publishEvent 成功した操作のイベントを通知します（epがnilの場合は何もしない、通知の失敗は操作自体の失敗にはしない）
+func publishEvent(ctx context.Context, ep proxy.EventPublisher, eventType string, data map[string]string) {
+	if ep == nil {
+		return
+	}
+	if err := ep.Publish(ctx, &model.Event{Type: eventType, Time: time.Now(), Data: data}); err != nil {
+		log.Default().Printf("%+v", err)
+	}
+}
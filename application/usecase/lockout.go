@@ -0,0 +1,198 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// LockoutPolicy 認証失敗時の待ち時間とロックアウトの条件
+type LockoutPolicy struct {
+	// AccountMaxFailures, IPMaxFailures この回数失敗するとLockoutDurationの間ロックする（0で無効）
+	AccountMaxFailures int
+	IPMaxFailures      int
+	// BaseDelay ロック前の失敗後に次の試行まで待たせる時間（失敗毎に倍になり、MaxDelayで頭打ち）
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	// ResetAfter 最後の失敗からこの時間経過すると失敗回数を忘れる
+	ResetAfter time.Duration
+}
+
+// delay failures回失敗した後に次の試行まで待たせる時間
+func (p *LockoutPolicy) delay(failures, max int) time.Duration {
+	if failures <= 0 || max <= 0 {
+		return 0
+	}
+	if failures >= max {
+		return p.LockoutDuration
+	}
+	d := p.BaseDelay
+	for i := 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// LockoutUsecase 認証失敗のロックアウトに対する操作を抽象化します
+type LockoutUsecase interface {
+	UserUsecase
+	Unlock(ctx context.Context, req *viewmodel.UnlockReq) error
+}
+
+// Signin、Confirm、PasswordlessVerifyの失敗をアカウント、IP毎に記録し、繰り返し失敗する場合は試行を拒否します
+type lockoutUsecase struct {
+	UserUsecase
+	ls     proxy.LockoutStore
+	as     proxy.AuditSink
+	policy LockoutPolicy
+}
+
+// NewLockoutUsecase UserUsecaseをロックアウトで修飾します
+func NewLockoutUsecase(
+	uu UserUsecase,
+	ls proxy.LockoutStore,
+	as proxy.AuditSink,
+	policy LockoutPolicy,
+) LockoutUsecase {
+	return &lockoutUsecase{uu, ls, as, policy}
+}
+
+// Confirm アカウント確認を行います（ログインも試行するためロックアウトの対象）
+func (lu *lockoutUsecase) Confirm(ctx context.Context, req *viewmodel.ConfirmReq) (*viewmodel.SigninResp, error) {
+	var resp *viewmodel.SigninResp
+	err := lu.guard(ctx, req.Email, func() (err error) {
+		resp, err = lu.UserUsecase.Confirm(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// Signin ログインを行います
+func (lu *lockoutUsecase) Signin(ctx context.Context, req *viewmodel.SigninReq) (*viewmodel.SigninResp, error) {
+	var resp *viewmodel.SigninResp
+	err := lu.guard(ctx, req.Email, func() (err error) {
+		resp, err = lu.UserUsecase.Signin(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// PasswordlessVerify ワンタイムコードでログインします
+func (lu *lockoutUsecase) PasswordlessVerify(ctx context.Context, req *viewmodel.PasswordlessVerifyReq) (*viewmodel.SigninResp, error) {
+	var resp *viewmodel.SigninResp
+	err := lu.guard(ctx, req.Email, func() (err error) {
+		resp, err = lu.UserUsecase.PasswordlessVerify(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// Unlock アカウント、IPのロックアウトを解除します
+func (lu *lockoutUsecase) Unlock(ctx context.Context, req *viewmodel.UnlockReq) error {
+	var keys []string
+	if req.Email != "" {
+		keys = append(keys, accountKey(req.Email))
+	}
+	if req.IP != "" {
+		keys = append(keys, ipKey(req.IP))
+	}
+	for _, k := range keys {
+		err := lu.ls.Reset(ctx, k)
+		lu.audit(ctx, model.AuditActionUnlock, k, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guard ロック中であれば試行せずに拒否し、試行結果に応じて失敗回数を更新します
+func (lu *lockoutUsecase) guard(ctx context.Context, email string, attempt func() error) error {
+	ip := model.ActorFromContext(ctx).IP
+	targets := []struct {
+		key string
+		max int
+	}{
+		{accountKey(email), lu.policy.AccountMaxFailures},
+		{ipKey(ip), lu.policy.IPMaxFailures},
+	}
+
+	for _, t := range targets {
+		if t.max <= 0 || t.key == ipKey("") {
+			continue
+		}
+		failures, last, err := lu.ls.Get(ctx, t.key)
+		if err != nil {
+			// ストア障害で全てのサインインを止めないよう、制限せずに通す
+			log.Default().Printf("%+v", err)
+			continue
+		}
+		if wait := time.Until(last.Add(lu.policy.delay(failures, t.max))); failures > 0 && wait > 0 {
+			lerr := &model.LockedError{RetryAfter: wait}
+			lu.audit(ctx, model.AuditActionLockoutRejected, t.key, lerr)
+			return lerr
+		}
+	}
+
+	if err := attempt(); err != nil {
+		if !isCredentialFailure(err) {
+			return err
+		}
+		for _, t := range targets {
+			if t.max <= 0 || t.key == ipKey("") {
+				continue
+			}
+			failures, ferr := lu.ls.Fail(ctx, t.key, lu.policy.ResetAfter)
+			if ferr != nil {
+				log.Default().Printf("%+v", ferr)
+				continue
+			}
+			if failures == t.max {
+				lu.audit(ctx, model.AuditActionLockout, t.key, &model.LockedError{RetryAfter: lu.policy.LockoutDuration})
+			}
+		}
+		return err
+	}
+	// IPは別アカウントでの成功で解除されないよう、アカウントのみリセットする
+	if lu.policy.AccountMaxFailures > 0 {
+		if err := lu.ls.Reset(ctx, accountKey(email)); err != nil {
+			log.Default().Printf("%+v", err)
+		}
+	}
+	return nil
+}
+
+// isCredentialFailure 誤ったパスワード、コードによる失敗か
+//
+// 流量制限やバックエンドの障害、未確認のアカウント等の失敗を数えると、障害時に利用者がロックされるため数えない。
+// 存在しないアカウントは、誤ったパスワードと区別できないよう失敗として数える。
+func isCredentialFailure(err error) bool {
+	var ce *model.InvalidChallengeAnswerError
+	return errors.Is(err, model.ErrNotAuthorized) ||
+		errors.Is(err, model.ErrInvalidCode) ||
+		errors.Is(err, model.ErrUserNotFound) ||
+		errors.As(err, &ce)
+}
+
+func (lu *lockoutUsecase) audit(ctx context.Context, action, target string, err error) {
+	writeAudit(ctx, lu.as, action, target, err)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
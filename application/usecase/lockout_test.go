@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/memory"
+)
+
+// Signinが常にerrで失敗するUserUsecase
+type failingSignin struct {
+	UserUsecase
+	err error
+}
+
+func (f *failingSignin) Signin(ctx context.Context, req *viewmodel.SigninReq) (*viewmodel.SigninResp, error) {
+	return nil, f.err
+}
+
+func TestLockoutCountsOnlyCredentialFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantLocked bool
+	}{
+		{"wrong password", errors.Wrap(model.ErrNotAuthorized, "password mismatch"), true},
+		{"unknown user", errors.Wrap(model.ErrUserNotFound, "user not found"), true},
+		{"wrong code", errors.WithStack(&model.InvalidChallengeAnswerError{}), true},
+		{"throttled", errors.Wrap(model.ErrTooManyRequests, "rate exceeded"), false},
+		{"not confirmed", errors.WithStack(model.ErrUserNotConfirmed), false},
+		{"backend outage", errors.WithStack(fmt.Errorf("dial tcp: connection refused")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ctx = model.WithActor(ctx, &model.Actor{IP: "192.0.2.1"})
+			lu := NewLockoutUsecase(&failingSignin{err: tt.err}, memory.NewLockoutStore(ctx), new(auditRecorder), LockoutPolicy{
+				AccountMaxFailures: 2,
+				IPMaxFailures:      2,
+				BaseDelay:          time.Hour,
+				MaxDelay:           time.Hour,
+				LockoutDuration:    time.Hour,
+				ResetAfter:         time.Hour,
+			})
+			req := &viewmodel.SigninReq{SigninReq: model.SigninReq{Email: "taro@example.com", Password: "x"}}
+			if _, err := lu.Signin(ctx, req); !errors.Is(err, errors.Cause(tt.err)) {
+				t.Fatalf("first attempt err = %v, want %v", err, tt.err)
+			}
+			_, err := lu.Signin(ctx, req)
+			var le *model.LockedError
+			if got := errors.As(err, &le); got != tt.wantLocked {
+				t.Errorf("second attempt locked = %v (err %v), want %v", got, err, tt.wantLocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// MagicLinkUsecase メールのリンクによるログインを抽象化します
+type MagicLinkUsecase interface {
+	StartMagicLink(ctx context.Context, req *viewmodel.MagicLinkStartReq) error
+	CompleteMagicLink(ctx context.Context, req *viewmodel.MagicLinkCallbackReq) (*viewmodel.SigninResp, error)
+}
+
+// 一度だけ使える署名付きのリンクをメールで送り、リンクの使用時にCUSTOM_AUTHでログインします
+type magicLinkUsecase struct {
+	ap          proxy.UserProxy
+	tk          proxy.MagicLinkTokenizer
+	rs          proxy.ReplayStore
+	mailer      proxy.Mailer
+	as          proxy.AuditSink
+	callbackURL string
+	ttl         time.Duration
+}
+
+// NewMagicLinkUsecase MagicLinkUsecaseを生成します（callbackURLにtokenクエリを付けたリンクを送る）
+func NewMagicLinkUsecase(
+	ap proxy.UserProxy,
+	tk proxy.MagicLinkTokenizer,
+	rs proxy.ReplayStore,
+	mailer proxy.Mailer,
+	as proxy.AuditSink,
+	callbackURL string,
+	ttl time.Duration,
+) MagicLinkUsecase {
+	return &magicLinkUsecase{ap, tk, rs, mailer, as, callbackURL, ttl}
+}
+
+// StartMagicLink リンクをメールで送ります（存在しないアカウントでも成功として扱う）
+func (mu *magicLinkUsecase) StartMagicLink(ctx context.Context, req *viewmodel.MagicLinkStartReq) error {
+	_, err := mu.ap.GetProfile(ctx, req.Email)
+	writeAudit(ctx, mu.as, model.AuditActionMagicLinkStart, req.Email, err)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, err := mu.tk.Mint(req.Email, mu.ttl)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(mu.callbackURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	m := &model.Mail{
+		To:      req.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Open this link to sign in:\n%s\n\nThe link can be used once and expires in %s.\n"+
+			"If you did not try to sign in, you can ignore this email.\n", u, mu.ttl),
+	}
+	// アカウントの有無で応答時間が変わらないよう、非同期に送る
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := mu.mailer.Send(ctx, m); err != nil {
+			log.Default().Printf("%+v", err)
+		}
+	}()
+	return nil
+}
+
+// CompleteMagicLink リンクのトークンを検証し、使用済みにした上でログインします
+func (mu *magicLinkUsecase) CompleteMagicLink(ctx context.Context, req *viewmodel.MagicLinkCallbackReq) (*viewmodel.SigninResp, error) {
+	token, email, err := mu.complete(ctx, req.Token)
+	writeAudit(ctx, mu.as, model.AuditActionMagicLinkCallback, email, err)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(viewmodel.SigninResp)
+	resp.Token = *token
+	return resp, nil
+}
+
+func (mu *magicLinkUsecase) complete(ctx context.Context, t string) (*model.Token, string, error) {
+	claims, err := mu.tk.Parse(t)
+	if err != nil {
+		return nil, "", err
+	}
+	first, err := mu.rs.Consume(ctx, claims.ID, time.Until(claims.ExpiresAt))
+	if err != nil {
+		return nil, claims.Email, err
+	}
+	if !first {
+		return nil, claims.Email, errors.Wrap(model.ErrInvalidMagicLink, "already used")
+	}
+	metadata := map[string]string{model.CustomAuthMethodKey: model.CustomAuthMethodMagicLink}
+	ch, err := mu.ap.InitiateCustomAuth(ctx, &model.CustomAuthReq{Email: claims.Email, Metadata: metadata})
+	if err != nil {
+		return nil, claims.Email, err
+	}
+	token, err := mu.ap.RespondToCustomChallenge(ctx, &model.CustomChallengeAnswerReq{
+		Email:    claims.Email,
+		Session:  ch.Session,
+		Answer:   t,
+		Metadata: metadata,
+	})
+	return token, claims.Email, err
+}
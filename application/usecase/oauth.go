@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// OAuthUsecase ホストされたUI（ソーシャルログイン、SAML）による認可コードフローを抽象化します
+type OAuthUsecase interface {
+	Login(ctx context.Context, req *viewmodel.OAuthLoginReq) (*viewmodel.OAuthLoginResp, error)
+	Callback(ctx context.Context, req *viewmodel.OAuthCallbackReq) (*viewmodel.SigninResp, error)
+}
+
+// stateとPKCEのcode_verifierを保持して認可コードをトークンに交換します
+type oauthUsecase struct {
+	op proxy.OAuthProxy
+	ss proxy.OAuthStateStore
+	as proxy.AuditSink
+	// providers 指定を許可するidentity_provider（空の場合は制限しない）
+	providers []string
+	stateTTL  time.Duration
+}
+
+// NewOAuthUsecase OAuthUsecaseを生成します
+func NewOAuthUsecase(
+	op proxy.OAuthProxy,
+	ss proxy.OAuthStateStore,
+	as proxy.AuditSink,
+	providers []string,
+	stateTTL time.Duration,
+) OAuthUsecase {
+	return &oauthUsecase{op, ss, as, providers, stateTTL}
+}
+
+// Login stateとcode_verifierを生成して保存し、認可エンドポイントのURLを返します
+func (ou *oauthUsecase) Login(ctx context.Context, req *viewmodel.OAuthLoginReq) (*viewmodel.OAuthLoginResp, error) {
+	resp, err := ou.login(ctx, req)
+	writeAudit(ctx, ou.as, model.AuditActionOAuthLogin, req.IdentityProvider, err)
+	return resp, err
+}
+
+func (ou *oauthUsecase) login(ctx context.Context, req *viewmodel.OAuthLoginReq) (*viewmodel.OAuthLoginResp, error) {
+	if req.IdentityProvider != "" && len(ou.providers) > 0 && !contains(ou.providers, req.IdentityProvider) {
+		return nil, errors.WithStack(&model.OAuthError{
+			Code:        "invalid_request",
+			Description: fmt.Sprintf("identity provider %q is not allowed", req.IdentityProvider),
+		})
+	}
+	state, err := randomURLSafe(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomURLSafe(32)
+	if err != nil {
+		return nil, err
+	}
+	err = ou.ss.Save(ctx, state, &model.OAuthState{
+		CodeVerifier:     verifier,
+		IdentityProvider: req.IdentityProvider,
+	}, ou.stateTTL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	return &viewmodel.OAuthLoginResp{
+		URL:      ou.op.AuthorizeURL(state, challenge, req.IdentityProvider),
+		State:    state,
+		StateTTL: ou.stateTTL,
+	}, nil
+}
+
+// Callback stateを検証し、認可コードをトークンに交換します
+func (ou *oauthUsecase) Callback(ctx context.Context, req *viewmodel.OAuthCallbackReq) (*viewmodel.SigninResp, error) {
+	token, provider, err := ou.callback(ctx, req)
+	writeAudit(ctx, ou.as, model.AuditActionOAuthCallback, provider, err)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(viewmodel.SigninResp)
+	resp.Token = *token
+	return resp, nil
+}
+
+func (ou *oauthUsecase) callback(ctx context.Context, req *viewmodel.OAuthCallbackReq) (*model.Token, string, error) {
+	// stateは認可サーバがエラーを返した場合も使用済みにする
+	s, err := ou.ss.Take(ctx, req.State)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.Error != "" {
+		return nil, s.IdentityProvider, errors.WithStack(&model.OAuthError{Code: req.Error, Description: req.ErrorDescription})
+	}
+	if req.Code == "" {
+		return nil, s.IdentityProvider, errors.WithStack(&model.OAuthError{Code: "invalid_request", Description: "missing code"})
+	}
+	token, err := ou.op.ExchangeCode(ctx, req.Code, s.CodeVerifier)
+	return token, s.IdentityProvider, err
+}
+
+func randomURLSafe(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/aws"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/memory"
+)
+
+const oauthRedirectURI = "https://app.example.com/oauth/callback"
+
+// fakeHostedUI 認可エンドポイントとトークンエンドポイントを模した認可サーバ
+type fakeHostedUI struct {
+	*httptest.Server
+	mu sync.Mutex
+	// challenges 発行した認可コードとcode_challenge
+	challenges map[string]string
+	// tokenStatus 0以外の場合、トークンエンドポイントはこのステータスでinvalid_grantを返す
+	tokenStatus int
+}
+
+func newFakeHostedUI(t *testing.T) *fakeHostedUI {
+	t.Helper()
+	f := &fakeHostedUI{challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/authorize", f.authorize)
+	mux.HandleFunc("/oauth2/token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorize ログイン済みとして、認可コードを付けてredirect_uriにリダイレクトします
+func (f *fakeHostedUI) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE required", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	code := fmt.Sprintf("code-%d", len(f.challenges)+1)
+	f.challenges[code] = q.Get("code_challenge")
+	f.mu.Unlock()
+	v := url.Values{"code": {code}, "state": {q.Get("state")}}
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+v.Encode(), http.StatusFound)
+}
+
+// token 認可コードを一度だけ、code_verifierが一致する場合にトークンに交換します
+func (f *fakeHostedUI) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	challenge, ok := f.challenges[r.PostForm.Get("code")]
+	delete(f.challenges, r.PostForm.Get("code"))
+	f.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	status := http.StatusOK
+	switch {
+	case f.tokenStatus != 0:
+		status = f.tokenStatus
+	case !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge:
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"id_token": "id-token", "refresh_token": "refresh-token", "expires_in": 3600})
+}
+
+// follow ブラウザとして認可エンドポイントのURLを開き、コールバックのクエリを返します
+func (f *fakeHostedUI) follow(t *testing.T, authorizeURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(authorizeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status = %d", res.StatusCode)
+	}
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query()
+}
+
+func newTestOAuthUsecase(t *testing.T, f *fakeHostedUI, as *auditRecorder) OAuthUsecase {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	op := aws.NewHostedUIProxy(f.URL, "client-1", "", oauthRedirectURI, []string{"openid"})
+	return NewOAuthUsecase(op, memory.NewOAuthStateStore(ctx), as, []string{"Google", "Okta"}, 5*time.Minute)
+}
+
+func TestOAuthLoginAndCallback(t *testing.T) {
+	f := newFakeHostedUI(t)
+	as := new(auditRecorder)
+	ou := newTestOAuthUsecase(t, f, as)
+	ctx := context.Background()
+
+	login, err := ou.Login(ctx, &viewmodel.OAuthLoginReq{IdentityProvider: "Google"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if login.StateTTL != 5*time.Minute {
+		t.Errorf("StateTTL = %v", login.StateTTL)
+	}
+	cb := f.follow(t, login.URL)
+	if cb.Get("state") != login.State {
+		t.Fatalf("state = %q, want %q", cb.Get("state"), login.State)
+	}
+	resp, err := ou.Callback(ctx, &viewmodel.OAuthCallbackReq{Code: cb.Get("code"), State: cb.Get("state")})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if resp.IDToken != "id-token" || resp.RefreshToken == nil || *resp.RefreshToken != "refresh-token" {
+		t.Errorf("token = %+v", resp.Token)
+	}
+	if len(as.events) != 2 {
+		t.Fatalf("audit events = %d, want 2", len(as.events))
+	}
+	for i, action := range []string{model.AuditActionOAuthLogin, model.AuditActionOAuthCallback} {
+		if ev := as.events[i]; ev.Action != action || ev.Target != "Google" || ev.Outcome != model.AuditOutcomeSuccess {
+			t.Errorf("audit event %d = %+v, want a successful %s for Google", i, ev, action)
+		}
+	}
+
+	// stateは一度しか使えない
+	_, err = ou.Callback(ctx, &viewmodel.OAuthCallbackReq{Code: cb.Get("code"), State: cb.Get("state")})
+	if !errors.Is(err, model.ErrInvalidOAuthState) {
+		t.Errorf("reused state: err = %v, want %v", err, model.ErrInvalidOAuthState)
+	}
+}
+
+// stateはログインごとに異なり、code_verifierはstateに紐づく
+func TestOAuthCallbackStateMismatch(t *testing.T) {
+	f := newFakeHostedUI(t)
+	ou := newTestOAuthUsecase(t, f, new(auditRecorder))
+	ctx := context.Background()
+
+	first, err := ou.Login(ctx, new(viewmodel.OAuthLoginReq))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	second, err := ou.Login(ctx, new(viewmodel.OAuthLoginReq))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if first.State == second.State {
+		t.Fatal("two logins share a state")
+	}
+	cb := f.follow(t, first.URL)
+
+	// 別のログインのstateでは、認可コードとcode_verifierが対応しない
+	_, err = ou.Callback(ctx, &viewmodel.OAuthCallbackReq{Code: cb.Get("code"), State: second.State})
+	var oerr *model.OAuthError
+	if !errors.As(err, &oerr) || oerr.Code != "invalid_grant" {
+		t.Errorf("swapped state: err = %v, want invalid_grant", err)
+	}
+
+	_, err = ou.Callback(ctx, &viewmodel.OAuthCallbackReq{Code: cb.Get("code"), State: "forged"})
+	if !errors.Is(err, model.ErrInvalidOAuthState) {
+		t.Errorf("unknown state: err = %v, want %v", err, model.ErrInvalidOAuthState)
+	}
+}
+
+func TestOAuthCallbackErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokenStatus int
+		// idpError コールバックに付く認可サーバのエラー
+		idpError string
+		// sendCode コールバックの認可コードを送るか
+		sendCode bool
+		wantCode string
+	}{
+		{"authorization server error", 0, "access_denied", false, "access_denied"},
+		{"missing code", 0, "", false, "invalid_request"},
+		{"token endpoint rejects the code", http.StatusBadRequest, "", true, "invalid_grant"},
+		{"token endpoint unauthorized", http.StatusUnauthorized, "", true, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeHostedUI(t)
+			f.tokenStatus = tt.tokenStatus
+			as := new(auditRecorder)
+			ou := newTestOAuthUsecase(t, f, as)
+			ctx := context.Background()
+
+			login, err := ou.Login(ctx, &viewmodel.OAuthLoginReq{IdentityProvider: "Okta"})
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			cb := f.follow(t, login.URL)
+			req := viewmodel.OAuthCallbackReq{State: cb.Get("state"), Error: tt.idpError}
+			if tt.sendCode {
+				req.Code = cb.Get("code")
+			}
+			_, err = ou.Callback(ctx, &req)
+			var oerr *model.OAuthError
+			if !errors.As(err, &oerr) || oerr.Code != tt.wantCode {
+				t.Fatalf("err = %v, want %s", err, tt.wantCode)
+			}
+			if ev := as.events[len(as.events)-1]; ev.Action != model.AuditActionOAuthCallback || ev.Target != "Okta" || ev.Outcome != model.AuditOutcomeFailure {
+				t.Errorf("audit event = %+v, want a failed callback for Okta", ev)
+			}
+
+			// 失敗したコールバックでもstateは使用済みになる
+			_, err = ou.Callback(ctx, &viewmodel.OAuthCallbackReq{Code: cb.Get("code"), State: req.State})
+			if !errors.Is(err, model.ErrInvalidOAuthState) {
+				t.Errorf("retry: err = %v, want %v", err, model.ErrInvalidOAuthState)
+			}
+		})
+	}
+}
+
+func TestOAuthLoginDisallowedProvider(t *testing.T) {
+	as := new(auditRecorder)
+	ou := newTestOAuthUsecase(t, newFakeHostedUI(t), as)
+	_, err := ou.Login(context.Background(), &viewmodel.OAuthLoginReq{IdentityProvider: "Facebook"})
+	var oerr *model.OAuthError
+	if !errors.As(err, &oerr) || oerr.Code != "invalid_request" {
+		t.Errorf("err = %v, want invalid_request", err)
+	}
+	if len(as.events) != 1 || as.events[0].Outcome != model.AuditOutcomeFailure || as.events[0].Target != "Facebook" {
+		t.Errorf("audit events = %+v, want one failure for Facebook", as.events)
+	}
+}
@@ -0,0 +1,729 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 一覧の件数
+const (
+	scimDefaultCount = 100
+	scimMaxResults   = 200
+)
+
+// SCIMUsecase SCIM 2.0（RFC 7643、7644）によるユーザ、グループのプロビジョニングを抽象化します
+//
+// フィルタ、PATCH、attributesは属性名で扱うため、リソースはJSONと同じ形のmapで返します。
+type SCIMUsecase interface {
+	ListUsers(ctx context.Context, q *viewmodel.SCIMQuery) (*viewmodel.SCIMListResponse, error)
+	GetUser(ctx context.Context, id string, q *viewmodel.SCIMQuery) (map[string]interface{}, error)
+	CreateUser(ctx context.Context, req *viewmodel.SCIMUser) (map[string]interface{}, error)
+	ReplaceUser(ctx context.Context, id string, req *viewmodel.SCIMUser) (map[string]interface{}, error)
+	PatchUser(ctx context.Context, id string, req *viewmodel.SCIMPatchOp) (map[string]interface{}, error)
+	DeleteUser(ctx context.Context, id string) error
+	ListGroups(ctx context.Context, q *viewmodel.SCIMQuery) (*viewmodel.SCIMListResponse, error)
+	GetGroup(ctx context.Context, id string, q *viewmodel.SCIMQuery) (map[string]interface{}, error)
+	CreateGroup(ctx context.Context, req *viewmodel.SCIMGroup) (map[string]interface{}, error)
+	ReplaceGroup(ctx context.Context, id string, req *viewmodel.SCIMGroup) (map[string]interface{}, error)
+	PatchGroup(ctx context.Context, id string, req *viewmodel.SCIMPatchOp) (map[string]interface{}, error)
+	DeleteGroup(ctx context.Context, id string) error
+	ServiceProviderConfig() map[string]interface{}
+	ListSchemas() *viewmodel.SCIMListResponse
+	GetSchema(id string) (map[string]interface{}, error)
+	ListResourceTypes() *viewmodel.SCIMListResponse
+	GetResourceType(id string) (map[string]interface{}, error)
+}
+
+// ユーザはsubをid、メールアドレスをuserNameとし、グループはグループ名をidとします
+type scimUsecase struct {
+	ap proxy.UserAdminProxy
+	as proxy.AuditSink
+	rs proxy.RevocationStore
+	// ep Webhookを使わない場合はnil
+	ep proxy.EventPublisher
+	// tokenTTL IDトークンの最大有効期間（無効化、削除したユーザの失効の記録はこの期間保持する）
+	tokenTTL time.Duration
+	// baseURL meta.locationの基点（例: https://auth.example.com/scim/v2）
+	baseURL string
+	// sendInvitation 作成したユーザに仮パスワードをメールで送る
+	sendInvitation bool
+}
+
+// NewSCIMUsecase SCIMUsecaseを生成します（Webhookを使わない場合epはnil）
+func NewSCIMUsecase(
+	ap proxy.UserAdminProxy,
+	as proxy.AuditSink,
+	rs proxy.RevocationStore,
+	ep proxy.EventPublisher,
+	tokenTTL time.Duration,
+	baseURL string,
+	sendInvitation bool,
+) SCIMUsecase {
+	return &scimUsecase{ap, as, rs, ep, tokenTTL, strings.TrimSuffix(baseURL, "/"), sendInvitation}
+}
+
+// ListUsers フィルタに一致するユーザを返します
+//
+// "userName eq"、"id eq"はバックエンドで直接検索し、それ以外は全てのユーザを読み込んで絞り込みます（グループは含まない）。
+func (su *scimUsecase) ListUsers(ctx context.Context, q *viewmodel.SCIMQuery) (*viewmodel.SCIMListResponse, error) {
+	f, err := parseSCIMFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var users []*model.UserRecord
+	if email, ok := scimEqualityOf(f, "username"); ok {
+		u, err := su.ap.DescribeUser(ctx, email)
+		if err != nil && !errors.Is(err, model.ErrUserNotFound) {
+			return nil, err
+		}
+		if u != nil {
+			users = append(users, u)
+		}
+	} else if id, ok := scimEqualityOf(f, "id"); ok {
+		u, err := su.findUser(ctx, id)
+		if err != nil && !errors.Is(err, model.ErrUserNotFound) {
+			return nil, err
+		}
+		if u != nil {
+			users = append(users, u)
+		}
+	} else {
+		for page := ""; ; {
+			var us []*model.UserRecord
+			if us, page, err = su.ap.ListUsers(ctx, page); err != nil {
+				return nil, err
+			}
+			users = append(users, us...)
+			if page == "" {
+				break
+			}
+		}
+	}
+	var matched []map[string]interface{}
+	for _, u := range users {
+		res, err := toSCIMMap(su.userResource(u))
+		if err != nil {
+			return nil, err
+		}
+		if f == nil || f.match(res) {
+			matched = append(matched, res)
+		}
+	}
+	return scimPage(matched, q)
+}
+
+// GetUser subでユーザを返します
+func (su *scimUsecase) GetUser(ctx context.Context, id string, q *viewmodel.SCIMQuery) (map[string]interface{}, error) {
+	u, err := su.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := toSCIMMap(su.userResource(u))
+	if err != nil {
+		return nil, err
+	}
+	return projectSCIM(res, q), nil
+}
+
+// CreateUser userNameのメールアドレスでユーザを作成します（passwordは仮パスワードとする）
+func (su *scimUsecase) CreateUser(ctx context.Context, req *viewmodel.SCIMUser) (map[string]interface{}, error) {
+	email := strings.TrimSpace(req.UserName)
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidValue, Detail: "userName must be an email address"})
+	}
+	if err := checkSCIMEmails(req, email); err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{"email_verified": "true"}
+	if name := scimNameOf(req, ""); name != "" {
+		attrs["name"] = name
+	}
+	err := su.ap.ImportUser(ctx, &model.ImportUserReq{
+		Email:             email,
+		Attributes:        attrs,
+		TemporaryPassword: req.Password,
+		SendInvitation:    su.sendInvitation,
+	})
+	su.audit(ctx, model.AuditActionCreateUser, email, err)
+	if err != nil {
+		return nil, err
+	}
+	u, err := su.ap.DescribeUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	su.publish(ctx, model.EventUserCreated, map[string]string{"sub": u.Attributes["sub"], "email": email, "name": attrs["name"]})
+	if req.Active != nil && !bool(*req.Active) {
+		if err := su.disable(ctx, u.Attributes["sub"]); err != nil {
+			return nil, err
+		}
+		u.Enabled = false
+	}
+	return toSCIMMap(su.userResource(u))
+}
+
+// ReplaceUser 名前、activeを変更します（含まれない属性は変更しない、userNameは変更できない）
+func (su *scimUsecase) ReplaceUser(ctx context.Context, id string, req *viewmodel.SCIMUser) (map[string]interface{}, error) {
+	u, err := su.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := su.updateUser(ctx, u, req); err != nil {
+		return nil, err
+	}
+	return su.userMap(ctx, u)
+}
+
+// PatchUser 現在のユーザに操作を適用し、ReplaceUserと同様に差分を反映します
+func (su *scimUsecase) PatchUser(ctx context.Context, id string, req *viewmodel.SCIMPatchOp) (map[string]interface{}, error) {
+	u, err := su.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := toSCIMMap(su.userResource(u))
+	if err != nil {
+		return nil, err
+	}
+	if err := applySCIMPatch(res, req); err != nil {
+		return nil, err
+	}
+	want := new(viewmodel.SCIMUser)
+	if err := fromSCIMMap(res, want); err != nil {
+		return nil, err
+	}
+	if err := su.updateUser(ctx, u, want); err != nil {
+		return nil, err
+	}
+	return su.userMap(ctx, u)
+}
+
+// DeleteUser ユーザを削除し、発行済みのIDトークンを失効させます
+func (su *scimUsecase) DeleteUser(ctx context.Context, id string) error {
+	u, err := su.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = su.ap.DeleteUser(ctx, scimUserName(u))
+	if err == nil {
+		err = su.rs.RevokeSubject(ctx, id, time.Now().Truncate(time.Second), su.tokenTTL)
+	}
+	su.audit(ctx, model.AuditActionDeleteUser, id, err)
+	if err != nil {
+		return err
+	}
+	su.publish(ctx, model.EventUserDeleted, map[string]string{"sub": id, "email": scimUserName(u)})
+	return nil
+}
+
+// ListGroups フィルタに一致するグループを返します
+//
+// "displayName eq"、"id eq"はバックエンドで直接検索し、それ以外は全てのグループを読み込んで絞り込みます。
+// メンバーはexcludedAttributes=membersの場合は取得しません。
+func (su *scimUsecase) ListGroups(ctx context.Context, q *viewmodel.SCIMQuery) (*viewmodel.SCIMListResponse, error) {
+	f, err := parseSCIMFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*model.GroupRecord
+	// described メンバーを取得済み
+	described := true
+	name, ok := scimEqualityOf(f, "displayname")
+	if !ok {
+		name, ok = scimEqualityOf(f, "id")
+	}
+	if ok {
+		g, err := su.ap.DescribeGroup(ctx, name)
+		if err != nil && !errors.Is(err, model.ErrGroupNotFound) {
+			return nil, err
+		}
+		if g != nil {
+			groups = append(groups, g)
+		}
+	} else {
+		for page := ""; ; {
+			var gs []*model.GroupRecord
+			if gs, page, err = su.ap.ListGroups(ctx, page); err != nil {
+				return nil, err
+			}
+			groups = append(groups, gs...)
+			if page == "" {
+				break
+			}
+		}
+		described = false
+		if f != nil && f.mentions("members") {
+			if err := su.describeGroups(ctx, groups); err != nil {
+				return nil, err
+			}
+			described = true
+		}
+	}
+	var matched []*model.GroupRecord
+	for _, g := range groups {
+		res, err := toSCIMMap(su.groupResource(g))
+		if err != nil {
+			return nil, err
+		}
+		if f == nil || f.match(res) {
+			matched = append(matched, g)
+		}
+	}
+	total := len(matched)
+	start, end := scimRange(total, q)
+	matched = matched[start:end]
+	if !described && !scimExcluded(q, "members") {
+		if err := su.describeGroups(ctx, matched); err != nil {
+			return nil, err
+		}
+	}
+	resources := make([]map[string]interface{}, 0, len(matched))
+	for _, g := range matched {
+		res, err := toSCIMMap(su.groupResource(g))
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, projectSCIM(res, q))
+	}
+	return &viewmodel.SCIMListResponse{
+		Schemas:      []string{viewmodel.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   start + 1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+// GetGroup メンバーを含めてグループを返します
+func (su *scimUsecase) GetGroup(ctx context.Context, id string, q *viewmodel.SCIMQuery) (map[string]interface{}, error) {
+	g, err := su.ap.DescribeGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := toSCIMMap(su.groupResource(g))
+	if err != nil {
+		return nil, err
+	}
+	return projectSCIM(res, q), nil
+}
+
+// CreateGroup displayNameを名前としてグループを作成し、メンバーを追加します
+func (su *scimUsecase) CreateGroup(ctx context.Context, req *viewmodel.SCIMGroup) (map[string]interface{}, error) {
+	name := strings.TrimSpace(req.DisplayName)
+	if name == "" {
+		return nil, errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidValue, Detail: "displayName is required"})
+	}
+	// 存在しないメンバーを指定された場合は作成しない
+	emails, err := su.memberEmails(ctx, req.Members)
+	if err != nil {
+		return nil, err
+	}
+	err = su.ap.CreateGroup(ctx, name)
+	su.audit(ctx, model.AuditActionCreateGroup, name, err)
+	if err != nil {
+		return nil, err
+	}
+	for sub, email := range emails {
+		if err := su.addMember(ctx, name, sub, email); err != nil {
+			return nil, err
+		}
+	}
+	return su.groupMap(ctx, name)
+}
+
+// ReplaceGroup メンバーを置き換えます（グループ名は変更できない）
+func (su *scimUsecase) ReplaceGroup(ctx context.Context, id string, req *viewmodel.SCIMGroup) (map[string]interface{}, error) {
+	g, err := su.ap.DescribeGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := su.updateGroup(ctx, g, req); err != nil {
+		return nil, err
+	}
+	return su.groupMap(ctx, g.Name)
+}
+
+// PatchGroup 現在のグループに操作を適用し、ReplaceGroupと同様に差分を反映します
+func (su *scimUsecase) PatchGroup(ctx context.Context, id string, req *viewmodel.SCIMPatchOp) (map[string]interface{}, error) {
+	g, err := su.ap.DescribeGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := toSCIMMap(su.groupResource(g))
+	if err != nil {
+		return nil, err
+	}
+	if err := applySCIMPatch(res, req); err != nil {
+		return nil, err
+	}
+	want := new(viewmodel.SCIMGroup)
+	if err := fromSCIMMap(res, want); err != nil {
+		return nil, err
+	}
+	if err := su.updateGroup(ctx, g, want); err != nil {
+		return nil, err
+	}
+	return su.groupMap(ctx, g.Name)
+}
+
+// DeleteGroup グループを削除します（メンバーのユーザは削除しない）
+func (su *scimUsecase) DeleteGroup(ctx context.Context, id string) error {
+	err := su.ap.DeleteGroup(ctx, id)
+	su.audit(ctx, model.AuditActionDeleteGroup, id, err)
+	return err
+}
+
+// findUser subでユーザを検索し、グループを含めて返します
+func (su *scimUsecase) findUser(ctx context.Context, id string) (*model.UserRecord, error) {
+	// Cognitoではsubを検索条件に埋め込むため、引用符などを含むidは検索しない
+	if id == "" || strings.ContainsAny(id, "\"\\") {
+		return nil, errors.WithStack(model.ErrUserNotFound)
+	}
+	u, err := su.ap.GetUser(ctx, &model.GetUserReq{Sub: id})
+	if err != nil {
+		return nil, err
+	}
+	return su.ap.DescribeUser(ctx, u.Email)
+}
+
+func (su *scimUsecase) userMap(ctx context.Context, u *model.UserRecord) (map[string]interface{}, error) {
+	u, err := su.ap.DescribeUser(ctx, scimUserName(u))
+	if err != nil {
+		return nil, err
+	}
+	return toSCIMMap(su.userResource(u))
+}
+
+// updateUser wantとの差分（名前、active）をバックエンドに反映します
+func (su *scimUsecase) updateUser(ctx context.Context, u *model.UserRecord, want *viewmodel.SCIMUser) error {
+	email := scimUserName(u)
+	if want.UserName != "" && !strings.EqualFold(strings.TrimSpace(want.UserName), email) {
+		return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMMutability, Detail: "userName cannot be changed"})
+	}
+	if err := checkSCIMEmails(want, email); err != nil {
+		return err
+	}
+	if want.Password != "" {
+		return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMMutability, Detail: "password can only be set when the user is created"})
+	}
+	if name := scimNameOf(want, u.Attributes["name"]); name != u.Attributes["name"] {
+		err := su.ap.ChangeProfile(ctx, email, &model.ChangeProfileReq{Name: name})
+		su.audit(ctx, model.AuditActionChangeProfile, email, err)
+		if err != nil {
+			return err
+		}
+		su.publish(ctx, model.EventUserProfileChanged, map[string]string{"email": email, "name": name})
+	}
+	if want.Active == nil || bool(*want.Active) == u.Enabled {
+		return nil
+	}
+	if *want.Active {
+		err := su.ap.EnableUser(ctx, email)
+		su.audit(ctx, model.AuditActionEnableUser, email, err)
+		if err != nil {
+			return err
+		}
+		su.publish(ctx, model.EventUserEnabled, map[string]string{"sub": u.Attributes["sub"], "email": email})
+		return nil
+	}
+	return su.disable(ctx, u.Attributes["sub"])
+}
+
+// disable ユーザを無効化し、発行済みのIDトークンを失効させます
+func (su *scimUsecase) disable(ctx context.Context, sub string) error {
+	err := su.ap.DisableUser(ctx, &model.DisableUserReq{Sub: sub})
+	if err == nil {
+		err = su.rs.RevokeSubject(ctx, sub, time.Now().Truncate(time.Second), su.tokenTTL)
+	}
+	su.audit(ctx, model.AuditActionDisableUser, sub, err)
+	if err != nil {
+		return err
+	}
+	su.publish(ctx, model.EventUserDisabled, map[string]string{"sub": sub})
+	return nil
+}
+
+func (su *scimUsecase) groupMap(ctx context.Context, name string) (map[string]interface{}, error) {
+	g, err := su.ap.DescribeGroup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return toSCIMMap(su.groupResource(g))
+}
+
+func (su *scimUsecase) describeGroups(ctx context.Context, groups []*model.GroupRecord) error {
+	for i, g := range groups {
+		d, err := su.ap.DescribeGroup(ctx, g.Name)
+		if err != nil {
+			return err
+		}
+		groups[i] = d
+	}
+	return nil
+}
+
+// updateGroup wantとの差分（メンバー）をバックエンドに反映します
+func (su *scimUsecase) updateGroup(ctx context.Context, g *model.GroupRecord, want *viewmodel.SCIMGroup) error {
+	if want.DisplayName != "" && want.DisplayName != g.Name {
+		return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMMutability, Detail: "displayName cannot be changed"})
+	}
+	current := make(map[string]string, len(g.Members))
+	for _, m := range g.Members {
+		current[m.Sub] = m.Username
+	}
+	var added []viewmodel.SCIMMultiValue
+	wanted := make(map[string]bool, len(want.Members))
+	for _, m := range want.Members {
+		wanted[m.Value] = true
+		if _, ok := current[m.Value]; !ok {
+			added = append(added, m)
+		}
+	}
+	emails, err := su.memberEmails(ctx, added)
+	if err != nil {
+		return err
+	}
+	for sub, email := range emails {
+		if err := su.addMember(ctx, g.Name, sub, email); err != nil {
+			return err
+		}
+	}
+	for sub, email := range current {
+		if wanted[sub] {
+			continue
+		}
+		err := su.ap.RemoveUserFromGroup(ctx, email, g.Name)
+		su.audit(ctx, model.AuditActionRemoveGroupMember, g.Name+"/"+sub, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberEmails メンバーのsubからメールアドレスを引きます（存在しないユーザはinvalidValue）
+func (su *scimUsecase) memberEmails(ctx context.Context, members []viewmodel.SCIMMultiValue) (map[string]string, error) {
+	emails := make(map[string]string, len(members))
+	for _, m := range members {
+		u, err := su.findUser(ctx, m.Value)
+		if errors.Is(err, model.ErrUserNotFound) {
+			return nil, errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidValue, Detail: "member " + m.Value + " not found"})
+		}
+		if err != nil {
+			return nil, err
+		}
+		emails[m.Value] = scimUserName(u)
+	}
+	return emails, nil
+}
+
+func (su *scimUsecase) addMember(ctx context.Context, group, sub, email string) error {
+	err := su.ap.AddUserToGroup(ctx, email, group)
+	su.audit(ctx, model.AuditActionAddGroupMember, group+"/"+sub, err)
+	return err
+}
+
+func (su *scimUsecase) userResource(u *model.UserRecord) *viewmodel.SCIMUser {
+	sub := u.Attributes["sub"]
+	email := scimUserName(u)
+	active := viewmodel.SCIMBool(u.Enabled)
+	r := &viewmodel.SCIMUser{
+		Schemas:  []string{viewmodel.SCIMSchemaUser},
+		ID:       sub,
+		UserName: email,
+		Emails:   []viewmodel.SCIMMultiValue{{Value: email, Type: "work", Primary: true}},
+		Active:   &active,
+		Meta:     su.meta("User", "/Users/"+url.PathEscape(sub), u.CreatedAt, u.UpdatedAt),
+	}
+	name, given, family := u.Attributes["name"], u.Attributes["given_name"], u.Attributes["family_name"]
+	if name != "" || given != "" || family != "" {
+		r.Name = &viewmodel.SCIMName{Formatted: name, GivenName: given, FamilyName: family}
+		r.DisplayName = name
+	}
+	for _, g := range u.Groups {
+		r.Groups = append(r.Groups, viewmodel.SCIMMultiValue{Value: g, Display: g, Ref: su.baseURL + "/Groups/" + url.PathEscape(g)})
+	}
+	return r
+}
+
+func (su *scimUsecase) groupResource(g *model.GroupRecord) *viewmodel.SCIMGroup {
+	r := &viewmodel.SCIMGroup{
+		Schemas:     []string{viewmodel.SCIMSchemaGroup},
+		ID:          g.Name,
+		DisplayName: g.Name,
+		Meta:        su.meta("Group", "/Groups/"+url.PathEscape(g.Name), g.CreatedAt, g.UpdatedAt),
+	}
+	for _, m := range g.Members {
+		r.Members = append(r.Members, viewmodel.SCIMMultiValue{Value: m.Sub, Display: m.Username, Ref: su.baseURL + "/Users/" + url.PathEscape(m.Sub)})
+	}
+	return r
+}
+
+func (su *scimUsecase) meta(resourceType, path string, created, updated time.Time) *viewmodel.SCIMMeta {
+	m := &viewmodel.SCIMMeta{ResourceType: resourceType, Location: su.baseURL + path}
+	if !created.IsZero() {
+		m.Created = created.UTC().Format(time.RFC3339)
+	}
+	if !updated.IsZero() {
+		m.LastModified = updated.UTC().Format(time.RFC3339)
+	}
+	return m
+}
+
+func (su *scimUsecase) audit(ctx context.Context, action, target string, err error) {
+	writeAudit(ctx, su.as, action, target, err)
+}
+
+func (su *scimUsecase) publish(ctx context.Context, eventType string, data map[string]string) {
+	publishEvent(ctx, su.ep, eventType, data)
+}
+
+// scimUserName メールアドレスをuserNameとします（メールアドレスをユーザ名とするCognitoのプールではUsernameはsubになる）
+func scimUserName(u *model.UserRecord) string {
+	if email := u.Attributes["email"]; email != "" {
+		return email
+	}
+	return u.Username
+}
+
+// scimNameOf リクエストの名前のうち現在の名前と異なるものを返します（givenName familyName、formatted、displayNameの順）
+//
+// PATCHではどの属性が変更されたか分からないため、変更されたものを優先します。
+func scimNameOf(r *viewmodel.SCIMUser, current string) string {
+	var candidates []string
+	if r.Name != nil {
+		candidates = append(candidates, strings.TrimSpace(r.Name.GivenName+" "+r.Name.FamilyName), r.Name.Formatted)
+	}
+	candidates = append(candidates, r.DisplayName)
+	for _, c := range candidates {
+		if c = strings.TrimSpace(c); c != "" && c != current {
+			return c
+		}
+	}
+	return current
+}
+
+// checkSCIMEmails プライマリ（1件のみの場合はその）メールアドレスがuserNameと一致するか検証します
+func checkSCIMEmails(r *viewmodel.SCIMUser, email string) error {
+	for _, e := range r.Emails {
+		if (e.Primary || len(r.Emails) == 1) && !strings.EqualFold(strings.TrimSpace(e.Value), email) {
+			return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMMutability, Detail: "the primary email must be the same as userName"})
+		}
+	}
+	return nil
+}
+
+func toSCIMMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m, nil
+}
+
+// fromSCIMMap PATCHを適用したリソースを読み込みます（型が合わない場合はinvalidValue）
+func fromSCIMMap(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidValue, Detail: err.Error()})
+	}
+	return nil
+}
+
+// scimRange startIndex（1始まり）、countから返す範囲を求めます
+func scimRange(total int, q *viewmodel.SCIMQuery) (start, end int) {
+	start = q.StartIndex - 1
+	if start < 0 {
+		start = 0
+	}
+	if start > total {
+		start = total
+	}
+	count := scimDefaultCount
+	if q.Count != nil {
+		count = *q.Count
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+	end = start + count
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+func scimPage(matched []map[string]interface{}, q *viewmodel.SCIMQuery) (*viewmodel.SCIMListResponse, error) {
+	start, end := scimRange(len(matched), q)
+	resources := make([]map[string]interface{}, 0, end-start)
+	for _, res := range matched[start:end] {
+		resources = append(resources, projectSCIM(res, q))
+	}
+	return &viewmodel.SCIMListResponse{
+		Schemas:      []string{viewmodel.SCIMSchemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   start + 1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+// projectSCIM attributes、excludedAttributesに従って属性を絞ります（schemas、idは常に返す）
+func projectSCIM(res map[string]interface{}, q *viewmodel.SCIMQuery) map[string]interface{} {
+	if q == nil {
+		return res
+	}
+	if attrs := scimAttrNames(q.Attributes); len(attrs) > 0 {
+		out := make(map[string]interface{}, len(attrs)+2)
+		for k, v := range res {
+			if k == "schemas" || k == "id" || attrs[strings.ToLower(k)] {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	for k := range res {
+		if k != "schemas" && k != "id" && scimExcluded(q, k) {
+			delete(res, k)
+		}
+	}
+	return res
+}
+
+func scimExcluded(q *viewmodel.SCIMQuery, attr string) bool {
+	return q != nil && scimAttrNames(q.ExcludedAttributes)[strings.ToLower(attr)]
+}
+
+// scimAttrNames カンマ区切りの属性名の最上位の名前を小文字で返します（name.givenNameはname）
+func scimAttrNames(s string) map[string]bool {
+	names := map[string]bool{}
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		if p, err := parseSCIMAttrPath(a); err == nil {
+			names[p.attr] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,462 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// scimFilter SCIMのフィルタ式（RFC 7644 3.4.2.2）
+//
+// リソースをJSONと同じ形のmapとして評価します。属性名、文字列の比較は大文字小文字を区別しません（idを除く）。
+type scimFilter interface {
+	match(res map[string]interface{}) bool
+	// mentions 式がattr（小文字）を参照しているか
+	mentions(attr string) bool
+}
+
+type scimLogicalFilter struct {
+	and         bool
+	left, right scimFilter
+}
+
+func (f *scimLogicalFilter) match(res map[string]interface{}) bool {
+	if f.and {
+		return f.left.match(res) && f.right.match(res)
+	}
+	return f.left.match(res) || f.right.match(res)
+}
+
+func (f *scimLogicalFilter) mentions(attr string) bool {
+	return f.left.mentions(attr) || f.right.mentions(attr)
+}
+
+type scimNotFilter struct {
+	f scimFilter
+}
+
+func (f *scimNotFilter) match(res map[string]interface{}) bool { return !f.f.match(res) }
+
+func (f *scimNotFilter) mentions(attr string) bool { return f.f.mentions(attr) }
+
+// scimCompareFilter 属性と値を比較します（opは小文字、prの場合valueは使わない）
+type scimCompareFilter struct {
+	path  scimAttrPath
+	op    string
+	value interface{}
+}
+
+func (f *scimCompareFilter) match(res map[string]interface{}) bool {
+	values := f.path.values(res)
+	if f.op == "pr" {
+		return len(values) > 0
+	}
+	if f.op == "ne" {
+		return !(&scimCompareFilter{f.path, "eq", f.value}).match(res)
+	}
+	if f.value == nil {
+		// "eq null"は属性がないことを表す
+		return f.op == "eq" && len(values) == 0
+	}
+	for _, v := range values {
+		if compareSCIMValue(v, f.op, f.value, f.path.caseExact()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *scimCompareFilter) mentions(attr string) bool { return f.path.attr == attr }
+
+// scimValuePathFilter 複数値属性のいずれかの要素がフィルタに一致するか（emails[type eq "work"]）
+type scimValuePathFilter struct {
+	attr string
+	f    scimFilter
+}
+
+func (f *scimValuePathFilter) match(res map[string]interface{}) bool {
+	for _, e := range elementsOf(lookup(res, f.attr)) {
+		if m, ok := e.(map[string]interface{}); ok && f.f.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *scimValuePathFilter) mentions(attr string) bool { return f.attr == attr }
+
+// scimAttrPath 属性のパス（スキーマURIは除き、小文字にする）
+type scimAttrPath struct {
+	attr string
+	sub  string
+}
+
+// parseSCIMAttrPath "urn:...:User:name.givenName"のような属性のパスを解析します
+func parseSCIMAttrPath(s string) (scimAttrPath, error) {
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		i := strings.LastIndex(s, ":")
+		s = s[i+1:]
+	}
+	p := scimAttrPath{attr: strings.ToLower(s)}
+	if i := strings.Index(p.attr, "."); i >= 0 {
+		p.attr, p.sub = p.attr[:i], p.attr[i+1:]
+	}
+	if p.attr == "" || strings.Contains(p.sub, ".") {
+		return p, fmt.Errorf("invalid attribute path %q", s)
+	}
+	return p, nil
+}
+
+// values 属性の値を返します（複数値属性は要素を展開し、nullと空の値は含めない）
+//
+// 副属性を指定しない複合属性の要素はvalueで比較します（emails eq "..."）。
+func (p scimAttrPath) values(res map[string]interface{}) []interface{} {
+	var values []interface{}
+	for _, v := range elementsOf(lookup(res, p.attr)) {
+		if m, ok := v.(map[string]interface{}); ok {
+			sub := p.sub
+			if sub == "" {
+				sub = "value"
+			}
+			v = lookup(m, sub)
+		} else if p.sub != "" {
+			continue
+		}
+		if v == nil || v == "" {
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// caseExact idのみ大文字小文字を区別する
+func (p scimAttrPath) caseExact() bool {
+	return p.attr == "id" && p.sub == ""
+}
+
+// lookup 大文字小文字を区別せずにキーの値を返します
+func lookup(m map[string]interface{}, key string) interface{} {
+	if k, ok := findKey(m, key); ok {
+		return m[k]
+	}
+	return nil
+}
+
+func findKey(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// elementsOf 配列の場合は要素を、それ以外は値自体を要素とします
+func elementsOf(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+func compareSCIMValue(v interface{}, op string, want interface{}, caseExact bool) bool {
+	switch want := want.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		if !caseExact {
+			s, want = strings.ToLower(s), strings.ToLower(want)
+		}
+		switch op {
+		case "eq":
+			return s == want
+		case "co":
+			return strings.Contains(s, want)
+		case "sw":
+			return strings.HasPrefix(s, want)
+		case "ew":
+			return strings.HasSuffix(s, want)
+		case "gt":
+			return s > want
+		case "ge":
+			return s >= want
+		case "lt":
+			return s < want
+		case "le":
+			return s <= want
+		}
+	case bool:
+		b, ok := v.(bool)
+		return ok && op == "eq" && b == want
+	case float64:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return n == want
+		case "gt":
+			return n > want
+		case "ge":
+			return n >= want
+		case "lt":
+			return n < want
+		case "le":
+			return n <= want
+		}
+	}
+	return false
+}
+
+// SCIMフィルタの字句
+const (
+	scimTokenWord = iota
+	scimTokenString
+	scimTokenLParen
+	scimTokenRParen
+	scimTokenLBracket
+	scimTokenRBracket
+)
+
+type scimToken struct {
+	kind int
+	text string
+}
+
+// scimFilterParser 再帰下降でフィルタを解析します（優先順位はnot、and、orの順）
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+// parseSCIMFilter フィルタを解析します（空の場合はnil）
+func parseSCIMFilter(s string) (scimFilter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeSCIMFilter(s)
+	if err != nil {
+		return nil, invalidFilter(err.Error())
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, invalidFilter("unexpected " + strconv.Quote(p.tokens[p.pos].text))
+	}
+	return f, nil
+}
+
+func invalidFilter(detail string) error {
+	return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidFilter, Detail: detail})
+}
+
+func tokenizeSCIMFilter(s string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, scimToken{scimTokenLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, scimToken{scimTokenRParen, ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, scimToken{scimTokenLBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, scimToken{scimTokenRBracket, "]"})
+			i++
+		case c == '"':
+			// JSONの文字列としてエスケープを解釈する
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			var str string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &str); err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:j+1])
+			}
+			tokens = append(tokens, scimToken{scimTokenString, str})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(s) && !strings.ContainsRune(" \t()[]\"", rune(s[j])); j++ {
+			}
+			tokens = append(tokens, scimToken{scimTokenWord, s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *scimFilterParser) peekWord(word string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == scimTokenWord && strings.EqualFold(p.tokens[p.pos].text, word)
+}
+
+func (p *scimFilterParser) expect(kind int, text string) error {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != kind {
+		return invalidFilter("expected " + strconv.Quote(text))
+	}
+	p.pos++
+	return nil
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogicalFilter{false, left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogicalFilter{true, left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary() (scimFilter, error) {
+	if p.peekWord("not") {
+		p.pos++
+		f, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &scimNotFilter{f}, nil
+	}
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == scimTokenLParen {
+		return p.parseGroup()
+	}
+	return p.parseAttrExpr()
+}
+
+func (p *scimFilterParser) parseGroup() (scimFilter, error) {
+	if err := p.expect(scimTokenLParen, "("); err != nil {
+		return nil, err
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(scimTokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p *scimFilterParser) parseAttrExpr() (scimFilter, error) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != scimTokenWord {
+		return nil, invalidFilter("expected an attribute")
+	}
+	path, err := parseSCIMAttrPath(p.tokens[p.pos].text)
+	if err != nil {
+		return nil, invalidFilter(err.Error())
+	}
+	p.pos++
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == scimTokenLBracket {
+		if path.sub != "" {
+			return nil, invalidFilter("unexpected \"[\" after " + path.attr + "." + path.sub)
+		}
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(scimTokenRBracket, "]"); err != nil {
+			return nil, err
+		}
+		return &scimValuePathFilter{path.attr, f}, nil
+	}
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != scimTokenWord {
+		return nil, invalidFilter("expected an operator after " + path.attr)
+	}
+	op := strings.ToLower(p.tokens[p.pos].text)
+	p.pos++
+	switch op {
+	case "pr":
+		return &scimCompareFilter{path: path, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, invalidFilter("unknown operator " + strconv.Quote(op))
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, invalidFilter("expected a value after " + op)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	if t.kind == scimTokenString {
+		return &scimCompareFilter{path, op, t.text}, nil
+	}
+	if t.kind != scimTokenWord {
+		return nil, invalidFilter("expected a value after " + op)
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return &scimCompareFilter{path, op, true}, nil
+	case "false":
+		return &scimCompareFilter{path, op, false}, nil
+	case "null":
+		return &scimCompareFilter{path, op, nil}, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, invalidFilter("invalid value " + strconv.Quote(t.text))
+	}
+	return &scimCompareFilter{path, op, n}, nil
+}
+
+// scimEqualityOf フィルタが"attr eq 文字列"の場合にその値を返します（バックエンドで直接検索するため）
+func scimEqualityOf(f scimFilter, attr string) (string, bool) {
+	cf, ok := f.(*scimCompareFilter)
+	if !ok || cf.op != "eq" || cf.path.attr != attr || cf.path.sub != "" {
+		return "", false
+	}
+	s, ok := cf.value.(string)
+	return s, ok
+}
@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// scimResource JSONのリソースをフィルタ、PATCHで扱うmapにします
+func scimResource(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// scimErrorType SCIMErrorのscimType（SCIMErrorでなければ空）
+func scimErrorType(err error) string {
+	var se *model.SCIMError
+	if errors.As(err, &se) {
+		return se.Type
+	}
+	return ""
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	user := `{
+		"id": "AbC-123",
+		"userName": "Taro@Example.com",
+		"active": true,
+		"name": {"givenName": "Taro", "familyName": "Yamada"},
+		"emails": [{"value": "taro@example.com", "type": "work", "primary": true}, {"value": "t@home.example", "type": "home"}],
+		"groups": [{"value": "admins"}],
+		"meta": {"resourceType": "User", "lastModified": "2026-01-02T03:04:05Z"},
+		"count": 3
+	}`
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "taro@example.com"`, true},
+		{`USERNAME EQ "TARO@EXAMPLE.COM"`, true},
+		{`userName ne "taro@example.com"`, false},
+		{`userName co "example"`, true},
+		{`userName sw "taro@"`, true},
+		{`userName ew ".org"`, false},
+		{`id eq "AbC-123"`, true},
+		// idのみ大文字小文字を区別する
+		{`id eq "abc-123"`, false},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "taro@example.com"`, true},
+		{`name.givenName eq "Taro"`, true},
+		{`name.middleName pr`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`count gt 2`, true},
+		{`count le 2`, false},
+		{`meta.lastModified gt "2026-01-01T00:00:00Z"`, true},
+		{`title eq null`, true},
+		{`userName eq null`, false},
+		{`title pr`, false},
+		{`emails pr`, true},
+		// 副属性のない複合属性はvalueで比較する
+		{`emails eq "t@home.example"`, true},
+		{`emails.type eq "home"`, true},
+		{`emails[type eq "work" and value co "taro"]`, true},
+		{`emails[type eq "home" and primary eq true]`, false},
+		{`groups[value eq "admins"]`, true},
+		{`not (active eq true)`, false},
+		{`not (userName eq "nobody@example.com")`, true},
+		// andはorより優先する
+		{`userName eq "nobody" and active eq true or count eq 3`, true},
+		{`userName eq "nobody" and (active eq true or count eq 3)`, false},
+		{`userName eq "nobody" or active eq true and count eq 4`, false},
+		{`((userName eq "taro@example.com"))`, true},
+		// 文字列はJSONとしてエスケープを解釈する
+		{`name.familyName eq "Yam\u0061da"`, true},
+	}
+	res := scimResource(t, user)
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := parseSCIMFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if got := f.match(res); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSCIMFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		`userName eq "taro`,
+		`userName eq`,
+		`userName`,
+		`userName like "taro"`,
+		`userName eq taro`,
+		`(userName eq "taro"`,
+		`userName eq "taro")`,
+		`emails[type eq "work"`,
+		`name.givenName[value eq "x"]`,
+		`a.b.c eq "x"`,
+		`and userName eq "taro"`,
+		`not userName eq "taro"`,
+		`userName eq "a" or`,
+	} {
+		t.Run(filter, func(t *testing.T) {
+			_, err := parseSCIMFilter(filter)
+			if got := scimErrorType(err); got != model.SCIMInvalidFilter {
+				t.Errorf("err = %v, want %s", err, model.SCIMInvalidFilter)
+			}
+		})
+	}
+}
+
+func TestParseSCIMFilterEmpty(t *testing.T) {
+	for _, filter := range []string{"", "  "} {
+		if f, err := parseSCIMFilter(filter); f != nil || err != nil {
+			t.Errorf("parseSCIMFilter(%q) = %v, %v, want nil, nil", filter, f, err)
+		}
+	}
+}
+
+func TestSCIMEqualityOf(t *testing.T) {
+	tests := []struct {
+		filter string
+		attr   string
+		want   string
+		ok     bool
+	}{
+		{`userName eq "taro@example.com"`, "username", "taro@example.com", true},
+		{`userName co "taro"`, "username", "", false},
+		{`userName eq "a" and active eq true`, "username", "", false},
+		{`name.givenName eq "Taro"`, "name", "", false},
+		{`id eq "abc"`, "username", "", false},
+	}
+	for _, tt := range tests {
+		f, err := parseSCIMFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := scimEqualityOf(f, tt.attr); got != tt.want || ok != tt.ok {
+			t.Errorf("scimEqualityOf(%s, %s) = %q, %v, want %q, %v", tt.filter, tt.attr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
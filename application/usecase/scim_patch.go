@@ -0,0 +1,252 @@
+package usecase
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// scimPatchPath PATCHの対象（attr、attr.sub、attr[filter]、attr[filter].sub）
+type scimPatchPath struct {
+	attr   string
+	filter scimFilter
+	sub    string
+}
+
+func parseSCIMPatchPath(s string) (*scimPatchPath, error) {
+	head, rest := s, ""
+	var filter scimFilter
+	if i := strings.Index(s, "["); i >= 0 {
+		j := strings.LastIndex(s, "]")
+		if j < i {
+			return nil, invalidPath(s)
+		}
+		var err error
+		if filter, err = parseSCIMFilter(s[i+1 : j]); err != nil || filter == nil {
+			return nil, invalidPath(s)
+		}
+		head, rest = s[:i], s[j+1:]
+	}
+	ap, err := parseSCIMAttrPath(head)
+	if err != nil {
+		return nil, invalidPath(s)
+	}
+	p := &scimPatchPath{attr: ap.attr, filter: filter, sub: ap.sub}
+	if rest != "" {
+		if filter == nil || ap.sub != "" || !strings.HasPrefix(rest, ".") || len(rest) < 2 {
+			return nil, invalidPath(s)
+		}
+		p.sub = strings.ToLower(rest[1:])
+	}
+	return p, nil
+}
+
+func invalidPath(path string) error {
+	return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidPath, Detail: "invalid path " + strconv.Quote(path)})
+}
+
+// applySCIMPatch PATCHの操作を順にリソースに適用します（RFC 7644 3.5.2）
+//
+// 適用後のリソースと元のリソースの差分をバックエンドに反映するため、ここでは検証しません。
+func applySCIMPatch(res map[string]interface{}, req *viewmodel.SCIMPatchOp) error {
+	if len(req.Operations) == 0 {
+		return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidSyntax, Detail: "no operations"})
+	}
+	for _, op := range req.Operations {
+		var value interface{}
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidSyntax, Detail: "invalid value"})
+			}
+		}
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidSyntax, Detail: "unknown op " + strconv.Quote(op.Op)})
+		}
+		if op.Path != "" {
+			p, err := parseSCIMPatchPath(op.Path)
+			if err != nil {
+				return err
+			}
+			if err := applySCIMPatchOp(res, p, kind, value); err != nil {
+				return err
+			}
+			continue
+		}
+		// パスがない場合は値のオブジェクトのキーをパスとする
+		if kind == "remove" {
+			return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMNoTarget, Detail: "remove requires a path"})
+		}
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidSyntax, Detail: "value must be an object when path is omitted"})
+		}
+		for k, v := range values {
+			if strings.EqualFold(k, "schemas") {
+				continue
+			}
+			p, err := parseSCIMPatchPath(k)
+			if err != nil {
+				return err
+			}
+			if err := applySCIMPatchOp(res, p, kind, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applySCIMPatchOp(res map[string]interface{}, p *scimPatchPath, kind string, value interface{}) error {
+	key, ok := findKey(res, p.attr)
+	if !ok {
+		key = p.attr
+	}
+	cur := res[key]
+
+	if p.filter != nil {
+		var out []interface{}
+		matched := false
+		for _, e := range elementsOf(cur) {
+			m, ok := e.(map[string]interface{})
+			if !ok || !p.filter.match(m) {
+				out = append(out, e)
+				continue
+			}
+			matched = true
+			switch {
+			case p.sub != "":
+				patchValue(m, p.sub, kind, value)
+			case kind == "remove":
+				continue
+			case kind == "replace":
+				if vm, ok := value.(map[string]interface{}); ok {
+					m = vm
+				}
+			default:
+				mergeValue(m, value)
+			}
+			out = append(out, m)
+		}
+		if !matched {
+			if kind == "remove" {
+				return nil
+			}
+			// emails[type eq "work"].valueのように等価条件で要素を特定できる場合は追加する
+			cf, ok := p.filter.(*scimCompareFilter)
+			if !ok || cf.op != "eq" || cf.path.sub != "" || p.sub == "" {
+				return errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMNoTarget, Detail: "no value matches the filter of " + p.attr})
+			}
+			out = append(out, map[string]interface{}{cf.path.attr: cf.value, p.sub: value})
+		}
+		res[key] = out
+		return nil
+	}
+
+	if p.sub != "" {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			patchValue(c, p.sub, kind, value)
+		case []interface{}:
+			// フィルタのない複数値属性の副属性は全ての要素が対象
+			for _, e := range c {
+				if m, ok := e.(map[string]interface{}); ok {
+					patchValue(m, p.sub, kind, value)
+				}
+			}
+		case nil:
+			if kind != "remove" {
+				res[key] = map[string]interface{}{p.sub: value}
+			}
+		}
+		return nil
+	}
+
+	switch kind {
+	case "remove":
+		arr, ok := cur.([]interface{})
+		if !ok || value == nil {
+			delete(res, key)
+			return nil
+		}
+		// 値を添えた場合は一致する要素のみ削除する（Entra IDのメンバーの削除）
+		var out []interface{}
+		for _, e := range arr {
+			if !containsSCIMValue(elementsOf(value), e) {
+				out = append(out, e)
+			}
+		}
+		res[key] = out
+	case "add":
+		switch c := cur.(type) {
+		case []interface{}:
+			for _, v := range elementsOf(value) {
+				if !containsSCIMValue(c, v) {
+					c = append(c, v)
+				}
+			}
+			res[key] = c
+		case map[string]interface{}:
+			mergeValue(c, value)
+		default:
+			res[key] = value
+		}
+	case "replace":
+		if c, ok := cur.(map[string]interface{}); ok {
+			if _, ok := value.(map[string]interface{}); ok {
+				mergeValue(c, value)
+				return nil
+			}
+		}
+		res[key] = value
+	}
+	return nil
+}
+
+// patchValue 複合属性の副属性を変更、削除します
+func patchValue(m map[string]interface{}, sub, kind string, value interface{}) {
+	key, ok := findKey(m, sub)
+	if !ok {
+		key = sub
+	}
+	if kind == "remove" {
+		delete(m, key)
+		return
+	}
+	m[key] = value
+}
+
+// mergeValue valueがオブジェクトの場合は副属性を上書きします
+func mergeValue(m map[string]interface{}, value interface{}) {
+	vm, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, v := range vm {
+		patchValue(m, k, "add", v)
+	}
+}
+
+// containsSCIMValue 複合属性はvalueが同じ要素を同じとみなします
+func containsSCIMValue(values []interface{}, v interface{}) bool {
+	want := scimValueKey(v)
+	for _, e := range values {
+		if scimValueKey(e) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func scimValueKey(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		return lookup(m, "value")
+	}
+	return v
+}
@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+func TestApplySCIMPatch(t *testing.T) {
+	const user = `{
+		"userName": "taro@example.com",
+		"active": true,
+		"name": {"givenName": "Taro", "familyName": "Yamada"},
+		"emails": [{"value": "taro@example.com", "type": "work", "primary": true}]
+	}`
+	const group = `{"displayName": "admins", "members": [{"value": "u1"}, {"value": "u2"}]}`
+	tests := []struct {
+		name string
+		res  string
+		ops  string
+		// want 適用後のリソース（wantTypeを指定した場合は使わない）
+		want     string
+		wantType string
+	}{
+		{
+			name: "replace a simple attribute",
+			res:  user,
+			ops:  `[{"op": "replace", "path": "active", "value": false}]`,
+			want: `{"userName": "taro@example.com", "active": false, "name": {"givenName": "Taro", "familyName": "Yamada"}, "emails": [{"value": "taro@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "op and path are case-insensitive",
+			res:  user,
+			ops:  `[{"op": "Replace", "path": "NAME.GIVENNAME", "value": "Jiro"}]`,
+			want: `{"userName": "taro@example.com", "active": true, "name": {"givenName": "Jiro", "familyName": "Yamada"}, "emails": [{"value": "taro@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			// Entra IDはパスを省略し、値を文字列の"False"で送る
+			name: "replace without a path",
+			res:  user,
+			ops:  `[{"op": "Replace", "value": {"active": "False", "name.familyName": "Suzuki"}}]`,
+			want: `{"userName": "taro@example.com", "active": "False", "name": {"givenName": "Taro", "familyName": "Suzuki"}, "emails": [{"value": "taro@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "replace a complex attribute merges sub-attributes",
+			res:  user,
+			ops:  `[{"op": "replace", "path": "name", "value": {"familyName": "Sato"}}]`,
+			want: `{"userName": "taro@example.com", "active": true, "name": {"givenName": "Taro", "familyName": "Sato"}, "emails": [{"value": "taro@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "replace the sub-attribute of a filtered value",
+			res:  user,
+			ops:  `[{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "jiro@example.com"}]`,
+			want: `{"userName": "taro@example.com", "active": true, "name": {"givenName": "Taro", "familyName": "Yamada"}, "emails": [{"value": "jiro@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "add a value matched by an equality filter",
+			res:  user,
+			ops:  `[{"op": "add", "path": "emails[type eq \"home\"].value", "value": "t@home.example"}]`,
+			want: `{"userName": "taro@example.com", "active": true, "name": {"givenName": "Taro", "familyName": "Yamada"}, "emails": [{"value": "taro@example.com", "type": "work", "primary": true}, {"type": "home", "value": "t@home.example"}]}`,
+		},
+		{
+			name:     "filter without a match",
+			res:      user,
+			ops:      `[{"op": "replace", "path": "emails[type co \"home\"].value", "value": "t@home.example"}]`,
+			wantType: model.SCIMNoTarget,
+		},
+		{
+			name: "remove an attribute",
+			res:  user,
+			ops:  `[{"op": "remove", "path": "name.givenName"}, {"op": "remove", "path": "active"}]`,
+			want: `{"userName": "taro@example.com", "name": {"familyName": "Yamada"}, "emails": [{"value": "taro@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "add members without duplicates",
+			res:  group,
+			ops:  `[{"op": "add", "path": "members", "value": [{"value": "u2"}, {"value": "u3"}]}]`,
+			want: `{"displayName": "admins", "members": [{"value": "u1"}, {"value": "u2"}, {"value": "u3"}]}`,
+		},
+		{
+			name: "remove a member by filter",
+			res:  group,
+			ops:  `[{"op": "remove", "path": "members[value eq \"u1\"]"}]`,
+			want: `{"displayName": "admins", "members": [{"value": "u2"}]}`,
+		},
+		{
+			// Entra IDはメンバーの削除で値を添える
+			name: "remove a member by value",
+			res:  group,
+			ops:  `[{"op": "remove", "path": "members", "value": [{"value": "u2"}]}]`,
+			want: `{"displayName": "admins", "members": [{"value": "u1"}]}`,
+		},
+		{
+			name: "remove a missing member",
+			res:  group,
+			ops:  `[{"op": "remove", "path": "members[value eq \"u9\"]"}]`,
+			want: group,
+		},
+		{
+			name: "replace all members",
+			res:  group,
+			ops:  `[{"op": "replace", "path": "members", "value": [{"value": "u3"}]}]`,
+			want: `{"displayName": "admins", "members": [{"value": "u3"}]}`,
+		},
+		{
+			name: "operations apply in order",
+			res:  group,
+			ops:  `[{"op": "remove", "path": "members"}, {"op": "add", "path": "members", "value": [{"value": "u4"}]}]`,
+			want: `{"displayName": "admins", "members": [{"value": "u4"}]}`,
+		},
+		{
+			name:     "no operations",
+			res:      user,
+			ops:      `[]`,
+			wantType: model.SCIMInvalidSyntax,
+		},
+		{
+			name:     "unknown op",
+			res:      user,
+			ops:      `[{"op": "move", "path": "active", "value": false}]`,
+			wantType: model.SCIMInvalidSyntax,
+		},
+		{
+			name:     "remove without a path",
+			res:      user,
+			ops:      `[{"op": "remove", "value": {"active": true}}]`,
+			wantType: model.SCIMNoTarget,
+		},
+		{
+			name:     "value must be an object without a path",
+			res:      user,
+			ops:      `[{"op": "add", "value": "x"}]`,
+			wantType: model.SCIMInvalidSyntax,
+		},
+		{
+			name:     "invalid path",
+			res:      user,
+			ops:      `[{"op": "replace", "path": "emails[type eq ].value", "value": "x"}]`,
+			wantType: model.SCIMInvalidPath,
+		},
+		{
+			name:     "sub-attribute after a filter must start with a dot",
+			res:      user,
+			ops:      `[{"op": "replace", "path": "emails[type eq \"work\"]value", "value": "x"}]`,
+			wantType: model.SCIMInvalidPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := scimResource(t, tt.res)
+			req := new(viewmodel.SCIMPatchOp)
+			if err := json.Unmarshal([]byte(`{"Operations": `+tt.ops+`}`), req); err != nil {
+				t.Fatal(err)
+			}
+			err := applySCIMPatch(res, req)
+			if tt.wantType != "" {
+				if got := scimErrorType(err); got != tt.wantType {
+					t.Fatalf("err = %v, want %s", err, tt.wantType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if want := scimResource(t, tt.want); !reflect.DeepEqual(res, want) {
+				got, _ := json.Marshal(res)
+				t.Errorf("resource = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
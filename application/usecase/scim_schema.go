@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// scimAttr スキーマの属性の定義を返します
+func scimAttr(name, typ, mutability, uniqueness string, required bool, subs ...map[string]interface{}) map[string]interface{} {
+	a := map[string]interface{}{
+		"name":        name,
+		"type":        typ,
+		"multiValued": false,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    "default",
+		"uniqueness":  uniqueness,
+	}
+	if len(subs) > 0 {
+		a["subAttributes"] = subs
+	}
+	return a
+}
+
+func scimMultiAttr(name, mutability string, subs ...map[string]interface{}) map[string]interface{} {
+	a := scimAttr(name, "complex", mutability, "none", false, subs...)
+	a["multiValued"] = true
+	return a
+}
+
+func (su *scimUsecase) schemas() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"schemas":     []string{viewmodel.SCIMSchemaSchema},
+			"id":          viewmodel.SCIMSchemaUser,
+			"name":        "User",
+			"description": "User Account",
+			"attributes": []map[string]interface{}{
+				scimAttr("userName", "string", "immutable", "server", true),
+				scimAttr("name", "complex", "readWrite", "none", false,
+					scimAttr("formatted", "string", "readWrite", "none", false),
+					scimAttr("familyName", "string", "readOnly", "none", false),
+					scimAttr("givenName", "string", "readOnly", "none", false),
+				),
+				scimAttr("displayName", "string", "readWrite", "none", false),
+				scimAttr("active", "boolean", "readWrite", "none", false),
+				scimAttr("password", "string", "writeOnly", "none", false),
+				scimMultiAttr("emails", "immutable",
+					scimAttr("value", "string", "immutable", "none", false),
+					scimAttr("type", "string", "immutable", "none", false),
+					scimAttr("primary", "boolean", "immutable", "none", false),
+				),
+				scimMultiAttr("groups", "readOnly",
+					scimAttr("value", "string", "readOnly", "none", false),
+					scimAttr("$ref", "reference", "readOnly", "none", false),
+					scimAttr("display", "string", "readOnly", "none", false),
+				),
+			},
+			"meta": map[string]interface{}{"resourceType": "Schema", "location": su.baseURL + "/Schemas/" + viewmodel.SCIMSchemaUser},
+		},
+		{
+			"schemas":     []string{viewmodel.SCIMSchemaSchema},
+			"id":          viewmodel.SCIMSchemaGroup,
+			"name":        "Group",
+			"description": "Group",
+			"attributes": []map[string]interface{}{
+				scimAttr("displayName", "string", "immutable", "server", true),
+				scimMultiAttr("members", "readWrite",
+					scimAttr("value", "string", "immutable", "none", false),
+					scimAttr("$ref", "reference", "immutable", "none", false),
+					scimAttr("display", "string", "readOnly", "none", false),
+				),
+			},
+			"meta": map[string]interface{}{"resourceType": "Schema", "location": su.baseURL + "/Schemas/" + viewmodel.SCIMSchemaGroup},
+		},
+	}
+}
+
+func (su *scimUsecase) resourceTypes() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"schemas":  []string{viewmodel.SCIMSchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   viewmodel.SCIMSchemaUser,
+			"meta":     map[string]interface{}{"resourceType": "ResourceType", "location": su.baseURL + "/ResourceTypes/User"},
+		},
+		{
+			"schemas":  []string{viewmodel.SCIMSchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   viewmodel.SCIMSchemaGroup,
+			"meta":     map[string]interface{}{"resourceType": "ResourceType", "location": su.baseURL + "/ResourceTypes/Group"},
+		},
+	}
+}
+
+// ServiceProviderConfig 対応している機能を返します（bulk、sort、etag、パスワードの変更には対応しない）
+func (su *scimUsecase) ServiceProviderConfig() map[string]interface{} {
+	unsupported := map[string]interface{}{"supported": false}
+	return map[string]interface{}{
+		"schemas":        []string{viewmodel.SCIMSchemaServiceProviderConfig},
+		"patch":          map[string]interface{}{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the shared bearer token (SCIM_TOKEN)",
+			"primary":     true,
+		}},
+		"meta": map[string]interface{}{"resourceType": "ServiceProviderConfig", "location": su.baseURL + "/ServiceProviderConfig"},
+	}
+}
+
+// ListSchemas UserとGroupのスキーマを返します
+func (su *scimUsecase) ListSchemas() *viewmodel.SCIMListResponse {
+	return scimStaticList(su.schemas())
+}
+
+// GetSchema URIでスキーマを返します
+func (su *scimUsecase) GetSchema(id string) (map[string]interface{}, error) {
+	return scimStaticFind(su.schemas(), id)
+}
+
+// ListResourceTypes UserとGroupのリソースタイプを返します
+func (su *scimUsecase) ListResourceTypes() *viewmodel.SCIMListResponse {
+	return scimStaticList(su.resourceTypes())
+}
+
+// GetResourceType 名前でリソースタイプを返します
+func (su *scimUsecase) GetResourceType(id string) (map[string]interface{}, error) {
+	return scimStaticFind(su.resourceTypes(), id)
+}
+
+func scimStaticList(resources []map[string]interface{}) *viewmodel.SCIMListResponse {
+	return &viewmodel.SCIMListResponse{
+		Schemas:      []string{viewmodel.SCIMSchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+func scimStaticFind(resources []map[string]interface{}, id string) (map[string]interface{}, error) {
+	for _, r := range resources {
+		if r["id"] == id {
+			return r, nil
+		}
+	}
+	return nil, errors.WithStack(&model.SCIMError{Status: http.StatusNotFound, Detail: "resource " + id + " not found"})
+}
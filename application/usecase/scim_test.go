@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// fakeUserAdmin 一覧を2件ずつのページで返すUserAdminProxy（使わない操作は未実装）
+type fakeUserAdmin struct {
+	proxy.UserAdminProxy
+	users []*model.UserRecord
+	// listCalls ListUsersの呼び出し回数
+	listCalls int
+}
+
+func newFakeUserAdmin(n int) *fakeUserAdmin {
+	fa := new(fakeUserAdmin)
+	for i := 1; i <= n; i++ {
+		fa.users = append(fa.users, &model.UserRecord{
+			Username:   fmt.Sprintf("sub-%d", i),
+			Enabled:    i%2 == 1,
+			Attributes: map[string]string{"sub": fmt.Sprintf("sub-%d", i), "email": fmt.Sprintf("user%d@example.com", i), "name": fmt.Sprintf("User %d", i)},
+		})
+	}
+	return fa
+}
+
+func (fa *fakeUserAdmin) ListUsers(ctx context.Context, pageToken string) ([]*model.UserRecord, string, error) {
+	fa.listCalls++
+	start := 0
+	if pageToken != "" {
+		fmt.Sscan(pageToken, &start)
+	}
+	end := start + 2
+	if end >= len(fa.users) {
+		return fa.users[start:], "", nil
+	}
+	return fa.users[start:end], fmt.Sprint(end), nil
+}
+
+func (fa *fakeUserAdmin) DescribeUser(ctx context.Context, email string) (*model.UserRecord, error) {
+	for _, u := range fa.users {
+		if u.Attributes["email"] == email {
+			return u, nil
+		}
+	}
+	return nil, errors.WithStack(model.ErrUserNotFound)
+}
+
+func (fa *fakeUserAdmin) GetUser(ctx context.Context, req *model.GetUserReq) (*model.User, error) {
+	for _, u := range fa.users {
+		if u.Attributes["sub"] == req.Sub {
+			return &model.User{Email: u.Attributes["email"]}, nil
+		}
+	}
+	return nil, errors.WithStack(model.ErrUserNotFound)
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestSCIMListUsersPaging(t *testing.T) {
+	tests := []struct {
+		name             string
+		q                viewmodel.SCIMQuery
+		wantTotal        int
+		wantStart        int
+		wantIDs          []string
+		wantBackendCalls int
+	}{
+		{"defaults", viewmodel.SCIMQuery{}, 5, 1, []string{"sub-1", "sub-2", "sub-3", "sub-4", "sub-5"}, 3},
+		{"second page", viewmodel.SCIMQuery{StartIndex: 3, Count: intPtr(2)}, 5, 3, []string{"sub-3", "sub-4"}, 3},
+		{"last page is short", viewmodel.SCIMQuery{StartIndex: 5, Count: intPtr(2)}, 5, 5, []string{"sub-5"}, 3},
+		{"beyond the last page", viewmodel.SCIMQuery{StartIndex: 9, Count: intPtr(2)}, 5, 6, []string{}, 3},
+		{"startIndex below 1", viewmodel.SCIMQuery{StartIndex: -3, Count: intPtr(1)}, 5, 1, []string{"sub-1"}, 3},
+		// count=0はtotalResultsのみ返す（RFC 7644 3.4.2.4）
+		{"count zero", viewmodel.SCIMQuery{Count: intPtr(0)}, 5, 1, []string{}, 3},
+		{"negative count", viewmodel.SCIMQuery{Count: intPtr(-1)}, 5, 1, []string{}, 3},
+		{"filter", viewmodel.SCIMQuery{Filter: `active eq true`, Count: intPtr(2)}, 3, 1, []string{"sub-1", "sub-3"}, 3},
+		// userName eqはバックエンドで直接検索する
+		{"userName eq", viewmodel.SCIMQuery{Filter: `userName eq "user4@example.com"`}, 1, 1, []string{"sub-4"}, 0},
+		{"userName eq without a match", viewmodel.SCIMQuery{Filter: `userName eq "nobody@example.com"`}, 0, 1, []string{}, 0},
+		{"id eq", viewmodel.SCIMQuery{Filter: `id eq "sub-2"`}, 1, 1, []string{"sub-2"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fa := newFakeUserAdmin(5)
+			su := NewSCIMUsecase(fa, new(auditRecorder), nil, nil, time.Hour, "https://auth.example.com/scim/v2/", false)
+			resp, err := su.ListUsers(context.Background(), &tt.q)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			ids := []string{}
+			for _, r := range resp.Resources {
+				ids = append(ids, r["id"].(string))
+			}
+			if resp.TotalResults != tt.wantTotal || resp.StartIndex != tt.wantStart || resp.ItemsPerPage != len(tt.wantIDs) || !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("totalResults %d, startIndex %d, itemsPerPage %d, ids %v; want %d, %d, %d, %v",
+					resp.TotalResults, resp.StartIndex, resp.ItemsPerPage, ids, tt.wantTotal, tt.wantStart, len(tt.wantIDs), tt.wantIDs)
+			}
+			if fa.listCalls != tt.wantBackendCalls {
+				t.Errorf("backend ListUsers called %d times, want %d", fa.listCalls, tt.wantBackendCalls)
+			}
+		})
+	}
+}
+
+// ListResponseのJSONがRFC 7644 3.4.2の形になること（Resourcesは空でも配列）
+func TestSCIMListResponseShape(t *testing.T) {
+	for _, count := range []int{0, 1} {
+		su := NewSCIMUsecase(newFakeUserAdmin(2), new(auditRecorder), nil, nil, time.Hour, "https://auth.example.com/scim/v2", false)
+		resp, err := su.ListUsers(context.Background(), &viewmodel.SCIMQuery{Count: intPtr(count)})
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		b, _ := json.Marshal(resp)
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if want := []string{"Resources", "itemsPerPage", "schemas", "startIndex", "totalResults"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("count %d: keys = %v, want %v", count, keys, want)
+		}
+		if !reflect.DeepEqual(m["schemas"], []interface{}{viewmodel.SCIMSchemaListResponse}) {
+			t.Errorf("count %d: schemas = %v", count, m["schemas"])
+		}
+		if _, ok := m["Resources"].([]interface{}); !ok {
+			t.Errorf("count %d: Resources = %v, want an array", count, m["Resources"])
+		}
+	}
+}
+
+func TestSCIMListUsersProjection(t *testing.T) {
+	su := NewSCIMUsecase(newFakeUserAdmin(1), new(auditRecorder), nil, nil, time.Hour, "https://auth.example.com/scim/v2", false)
+	tests := []struct {
+		q    viewmodel.SCIMQuery
+		want []string
+	}{
+		{viewmodel.SCIMQuery{Attributes: "userName,name.givenName"}, []string{"id", "name", "schemas", "userName"}},
+		{viewmodel.SCIMQuery{ExcludedAttributes: "emails,meta,name,displayName"}, []string{"active", "id", "schemas", "userName"}},
+		// schemasとidは除外できない
+		{viewmodel.SCIMQuery{ExcludedAttributes: "schemas,id,emails,meta,name,displayName,active"}, []string{"id", "schemas", "userName"}},
+	}
+	for _, tt := range tests {
+		resp, err := su.ListUsers(context.Background(), &tt.q)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		var keys []string
+		for k := range resp.Resources[0] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("%+v: attributes = %v, want %v", tt.q, keys, tt.want)
+		}
+	}
+}
+
+func TestSCIMListUsersInvalidFilter(t *testing.T) {
+	su := NewSCIMUsecase(newFakeUserAdmin(1), new(auditRecorder), nil, nil, time.Hour, "", false)
+	_, err := su.ListUsers(context.Background(), &viewmodel.SCIMQuery{Filter: `userName eq`})
+	if got := scimErrorType(err); got != model.SCIMInvalidFilter {
+		t.Errorf("err = %v, want %s", err, model.SCIMInvalidFilter)
+	}
+}
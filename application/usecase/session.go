@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// SessionUsecase ログイン中のデバイス（セッション）に対する操作を抽象化します
+type SessionUsecase interface {
+	UserUsecase
+	ListSessions(ctx context.Context, email string) (*viewmodel.SessionsResp, error)
+	ForgetSession(ctx context.Context, email, deviceKey string) error
+	UpdateSession(ctx context.Context, email, deviceKey string, req *viewmodel.UpdateSessionReq) error
+}
+
+// デバイスを使ったSignin、Refreshの度にIP、ユーザエージェントを記録し、デバイス一覧に添えます
+type sessionUsecase struct {
+	UserUsecase
+	ap proxy.UserProxy
+	ds proxy.DeviceActivityStore
+	as proxy.AuditSink
+	// activityTTL 最後の利用からこの期間で利用状況の記録を消す
+	activityTTL time.Duration
+}
+
+// NewSessionUsecase UserUsecaseをデバイスの利用状況の記録で修飾します
+func NewSessionUsecase(
+	uu UserUsecase,
+	ap proxy.UserProxy,
+	ds proxy.DeviceActivityStore,
+	as proxy.AuditSink,
+	activityTTL time.Duration,
+) SessionUsecase {
+	return &sessionUsecase{uu, ap, ds, as, activityTTL}
+}
+
+// Signin ログインを行います（デバイス名の指定がなければユーザエージェントを名前にする）
+func (su *sessionUsecase) Signin(ctx context.Context, req *viewmodel.SigninReq) (*viewmodel.SigninResp, error) {
+	if req.DeviceName == "" {
+		req.DeviceName = model.ActorFromContext(ctx).UserAgent
+	}
+	resp, err := su.UserUsecase.Signin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.NewDevice != nil:
+		su.touch(ctx, resp.NewDevice.Key)
+	case req.Device != nil:
+		su.touch(ctx, req.Device.Key)
+	}
+	return resp, nil
+}
+
+// Refresh トークンリフレッシュを行います
+func (su *sessionUsecase) Refresh(ctx context.Context, req *viewmodel.RefreshReq) (*viewmodel.SigninResp, error) {
+	resp, err := su.UserUsecase.Refresh(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.DeviceKey != "" {
+		su.touch(ctx, req.DeviceKey)
+	}
+	return resp, nil
+}
+
+// ListSessions デバイス一覧を最終利用状況とあわせて返します
+func (su *sessionUsecase) ListSessions(ctx context.Context, email string) (*viewmodel.SessionsResp, error) {
+	devices, err := su.ap.ListDevices(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(devices))
+	for i, d := range devices {
+		keys[i] = d.Key
+	}
+	activities, err := su.ds.Get(ctx, keys)
+	if err != nil {
+		// 利用状況は補足情報のため、取得できなくても一覧は返す
+		log.Default().Printf("%+v", err)
+	}
+	for _, d := range devices {
+		if a, ok := activities[d.Key]; ok {
+			at := a.At
+			d.LastIP, d.LastUserAgent, d.LastSeenAt = a.IP, a.UserAgent, &at
+		}
+	}
+	return &viewmodel.SessionsResp{Sessions: devices}, nil
+}
+
+// ForgetSession デバイスの登録を削除し、そのデバイスでのリフレッシュをできなくします
+// （発行済みのIDトークンは有効期限まで使えるため、必要に応じてGlobalSignoutを併用する）
+func (su *sessionUsecase) ForgetSession(ctx context.Context, email, deviceKey string) error {
+	err := su.ap.ForgetDevice(ctx, email, deviceKey)
+	if err == nil {
+		if derr := su.ds.Delete(ctx, deviceKey); derr != nil {
+			log.Default().Printf("%+v", derr)
+		}
+	}
+	writeAudit(ctx, su.as, model.AuditActionForgetDevice, deviceKey, err)
+	return err
+}
+
+// UpdateSession デバイスを記憶するかを変更します
+func (su *sessionUsecase) UpdateSession(ctx context.Context, email, deviceKey string, req *viewmodel.UpdateSessionReq) error {
+	err := su.ap.UpdateDeviceStatus(ctx, email, &model.UpdateDeviceStatusReq{DeviceKey: deviceKey, Remembered: *req.Remembered})
+	writeAudit(ctx, su.as, model.AuditActionUpdateDeviceStatus, deviceKey, err)
+	return err
+}
+
+// touch 利用状況を記録します（失敗してもログインは成功として扱う）
+func (su *sessionUsecase) touch(ctx context.Context, deviceKey string) {
+	actor := model.ActorFromContext(ctx)
+	err := su.ds.Touch(ctx, deviceKey, &model.DeviceActivity{
+		IP:        actor.IP,
+		UserAgent: actor.UserAgent,
+		At:        time.Now(),
+	}, su.activityTTL)
+	if err != nil {
+		log.Default().Printf("%+v", err)
+	}
+}
@@ -2,8 +2,10 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
 	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
 )
 
@@ -11,6 +13,7 @@ import (
 type UserUsecase interface {
 	Create(ctx context.Context, req *viewmodel.CreateReq) error
 	Confirm(ctx context.Context, req *viewmodel.ConfirmReq) (*viewmodel.SigninResp, error)
+	ResendConfirmationCode(ctx context.Context, req *viewmodel.ResendConfirmationCodeReq) error
 	Signin(ctx context.Context, req *viewmodel.SigninReq) (*viewmodel.SigninResp, error)
 	Refresh(ctx context.Context, req *viewmodel.RefreshReq) (*viewmodel.SigninResp, error)
 	ChangePassword(ctx context.Context, email string, req *viewmodel.ChangePasswordReq) error
@@ -19,44 +22,73 @@ type UserUsecase interface {
 	GetProfile(ctx context.Context, email string) (*viewmodel.User, error)
 	ChangeProfile(ctx context.Context, email string, req *viewmodel.ChangeProfileReq) error
 	Signout(ctx context.Context, req *viewmodel.SignoutReq) error
+	GlobalSignout(ctx context.Context, email string) error
 	Invite(ctx context.Context, req *viewmodel.InviteReq) (*viewmodel.InviteResp, error)
 	RespondToInvitation(ctx context.Context, req *viewmodel.RespondToInvitationReq) (*viewmodel.SigninResp, error)
 	GetUserForAdmin(ctx context.Context, req *viewmodel.GetUserReq) (*viewmodel.User, error)
+	DisableUserForAdmin(ctx context.Context, req *viewmodel.DisableUserReq) error
+	PasswordlessStart(ctx context.Context, req *viewmodel.PasswordlessStartReq) (*viewmodel.PasswordlessStartResp, error)
+	PasswordlessVerify(ctx context.Context, req *viewmodel.PasswordlessVerifyReq) (*viewmodel.SigninResp, error)
 }
 
 // アカウントに対する操作を提供します
 type userUsecase struct {
 	ap proxy.UserProxy
+	as proxy.AuditSink
+	rs proxy.RevocationStore
+	// ep Webhookを使わない場合はnil
+	ep proxy.EventPublisher
+	// tokenTTL IDトークンの最大有効期間（失効の記録はこの期間保持する）
+	tokenTTL time.Duration
 }
 
-// NewUserUsecase UserUsecaseを生成します
+// NewUserUsecase UserUsecaseを生成します（Webhookを使わない場合epはnil）
 func NewUserUsecase(
 	ap proxy.UserProxy,
+	as proxy.AuditSink,
+	rs proxy.RevocationStore,
+	ep proxy.EventPublisher,
+	tokenTTL time.Duration,
 ) UserUsecase {
-	return &userUsecase{ap}
+	return &userUsecase{ap, as, rs, ep, tokenTTL}
 }
 
 // Create アカウント新規作成
 func (tu *userUsecase) Create(ctx context.Context, req *viewmodel.CreateReq) error {
 	// uuidを返すので、利用可能
-	_, err := tu.ap.Signup(ctx, &req.CreateReq)
-	return err
+	sub, err := tu.ap.Signup(ctx, &req.CreateReq)
+	tu.audit(ctx, model.AuditActionSignup, req.Email, err)
+	if err != nil {
+		return err
+	}
+	tu.publish(ctx, model.EventUserSignedUp, map[string]string{"sub": sub, "email": req.Email, "name": req.Name})
+	return nil
 }
 
 // Confirm アカウント確認を行います（ログインも試行する、MFAが設定された認証プールには適用できないので注意）
 func (tu *userUsecase) Confirm(ctx context.Context, req *viewmodel.ConfirmReq) (*viewmodel.SigninResp, error) {
 	token, err := tu.ap.ConfirmAndSignin(ctx, &req.ConfirmAndSigninReq)
+	tu.audit(ctx, model.AuditActionConfirmSignup, req.Email, err)
 	if err != nil {
 		return nil, err
 	}
+	tu.publish(ctx, model.EventUserConfirmed, map[string]string{"email": req.Email})
 	resp := new(viewmodel.SigninResp)
 	resp.Token = *token
 	return resp, nil
 }
 
+// ResendConfirmationCode 確認コードを再送します
+func (tu *userUsecase) ResendConfirmationCode(ctx context.Context, req *viewmodel.ResendConfirmationCodeReq) error {
+	err := tu.ap.ResendConfirmationCode(ctx, &req.ResendConfirmationCodeReq)
+	tu.audit(ctx, model.AuditActionResendConfirmation, req.Email, err)
+	return err
+}
+
 // Signin アカウント確認を行います（ログインも試行する、MFAが設定された認証プールには適用できないので注意）
 func (tu *userUsecase) Signin(ctx context.Context, req *viewmodel.SigninReq) (*viewmodel.SigninResp, error) {
 	token, err := tu.ap.Signin(ctx, &req.SigninReq)
+	tu.audit(ctx, model.AuditActionSignin, req.Email, err)
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +100,7 @@ func (tu *userUsecase) Signin(ctx context.Context, req *viewmodel.SigninReq) (*v
 // Refresh トークンリフレッシュを行います
 func (tu *userUsecase) Refresh(ctx context.Context, req *viewmodel.RefreshReq) (*viewmodel.SigninResp, error) {
 	token, err := tu.ap.Refresh(ctx, &req.RefreshReq)
+	tu.audit(ctx, model.AuditActionRefresh, req.Sub, err)
 	if err != nil {
 		return nil, err
 	}
@@ -78,17 +111,27 @@ func (tu *userUsecase) Refresh(ctx context.Context, req *viewmodel.RefreshReq) (
 
 // ChangePassword パスワード変更を行います
 func (tu *userUsecase) ChangePassword(ctx context.Context, email string, req *viewmodel.ChangePasswordReq) error {
-	return tu.ap.ChangePassword(ctx, email, &req.ChangePasswordReq)
+	err := tu.ap.ChangePassword(ctx, email, &req.ChangePasswordReq)
+	if err == nil {
+		// 変更前に発行されたIDトークンを失効させる
+		err = tu.revokeSubject(ctx)
+	}
+	tu.audit(ctx, model.AuditActionChangePassword, email, err)
+	return err
 }
 
 // ForgotPassword パスワード忘れ
 func (tu *userUsecase) ForgotPassword(ctx context.Context, req *viewmodel.ForgotPasswordReq) error {
-	return tu.ap.ForgotPassword(ctx, &req.ForgotPasswordReq)
+	err := tu.ap.ForgotPassword(ctx, &req.ForgotPasswordReq)
+	tu.audit(ctx, model.AuditActionForgotPassword, req.Email, err)
+	return err
 }
 
 // ConfirmForgotPassword パスワード忘れ確認
 func (tu *userUsecase) ConfirmForgotPassword(ctx context.Context, req *viewmodel.ConfirmForgotPasswordReq) error {
-	return tu.ap.ConfirmForgotPassword(ctx, &req.ConfirmForgotPasswordReq)
+	err := tu.ap.ConfirmForgotPassword(ctx, &req.ConfirmForgotPasswordReq)
+	tu.audit(ctx, model.AuditActionConfirmForgotPassword, req.Email, err)
+	return err
 }
 
 // GetProfile アカウント情報を取得します
@@ -104,26 +147,54 @@ func (tu *userUsecase) GetProfile(ctx context.Context, email string) (*viewmodel
 
 // ChangeProfile アカウント情報を変更します
 func (tu *userUsecase) ChangeProfile(ctx context.Context, email string, req *viewmodel.ChangeProfileReq) error {
-	return tu.ap.ChangeProfile(ctx, email, &req.ChangeProfileReq)
+	err := tu.ap.ChangeProfile(ctx, email, &req.ChangeProfileReq)
+	tu.audit(ctx, model.AuditActionChangeProfile, email, err)
+	if err != nil {
+		return err
+	}
+	tu.publish(ctx, model.EventUserProfileChanged, map[string]string{"email": email, "name": req.Name})
+	return nil
 }
 
-// Signout ログアウトを行います
+// Signout ログアウトを行います（IDトークンが添えられていれば、同じ認証から発行されたIDトークンも失効させる）
 func (tu *userUsecase) Signout(ctx context.Context, req *viewmodel.SignoutReq) error {
-	return tu.ap.Signout(ctx, &req.SignoutReq)
+	err := tu.ap.Signout(ctx, &req.SignoutReq)
+	if claims := model.ClaimsFromContext(ctx); err == nil && claims != nil {
+		id := claims.OriginJTI
+		if id == "" {
+			id = claims.JTI
+		}
+		err = tu.rs.RevokeToken(ctx, id, time.Now().Add(tu.tokenTTL))
+	}
+	tu.audit(ctx, model.AuditActionSignout, "", err)
+	return err
+}
+
+// GlobalSignout 全ての端末からログアウトを行います
+func (tu *userUsecase) GlobalSignout(ctx context.Context, email string) error {
+	err := tu.ap.GlobalSignout(ctx, email)
+	if err == nil {
+		err = tu.revokeSubject(ctx)
+	}
+	tu.audit(ctx, model.AuditActionGlobalSignout, email, err)
+	return err
 }
 
 // Invite 招待を行います
 func (tu *userUsecase) Invite(ctx context.Context, req *viewmodel.InviteReq) (*viewmodel.InviteResp, error) {
 	sub, err := tu.ap.Invite(ctx, &req.InviteReq)
+	tu.audit(ctx, model.AuditActionInvite, req.Email, err)
 	if err != nil {
 		return nil, err
 	}
+	tu.publish(ctx, model.EventUserInvited, map[string]string{"sub": sub, "email": req.Email})
 	return &viewmodel.InviteResp{Sub: sub}, nil
 }
 
 // RespondToInvitation 招待応答を行います
 func (tu *userUsecase) RespondToInvitation(ctx context.Context, req *viewmodel.RespondToInvitationReq) (*viewmodel.SigninResp, error) {
 	token, err := tu.ap.RespondToInvitation(ctx, &req.RespondToInvitationReq)
+	tu.audit(ctx, model.AuditActionRespondToInvitation, req.Email, err)
 	if err != nil {
 		return nil, err
 	}
@@ -142,3 +213,67 @@ func (tu *userUsecase) GetUserForAdmin(ctx context.Context, req *viewmodel.GetUs
 	resp.User = *user
 	return resp, nil
 }
+
+// DisableUserForAdmin ユーザを無効化し、発行済みのIDトークンを失効させます
+func (tu *userUsecase) DisableUserForAdmin(ctx context.Context, req *viewmodel.DisableUserReq) error {
+	err := tu.ap.DisableUser(ctx, &req.DisableUserReq)
+	if err == nil {
+		err = tu.rs.RevokeSubject(ctx, req.Sub, time.Now().Truncate(time.Second), tu.tokenTTL)
+	}
+	tu.audit(ctx, model.AuditActionDisableUser, req.Sub, err)
+	if err != nil {
+		return err
+	}
+	tu.publish(ctx, model.EventUserDisabled, map[string]string{"sub": req.Sub})
+	return nil
+}
+
+// PasswordlessStart メールのワンタイムコードによるログインを開始します（コードの送信はトリガで行う）
+func (tu *userUsecase) PasswordlessStart(ctx context.Context, req *viewmodel.PasswordlessStartReq) (*viewmodel.PasswordlessStartResp, error) {
+	ch, err := tu.ap.InitiateCustomAuth(ctx, &model.CustomAuthReq{
+		Email:    req.Email,
+		Metadata: map[string]string{model.CustomAuthMethodKey: model.CustomAuthMethodEmailOTP},
+	})
+	tu.audit(ctx, model.AuditActionPasswordlessStart, req.Email, err)
+	if err != nil {
+		return nil, err
+	}
+	return &viewmodel.PasswordlessStartResp{Session: ch.Session}, nil
+}
+
+// PasswordlessVerify ワンタイムコードを検証してログインします
+func (tu *userUsecase) PasswordlessVerify(ctx context.Context, req *viewmodel.PasswordlessVerifyReq) (*viewmodel.SigninResp, error) {
+	token, err := tu.ap.RespondToCustomChallenge(ctx, &model.CustomChallengeAnswerReq{
+		Email:    req.Email,
+		Session:  req.Session,
+		Answer:   req.Code,
+		Metadata: map[string]string{model.CustomAuthMethodKey: model.CustomAuthMethodEmailOTP},
+	})
+	tu.audit(ctx, model.AuditActionPasswordlessVerify, req.Email, err)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(viewmodel.SigninResp)
+	resp.Token = *token
+	return resp, nil
+}
+
+// revokeSubject 認証済みのユーザに対して現在までに発行されたIDトークンを失効させます
+// （iatは秒単位のため、同じ秒に発行されたトークンは有効のままにする）
+func (tu *userUsecase) revokeSubject(ctx context.Context) error {
+	claims := model.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil
+	}
+	return tu.rs.RevokeSubject(ctx, claims.Sub, time.Now().Truncate(time.Second), tu.tokenTTL)
+}
+
+// audit 監査ログを書き込みます
+func (tu *userUsecase) audit(ctx context.Context, action, target string, err error) {
+	writeAudit(ctx, tu.as, action, target, err)
+}
+
+// publish ユーザのライフサイクルのイベントを通知します
+func (tu *userUsecase) publish(ctx context.Context, eventType string, data map[string]string) {
+	publishEvent(ctx, tu.ep, eventType, data)
+}
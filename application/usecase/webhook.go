@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 配信の一覧の既定の件数
+const defaultWebhookDeliveriesLimit = 100
+
+// WebhookUsecase Webhookの配信の確認、再送を抽象化します
+type WebhookUsecase interface {
+	ListDeliveries(ctx context.Context, req *viewmodel.WebhookDeliveriesReq) (*viewmodel.WebhookDeliveriesResp, error)
+	Replay(ctx context.Context, req *viewmodel.ReplayWebhooksReq) (*viewmodel.ReplayWebhooksResp, error)
+}
+
+type webhookUsecase struct {
+	ob proxy.WebhookOutbox
+	as proxy.AuditSink
+}
+
+// NewWebhookUsecase WebhookUsecaseを生成します
+func NewWebhookUsecase(ob proxy.WebhookOutbox, as proxy.AuditSink) WebhookUsecase {
+	return &webhookUsecase{ob, as}
+}
+
+// ListDeliveries 条件に合う配信を新しい順に返します
+func (wu *webhookUsecase) ListDeliveries(ctx context.Context, req *viewmodel.WebhookDeliveriesReq) (*viewmodel.WebhookDeliveriesResp, error) {
+	f := &model.WebhookDeliveryFilter{
+		EventID:   req.EventID,
+		EventType: req.EventType,
+		Endpoint:  req.Endpoint,
+		Status:    req.Status,
+		Limit:     req.Limit,
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultWebhookDeliveriesLimit
+	}
+	deliveries, err := wu.ob.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []*model.WebhookDelivery{}
+	}
+	return &viewmodel.WebhookDeliveriesResp{Deliveries: deliveries}, nil
+}
+
+// Replay 条件に合う配信を未配信に戻します（配信済みのイベントも同じIDで再び送る）
+func (wu *webhookUsecase) Replay(ctx context.Context, req *viewmodel.ReplayWebhooksReq) (*viewmodel.ReplayWebhooksResp, error) {
+	f := &model.WebhookDeliveryFilter{
+		EventID:   req.EventID,
+		EventType: req.EventType,
+		Endpoint:  req.Endpoint,
+		Status:    req.Status,
+	}
+	if req.Since != nil {
+		f.Since = *req.Since
+	}
+	if req.Until != nil {
+		f.Until = *req.Until
+	}
+	// 全ての配信を誤って再送しないよう、イベントか期間の指定を必須にする
+	if f.EventID == "" && f.Since.IsZero() {
+		err := errors.WithStack(model.ErrEmptyWebhookFilter)
+		writeAudit(ctx, wu.as, model.AuditActionReplayWebhooks, replayTarget(f), err)
+		return nil, err
+	}
+	n, err := wu.ob.Replay(ctx, f, time.Now())
+	writeAudit(ctx, wu.as, model.AuditActionReplayWebhooks, replayTarget(f), err)
+	if err != nil {
+		return nil, err
+	}
+	return &viewmodel.ReplayWebhooksResp{Replayed: n}, nil
+}
+
+// replayTarget 監査ログに再送の条件を残します
+func replayTarget(f *model.WebhookDeliveryFilter) string {
+	var conds []string
+	for _, c := range []struct{ k, v string }{
+		{"event_id", f.EventID},
+		{"event_type", f.EventType},
+		{"endpoint", f.Endpoint},
+		{"status", f.Status},
+	} {
+		if c.v != "" {
+			conds = append(conds, c.k+"="+c.v)
+		}
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "since="+f.Since.UTC().Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "until="+f.Until.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(conds, " ")
+}
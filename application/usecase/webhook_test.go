@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// Replayの条件を記録するアウトボックス
+type fakeOutbox struct {
+	replayed []*model.WebhookDeliveryFilter
+}
+
+func (o *fakeOutbox) Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	return nil
+}
+
+func (o *fakeOutbox) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*model.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (o *fakeOutbox) Update(ctx context.Context, d *model.WebhookDelivery) error {
+	return nil
+}
+
+func (o *fakeOutbox) List(ctx context.Context, f *model.WebhookDeliveryFilter) ([]*model.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (o *fakeOutbox) Replay(ctx context.Context, f *model.WebhookDeliveryFilter, now time.Time) (int, error) {
+	o.replayed = append(o.replayed, f)
+	return 1, nil
+}
+
+type auditRecorder struct {
+	events []*model.AuditEvent
+}
+
+func (a *auditRecorder) Write(ctx context.Context, ev *model.AuditEvent) error {
+	a.events = append(a.events, ev)
+	return nil
+}
+
+func TestWebhookReplayFilter(t *testing.T) {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		req     *viewmodel.ReplayWebhooksReq
+		wantErr error
+	}{
+		{"empty", &viewmodel.ReplayWebhooksReq{}, model.ErrEmptyWebhookFilter},
+		{"endpoint only", &viewmodel.ReplayWebhooksReq{Endpoint: "crm", Status: model.WebhookFailed}, model.ErrEmptyWebhookFilter},
+		{"event id", &viewmodel.ReplayWebhooksReq{EventID: "ev-1"}, nil},
+		{"since", &viewmodel.ReplayWebhooksReq{Endpoint: "crm", Since: &since}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob, as := new(fakeOutbox), new(auditRecorder)
+			resp, err := NewWebhookUsecase(ob, as).Replay(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(ob.replayed) != 0 {
+					t.Errorf("outbox replayed %d filters, want none", len(ob.replayed))
+				}
+			} else if resp.Replayed != 1 || len(ob.replayed) != 1 {
+				t.Errorf("replayed = %d (%d calls), want 1", resp.Replayed, len(ob.replayed))
+			}
+			if len(as.events) != 1 || as.events[0].Action != model.AuditActionReplayWebhooks {
+				t.Fatalf("audit events = %+v, want one %s", as.events, model.AuditActionReplayWebhooks)
+			}
+			wantOutcome := model.AuditOutcomeSuccess
+			if tt.wantErr != nil {
+				wantOutcome = model.AuditOutcomeFailure
+			}
+			if as.events[0].Outcome != wantOutcome {
+				t.Errorf("audit outcome = %s, want %s", as.events[0].Outcome, wantOutcome)
+			}
+		})
+	}
+}
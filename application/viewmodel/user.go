@@ -1,6 +1,10 @@
 package viewmodel
 
-import "github.com/taniyuu/gin-cognito-sample/domain/model"
+import (
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
 
 type CreateReq struct {
 	model.CreateReq
@@ -10,6 +14,10 @@ type ConfirmReq struct {
 	model.ConfirmAndSigninReq
 }
 
+type ResendConfirmationCodeReq struct {
+	model.ResendConfirmationCodeReq
+}
+
 type SigninReq struct {
 	model.SigninReq
 }
@@ -50,6 +58,57 @@ type GetUserReq struct {
 	model.GetUserReq
 }
 
+type DisableUserReq struct {
+	model.DisableUserReq
+}
+
+type PasswordlessStartReq struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordlessStartResp struct {
+	Session string `json:"session"`
+}
+
+type PasswordlessVerifyReq struct {
+	Email   string `json:"email" validate:"required,email"`
+	Session string `json:"session" validate:"required"`
+	Code    string `json:"code" validate:"required"`
+}
+
+type MagicLinkStartReq struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkCallbackReq struct {
+	Token string `form:"token" validate:"required"`
+}
+
+type OAuthLoginReq struct {
+	IdentityProvider string `form:"identity_provider"`
+}
+
+type OAuthLoginResp struct {
+	URL      string
+	State    string
+	StateTTL time.Duration
+}
+
+type OAuthCallbackReq struct {
+	Code             string `form:"code"`
+	State            string `form:"state" validate:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+type UpdateSessionReq struct {
+	Remembered *bool `json:"remembered" validate:"required"`
+}
+
+type SessionsResp struct {
+	Sessions []*model.Device `json:"sessions"`
+}
+
 type SigninResp struct {
 	model.Token
 }
@@ -61,3 +120,8 @@ type InviteResp struct {
 type User struct {
 	model.User
 }
+
+type UnlockReq struct {
+	Email string `json:"email" validate:"required_without=IP,omitempty,email"`
+	IP    string `json:"ip" validate:"required_without=Email,omitempty,ip"`
+}
@@ -0,0 +1,33 @@
+package viewmodel
+
+import (
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+type WebhookDeliveriesReq struct {
+	EventID   string `form:"event_id"`
+	EventType string `form:"event_type"`
+	Endpoint  string `form:"endpoint"`
+	Status    string `form:"status" validate:"omitempty,oneof=pending delivered failed"`
+	Limit     int    `form:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+type WebhookDeliveriesResp struct {
+	Deliveries []*model.WebhookDelivery `json:"deliveries"`
+}
+
+// ReplayWebhooksReq 全ての配信を誤って再送しないよう、event_idかsinceを必須にする
+type ReplayWebhooksReq struct {
+	EventID   string     `json:"event_id" validate:"required_without=Since"`
+	EventType string     `json:"event_type"`
+	Endpoint  string     `json:"endpoint"`
+	Status    string     `json:"status" validate:"omitempty,oneof=pending delivered failed"`
+	Since     *time.Time `json:"since" validate:"required_without=EventID"`
+	Until     *time.Time `json:"until"`
+}
+
+type ReplayWebhooksResp struct {
+	Replayed int `json:"replayed"`
+}
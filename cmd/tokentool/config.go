@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/taniyuu/gin-cognito-sample/config"
+)
+
+// configFlags 設定を読み込む共通のフラグ
+type configFlags struct {
+	configFile string
+	backend    string
+}
+
+func (cf *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&cf.configFile, "config", "", "YAML config file")
+	fs.StringVar(&cf.backend, "backend", "", "cognito, sql or ldap (AUTH_BACKEND if empty)")
+}
+
+// load 設定を読み込みます（-config、-backendがなければ環境変数、.envのみ）
+func (cf *configFlags) load() (*config.TokentoolConfig, error) {
+	var args []string
+	if cf.configFile != "" {
+		args = append(args, "-config", cf.configFile)
+	}
+	if cf.backend != "" {
+		args = append(args, "-auth-backend", cf.backend)
+	}
+	cfg := new(config.TokentoolConfig)
+	if err := config.LoadInto(cfg, args); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// expectation ValidateJWTが要求する値
+type expectation struct {
+	issuer   string
+	audience string
+	// jwks JWKSのファイルかURL、keyFileが空でない場合はその公開鍵を使う
+	jwks    string
+	keyFile string
+}
+
+// expectationOf サーバと同じ設定からValidateJWTが要求する値を求めます
+func expectationOf(cfg *config.TokentoolConfig) expectation {
+	if cfg.Backend == config.BackendCognito {
+		if cfg.Cognito.PoolID == "" {
+			return expectation{audience: cfg.Cognito.ClientID}
+		}
+		iss := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", cfg.Cognito.Region, cfg.Cognito.PoolID)
+		return expectation{iss, cfg.Cognito.ClientID, iss + "/.well-known/jwks.json", ""}
+	}
+	e := expectation{issuer: cfg.LocalJWT.Issuer, audience: cfg.LocalJWT.Audience, keyFile: cfg.LocalJWT.KeyFile}
+	if e.keyFile == "" && e.issuer != "" {
+		e.jwks = strings.TrimSuffix(e.issuer, "/") + "/.well-known/jwks.json"
+	}
+	return e
+}
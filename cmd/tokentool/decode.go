@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+)
+
+// errInvalidToken ValidateJWTで拒否されるトークン（失敗した検査は出力済み）
+var errInvalidToken = errors.New("invalid token")
+
+// 検査の結果
+const (
+	statusOK   = "ok"
+	statusFail = "FAIL"
+	statusSkip = "skip"
+)
+
+// check ValidateJWTの検査項目ごとの結果
+type check struct {
+	name   string
+	status string
+	detail string
+}
+
+type checks []check
+
+func (cs *checks) add(name, status, format string, a ...interface{}) {
+	*cs = append(*cs, check{name, status, fmt.Sprintf(format, a...)})
+}
+
+func (cs checks) failed() bool {
+	for _, c := range cs {
+		if c.status == statusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// runDecode トークンの内容を表示し、ValidateJWTの検査を1つずつ行います
+func runDecode(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	jwks := fs.String("jwks", "", "JWKS file or URL (from the config if empty)")
+	keyFile := fs.String("key", "", "RSA private key (PEM) of the local issuer, instead of -jwks")
+	issuer := fs.String("issuer", "", "expected iss (from the config if empty)")
+	audience := fs.String("audience", "", "expected aud (from the config if empty)")
+	tokenUse := fs.String("token-use", "id", "expected token_use")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tokentool decode [flags] [token]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	raw, err := readToken(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	cfg, err := cf.load()
+	if err != nil {
+		return err
+	}
+	e := expectationOf(cfg)
+	if *jwks != "" {
+		e.jwks, e.keyFile = *jwks, ""
+	}
+	if *keyFile != "" {
+		e.jwks, e.keyFile = "", *keyFile
+	}
+	if *issuer != "" {
+		e.issuer = *issuer
+	}
+	if *audience != "" {
+		e.audience = *audience
+	}
+
+	var cs checks
+	// AuthzMiddlewareはAuthorizationヘッダの値をそのままトークンとして扱う
+	if len(raw) > 7 && strings.EqualFold(raw[:7], "Bearer ") {
+		raw = strings.TrimSpace(raw[7:])
+		cs.add("format", statusFail, `send the ID token itself in the Authorization header, without "Bearer "`)
+	}
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return errors.WithStack(fmt.Errorf("not a compact JWS: %d segments, want 3", len(parts)))
+	}
+	for i, name := range []string{"header", "claims"} {
+		b, err := decodeSegment(parts[i])
+		if err != nil {
+			return errors.Wrapf(err, "decode %s", name)
+		}
+		fmt.Fprintf(out, "%s:\n%s\n\n", name, b)
+	}
+	msg, err := jws.Parse([]byte(raw))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	hdr := msg.Signatures()[0].ProtectedHeaders()
+	jt, err := jwt.ParseInsecure([]byte(raw))
+	if err != nil {
+		cs.add("format", statusFail, "claims: %v", err)
+	} else if len(cs) == 0 {
+		cs.add("format", statusOK, "")
+	}
+	now := time.Now()
+	if jt != nil {
+		printTimes(out, jt, now)
+	}
+
+	// 署名
+	set, src, err := loadKeySet(ctx, e)
+	var key jwk.Key
+	switch {
+	case err != nil:
+		cs.add("kid", statusFail, "%v", err)
+	case set == nil:
+		cs.add("kid", statusSkip, "no JWKS: give -jwks, or configure COGNITO_POOL_ID or LOCAL_JWT_*")
+	case hdr.KeyID() == "":
+		cs.add("kid", statusFail, "no kid in the header; ValidateJWT looks up the key by kid")
+	default:
+		var ok bool
+		if key, ok = set.LookupKeyID(hdr.KeyID()); ok {
+			cs.add("kid", statusOK, "%s found in %s", hdr.KeyID(), src)
+		} else {
+			cs.add("kid", statusFail, "%s not in %s (has %s); issued by another pool or issuer, or the key was rotated",
+				hdr.KeyID(), src, strings.Join(keyIDs(set), ", "))
+		}
+	}
+	switch {
+	case key == nil:
+		cs.add("alg", statusSkip, "no key")
+	case key.KeyUsage() != "" && key.KeyUsage() != jwk.ForSignature.String():
+		cs.add("alg", statusFail, "key %s is for use %q, not sig", hdr.KeyID(), key.KeyUsage())
+		key = nil
+	case key.Algorithm().String() == "":
+		cs.add("alg", statusFail, "key %s has no alg; ValidateJWT does not infer it from the key type", hdr.KeyID())
+		key = nil
+	case key.Algorithm().String() != hdr.Algorithm().String():
+		cs.add("alg", statusFail, "signed with %s but key %s is for %s", hdr.Algorithm(), hdr.KeyID(), key.Algorithm())
+		key = nil
+	default:
+		cs.add("alg", statusOK, "%s", hdr.Algorithm())
+	}
+	if key == nil {
+		cs.add("signature", statusSkip, "no usable key")
+	} else if _, err := jws.Verify([]byte(raw), jws.WithKey(hdr.Algorithm(), key)); err != nil {
+		cs.add("signature", statusFail, "%v; the token was altered or signed with another key of the same kid", err)
+	} else {
+		cs.add("signature", statusOK, "")
+	}
+
+	// クレーム
+	if jt == nil {
+		for _, name := range []string{"exp", "nbf", "iat", "iss", "aud", "token_use"} {
+			cs.add(name, statusSkip, "claims could not be parsed")
+		}
+	} else {
+		checkClaims(&cs, jt, e, *tokenUse, now)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "checks:")
+	for _, c := range cs {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", c.status, c.name, c.detail)
+	}
+	tw.Flush()
+
+	// ValidateJWTと同じ条件でまとめて検証する（失効は確認しない）
+	failed := cs.failed()
+	switch {
+	case set == nil || e.issuer == "" || e.audience == "":
+		fmt.Fprintln(out, "\nValidateJWT: not evaluated (JWKS, issuer and audience are required)")
+	default:
+		_, err := jwt.Parse(
+			[]byte(raw),
+			jwt.WithKeySet(set),
+			jwt.WithValidate(true),
+			jwt.WithIssuer(e.issuer),
+			jwt.WithAudience(e.audience),
+			jwt.WithClaimValue("token_use", *tokenUse),
+		)
+		if err != nil {
+			fmt.Fprintf(out, "\nValidateJWT: %v\n", err)
+			failed = true
+		} else {
+			fmt.Fprintln(out, "\nValidateJWT: ok (revocation is not checked)")
+		}
+	}
+	if failed {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// checkClaims 有効期限、発行者、オーディエンス、token_useを検査します
+func checkClaims(cs *checks, jt jwt.Token, e expectation, tokenUse string, now time.Time) {
+	if exp := jt.Expiration(); exp.IsZero() {
+		cs.add("exp", statusOK, "not set")
+	} else if !now.Before(exp) {
+		cs.add("exp", statusFail, "expired %s", relative(exp, now))
+	} else {
+		cs.add("exp", statusOK, "expires %s", relative(exp, now))
+	}
+	if nbf := jt.NotBefore(); !nbf.IsZero() && now.Before(nbf) {
+		cs.add("nbf", statusFail, "not valid until %s (%s)", nbf.Local().Format(time.RFC3339), relative(nbf, now))
+	} else {
+		cs.add("nbf", statusOK, "")
+	}
+	if iat := jt.IssuedAt(); !iat.IsZero() && now.Before(iat) {
+		cs.add("iat", statusFail, "issued %s; check the clock of this host and of the issuer", relative(iat, now))
+	} else {
+		cs.add("iat", statusOK, "")
+	}
+
+	switch {
+	case e.issuer == "":
+		cs.add("iss", statusSkip, "no expected issuer: give -issuer")
+	case jt.Issuer() != e.issuer:
+		cs.add("iss", statusFail, "%q, want %q", jt.Issuer(), e.issuer)
+	default:
+		cs.add("iss", statusOK, "%s", jt.Issuer())
+	}
+
+	aud := jt.Audience()
+	switch {
+	case e.audience == "":
+		cs.add("aud", statusSkip, "no expected audience: give -audience")
+	case contains(aud, e.audience):
+		cs.add("aud", statusOK, "%s", e.audience)
+	default:
+		detail := fmt.Sprintf("%q, want %q", aud, e.audience)
+		if _, ok := jt.Get("client_id"); ok && len(aud) == 0 {
+			detail += "; access tokens have client_id instead of aud"
+		}
+		cs.add("aud", statusFail, "%s", detail)
+	}
+
+	v, _ := jt.Get("token_use")
+	use, _ := v.(string)
+	switch {
+	case use == tokenUse:
+		cs.add("token_use", statusOK, "%s", use)
+	case use == "access" && tokenUse == "id":
+		cs.add("token_use", statusFail, "%q, want %q; send the ID token, not the access token", use, tokenUse)
+	default:
+		cs.add("token_use", statusFail, "%q, want %q", use, tokenUse)
+	}
+}
+
+// readToken 引数、引数がなければ標準入力からトークンを読み込みます
+func readToken(arg string) (string, error) {
+	if arg != "" && arg != "-" {
+		return strings.TrimSpace(arg), nil
+	}
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return "", errors.WithStack(fmt.Errorf("no token given"))
+	}
+	return s, nil
+}
+
+// decodeSegment Base64URLのセグメントを整形したJSONにします
+func decodeSegment(seg string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// printTimes 日時のクレームを読める形で出力します
+func printTimes(w io.Writer, jt jwt.Token, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "times:")
+	for _, c := range []struct {
+		name string
+		t    time.Time
+	}{
+		{jwt.IssuedAtKey, jt.IssuedAt()},
+		{jwt.NotBeforeKey, jt.NotBefore()},
+		{jwt.ExpirationKey, jt.Expiration()},
+	} {
+		if c.t.IsZero() {
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", c.name, c.t.Local().Format(time.RFC3339), relative(c.t, now))
+	}
+	fmt.Fprintf(tw, "  now\t%s\t\n", now.Local().Format(time.RFC3339))
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// loadKeySet 検証鍵を読み込み、読み込み元と合わせて返します（検証鍵が分からない場合はnil）
+func loadKeySet(ctx context.Context, e expectation) (jwk.Set, string, error) {
+	switch {
+	case e.keyFile != "":
+		keyPEM, err := ioutil.ReadFile(e.keyFile)
+		if err != nil {
+			return nil, e.keyFile, errors.WithStack(err)
+		}
+		ti, err := token.NewLocalIssuer(keyPEM, e.issuer, e.audience, time.Hour)
+		if err != nil {
+			return nil, e.keyFile, err
+		}
+		b, err := ti.PublicJWKS()
+		if err != nil {
+			return nil, e.keyFile, err
+		}
+		set, err := jwk.Parse(b)
+		return set, e.keyFile, errors.WithStack(err)
+	case strings.HasPrefix(e.jwks, "https://"), strings.HasPrefix(e.jwks, "http://"):
+		set, err := jwk.Fetch(ctx, e.jwks)
+		if err != nil {
+			return nil, e.jwks, errors.Wrapf(err, "fetch %s", e.jwks)
+		}
+		return set, e.jwks, nil
+	case e.jwks != "":
+		set, err := jwk.ReadFile(e.jwks)
+		if err != nil {
+			return nil, e.jwks, errors.Wrapf(err, "read %s", e.jwks)
+		}
+		return set, e.jwks, nil
+	default:
+		return nil, "", nil
+	}
+}
+
+func keyIDs(set jwk.Set) []string {
+	ids := make([]string, 0, set.Len())
+	for i := 0; i < set.Len(); i++ {
+		k, _ := set.Get(i)
+		ids = append(ids, k.KeyID())
+	}
+	return ids
+}
+
+// relative 現在からの相対的な時間を返します
+func relative(t, now time.Time) string {
+	d := t.Sub(now).Round(time.Second)
+	if d < 0 {
+		return (-d).String() + " ago"
+	}
+	return "in " + d.String()
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `usage: tokentool <command> [flags] [args]
+
+commands:
+  decode [token]   show the header and claims of an ID token and which check
+                   of ValidateJWT fails (reads the token from stdin if omitted)
+  mint             sign a test ID token with the local issuer key
+
+Run "tokentool <command> -h" for the flags of a command.
+The issuer, audience and keys are taken from the config of the server
+(AUTH_BACKEND, COGNITO_* or LOCAL_JWT_*; environment, .env or -config)
+unless given with flags.
+`
+
+// commands サブコマンド（結果はoutに出力する）
+var commands = map[string]func(ctx context.Context, args []string, out io.Writer) error{
+	"decode": runDecode,
+	"mint":   runMint,
+}
+
+// IDトークンの検証に失敗する原因の調査、結合テスト用のトークンの発行を行うコマンド
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	err := run(ctx, os.Args[2:], os.Stdout)
+	if err == errInvalidToken {
+		// 失敗した検査は出力済み
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
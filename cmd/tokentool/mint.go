@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+)
+
+// runMint ローカルの発行者の鍵でテスト用のIDトークンを発行します
+func runMint(_ context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("mint", flag.ExitOnError)
+	var cf configFlags
+	cf.register(fs)
+	keyFile := fs.String("key", "", "RSA private key (PEM) of the issuer (LOCAL_JWT_KEY_FILE if empty)")
+	issuer := fs.String("issuer", "", "iss (LOCAL_JWT_ISSUER if empty)")
+	audience := fs.String("audience", "", "aud (LOCAL_JWT_AUDIENCE if empty)")
+	ttl := fs.Duration("ttl", 0, "lifetime, negative for an expired token (LOCAL_JWT_TTL if 0)")
+	sub := fs.String("sub", "", "sub of the user")
+	email := fs.String("email", "", "email of the user")
+	groups := fs.String("groups", "", "comma separated groups")
+	originJTI := fs.String("origin-jti", "", "jti of the refresh token the ID token is derived from")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tokentool mint [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 || *sub == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg, err := cf.load()
+	if err != nil {
+		return err
+	}
+	lj := cfg.LocalJWT
+	if *keyFile != "" {
+		lj.KeyFile = *keyFile
+	}
+	if *issuer != "" {
+		lj.Issuer = *issuer
+	}
+	if *audience != "" {
+		lj.Audience = *audience
+	}
+	if *ttl != 0 {
+		lj.TTL = *ttl
+	}
+	// 鍵を生成すると発行したトークンをサーバで検証できないため、ファイルを必須にする
+	if lj.KeyFile == "" {
+		return errors.WithStack(fmt.Errorf("missing signing key: give -key or LOCAL_JWT_KEY_FILE"))
+	}
+	if lj.Issuer == "" {
+		return errors.WithStack(fmt.Errorf("missing issuer: give -issuer or LOCAL_JWT_ISSUER"))
+	}
+
+	keyPEM, err := ioutil.ReadFile(lj.KeyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ti, err := token.NewLocalIssuer(keyPEM, lj.Issuer, lj.Audience, lj.TTL)
+	if err != nil {
+		return err
+	}
+	c := &model.Claims{Sub: *sub, Email: *email, OriginJTI: *originJTI}
+	if *groups != "" {
+		c.Groups = strings.Split(*groups, ",")
+	}
+	idToken, err := ti.IssueIDToken(c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, idToken)
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+)
+
+const (
+	testIssuer   = "http://localhost:3000"
+	testAudience = "gin-cognito-sample"
+)
+
+// writeTestKey 署名鍵のPEMファイルを作り、そのパスを返します
+func writeTestKey(t *testing.T) string {
+	t.Helper()
+	keyPEM, err := token.GenerateKeyPEM()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(path, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mint runMintで発行したトークンを返します
+func mint(t *testing.T, keyFile string, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	args = append([]string{"-backend", "sql", "-key", keyFile, "-issuer", testIssuer, "-audience", testAudience}, args...)
+	if err := runMint(context.Background(), args, &out); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// decode runDecodeの出力とエラーを返します
+func decode(t *testing.T, raw string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	args = append(append([]string{"-backend", "sql"}, args...), raw)
+	err := runDecode(context.Background(), args, &out)
+	return out.String(), err
+}
+
+// checkStatus decodeの出力から検査の結果を返します
+func checkStatus(output, name string) string {
+	m := regexp.MustCompile(`(?m)^  (\S+)\s+` + regexp.QuoteMeta(name) + `\b`).FindStringSubmatch(output)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+func TestMintRoundTrip(t *testing.T) {
+	keyFile := writeTestKey(t)
+	before := time.Now().Truncate(time.Second)
+	raw := mint(t, keyFile, "-ttl", "90m", "-sub", "sub-1", "-email", "taro@example.com", "-groups", "admin,staff", "-origin-jti", "rt-1")
+	after := time.Now()
+
+	// サーバと同じ検証で受け付けられること
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti, err := token.NewLocalIssuer(keyPEM, testIssuer, testAudience, time.Hour)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	c, err := ti.ValidateJWT(raw)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if c.Sub != "sub-1" || c.Email != "taro@example.com" || c.OriginJTI != "rt-1" || !reflect.DeepEqual(c.Groups, []string{"admin", "staff"}) || c.JTI == "" {
+		t.Errorf("claims = %+v", c)
+	}
+	if c.IssuedAt.Before(before) || c.IssuedAt.After(after) {
+		t.Errorf("iat = %v, want between %v and %v", c.IssuedAt, before, after)
+	}
+	if d := c.ExpiresAt.Sub(c.IssuedAt); d != 90*time.Minute {
+		t.Errorf("exp - iat = %v, want -ttl 90m", d)
+	}
+
+	jt, err := jwt.ParseInsecure([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jt.Issuer() != testIssuer || !reflect.DeepEqual(jt.Audience(), []string{testAudience}) {
+		t.Errorf("iss %q, aud %v", jt.Issuer(), jt.Audience())
+	}
+	if use, _ := jt.Get("token_use"); use != "id" {
+		t.Errorf("token_use = %v, want id", use)
+	}
+
+	output, err := decode(t, raw, "-key", keyFile, "-issuer", testIssuer, "-audience", testAudience)
+	if err != nil {
+		t.Fatalf("%+v\n%s", err, output)
+	}
+	for _, name := range []string{"format", "kid", "alg", "signature", "exp", "nbf", "iat", "iss", "aud", "token_use"} {
+		if got := checkStatus(output, name); got != statusOK {
+			t.Errorf("check %s = %q, want %s\n%s", name, got, statusOK, output)
+		}
+	}
+	for _, want := range []string{`"sub": "sub-1"`, `"email": "taro@example.com"`, "ValidateJWT: ok"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q\n%s", want, output)
+		}
+	}
+}
+
+// 公開鍵のJWKSファイルでも検証できること
+func TestDecodeWithJWKSFile(t *testing.T) {
+	keyFile := writeTestKey(t)
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti, err := token.NewLocalIssuer(keyPEM, testIssuer, testAudience, time.Hour)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	jwks, err := ti.PublicJWKS()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(jwksFile, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+	raw := mint(t, keyFile, "-ttl", "5m", "-sub", "sub-1")
+	if output, err := decode(t, raw, "-jwks", jwksFile, "-issuer", testIssuer, "-audience", testAudience); err != nil {
+		t.Fatalf("%+v\n%s", err, output)
+	}
+}
+
+func TestDecodeFailures(t *testing.T) {
+	keyFile, otherKeyFile := writeTestKey(t), writeTestKey(t)
+	valid := mint(t, keyFile, "-ttl", "5m", "-sub", "sub-1")
+	tests := []struct {
+		name string
+		raw  string
+		args []string
+		// wantFail 失敗する検査
+		wantFail string
+	}{
+		{"expired", mint(t, keyFile, "-ttl", "-1m", "-sub", "sub-1"), nil, "exp"},
+		{"other issuer", valid, []string{"-issuer", "https://issuer.example.com"}, "iss"},
+		{"other audience", valid, []string{"-audience", "other-client"}, "aud"},
+		{"signed with another key", valid, []string{"-key", otherKeyFile}, "kid"},
+		{"access token expected", valid, []string{"-token-use", "access"}, "token_use"},
+		{"bearer prefix", "Bearer " + valid, nil, "format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-key", keyFile, "-issuer", testIssuer, "-audience", testAudience}, tt.args...)
+			output, err := decode(t, tt.raw, args...)
+			if err != errInvalidToken {
+				t.Fatalf("err = %v, want %v\n%s", err, errInvalidToken, output)
+			}
+			if got := checkStatus(output, tt.wantFail); got != statusFail {
+				t.Errorf("check %s = %q, want %s\n%s", tt.wantFail, got, statusFail, output)
+			}
+		})
+	}
+}
+
+// 改ざんしたトークンは署名の検査で失敗すること
+func TestDecodeTampered(t *testing.T) {
+	keyFile := writeTestKey(t)
+	parts := strings.Split(mint(t, keyFile, "-ttl", "5m", "-sub", "sub-1"), ".")
+	other := strings.Split(mint(t, keyFile, "-ttl", "5m", "-sub", "sub-2"), ".")
+	raw := strings.Join([]string{parts[0], other[1], parts[2]}, ".")
+	output, err := decode(t, raw, "-key", keyFile, "-issuer", testIssuer, "-audience", testAudience)
+	if err != errInvalidToken {
+		t.Fatalf("err = %v, want %v\n%s", err, errInvalidToken, output)
+	}
+	if got := checkStatus(output, "signature"); got != statusFail {
+		t.Errorf("check signature = %q, want %s\n%s", got, statusFail, output)
+	}
+}
+
+func TestMintRequiresKeyAndIssuer(t *testing.T) {
+	t.Setenv("LOCAL_JWT_KEY_FILE", "")
+	t.Setenv("LOCAL_JWT_ISSUER", "")
+	keyFile := writeTestKey(t)
+	for _, tt := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"-issuer", testIssuer}, "missing signing key"},
+		{[]string{"-key", keyFile}, "missing issuer"},
+	} {
+		err := runMint(context.Background(), append([]string{"-backend", "sql", "-sub", "sub-1"}, tt.args...), new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: err = %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	_ "github.com/lib/pq"
+
+	"github.com/taniyuu/gin-cognito-sample/config"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+	awsWrapper "github.com/taniyuu/gin-cognito-sample/infrastructure/aws"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/mail"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/password"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/rdb"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+	"github.com/taniyuu/gin-cognito-sample/triggers"
+)
+
+// Cognitoのユーザプールのトリガとして動かすLambda関数
+func main() {
+	cfg := new(config.TriggersConfig)
+	if err := config.LoadInto(cfg, os.Args[1:]); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	log.Default().Printf("effective config:\n%s", config.Redact(cfg))
+
+	var mailer proxy.Mailer
+	if cfg.Mail.SMTPAddr != "" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPAddr, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		mailer = mail.NewLogMailer()
+	}
+	h := &triggers.Handler{
+		CustomAuth: &triggers.CustomAuth{
+			Methods: map[string]triggers.ChallengeMethod{
+				model.CustomAuthMethodEmailOTP: &triggers.EmailOTP{
+					Mailer:     mailer,
+					CodeLength: cfg.Passwordless.CodeLength,
+					TTL:        cfg.Passwordless.CodeTTL,
+				},
+			},
+			MaxAttempts: cfg.Passwordless.MaxAttempts,
+		},
+	}
+	if cfg.MagicLinkSecret != "" {
+		h.CustomAuth.Methods[model.CustomAuthMethodMagicLink] = &triggers.MagicLink{
+			Tokenizer: token.NewHMACMagicLinkTokenizer(cfg.MagicLinkSecret),
+		}
+	}
+	if cfg.Legacy.DSN != "" {
+		db, err := sql.Open(cfg.Legacy.Driver, cfg.Legacy.DSN)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		hasher, err := password.NewHasher(password.AlgorithmBcrypt)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		ls, err := rdb.NewSQLLegacyUserStore(db, cfg.Legacy.Query, hasher)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		h.UserMigration = &triggers.UserMigration{Store: ls}
+	}
+	templates, err := triggers.NewTemplates(cfg.Message.TemplatesDir, cfg.Message.DefaultLocale)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	h.PreSignUp = &triggers.PreSignUp{
+		AllowedDomains:     cfg.Signup.AllowedDomains,
+		AutoConfirmDomains: cfg.Signup.AutoConfirmDomains,
+	}
+	h.PostConfirmation = &triggers.PostConfirmation{
+		DefaultGroups: cfg.Signup.DefaultGroups,
+		Templates:     templates,
+		AppName:       cfg.Message.AppName,
+	}
+	if len(cfg.Signup.DefaultGroups) > 0 {
+		h.PostConfirmation.Groups = awsWrapper.NewCognitoAdminProxy(cfg.Cognito.Region, cfg.Cognito.PoolID)
+	}
+	if cfg.Signup.WelcomeEmail {
+		h.PostConfirmation.Mailer = mailer
+	}
+	h.PreAuthentication = &triggers.PreAuthentication{
+		AllowedDomains:       cfg.PreAuth.AllowedDomains,
+		RequireVerifiedEmail: cfg.PreAuth.RequireVerifiedEmail,
+		ClientIDs:            cfg.PreAuth.ClientIDs,
+	}
+	h.PreTokenGeneration, err = newPreTokenGeneration(&cfg.Token)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	h.CustomMessage = &triggers.CustomMessage{
+		Templates: templates,
+		AppName:   cfg.Message.AppName,
+	}
+	if cfg.HarnessAddr != "" {
+		log.Default().Printf("serving trigger events on %s", cfg.HarnessAddr)
+		log.Fatal(http.ListenAndServe(cfg.HarnessAddr, triggers.NewHarness(h)))
+	}
+	lambda.Start(h.Handle)
+}
+
+// newPreTokenGeneration TOKEN_*の設定からPre Token Generationトリガを生成します
+func newPreTokenGeneration(cfg *config.TokenTriggerConfig) (*triggers.PreTokenGeneration, error) {
+	claims, err := triggers.ParseClaims(cfg.Claims)
+	if err != nil {
+		return nil, err
+	}
+	// 値は属性名になる
+	attrs, err := triggers.ParseClaims(cfg.ClaimAttributes)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cfg.SuppressClaims {
+		if err := triggers.CheckClaim(c); err != nil {
+			return nil, err
+		}
+	}
+	return &triggers.PreTokenGeneration{
+		ClaimAttributes: attrs,
+		Claims:          claims,
+		Groups:          cfg.Groups,
+		SuppressClaims:  cfg.SuppressClaims,
+	}, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// result ユーザを変更するコマンドの結果
+type result struct {
+	Email  string `json:"email"`
+	Action string `json:"action"`
+	Sub    string `json:"sub,omitempty"`
+	Group  string `json:"group,omitempty"`
+}
+
+// command 共通のフラグを解析し、引数の数を確認してからfnを実行します
+func command(ctx context.Context, name, argsUsage string, nargs int, args []string,
+	setup func(fs *flag.FlagSet),
+	fn func(admin proxy.UserAdminProxy, out *printer, args []string) error,
+) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var bf backendFlags
+	bf.register(fs)
+	output := fs.String("output", formatTable, "table or json")
+	if setup != nil {
+		setup(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: usersctl %s [flags] %s\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != nargs || (*output != formatTable && *output != formatJSON) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	admin, err := bf.newAdminProxy(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(admin, &printer{os.Stdout, *output}, fs.Args())
+}
+
+func runGet(ctx context.Context, args []string) error {
+	return command(ctx, "get", "<email>", 1, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		u, err := admin.DescribeUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return out.user(u)
+	})
+}
+
+func runList(ctx context.Context, args []string) error {
+	var limit int
+	return command(ctx, "list", "", 0, args, func(fs *flag.FlagSet) {
+		fs.IntVar(&limit, "limit", 0, "maximum number of users (0 for all)")
+	}, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		var users []*model.UserRecord
+		for page := ""; ; {
+			us, next, err := admin.ListUsers(ctx, page)
+			if err != nil {
+				return err
+			}
+			users = append(users, us...)
+			if limit > 0 && len(users) >= limit {
+				users = users[:limit]
+				break
+			}
+			if next == "" {
+				break
+			}
+			page = next
+		}
+		return out.users(users)
+	})
+}
+
+// runDisable subで無効化するUserProxy.DisableUserを使います
+func runDisable(ctx context.Context, args []string) error {
+	return command(ctx, "disable", "<email>", 1, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		u, err := admin.DescribeUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		sub := u.Attributes["sub"]
+		if err := admin.DisableUser(ctx, &model.DisableUserReq{Sub: sub}); err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "disabled", Sub: sub})
+	})
+}
+
+func runEnable(ctx context.Context, args []string) error {
+	return command(ctx, "enable", "<email>", 1, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		if err := admin.EnableUser(ctx, args[0]); err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "enabled"})
+	})
+}
+
+func runDelete(ctx context.Context, args []string) error {
+	var yes bool
+	return command(ctx, "delete", "<email>", 1, args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&yes, "yes", false, "confirm the deletion")
+	}, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		if !yes {
+			return errors.WithStack(fmt.Errorf("deleting %s cannot be undone, run again with -yes", args[0]))
+		}
+		if err := admin.DeleteUser(ctx, args[0]); err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "deleted"})
+	})
+}
+
+func runResetPassword(ctx context.Context, args []string) error {
+	return command(ctx, "reset-password", "<email>", 1, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		if err := admin.ResetPassword(ctx, args[0]); err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "password reset"})
+	})
+}
+
+func runAddToGroup(ctx context.Context, args []string) error {
+	return command(ctx, "add-to-group", "<email> <group>", 2, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		if err := admin.AddUserToGroup(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "added to group", Group: args[1]})
+	})
+}
+
+func runGlobalSignout(ctx context.Context, args []string) error {
+	return command(ctx, "global-signout", "<email>", 1, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		if err := admin.GlobalSignout(ctx, args[0]); err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "signed out"})
+	})
+}
+
+func runInvite(ctx context.Context, args []string) error {
+	return command(ctx, "invite", "<email>", 1, args, nil, func(admin proxy.UserAdminProxy, out *printer, args []string) error {
+		sub, err := admin.Invite(ctx, &model.InviteReq{Email: args[0]})
+		if err != nil {
+			return err
+		}
+		return out.result(&result{Email: args[0], Action: "invited", Sub: sub})
+	})
+}
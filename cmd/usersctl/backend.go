@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/config"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+	awsWrapper "github.com/taniyuu/gin-cognito-sample/infrastructure/aws"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/mail"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/password"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/rdb"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// memorySeed memoryバックエンドに最初から入れるユーザ（passwordが空のユーザは招待に応答していない状態）
+var memorySeed = []struct {
+	email, name, password string
+	groups                []string
+}{
+	{"alice@example.com", "Alice", "Alice-Passw0rd", []string{"admins"}},
+	{"bob@example.com", "Bob", "", nil},
+}
+
+// memoryTemporaryPassword memoryバックエンドのユーザの仮パスワード
+const memoryTemporaryPassword = "Temporary-Passw0rd"
+
+// backendFlags バックエンドを選ぶ共通のフラグ
+type backendFlags struct {
+	configFile string
+	backend    string
+}
+
+func (bf *backendFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&bf.configFile, "config", "", "YAML config file")
+	fs.StringVar(&bf.backend, "backend", "", "cognito, sql or memory (AUTH_BACKEND if empty)")
+}
+
+// newAdminProxy 設定を読み込んでUserAdminProxyを生成します（-config、-backendがなければ環境変数、.envのみ）
+func (bf *backendFlags) newAdminProxy(ctx context.Context) (proxy.UserAdminProxy, error) {
+	var args []string
+	if bf.configFile != "" {
+		args = append(args, "-config", bf.configFile)
+	}
+	if bf.backend != "" {
+		args = append(args, "-auth-backend", bf.backend)
+	}
+	cfg := new(config.UsersctlConfig)
+	if err := config.LoadInto(cfg, args); err != nil {
+		return nil, err
+	}
+	if cfg.Backend == config.BackendCognito {
+		return awsWrapper.NewCognitoAdminProxy(cfg.Cognito.Region, cfg.Cognito.PoolID), nil
+	}
+
+	var mailer proxy.Mailer
+	if cfg.Mail.SMTPAddr != "" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPAddr, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		mailer = mail.NewLogMailer()
+	}
+	// IDトークンは発行しないが、SQLバックエンドの生成に必要
+	var keyPEM []byte
+	var err error
+	if cfg.LocalJWT.KeyFile != "" {
+		keyPEM, err = ioutil.ReadFile(cfg.LocalJWT.KeyFile)
+	} else {
+		keyPEM, err = token.GenerateKeyPEM()
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ti, err := token.NewLocalIssuer(keyPEM, cfg.LocalJWT.Issuer, cfg.LocalJWT.Audience, cfg.LocalJWT.TTL)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := password.NewHasher(cfg.SQL.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	driver, dsn := cfg.SQL.Driver, cfg.SQL.DSN
+	if cfg.Backend == config.BackendMemory {
+		driver, dsn = "sqlite3", ":memory:"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if cfg.Backend == config.BackendMemory {
+		// 接続毎に別のデータベースになるため、1つの接続を使い続ける
+		db.SetMaxOpenConns(1)
+	}
+	admin, err := rdb.NewSQLUserAdminProxy(ctx, db, hasher, ti, mailer, rdb.SQLUserOptions{
+		ConfirmationCodeTTL: cfg.SQL.ConfirmationCodeTTL,
+		ResetCodeTTL:        cfg.SQL.ResetCodeTTL,
+		InvitationTTL:       cfg.SQL.InvitationTTL,
+		RefreshTokenTTL:     cfg.SQL.RefreshTokenTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Backend == config.BackendMemory {
+		for _, s := range memorySeed {
+			if err := admin.ImportUser(ctx, &model.ImportUserReq{
+				Email:             s.email,
+				Attributes:        map[string]string{"name": s.name},
+				TemporaryPassword: memoryTemporaryPassword,
+			}); err != nil {
+				return nil, err
+			}
+			if s.password != "" {
+				if _, err := admin.RespondToInvitation(ctx, &model.RespondToInvitationReq{
+					Email: s.email, Name: s.name, Password: s.password, ConfirmationCode: memoryTemporaryPassword,
+				}); err != nil {
+					return nil, err
+				}
+			}
+			for _, g := range s.groups {
+				if err := admin.AddUserToGroup(ctx, s.email, g); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return admin, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// runExport 全てのユーザを属性、状態とともに書き出します
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var bf backendFlags
+	bf.register(fs)
+	format := fs.String("format", "", "csv or jsonl (by -o extension if empty)")
+	output := fs.String("o", "", "output file (stdout if empty)")
+	maxRetries := fs.Int("max-retries", 8, "retries per page on TooManyRequestsException")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: usersctl export [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	f, err := formatOf(*format, *output)
+	if err != nil {
+		return err
+	}
+	admin, err := bf.newAdminProxy(ctx)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	w := newRecordWriter(out, f)
+	n := 0
+	for page := ""; ; {
+		var users []*model.UserRecord
+		var next string
+		if err := withRetry(ctx, *maxRetries, func() error {
+			var err error
+			users, next, err = admin.ListUsers(ctx, page)
+			return err
+		}); err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := w.Write(u); err != nil {
+				return err
+			}
+		}
+		n += len(users)
+		if next == "" {
+			break
+		}
+		page = next
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Default().Printf("exported %d users", n)
+	return nil
+}
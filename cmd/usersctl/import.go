@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// importLogInterval 進捗を表示する件数の間隔
+const importLogInterval = 100
+
+// runImport 入力ファイルのユーザを作成します
+//
+// 作成済み、または既に存在したユーザは進捗ファイルに記録し、中断後の再実行では読み飛ばします。
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var bf backendFlags
+	bf.register(fs)
+	format := fs.String("format", "", "csv or jsonl (by file extension if empty)")
+	concurrency := fs.Int("concurrency", 4, "users created in parallel")
+	maxRetries := fs.Int("max-retries", 8, "retries per user on TooManyRequestsException")
+	dryRun := fs.Bool("dry-run", false, "only read and validate the file")
+	progressFile := fs.String("progress", "", "file recording imported users, to resume from (default <file>.progress)")
+	invite := fs.Bool("invite", false, "send invitation emails (suppressed by default)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: usersctl import [flags] <file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *concurrency <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	f, err := formatOf(*format, path)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	recs, err := readRecords(in, f)
+	in.Close()
+	if err != nil {
+		return err
+	}
+	if *progressFile == "" {
+		*progressFile = path + ".progress"
+	}
+	p, err := openProgress(*progressFile, *dryRun)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	pending := make([]*importRecord, 0, len(recs))
+	for _, rec := range recs {
+		if !p.isDone(rec.req.Email) {
+			rec.req.SendInvitation = *invite
+			pending = append(pending, rec)
+		}
+	}
+	log.Default().Printf("%d users in %s, %d already imported, %d to import", len(recs), path, len(recs)-len(pending), len(pending))
+	if *dryRun || len(pending) == 0 {
+		return nil
+	}
+
+	admin, err := bf.newAdminProxy(ctx)
+	if err != nil {
+		return err
+	}
+	im := &importer{admin: admin, progress: p, maxRetries: *maxRetries, total: len(pending)}
+	im.run(ctx, pending, *concurrency)
+	log.Default().Printf("created %d, already existed %d, failed %d", im.created, im.existing, im.failed)
+	if ctx.Err() != nil {
+		return errors.WithStack(fmt.Errorf("interrupted, run again with -progress %s to resume", *progressFile))
+	}
+	if im.failed > 0 {
+		return errors.WithStack(fmt.Errorf("%d users failed to import, fix them and run again to retry", im.failed))
+	}
+	return nil
+}
+
+// importer 並列にユーザを作成し、結果を集計します
+type importer struct {
+	admin      proxy.UserAdminProxy
+	progress   *progress
+	maxRetries int
+	total      int
+	// created, existing, failed, processed atomicで更新する
+	created, existing, failed, processed int64
+}
+
+// run concurrency個のワーカーで作成します（ctxがキャンセルされると、作成中のユーザを待って終了する）
+func (im *importer) run(ctx context.Context, recs []*importRecord, concurrency int) {
+	ch := make(chan *importRecord)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range ch {
+				im.importOne(ctx, rec)
+			}
+		}()
+	}
+loop:
+	for _, rec := range recs {
+		select {
+		case ch <- rec:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+}
+
+func (im *importer) importOne(ctx context.Context, rec *importRecord) {
+	err := withRetry(ctx, im.maxRetries, func() error {
+		return im.admin.ImportUser(ctx, rec.req)
+	})
+	switch {
+	case err == nil:
+		atomic.AddInt64(&im.created, 1)
+	case errors.Is(err, model.ErrUserAlreadyExists):
+		atomic.AddInt64(&im.existing, 1)
+	case ctx.Err() != nil:
+		// 中断した場合は未完了のまま残す
+		return
+	default:
+		atomic.AddInt64(&im.failed, 1)
+		log.Default().Printf("line %d %s: %v", rec.line, rec.req.Email, err)
+		return
+	}
+	if err := im.progress.markDone(rec.req.Email); err != nil {
+		log.Default().Printf("%+v", err)
+	}
+	if n := atomic.AddInt64(&im.processed, 1); n%importLogInterval == 0 {
+		log.Default().Printf("%d/%d users imported", n, im.total)
+	}
+}
+
+// progress インポート済みのメールアドレスを1行ずつ追記するファイル
+type progress struct {
+	mu   sync.Mutex
+	done map[string]bool
+	f    *os.File
+}
+
+// openProgress 記録済みのメールアドレスを読み込みます（readOnlyの場合は追記しない）
+func openProgress(path string, readOnly bool) (*progress, error) {
+	p := &progress{done: map[string]bool{}}
+	if r, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			if email := strings.TrimSpace(sc.Text()); email != "" {
+				p.done[strings.ToLower(email)] = true
+			}
+		}
+		r.Close()
+		if err := sc.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+	if readOnly {
+		return p, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	p.f = f
+	return p, nil
+}
+
+func (p *progress) isDone(email string) bool {
+	return p.done[strings.ToLower(email)]
+}
+
+func (p *progress) markDone(email string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintln(p.f, email)
+	return errors.WithStack(err)
+}
+
+func (p *progress) Close() error {
+	if p.f == nil {
+		return nil
+	}
+	return errors.WithStack(p.f.Close())
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const usage = `usage: usersctl <command> [flags] [args]
+
+commands:
+  get <email>                   show a user with attributes and groups
+  list                          list users
+  disable <email>               disable a user
+  enable <email>                enable a disabled user
+  delete -yes <email>           delete a user
+  reset-password <email>        invalidate the password and email a reset code
+  add-to-group <email> <group>  add a user to a group
+  global-signout <email>        revoke all refresh tokens of a user
+  invite <email>                create a user and email a temporary password
+  import <file>                 create users from a CSV or JSON Lines file
+  export                        write all users to a CSV or JSON Lines file
+
+Run "usersctl <command> -h" for the flags of a command.
+The backend is chosen with -backend (cognito, sql or memory) or AUTH_BACKEND,
+and configured like the server (environment, .env or -config).
+`
+
+// commands サブコマンド
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"get":            runGet,
+	"list":           runList,
+	"disable":        runDisable,
+	"enable":         runEnable,
+	"delete":         runDelete,
+	"reset-password": runResetPassword,
+	"add-to-group":   runAddToGroup,
+	"global-signout": runGlobalSignout,
+	"invite":         runInvite,
+	"import":         runImport,
+	"export":         runExport,
+}
+
+// 入出力の形式
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// ユーザの管理操作、一括インポート、エクスポートを行うコマンド
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	rand.Seed(time.Now().UnixNano())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := run(ctx, os.Args[2:]); err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+// formatOf formatが空の場合はファイルの拡張子から形式を判別します（判別できない場合はCSV）
+func formatOf(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson":
+			format = formatJSONL
+		default:
+			format = formatCSV
+		}
+	}
+	if format != formatCSV && format != formatJSONL {
+		return "", errors.WithStack(fmt.Errorf("unknown format %q", format))
+	}
+	return format, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// 管理操作の出力形式
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// userView JSONで出力するユーザ（列名はエクスポートと揃える）
+type userView struct {
+	Username   string            `json:"username"`
+	Status     string            `json:"user_status"`
+	Enabled    bool              `json:"enabled"`
+	CreatedAt  time.Time         `json:"user_create_date"`
+	UpdatedAt  time.Time         `json:"user_last_modified_date"`
+	Groups     []string          `json:"groups,omitempty"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+func newUserView(u *model.UserRecord) *userView {
+	return &userView{u.Username, u.Status, u.Enabled, u.CreatedAt.UTC(), u.UpdatedAt.UTC(), u.Groups, u.Attributes}
+}
+
+// printer コマンドの結果を表、またはJSONで出力します
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// user 表の場合は項目名と値を1行ずつ出力します
+func (p *printer) user(u *model.UserRecord) error {
+	if p.format == formatJSON {
+		return p.json(newUserView(u))
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "username\t%s\n", u.Username)
+	fmt.Fprintf(tw, "user_status\t%s\n", u.Status)
+	fmt.Fprintf(tw, "enabled\t%t\n", u.Enabled)
+	fmt.Fprintf(tw, "user_create_date\t%s\n", formatTime(u.CreatedAt))
+	fmt.Fprintf(tw, "user_last_modified_date\t%s\n", formatTime(u.UpdatedAt))
+	fmt.Fprintf(tw, "groups\t%s\n", strings.Join(u.Groups, ","))
+	names := make([]string, 0, len(u.Attributes))
+	for k := range u.Attributes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", k, u.Attributes[k])
+	}
+	return errors.WithStack(tw.Flush())
+}
+
+// users 表の場合は1ユーザを1行で出力します（JSONの場合は配列）
+func (p *printer) users(users []*model.UserRecord) error {
+	if p.format == formatJSON {
+		views := make([]*userView, 0, len(users))
+		for _, u := range users {
+			views = append(views, newUserView(u))
+		}
+		return p.json(views)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tSUB\tNAME\tSTATUS\tENABLED\tCREATED")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\n",
+			u.Username, u.Attributes["sub"], u.Attributes["name"], u.Status, u.Enabled, formatTime(u.CreatedAt))
+	}
+	return errors.WithStack(tw.Flush())
+}
+
+func (p *printer) result(r *result) error {
+	if p.format == formatJSON {
+		return p.json(r)
+	}
+	msg := r.Email + ": " + r.Action
+	if r.Group != "" {
+		msg += " " + r.Group
+	}
+	if r.Sub != "" {
+		msg += " (sub " + r.Sub + ")"
+	}
+	_, err := fmt.Fprintln(p.w, msg)
+	return errors.WithStack(err)
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(v))
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// 属性以外の列（エクスポートで出力し、インポートでは読み飛ばす）
+const (
+	colUsername  = "username"
+	colStatus    = "user_status"
+	colEnabled   = "enabled"
+	colCreatedAt = "user_create_date"
+	colUpdatedAt = "user_last_modified_date"
+)
+
+// colTemporaryPassword インポートでのみ使う列（空の場合はCognitoが生成する）
+const colTemporaryPassword = "temporary_password"
+
+// ignoredOnImport Cognitoが設定するため、インポートでは読み飛ばす列
+var ignoredOnImport = map[string]bool{
+	colUsername:  true,
+	colStatus:    true,
+	colEnabled:   true,
+	colCreatedAt: true,
+	colUpdatedAt: true,
+	"sub":        true,
+	"identities": true,
+}
+
+// maxJSONLineSize JSON Linesの1行の上限
+const maxJSONLineSize = 1024 * 1024
+
+// importRecord 入力ファイルの1ユーザ（lineはエラーの表示に使う）
+type importRecord struct {
+	line int
+	req  *model.ImportUserReq
+}
+
+// readRecords 入力ファイルを全て読み込み、メールアドレスの欠落や重複がないか検証します
+func readRecords(r io.Reader, format string) ([]*importRecord, error) {
+	var recs []*importRecord
+	add := func(line int, fields map[string]string) error {
+		rec, err := newImportRecord(line, fields)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, rec)
+		return nil
+	}
+	var err error
+	if format == formatJSONL {
+		err = readJSONL(r, add)
+	} else {
+		err = readCSV(r, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]int, len(recs))
+	for _, rec := range recs {
+		key := strings.ToLower(rec.req.Email)
+		if prev, ok := seen[key]; ok {
+			return nil, errors.WithStack(fmt.Errorf("line %d: %s is already on line %d", rec.line, rec.req.Email, prev))
+		}
+		seen[key] = rec.line
+	}
+	return recs, nil
+}
+
+// readCSV 1行目を列名として読み込みます
+func readCSV(r io.Reader, add func(line int, fields map[string]string) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return errors.Wrap(err, "read CSV header")
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		line, _ := cr.FieldPos(0)
+		fields := make(map[string]string, len(header))
+		for i, v := range row {
+			fields[header[i]] = v
+		}
+		if err := add(line, fields); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONL 1行に1つのオブジェクトを読み込みます（空行は読み飛ばす）
+func readJSONL(r io.Reader, add func(line int, fields map[string]string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxJSONLineSize)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &obj); err != nil {
+			return errors.Wrapf(err, "line %d", line)
+		}
+		fields := make(map[string]string, len(obj))
+		for k, v := range obj {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				fields[k] = v
+			case bool, float64:
+				fields[k] = fmt.Sprint(v)
+			default:
+				return errors.WithStack(fmt.Errorf("line %d: %s must be a string, number or boolean", line, k))
+			}
+		}
+		if err := add(line, fields); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(sc.Err())
+}
+
+// newImportRecord 列をユーザの属性に振り分けます（空の値は設定しない）
+//
+// 入力元でメールアドレスを確認済みとみなし、email_verifiedの列がなければtrueにします（パスワードのリセットに必要）。
+func newImportRecord(line int, fields map[string]string) (*importRecord, error) {
+	email := strings.TrimSpace(fields["email"])
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, errors.WithStack(fmt.Errorf("line %d: missing or invalid email %q", line, email))
+	}
+	req := &model.ImportUserReq{
+		Email:             email,
+		Attributes:        map[string]string{"email_verified": "true"},
+		TemporaryPassword: fields[colTemporaryPassword],
+	}
+	for k, v := range fields {
+		if k == "email" || k == colTemporaryPassword || ignoredOnImport[k] || v == "" {
+			continue
+		}
+		req.Attributes[k] = v
+	}
+	return &importRecord{line, req}, nil
+}
+
+// recordWriter エクスポートするユーザを書き出します
+type recordWriter interface {
+	Write(u *model.UserRecord) error
+	// Flush 書き出しを完了します
+	Flush() error
+}
+
+func newRecordWriter(w io.Writer, format string) recordWriter {
+	if format == formatJSONL {
+		return &jsonlWriter{json.NewEncoder(w)}
+	}
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// 1ユーザを1行のオブジェクトで書き出します（属性は列と同じ階層に置く）
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (jw *jsonlWriter) Write(u *model.UserRecord) error {
+	obj := make(map[string]interface{}, len(u.Attributes)+5)
+	for k, v := range u.Attributes {
+		obj[k] = v
+	}
+	obj[colUsername] = u.Username
+	obj[colStatus] = u.Status
+	obj[colEnabled] = u.Enabled
+	obj[colCreatedAt] = u.CreatedAt.UTC().Format(time.RFC3339)
+	obj[colUpdatedAt] = u.UpdatedAt.UTC().Format(time.RFC3339)
+	return errors.WithStack(jw.enc.Encode(obj))
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return nil
+}
+
+// 列を揃えるため、全てのユーザを保持してからFlushで書き出します
+type csvWriter struct {
+	w     *csv.Writer
+	users []*model.UserRecord
+}
+
+func (cw *csvWriter) Write(u *model.UserRecord) error {
+	cw.users = append(cw.users, u)
+	return nil
+}
+
+func (cw *csvWriter) Flush() error {
+	names := map[string]bool{}
+	for _, u := range cw.users {
+		for k := range u.Attributes {
+			names[k] = true
+		}
+	}
+	attrs := make([]string, 0, len(names))
+	for k := range names {
+		attrs = append(attrs, k)
+	}
+	sort.Strings(attrs)
+	header := append([]string{colUsername, colStatus, colEnabled, colCreatedAt, colUpdatedAt}, attrs...)
+	if err := cw.w.Write(header); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, u := range cw.users {
+		row := []string{
+			u.Username,
+			u.Status,
+			fmt.Sprint(u.Enabled),
+			u.CreatedAt.UTC().Format(time.RFC3339),
+			u.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		for _, k := range attrs {
+			row = append(row, u.Attributes[k])
+		}
+		if err := cw.w.Write(row); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	cw.w.Flush()
+	return errors.WithStack(cw.w.Error())
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// API制限による再試行の待ち時間（指数バックオフ）
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 20 * time.Second
+)
+
+// withRetry fnがmodel.ErrTooManyRequestsを返す間、最大maxRetries回まで待ってから再試行します
+func withRetry(ctx context.Context, maxRetries int, fn func() error) error {
+	for n := 0; ; n++ {
+		err := fn()
+		if !errors.Is(err, model.ErrTooManyRequests) || n >= maxRetries {
+			return err
+		}
+		t := time.NewTimer(retryDelay(n))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.WithStack(ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// retryDelay n回目（0始まり）の再試行までの待ち時間（同時に再試行が集中しないよう半分はランダムにする）
+func retryDelay(n int) time.Duration {
+	d := retryMaxDelay
+	if n < 16 && retryBaseDelay<<n < retryMaxDelay {
+		d = retryBaseDelay << n
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
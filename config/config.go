@@ -0,0 +1,673 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 認証バックエンド
+const (
+	BackendCognito = "cognito"
+	BackendSQL     = "sql"
+	BackendLDAP    = "ldap"
+	// BackendMemory サンプルのユーザを入れたメモリ上のSQLバックエンド（cmd/usersctlのみ）
+	BackendMemory = "memory"
+)
+
+// IDトークンの検証方式（空の場合はバックエンドが発行するトークンを検証する）
+const (
+	AuthorizerCognito = "cognito"
+	AuthorizerLocal   = "local"
+	AuthorizerOIDC    = "oidc"
+)
+
+// Cognitoのログインフロー（infrastructure/awsのAuthFlow*と同じ値）
+const (
+	AuthFlowUserPassword = "user_password"
+	AuthFlowUserSRP      = "user_srp"
+)
+
+// 状態を保持するストア
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// Config アプリケーション全体の設定
+//
+// 各項目は default < YAMLファイル < .env < 環境変数 < コマンドライン引数 の順に上書きされます。
+// コマンドライン引数名は環境変数名を小文字・ハイフン区切りにしたものです（COGNITO_POOL_ID → -cognito-pool-id）。
+type Config struct {
+	Backend    string           `yaml:"backend" env:"AUTH_BACKEND" default:"cognito" usage:"authentication backend (cognito, sql or ldap)"`
+	Authorizer string           `yaml:"authorizer" env:"AUTHORIZER" usage:"ID token verifier (cognito, local, or oidc to accept tokens of OIDC_ISSUERS; empty for the backend's own)"`
+	Cognito    CognitoConfig    `yaml:"cognito"`
+	SQL        SQLConfig        `yaml:"sql"`
+	LDAP       LDAPConfig       `yaml:"ldap"`
+	Legacy     LegacyConfig     `yaml:"legacy"`
+	LocalJWT   LocalJWTConfig   `yaml:"local_jwt"`
+	OIDC       OIDCConfig       `yaml:"oidc"`
+	Server     ServerConfig     `yaml:"server"`
+	Audit      AuditConfig      `yaml:"audit"`
+	Redis      RedisConfig      `yaml:"redis"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
+	Lockout    LockoutConfig    `yaml:"lockout"`
+	Revocation RevocationConfig `yaml:"revocation"`
+	Device     DeviceConfig     `yaml:"device"`
+	MagicLink  MagicLinkConfig  `yaml:"magic_link"`
+	OAuth      OAuthConfig      `yaml:"oauth"`
+	SCIM       SCIMConfig       `yaml:"scim"`
+	Webhook    WebhookConfig    `yaml:"webhook"`
+	Mail       MailConfig       `yaml:"mail"`
+	Password   PasswordConfig   `yaml:"password"`
+	// AdminGroups 管理エンドポイントを使えるユーザのグループ（IDトークンのcognito:groups等）
+	AdminGroups []string `yaml:"admin_groups" env:"ADMIN_GROUPS" default:"admin" usage:"groups whose members may use the admin routes"`
+	// EnumerationProtection サインアップ等でアカウントの有無が分からないようにする
+	EnumerationProtection  bool          `yaml:"enumeration_protection" env:"ENUMERATION_PROTECTION" default:"false"`
+	EnumerationMinResponse time.Duration `yaml:"enumeration_min_response" env:"ENUMERATION_MIN_RESPONSE_TIME" default:"1500ms"`
+}
+
+// CognitoConfig Amazon Cognitoの設定
+type CognitoConfig struct {
+	Region       string `yaml:"region" env:"COGNITO_REGION"`
+	PoolID       string `yaml:"pool_id" env:"COGNITO_POOL_ID"`
+	ClientID     string `yaml:"client_id" env:"COGNITO_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"COGNITO_CLIENT_SECRET" secret:"true"`
+	AuthFlow     string `yaml:"auth_flow" env:"COGNITO_AUTH_FLOW" default:"user_password" usage:"sign-in flow (user_password or user_srp)"`
+}
+
+// SQLConfig AUTH_BACKEND=sqlでアカウントを保存するデータベースの設定
+type SQLConfig struct {
+	Driver       string `yaml:"driver" env:"SQL_DRIVER" default:"sqlite3" usage:"postgres or sqlite3"`
+	DSN          string `yaml:"dsn" env:"SQL_DSN" secret:"true"`
+	PasswordHash string `yaml:"password_hash" env:"SQL_PASSWORD_HASH" default:"argon2id" usage:"bcrypt or argon2id (existing hashes of either keep working)"`
+	// ConfirmationCodeTTL, ResetCodeTTL, InvitationTTL Cognitoの既定値に合わせる
+	ConfirmationCodeTTL time.Duration `yaml:"confirmation_code_ttl" env:"SQL_CONFIRMATION_CODE_TTL" default:"24h"`
+	ResetCodeTTL        time.Duration `yaml:"reset_code_ttl" env:"SQL_RESET_CODE_TTL" default:"1h"`
+	InvitationTTL       time.Duration `yaml:"invitation_ttl" env:"SQL_INVITATION_TTL" default:"168h"`
+	RefreshTokenTTL     time.Duration `yaml:"refresh_token_ttl" env:"SQL_REFRESH_TOKEN_TTL" default:"720h"`
+}
+
+// LDAPConfig AUTH_BACKEND=ldapで認証に使うディレクトリの設定
+type LDAPConfig struct {
+	URL      string `yaml:"url" env:"LDAP_URL" usage:"ldap://host:389 or ldaps://host:636"`
+	StartTLS bool   `yaml:"start_tls" env:"LDAP_START_TLS" default:"false"`
+	// BindDN, BindPassword エントリの検索に使うサービスアカウント（空の場合は匿名で検索する）
+	BindDN       string `yaml:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD" secret:"true"`
+	BaseDN       string `yaml:"base_dn" env:"LDAP_BASE_DN"`
+	UserFilter   string `yaml:"user_filter" env:"LDAP_USER_FILTER" default:"(&(objectClass=person)(mail=%s))" usage:"%s is replaced with the escaped email"`
+	// SubAttribute Active DirectoryではobjectGUIDにする
+	SubAttribute   string        `yaml:"sub_attribute" env:"LDAP_SUB_ATTRIBUTE" default:"entryUUID"`
+	EmailAttribute string        `yaml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE" default:"mail"`
+	NameAttribute  string        `yaml:"name_attribute" env:"LDAP_NAME_ATTRIBUTE" default:"displayName"`
+	GroupAttribute string        `yaml:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE" default:"memberOf"`
+	Timeout        time.Duration `yaml:"timeout" env:"LDAP_TIMEOUT" default:"5s"`
+}
+
+// LegacyConfig Cognitoへ移行する前のシステムのアカウントを参照するデータベースの設定（DSNが空の場合は移行しない）
+type LegacyConfig struct {
+	Driver string `yaml:"driver" env:"LEGACY_SQL_DRIVER" default:"postgres" usage:"postgres or sqlite3 (postgres only for cmd/triggers)"`
+	DSN    string `yaml:"dsn" env:"LEGACY_SQL_DSN" secret:"true"`
+	// Query 小文字にしたメールアドレスを$1で受け取り、email、name、password_hash（bcrypt、argon2id）の順に返す
+	Query string `yaml:"query" env:"LEGACY_SQL_QUERY" default:"SELECT email, name, password_hash FROM users WHERE lower(email) = $1" usage:"further columns are copied as user attributes by column name"`
+}
+
+// LocalJWTConfig AUTH_BACKEND=sql、ldapでIDトークンを発行する鍵などの設定
+type LocalJWTConfig struct {
+	// KeyFile PEM形式のRSA秘密鍵（空の場合は起動毎に生成するため、再起動で発行済みのトークンが無効になる）
+	KeyFile  string        `yaml:"key_file" env:"LOCAL_JWT_KEY_FILE" usage:"RSA private key (PEM) to sign ID tokens"`
+	Issuer   string        `yaml:"issuer" env:"LOCAL_JWT_ISSUER" usage:"iss of ID tokens, e.g. https://auth.example.com"`
+	Audience string        `yaml:"audience" env:"LOCAL_JWT_AUDIENCE" default:"gin-cognito-sample"`
+	TTL      time.Duration `yaml:"ttl" env:"LOCAL_JWT_TTL" default:"1h"`
+}
+
+// OIDCConfig OIDCディスカバリによるIDトークンの検証の設定
+//
+// 発行者ごとの設定（issuer=value をカンマ区切り）が無い発行者には、共通の設定を使う
+type OIDCConfig struct {
+	// Issuers 信頼する発行者（issクレームと完全一致させる、末尾のスラッシュも含む）
+	Issuers   []string `yaml:"issuers" env:"OIDC_ISSUERS" usage:"trusted issuers, e.g. https://example.auth0.com/,https://keycloak.example.com/realms/app"`
+	Audiences []string `yaml:"audiences" env:"OIDC_AUDIENCES" usage:"accepted aud values (any of them) of issuers without OIDC_ISSUER_AUDIENCES"`
+	// SubClaim, EmailClaim, GroupsClaim 読み替えるクレーム名（入れ子はドット区切り、例: realm_access.roles）
+	SubClaim    string `yaml:"sub_claim" env:"OIDC_SUB_CLAIM" default:"sub"`
+	EmailClaim  string `yaml:"email_claim" env:"OIDC_EMAIL_CLAIM" default:"email"`
+	GroupsClaim string `yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM" default:"groups"`
+	// IssuerAudiences 発行者ごとのaud（同じ発行者を繰り返して複数指定できる）
+	IssuerAudiences    []string `yaml:"issuer_audiences" env:"OIDC_ISSUER_AUDIENCES" usage:"issuer=aud pairs; replace OIDC_AUDIENCES for that issuer"`
+	IssuerSubClaims    []string `yaml:"issuer_sub_claims" env:"OIDC_ISSUER_SUB_CLAIMS" usage:"issuer=claim pairs overriding OIDC_SUB_CLAIM"`
+	IssuerEmailClaims  []string `yaml:"issuer_email_claims" env:"OIDC_ISSUER_EMAIL_CLAIMS" usage:"issuer=claim pairs overriding OIDC_EMAIL_CLAIM"`
+	IssuerGroupsClaims []string `yaml:"issuer_groups_claims" env:"OIDC_ISSUER_GROUPS_CLAIMS" usage:"issuer=claim pairs overriding OIDC_GROUPS_CLAIM"`
+}
+
+// OIDCIssuerConfig 共通の設定で補った発行者ごとの設定
+type OIDCIssuerConfig struct {
+	Issuer      string
+	Audiences   []string
+	SubClaim    string
+	EmailClaim  string
+	GroupsClaim string
+}
+
+// IssuerConfigs OIDC_ISSUERSの順に発行者ごとの設定を返します
+func (c *OIDCConfig) IssuerConfigs() ([]OIDCIssuerConfig, error) {
+	audiences, err := c.issuerPairs("OIDC_ISSUER_AUDIENCES", c.IssuerAudiences)
+	if err != nil {
+		return nil, err
+	}
+	subClaims, err := c.issuerPairs("OIDC_ISSUER_SUB_CLAIMS", c.IssuerSubClaims)
+	if err != nil {
+		return nil, err
+	}
+	emailClaims, err := c.issuerPairs("OIDC_ISSUER_EMAIL_CLAIMS", c.IssuerEmailClaims)
+	if err != nil {
+		return nil, err
+	}
+	groupsClaims, err := c.issuerPairs("OIDC_ISSUER_GROUPS_CLAIMS", c.IssuerGroupsClaims)
+	if err != nil {
+		return nil, err
+	}
+	last := func(values []string, fallback string) string {
+		if len(values) == 0 {
+			return fallback
+		}
+		return values[len(values)-1]
+	}
+	ics := make([]OIDCIssuerConfig, 0, len(c.Issuers))
+	for _, iss := range c.Issuers {
+		ic := OIDCIssuerConfig{
+			Issuer:      iss,
+			Audiences:   audiences[iss],
+			SubClaim:    last(subClaims[iss], c.SubClaim),
+			EmailClaim:  last(emailClaims[iss], c.EmailClaim),
+			GroupsClaim: last(groupsClaims[iss], c.GroupsClaim),
+		}
+		if len(ic.Audiences) == 0 {
+			ic.Audiences = c.Audiences
+		}
+		ics = append(ics, ic)
+	}
+	return ics, nil
+}
+
+// issuerPairs issuer=value の一覧を発行者ごとにまとめます
+//
+// 発行者のURLに = が含まれる場合に備えて、最後の = で分ける
+func (c *OIDCConfig) issuerPairs(env string, pairs []string) (map[string][]string, error) {
+	m := map[string][]string{}
+	for _, p := range pairs {
+		i := strings.LastIndex(p, "=")
+		if i <= 0 || i == len(p)-1 {
+			return nil, fmt.Errorf("invalid %s entry %q (issuer=value)", env, p)
+		}
+		iss, v := p[:i], p[i+1:]
+		if !contains(c.Issuers, iss) {
+			return nil, fmt.Errorf("%s entry %q names an issuer not in OIDC_ISSUERS", env, p)
+		}
+		m[iss] = append(m[iss], v)
+	}
+	return m, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerConfig HTTPサーバの設定
+type ServerConfig struct {
+	Addr            string        `yaml:"addr" env:"SERVER_ADDR" default:":3000"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"10s"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"120s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"20s"`
+	// ReadinessCacheTTL /readyzの結果を使い回す期間（0で毎回確認する）
+	ReadinessCacheTTL time.Duration `yaml:"readiness_cache_ttl" env:"SERVER_READINESS_CACHE_TTL" default:"5s"`
+	TLSCertFile       string        `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	// TLSReloadInterval 証明書ファイルの更新確認間隔（0で無効）
+	TLSReloadInterval time.Duration `yaml:"tls_reload_interval" env:"TLS_RELOAD_INTERVAL" default:"30s"`
+	TLSClientCAFile   string        `yaml:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"verify client certificates (mTLS) against this CA bundle"`
+	TLSClientAuth     string        `yaml:"tls_client_auth" env:"TLS_CLIENT_AUTH" default:"optional" usage:"optional or require"`
+	// ServiceIdentities クライアント証明書のCN/SANとサービスIDの対応（name=identity をカンマ区切り）
+	ServiceIdentities []string `yaml:"service_identities" env:"MTLS_SERVICE_IDENTITIES"`
+	// TrustedProxies X-Forwarded-For、X-Real-IPを信頼するプロキシ（空の場合は接続元のIPをクライアントIPとする）
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"IPs or CIDRs of reverse proxies whose X-Forwarded-For is trusted (none if empty)"`
+}
+
+// AuditConfig 監査ログの設定
+type AuditConfig struct {
+	LogFile  string `yaml:"log_file" env:"AUDIT_LOG_FILE" usage:"JSON Lines audit log file (stdout if empty)"`
+	DBDriver string `yaml:"db_driver" env:"AUDIT_DB_DRIVER" usage:"write audit events to SQL (postgres, sqlite3)"`
+	DBDSN    string `yaml:"db_dsn" env:"AUDIT_DB_DSN" secret:"true"`
+}
+
+// RedisConfig 共有ストアとして使うRedis（互換サーバ）の設定
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `yaml:"db" env:"REDIS_DB"`
+}
+
+// RateLimitConfig 認証エンドポイントのレート制限の設定（PER_MINUTEが0で無効）
+type RateLimitConfig struct {
+	Store            string  `yaml:"store" env:"RATE_LIMIT_STORE" default:"memory" usage:"memory or redis"`
+	IPPerMinute      float64 `yaml:"ip_per_minute" env:"RATE_LIMIT_IP_PER_MINUTE" default:"30"`
+	IPBurst          int     `yaml:"ip_burst" env:"RATE_LIMIT_IP_BURST" default:"10"`
+	AccountPerMinute float64 `yaml:"account_per_minute" env:"RATE_LIMIT_ACCOUNT_PER_MINUTE" default:"5"`
+	AccountBurst     int     `yaml:"account_burst" env:"RATE_LIMIT_ACCOUNT_BURST" default:"5"`
+}
+
+// LockoutConfig 認証失敗によるロックアウトの設定（MAX_FAILURESが0で無効）
+type LockoutConfig struct {
+	Store              string        `yaml:"store" env:"LOCKOUT_STORE" default:"memory" usage:"memory or redis"`
+	AccountMaxFailures int           `yaml:"account_max_failures" env:"LOCKOUT_ACCOUNT_MAX_FAILURES" default:"5"`
+	IPMaxFailures      int           `yaml:"ip_max_failures" env:"LOCKOUT_IP_MAX_FAILURES" default:"50"`
+	BaseDelay          time.Duration `yaml:"base_delay" env:"LOCKOUT_BASE_DELAY" default:"1s"`
+	MaxDelay           time.Duration `yaml:"max_delay" env:"LOCKOUT_MAX_DELAY" default:"30s"`
+	Duration           time.Duration `yaml:"duration" env:"LOCKOUT_DURATION" default:"15m"`
+	ResetAfter         time.Duration `yaml:"reset_after" env:"LOCKOUT_RESET_AFTER" default:"1h"`
+}
+
+// RevocationConfig IDトークンの失効の設定
+type RevocationConfig struct {
+	Store string `yaml:"store" env:"REVOCATION_STORE" default:"memory" usage:"memory or redis"`
+	// TokenTTL ユーザプールのIDトークンの有効期間以上にする（失効の記録をこの期間保持する）
+	TokenTTL time.Duration `yaml:"token_ttl" env:"REVOCATION_TOKEN_TTL" default:"24h"`
+}
+
+// DeviceConfig デバイス（セッション）の最終利用状況の記録の設定
+type DeviceConfig struct {
+	ActivityStore string `yaml:"activity_store" env:"DEVICE_ACTIVITY_STORE" default:"memory" usage:"memory or redis"`
+	// ActivityTTL 最後の利用からこの期間で記録を消す（ユーザプールのリフレッシュトークンの有効期間に揃える）
+	ActivityTTL time.Duration `yaml:"activity_ttl" env:"DEVICE_ACTIVITY_TTL" default:"720h"`
+}
+
+// MagicLinkConfig メールのリンクによるログインの設定（SECRETが空の場合は無効）
+type MagicLinkConfig struct {
+	// Secret リンクのトークンの署名鍵（トリガと同じ値にする）
+	Secret string `yaml:"secret" env:"MAGIC_LINK_SECRET" secret:"true"`
+	// URL メールに載せるリンク（tokenクエリを付ける）
+	URL         string        `yaml:"url" env:"MAGIC_LINK_URL" usage:"link sent by email, e.g. https://example.com/magic-link/callback"`
+	TTL         time.Duration `yaml:"ttl" env:"MAGIC_LINK_TTL" default:"15m"`
+	ReplayStore string        `yaml:"replay_store" env:"MAGIC_LINK_REPLAY_STORE" default:"memory" usage:"memory or redis"`
+}
+
+// OAuthConfig ホストされたUIによる認可コードフローの設定（DOMAINが空の場合は無効）
+type OAuthConfig struct {
+	// Domain ユーザプールのドメイン（https://<prefix>.auth.<region>.amazoncognito.com）
+	Domain      string   `yaml:"domain" env:"OAUTH_DOMAIN" usage:"user pool domain of the hosted UI"`
+	RedirectURI string   `yaml:"redirect_uri" env:"OAUTH_REDIRECT_URI" usage:"callback URL registered on the app client, e.g. https://example.com/oauth/callback"`
+	Scopes      []string `yaml:"scopes" env:"OAUTH_SCOPES" default:"openid,email,profile"`
+	// IdentityProviders identity_providerで指定できるIdP名（空の場合は制限しない）
+	IdentityProviders []string      `yaml:"identity_providers" env:"OAUTH_IDENTITY_PROVIDERS"`
+	StateTTL          time.Duration `yaml:"state_ttl" env:"OAUTH_STATE_TTL" default:"10m"`
+	StateStore        string        `yaml:"state_store" env:"OAUTH_STATE_STORE" default:"memory" usage:"memory or redis"`
+}
+
+// SCIMConfig IdPからのSCIMによるプロビジョニングの設定（TOKENが空の場合は無効）
+type SCIMConfig struct {
+	// Token IdPに登録するベアラートークン
+	Token string `yaml:"token" env:"SCIM_TOKEN" secret:"true" usage:"bearer token of the identity provider (32 characters or more)"`
+	// BaseURL IdPから見た/scim/v2のURL（meta.locationに使う）
+	BaseURL        string `yaml:"base_url" env:"SCIM_BASE_URL" usage:"e.g. https://auth.example.com/scim/v2"`
+	SendInvitation bool   `yaml:"send_invitation" env:"SCIM_SEND_INVITATION" default:"true" usage:"email a temporary password to provisioned users"`
+}
+
+// WebhookConfig ユーザのライフサイクルのイベントを通知するWebhookの設定（ENDPOINTSが空の場合は無効）
+type WebhookConfig struct {
+	// Endpoints, Secrets, Events 配信先毎の値（name=value をカンマ区切り、Eventsは名前毎に繰り返す）
+	Endpoints []string `yaml:"endpoints" env:"WEBHOOK_ENDPOINTS" usage:"name=URL per endpoint, e.g. crm=https://crm.example.com/hooks"`
+	Secrets   []string `yaml:"secrets" env:"WEBHOOK_SECRETS" secret:"true" usage:"name=secret per endpoint to sign deliveries with HMAC-SHA256"`
+	Events    []string `yaml:"events" env:"WEBHOOK_EVENTS" usage:"name=event pairs, e.g. crm=user.signed_up,crm=user.deleted (all events if an endpoint has none)"`
+	// OutboxDriver, OutboxDSN 配信前のイベントを保存するデータベース（再起動しても配信を失わない）
+	OutboxDriver string        `yaml:"outbox_driver" env:"WEBHOOK_OUTBOX_DRIVER" default:"sqlite3" usage:"postgres or sqlite3"`
+	OutboxDSN    string        `yaml:"outbox_dsn" env:"WEBHOOK_OUTBOX_DSN" secret:"true"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"12"`
+	BaseDelay    time.Duration `yaml:"base_delay" env:"WEBHOOK_BASE_DELAY" default:"10s" usage:"delay after the first failure, doubled on each retry"`
+	MaxDelay     time.Duration `yaml:"max_delay" env:"WEBHOOK_MAX_DELAY" default:"1h"`
+	Timeout      time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" default:"10s"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"WEBHOOK_POLL_INTERVAL" default:"5s"`
+}
+
+// MailConfig 通知メールの設定（SMTP_ADDRが空の場合はログに出力する）
+type MailConfig struct {
+	SMTPAddr     string `yaml:"smtp_addr" env:"MAIL_SMTP_ADDR"`
+	SMTPUsername string `yaml:"smtp_username" env:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"MAIL_SMTP_PASSWORD" secret:"true"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+}
+
+// PasswordConfig パスワードポリシーの設定（Cognitoのユーザプールの設定と揃えてください）
+type PasswordConfig struct {
+	MinLength        int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" default:"8"`
+	MaxLength        int    `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" default:"256"`
+	RequireUpper     bool   `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER" default:"true"`
+	RequireLower     bool   `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER" default:"true"`
+	RequireDigit     bool   `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT" default:"true"`
+	RequireSymbol    bool   `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL" default:"true"`
+	DisallowPersonal bool   `yaml:"disallow_personal" env:"PASSWORD_DISALLOW_PERSONAL" default:"true"`
+	BreachedFile     string `yaml:"breached_file" env:"PASSWORD_BREACHED_FILE" usage:"SHA-1 breached password list (file or directory of prefix range files)"`
+}
+
+// Validate 選択されたバックエンドに必要な項目が揃っているか検証します
+func (c *Config) Validate() error {
+	var missing []string
+	require := func(env, v string) {
+		if v != "" {
+			return
+		}
+		for _, m := range missing {
+			if m == env {
+				return
+			}
+		}
+		missing = append(missing, env)
+	}
+	switch c.Backend {
+	case BackendCognito:
+		require("COGNITO_REGION", c.Cognito.Region)
+		require("COGNITO_POOL_ID", c.Cognito.PoolID)
+		require("COGNITO_CLIENT_ID", c.Cognito.ClientID)
+		require("COGNITO_CLIENT_SECRET", c.Cognito.ClientSecret)
+		if c.Cognito.AuthFlow != AuthFlowUserPassword && c.Cognito.AuthFlow != AuthFlowUserSRP {
+			return fmt.Errorf("unknown COGNITO_AUTH_FLOW %q", c.Cognito.AuthFlow)
+		}
+	case BackendSQL:
+		require("SQL_DSN", c.SQL.DSN)
+		require("LOCAL_JWT_ISSUER", c.LocalJWT.Issuer)
+		if c.SQL.Driver != "postgres" && c.SQL.Driver != "sqlite3" {
+			return fmt.Errorf("unknown SQL_DRIVER %q", c.SQL.Driver)
+		}
+		if c.SQL.PasswordHash != "bcrypt" && c.SQL.PasswordHash != "argon2id" {
+			return fmt.Errorf("unknown SQL_PASSWORD_HASH %q", c.SQL.PasswordHash)
+		}
+	case BackendLDAP:
+		require("LDAP_URL", c.LDAP.URL)
+		require("LDAP_BASE_DN", c.LDAP.BaseDN)
+		require("LOCAL_JWT_ISSUER", c.LocalJWT.Issuer)
+		if !strings.Contains(c.LDAP.UserFilter, "%s") {
+			return fmt.Errorf("LDAP_USER_FILTER must contain %%s")
+		}
+	default:
+		return fmt.Errorf("unknown AUTH_BACKEND %q", c.Backend)
+	}
+	if c.Legacy.DSN != "" {
+		if c.Backend != BackendCognito {
+			return fmt.Errorf("LEGACY_SQL_DSN requires AUTH_BACKEND=cognito")
+		}
+		if c.Legacy.Driver != "postgres" && c.Legacy.Driver != "sqlite3" {
+			return fmt.Errorf("unknown LEGACY_SQL_DRIVER %q", c.Legacy.Driver)
+		}
+	}
+	if c.Backend != BackendCognito {
+		if c.LocalJWT.TTL > c.Revocation.TokenTTL {
+			return fmt.Errorf("REVOCATION_TOKEN_TTL must not be shorter than LOCAL_JWT_TTL")
+		}
+		if c.MagicLink.Secret != "" || c.OAuth.Domain != "" {
+			return fmt.Errorf("MAGIC_LINK_SECRET and OAUTH_DOMAIN require AUTH_BACKEND=cognito")
+		}
+	}
+	switch c.Authorizer {
+	case "":
+	case AuthorizerCognito:
+		require("COGNITO_REGION", c.Cognito.Region)
+		require("COGNITO_POOL_ID", c.Cognito.PoolID)
+		require("COGNITO_CLIENT_ID", c.Cognito.ClientID)
+	case AuthorizerLocal:
+		if c.Backend == BackendCognito {
+			return fmt.Errorf("AUTHORIZER=local requires AUTH_BACKEND=sql or ldap")
+		}
+	case AuthorizerOIDC:
+		if len(c.OIDC.Issuers) == 0 {
+			require("OIDC_ISSUERS", "")
+		}
+		ics, err := c.OIDC.IssuerConfigs()
+		if err != nil {
+			return err
+		}
+		for _, ic := range ics {
+			if len(ic.Audiences) == 0 {
+				return fmt.Errorf("OIDC_AUDIENCES or OIDC_ISSUER_AUDIENCES is required for %s", ic.Issuer)
+			}
+			if ic.SubClaim == "" {
+				return fmt.Errorf("OIDC_SUB_CLAIM or OIDC_ISSUER_SUB_CLAIMS is required for %s", ic.Issuer)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown AUTHORIZER %q", c.Authorizer)
+	}
+	if c.SCIM.Token != "" {
+		if c.Backend != BackendCognito && c.Backend != BackendSQL {
+			return fmt.Errorf("SCIM_TOKEN requires AUTH_BACKEND=cognito or sql")
+		}
+		if len(c.SCIM.Token) < 32 {
+			return fmt.Errorf("SCIM_TOKEN must be at least 32 characters")
+		}
+	}
+	if len(c.Webhook.Endpoints) > 0 {
+		require("WEBHOOK_OUTBOX_DSN", c.Webhook.OutboxDSN)
+		if c.Webhook.OutboxDriver != "postgres" && c.Webhook.OutboxDriver != "sqlite3" {
+			return fmt.Errorf("unknown WEBHOOK_OUTBOX_DRIVER %q", c.Webhook.OutboxDriver)
+		}
+		if c.Webhook.MaxAttempts < 1 {
+			return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+		}
+		if c.Webhook.BaseDelay <= 0 || c.Webhook.MaxDelay < c.Webhook.BaseDelay {
+			return fmt.Errorf("WEBHOOK_BASE_DELAY must be positive and not longer than WEBHOOK_MAX_DELAY")
+		}
+		if c.Webhook.Timeout <= 0 || c.Webhook.PollInterval <= 0 {
+			return fmt.Errorf("WEBHOOK_TIMEOUT and WEBHOOK_POLL_INTERVAL must be positive")
+		}
+	}
+	if c.Audit.DBDriver != "" {
+		require("AUDIT_DB_DSN", c.Audit.DBDSN)
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.Server.TLSClientCAFile != "" && c.Server.TLSCertFile == "" {
+		return fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE")
+	}
+	if len(c.Server.ServiceIdentities) > 0 && c.Server.TLSClientCAFile == "" {
+		return fmt.Errorf("MTLS_SERVICE_IDENTITIES requires TLS_CLIENT_CA_FILE")
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return fmt.Errorf("invalid TRUSTED_PROXIES entry %q (IP or CIDR)", p)
+			}
+		}
+	}
+	for _, s := range []struct{ env, store string }{
+		{"RATE_LIMIT_STORE", c.RateLimit.Store},
+		{"LOCKOUT_STORE", c.Lockout.Store},
+		{"REVOCATION_STORE", c.Revocation.Store},
+		{"DEVICE_ACTIVITY_STORE", c.Device.ActivityStore},
+		{"MAGIC_LINK_REPLAY_STORE", c.MagicLink.ReplayStore},
+		{"OAUTH_STATE_STORE", c.OAuth.StateStore},
+	} {
+		switch s.store {
+		case StoreMemory:
+		case StoreRedis:
+			require("REDIS_ADDR", c.Redis.Addr)
+		default:
+			return fmt.Errorf("unknown %s %q", s.env, s.store)
+		}
+	}
+	if c.Mail.SMTPAddr != "" {
+		require("MAIL_FROM", c.Mail.From)
+	}
+	if c.MagicLink.Secret != "" {
+		require("MAGIC_LINK_URL", c.MagicLink.URL)
+	}
+	if c.OAuth.Domain != "" {
+		require("OAUTH_REDIRECT_URI", c.OAuth.RedirectURI)
+	}
+	// バーストが0では、制限が有効な間すべてのリクエストを拒否する
+	if c.RateLimit.IPPerMinute > 0 && c.RateLimit.IPBurst < 1 {
+		return fmt.Errorf("RATE_LIMIT_IP_BURST must be at least 1 (set RATE_LIMIT_IP_PER_MINUTE=0 to disable the limit)")
+	}
+	if c.RateLimit.AccountPerMinute > 0 && c.RateLimit.AccountBurst < 1 {
+		return fmt.Errorf("RATE_LIMIT_ACCOUNT_BURST must be at least 1 (set RATE_LIMIT_ACCOUNT_PER_MINUTE=0 to disable the limit)")
+	}
+	if c.Lockout.BaseDelay <= 0 || c.Lockout.MaxDelay < c.Lockout.BaseDelay || c.Lockout.Duration <= 0 {
+		return fmt.Errorf("LOCKOUT_BASE_DELAY and LOCKOUT_DURATION must be positive and LOCKOUT_MAX_DELAY not shorter than LOCKOUT_BASE_DELAY")
+	}
+	// 失敗の記録が待ち時間やロックの終了より先に消えると、ロックが途中で解除される
+	if c.Lockout.ResetAfter < c.Lockout.Duration || c.Lockout.ResetAfter < c.Lockout.MaxDelay {
+		return fmt.Errorf("LOCKOUT_RESET_AFTER must not be shorter than LOCKOUT_DURATION or LOCKOUT_MAX_DELAY")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required config for backend %q: %s", c.Backend, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// TriggersConfig Cognitoのトリガ（cmd/triggers）の設定
+type TriggersConfig struct {
+	Mail         MailConfig         `yaml:"mail"`
+	Passwordless PasswordlessConfig `yaml:"passwordless"`
+	// MagicLinkSecret サーバのMAGIC_LINK_SECRETと同じ値（空の場合はマジックリンクを受け付けない）
+	MagicLinkSecret string `yaml:"magic_link_secret" env:"MAGIC_LINK_SECRET" secret:"true"`
+	// Legacy User Migrationトリガの移行元（DSNが空の場合は移行しない）
+	Legacy LegacyConfig `yaml:"legacy"`
+	// Cognito Post Confirmationトリガでグループに追加するユーザプール
+	Cognito CognitoConfig        `yaml:"cognito"`
+	Signup  SignupTriggerConfig  `yaml:"signup"`
+	Token   TokenTriggerConfig   `yaml:"token"`
+	Message MessageTriggerConfig `yaml:"message"`
+	PreAuth PreAuthTriggerConfig `yaml:"pre_auth"`
+	// HarnessAddr 指定した場合はLambdaではなく、イベントのJSONを受け付けるHTTPサーバとして動かす（ローカルでの確認用）
+	HarnessAddr string `yaml:"harness_addr" env:"TRIGGERS_HARNESS_ADDR" usage:"serve the triggers over HTTP on this address instead of Lambda, e.g. :9000"`
+}
+
+// SignupTriggerConfig Pre Sign-up、Post Confirmationトリガの設定
+type SignupTriggerConfig struct {
+	// AllowedDomains サインアップできるメールアドレスのドメイン（空の場合は制限しない）
+	AllowedDomains []string `yaml:"allowed_domains" env:"SIGNUP_ALLOWED_DOMAINS" usage:"email domains allowed to sign up (all if empty)"`
+	// AutoConfirmDomains 確認コードなしで確認済みにするドメイン
+	AutoConfirmDomains []string `yaml:"auto_confirm_domains" env:"SIGNUP_AUTO_CONFIRM_DOMAINS" usage:"email domains confirmed and verified without a code"`
+	// DefaultGroups 確認したユーザを追加するグループ（COGNITO_POOL_IDが必要）
+	DefaultGroups []string `yaml:"default_groups" env:"SIGNUP_DEFAULT_GROUPS" usage:"groups to add users to once they confirm their sign-up"`
+	// WelcomeEmail 確認したユーザに歓迎メールを送る
+	WelcomeEmail bool `yaml:"welcome_email" env:"SIGNUP_WELCOME_EMAIL" default:"false"`
+}
+
+// TokenTriggerConfig Pre Token Generationトリガの設定
+type TokenTriggerConfig struct {
+	// ClaimAttributes ユーザ属性から追加するクレーム（claim=attribute をカンマ区切り）
+	ClaimAttributes []string `yaml:"claim_attributes" env:"TOKEN_CLAIM_ATTRIBUTES" usage:"claim=attribute pairs, e.g. tenant_id=custom:tenant_id"`
+	// Claims 全てのトークンに追加するクレーム（claim=value をカンマ区切り）
+	Claims []string `yaml:"claims" env:"TOKEN_CLAIMS" usage:"claim=value pairs added to every ID token"`
+	// Groups cognito:groupsに追加するグループ
+	Groups []string `yaml:"groups" env:"TOKEN_GROUPS" usage:"groups added to cognito:groups of every ID token"`
+	// SuppressClaims IDトークンから除くクレーム
+	SuppressClaims []string `yaml:"suppress_claims" env:"TOKEN_SUPPRESS_CLAIMS" usage:"claims removed from the ID token, e.g. phone_number"`
+}
+
+// MessageTriggerConfig Custom Messageトリガ（と歓迎メール）の設定
+type MessageTriggerConfig struct {
+	// TemplatesDir 組み込みのテンプレートを置き換える<種類>.<ロケール>.tmplを置いたディレクトリ
+	TemplatesDir string `yaml:"templates_dir" env:"MESSAGE_TEMPLATES_DIR" usage:"directory of <kind>.<locale>.tmpl files overriding the built-in templates"`
+	// DefaultLocale ユーザのロケールのテンプレートがない場合に使うロケール
+	DefaultLocale string `yaml:"default_locale" env:"MESSAGE_DEFAULT_LOCALE" default:"en"`
+	// AppName テンプレートで{{.AppName}}として使うサービス名
+	AppName string `yaml:"app_name" env:"MESSAGE_APP_NAME" default:"gin-cognito-sample"`
+}
+
+// PreAuthTriggerConfig Pre Authenticationトリガの設定
+type PreAuthTriggerConfig struct {
+	// AllowedDomains ログインできるメールアドレスのドメイン（空の場合は制限しない）
+	AllowedDomains []string `yaml:"allowed_domains" env:"PREAUTH_ALLOWED_DOMAINS" usage:"email domains allowed to sign in (all if empty)"`
+	// RequireVerifiedEmail メールアドレスを確認していないユーザのログインを拒否する
+	RequireVerifiedEmail bool `yaml:"require_verified_email" env:"PREAUTH_REQUIRE_VERIFIED_EMAIL" default:"false"`
+	// ClientIDs ログインを受け付けるアプリクライアント（空の場合は制限しない）
+	ClientIDs []string `yaml:"client_ids" env:"PREAUTH_CLIENT_IDS" usage:"app client IDs allowed to sign in (all if empty)"`
+}
+
+// PasswordlessConfig パスワードレスログイン（CUSTOM_AUTH）のチャレンジの設定
+type PasswordlessConfig struct {
+	CodeLength int           `yaml:"code_length" env:"PASSWORDLESS_CODE_LENGTH" default:"6"`
+	CodeTTL    time.Duration `yaml:"code_ttl" env:"PASSWORDLESS_CODE_TTL" default:"5m"`
+	// MaxAttempts 1回のログインでコードを回答できる回数
+	MaxAttempts int `yaml:"max_attempts" env:"PASSWORDLESS_MAX_ATTEMPTS" default:"3"`
+}
+
+// Validate トリガに必要な項目が揃っているか検証します
+func (c *TriggersConfig) Validate() error {
+	if c.Mail.SMTPAddr != "" && c.Mail.From == "" {
+		return fmt.Errorf("missing required config: MAIL_FROM")
+	}
+	if c.Passwordless.CodeLength < 4 || c.Passwordless.CodeLength > 10 {
+		return fmt.Errorf("PASSWORDLESS_CODE_LENGTH must be between 4 and 10")
+	}
+	if c.Passwordless.MaxAttempts <= 0 {
+		return fmt.Errorf("PASSWORDLESS_MAX_ATTEMPTS must be positive")
+	}
+	if c.Legacy.DSN != "" && c.Legacy.Driver != "postgres" {
+		return fmt.Errorf("LEGACY_SQL_DRIVER must be postgres for triggers")
+	}
+	if len(c.Signup.DefaultGroups) > 0 && c.Cognito.PoolID == "" {
+		return fmt.Errorf("missing required config: COGNITO_POOL_ID (for SIGNUP_DEFAULT_GROUPS)")
+	}
+	if c.Message.DefaultLocale == "" {
+		return fmt.Errorf("missing required config: MESSAGE_DEFAULT_LOCALE")
+	}
+	return nil
+}
+
+// UsersctlConfig ユーザの一括操作、管理操作（cmd/usersctl）の設定
+type UsersctlConfig struct {
+	Backend  string         `yaml:"backend" env:"AUTH_BACKEND" default:"cognito" usage:"cognito, sql, or memory (sample users, not persisted)"`
+	Cognito  CognitoConfig  `yaml:"cognito"`
+	SQL      SQLConfig      `yaml:"sql"`
+	LocalJWT LocalJWTConfig `yaml:"local_jwt"`
+	Mail     MailConfig     `yaml:"mail"`
+}
+
+// Validate 選択されたバックエンドに必要な項目が揃っているか検証します
+func (c *UsersctlConfig) Validate() error {
+	switch c.Backend {
+	case BackendCognito:
+		if c.Cognito.PoolID == "" {
+			return fmt.Errorf("missing required config: COGNITO_POOL_ID")
+		}
+	case BackendSQL:
+		if c.SQL.DSN == "" {
+			return fmt.Errorf("missing required config: SQL_DSN")
+		}
+		if c.SQL.Driver != "postgres" && c.SQL.Driver != "sqlite3" {
+			return fmt.Errorf("unknown SQL_DRIVER %q", c.SQL.Driver)
+		}
+	case BackendMemory:
+	default:
+		return fmt.Errorf("unknown AUTH_BACKEND %q", c.Backend)
+	}
+	if c.Mail.SMTPAddr != "" && c.Mail.From == "" {
+		return fmt.Errorf("missing required config: MAIL_FROM")
+	}
+	return nil
+}
+
+// TokentoolConfig IDトークンの調査、テスト用トークンの発行（cmd/tokentool）の設定
+type TokentoolConfig struct {
+	Backend  string         `yaml:"backend" env:"AUTH_BACKEND" default:"cognito" usage:"cognito, sql or ldap (chooses the issuer, audience and JWKS)"`
+	Cognito  CognitoConfig  `yaml:"cognito"`
+	LocalJWT LocalJWTConfig `yaml:"local_jwt"`
+}
+
+// Validate バックエンドが既知のものか検証します（検証に使う値はコマンドのフラグでも指定できるため必須にしない）
+func (c *TokentoolConfig) Validate() error {
+	switch c.Backend {
+	case BackendCognito, BackendSQL, BackendLDAP:
+		return nil
+	default:
+		return fmt.Errorf("unknown AUTH_BACKEND %q", c.Backend)
+	}
+}
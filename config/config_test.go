@@ -0,0 +1,106 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLockoutDurations(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"defaults", nil, ""},
+		{"reset after shorter than lockout", []string{"-lockout-duration", "2h"}, "LOCKOUT_RESET_AFTER"},
+		{"reset after shorter than max delay", []string{"-lockout-max-delay", "2h", "-lockout-duration", "10m"}, "LOCKOUT_RESET_AFTER"},
+		{"max delay shorter than base delay", []string{"-lockout-base-delay", "1m", "-lockout-max-delay", "30s"}, "LOCKOUT_MAX_DELAY"},
+		{"zero lockout", []string{"-lockout-duration", "0s"}, "LOCKOUT_DURATION"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-auth-backend", "sql", "-sql-dsn", "users.db", "-local-jwt-issuer", "http://localhost:3000"}, tt.args...)
+			_, err := Load(args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to mention %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRateLimitBurst(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"defaults", nil, ""},
+		{"zero ip burst", []string{"-rate-limit-ip-burst", "0"}, "RATE_LIMIT_IP_BURST"},
+		{"zero account burst", []string{"-rate-limit-account-burst", "0"}, "RATE_LIMIT_ACCOUNT_BURST"},
+		{"negative account burst", []string{"-rate-limit-account-burst", "-1"}, "RATE_LIMIT_ACCOUNT_BURST"},
+		// 制限が無効ならバーストは使わない
+		{"zero burst with the limit disabled", []string{"-rate-limit-ip-per-minute", "0", "-rate-limit-ip-burst", "0"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-auth-backend", "sql", "-sql-dsn", "users.db", "-local-jwt-issuer", "http://localhost:3000"}, tt.args...)
+			_, err := Load(args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to mention %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCIssuerConfigs(t *testing.T) {
+	c := &OIDCConfig{
+		Issuers:            []string{"https://a.example.com/", "https://b.example.com/realms/app"},
+		Audiences:          []string{"shared"},
+		SubClaim:           "sub",
+		EmailClaim:         "email",
+		GroupsClaim:        "groups",
+		IssuerAudiences:    []string{"https://b.example.com/realms/app=app-b", "https://b.example.com/realms/app=app-b2"},
+		IssuerGroupsClaims: []string{"https://b.example.com/realms/app=realm_access.roles"},
+	}
+	got, err := c.IssuerConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OIDCIssuerConfig{
+		{Issuer: "https://a.example.com/", Audiences: []string{"shared"}, SubClaim: "sub", EmailClaim: "email", GroupsClaim: "groups"},
+		{Issuer: "https://b.example.com/realms/app", Audiences: []string{"app-b", "app-b2"}, SubClaim: "sub", EmailClaim: "email", GroupsClaim: "realm_access.roles"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("IssuerConfigs() = %+v, want %+v", got, want)
+	}
+
+	for _, pairs := range [][]string{{"https://c.example.com/=app"}, {"app"}, {"https://a.example.com/="}} {
+		c.IssuerAudiences = pairs
+		if _, err := c.IssuerConfigs(); err == nil {
+			t.Errorf("IssuerConfigs() with %v: want an error", pairs)
+		}
+	}
+}
+
+func TestValidateOIDCAudiences(t *testing.T) {
+	base := []string{"-auth-backend", "sql", "-sql-dsn", "users.db", "-local-jwt-issuer", "http://localhost:3000", "-authorizer", "oidc", "-oidc-issuers", "https://a.example.com/,https://b.example.com/"}
+	if _, err := Load(append(base, "-oidc-issuer-audiences", "https://a.example.com/=app-a")); err == nil || !strings.Contains(err.Error(), "https://b.example.com/") {
+		t.Errorf("err = %v, want the issuer without audiences to be reported", err)
+	}
+	if _, err := Load(append(base, "-oidc-issuer-audiences", "https://a.example.com/=app-a,https://b.example.com/=app-b")); err != nil {
+		t.Errorf("err = %v, want nil", err)
+	}
+}
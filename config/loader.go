@@ -0,0 +1,223 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	dotenvFile    = ".env"
+	configFileEnv = "CONFIG_FILE"
+	redacted      = "********"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load 設定を読み込み、検証します
+func Load(args []string) (*Config, error) {
+	cfg := new(Config)
+	if err := LoadInto(cfg, args); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadInto Configと同じ規則で、cfg（構造体へのポインタ）に設定を読み込みます
+//
+// Lambdaトリガなど、サーバとは別のバイナリの設定に使います。cfgがValidate() errorを持つ場合は最後に呼び出します。
+func LoadInto(cfg interface{}, args []string) error {
+	if err := each(cfg, func(f reflect.StructField, v reflect.Value) error {
+		if d, ok := f.Tag.Lookup("default"); ok {
+			return setValue(v, d)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// コマンドライン引数は最優先だが、YAMLファイルのパスを知るため先に解析しておく
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML config file (or "+configFileEnv+")")
+	flags := map[string]*string{}
+	if err := each(cfg, func(f reflect.StructField, v reflect.Value) error {
+		name := flagName(f.Tag.Get("env"))
+		flags[name] = fs.String(name, "", f.Tag.Get("usage"))
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// .envは任意（コンテナでは実際の環境変数のみで動かす）、既存の環境変数は上書きしない
+	if _, err := os.Stat(dotenvFile); err == nil {
+		if err := godotenv.Load(dotenvFile); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv(configFileEnv)
+	}
+	if *configFile != "" {
+		b, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+			return errors.Wrapf(err, "parse %s", *configFile)
+		}
+	}
+
+	if err := each(cfg, func(f reflect.StructField, v reflect.Value) error {
+		key := f.Tag.Get("env")
+		if f.Tag.Get("secret") == "true" {
+			if path := os.Getenv(key + "_FILE"); path != "" {
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					return errors.Wrapf(err, "read %s_FILE", key)
+				}
+				return setValue(v, strings.TrimRight(string(b), "\r\n"))
+			}
+		}
+		// 空の値もYAMLの値を消すために使えるよう、設定されていれば適用する
+		if s, ok := os.LookupEnv(key); ok {
+			return errors.Wrap(setValue(v, s), key)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var visitErr error
+	fs.Visit(func(fl *flag.Flag) {
+		if p, ok := flags[fl.Name]; ok && visitErr == nil {
+			_ = each(cfg, func(f reflect.StructField, v reflect.Value) error {
+				if flagName(f.Tag.Get("env")) == fl.Name {
+					visitErr = errors.Wrap(setValue(v, *p), "-"+fl.Name)
+				}
+				return nil
+			})
+		}
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+
+	if v, ok := cfg.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Redacted 秘密情報を伏せた有効な設定を ENV=value 形式で返します
+func (c *Config) Redacted() string {
+	return Redact(c)
+}
+
+// Redact LoadIntoで読み込んだcfgの秘密情報を伏せて ENV=value 形式で返します
+func Redact(cfg interface{}) string {
+	var sb strings.Builder
+	_ = each(cfg, func(f reflect.StructField, v reflect.Value) error {
+		val := fmt.Sprint(v.Interface())
+		if v.Kind() == reflect.Slice {
+			val = strings.Trim(val, "[]")
+		}
+		if f.Tag.Get("secret") == "true" && val != "" {
+			val = redacted
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", f.Tag.Get("env"), val)
+		return nil
+	})
+	return sb.String()
+}
+
+// each env タグを持つ項目を順に処理します（ネストした構造体は再帰的にたどる）
+func each(cfg interface{}, fn func(f reflect.StructField, v reflect.Value) error) error {
+	return walk(reflect.ValueOf(cfg).Elem(), fn)
+}
+
+func walk(v reflect.Value, fn func(f reflect.StructField, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if _, ok := f.Tag.Lookup("env"); ok {
+			if err := fn(f, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Struct {
+			if err := walk(fv, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, s string) error {
+	// 空の値はゼロ値（空の文字列、0、false、空のリスト）とする
+	if strings.TrimSpace(s) == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return errors.WithStack(fmt.Errorf("unsupported config type %s", v.Type()))
+	}
+	return nil
+}
+
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(env), "_", "-")
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type loaderTestConfig struct {
+	Name    string        `yaml:"name" env:"LOADER_TEST_NAME" default:"fallback"`
+	Secret  string        `yaml:"secret" env:"LOADER_TEST_SECRET" secret:"true"`
+	List    []string      `yaml:"list" env:"LOADER_TEST_LIST"`
+	Count   int           `yaml:"count" env:"LOADER_TEST_COUNT"`
+	Enabled bool          `yaml:"enabled" env:"LOADER_TEST_ENABLED"`
+	Timeout time.Duration `yaml:"timeout" env:"LOADER_TEST_TIMEOUT"`
+}
+
+func TestLoadIntoEnvOverridesYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "name: from-yaml\nsecret: s3cret\nlist: [a, b]\ncount: 3\nenabled: true\ntimeout: 5s\n"
+	if err := ioutil.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want loaderTestConfig
+	}{
+		{
+			name: "no env",
+			want: loaderTestConfig{Name: "from-yaml", Secret: "s3cret", List: []string{"a", "b"}, Count: 3, Enabled: true, Timeout: 5 * time.Second},
+		},
+		{
+			name: "values",
+			env: map[string]string{
+				"LOADER_TEST_NAME": "from-env", "LOADER_TEST_LIST": "c, d", "LOADER_TEST_COUNT": "7",
+				"LOADER_TEST_ENABLED": "false", "LOADER_TEST_TIMEOUT": "1m",
+			},
+			want: loaderTestConfig{Name: "from-env", Secret: "s3cret", List: []string{"c", "d"}, Count: 7, Timeout: time.Minute},
+		},
+		{
+			name: "empty values clear the YAML",
+			env: map[string]string{
+				"LOADER_TEST_NAME": "", "LOADER_TEST_SECRET": "", "LOADER_TEST_LIST": "", "LOADER_TEST_COUNT": "",
+				"LOADER_TEST_ENABLED": "", "LOADER_TEST_TIMEOUT": " ",
+			},
+			want: loaderTestConfig{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg := new(loaderTestConfig)
+			if err := LoadInto(cfg, []string{"-config", path}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*cfg, tt.want) {
+				t.Errorf("config = %+v, want %+v", *cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIntoEmptyFlag(t *testing.T) {
+	cfg := new(loaderTestConfig)
+	if err := LoadInto(cfg, []string{"-loader-test-name", "", "-loader-test-count", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "" || cfg.Count != 0 {
+		t.Errorf("config = %+v, want the default name cleared and count 0", *cfg)
+	}
+}
+
+// clearConfigEnv Configの環境変数をテストの間だけ未設定にします（終了後に元に戻す）
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	keys := []string{configFileEnv}
+	_ = each(new(Config), func(f reflect.StructField, v reflect.Value) error {
+		keys = append(keys, f.Tag.Get("env"), f.Tag.Get("env")+"_FILE")
+		return nil
+	})
+	for _, k := range keys {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+}
+
+// redactedValues Redactの出力を環境変数名と値の組にします
+func redactedValues(cfg *Config) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(cfg.Redacted()), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		values[kv[0]] = kv[1]
+	}
+	return values
+}
+
+// cp .env.sample .envとしてもconfig.sample.yamlの値を空で消さないこと
+func TestLoadSampleFiles(t *testing.T) {
+	dotenv, err := ioutil.ReadFile("../.env.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlPath, err := filepath.Abs("../config.sample.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(dotenv))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") && strings.HasSuffix(line, "=") {
+			t.Errorf(".env.sample: %q is empty and would clear the YAML value; comment it out", line)
+		}
+	}
+
+	clearConfigEnv(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// 秘密情報はYAMLに書かないためフラグで与える
+	args := []string{"-config", yamlPath, "-cognito-client-secret", "someval"}
+	yamlOnly, err := Load(args)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := ioutil.WriteFile(dotenvFile, dotenv, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	both, err := Load(args)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if both.LocalJWT.Issuer != "http://localhost:3000" || both.SQL.DSN != "users.db" || both.LDAP.URL != "ldap://localhost:389" {
+		t.Errorf("local_jwt.issuer %q, sql.dsn %q, ldap.url %q; want the values of config.sample.yaml",
+			both.LocalJWT.Issuer, both.SQL.DSN, both.LDAP.URL)
+	}
+	got := redactedValues(both)
+	for k, v := range redactedValues(yamlOnly) {
+		if v != "" && got[k] == "" {
+			t.Errorf("%s = %q from config.sample.yaml is cleared by .env.sample", k, v)
+		}
+	}
+}
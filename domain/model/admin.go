@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// UserRecord 管理者が参照するユーザ
+type UserRecord struct {
+	Username  string
+	Status    string
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Attributes sub、email、nameなどの全ての属性
+	Attributes map[string]string
+	// Groups 一覧では取得しない
+	Groups []string
+}
+
+// ImportUserReq 一括インポートで作成するユーザ
+type ImportUserReq struct {
+	Email string
+	// Attributes email以外に設定する属性（name、custom:...など）
+	Attributes map[string]string
+	// TemporaryPassword 空の場合はバックエンドが生成する
+	TemporaryPassword string
+	// SendInvitation 招待メールを送る（falseの場合は送らない）
+	SendInvitation bool
+}
+
+// GroupRecord 管理者が参照するグループ
+type GroupRecord struct {
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Members 一覧では取得しない
+	Members []*GroupMember
+}
+
+// GroupMember グループに属するユーザ
+type GroupMember struct {
+	Sub      string
+	Username string
+}
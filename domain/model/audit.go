@@ -0,0 +1,83 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// 監査ログのアクション
+const (
+	AuditActionSignup                = "signup"
+	AuditActionConfirmSignup         = "confirm_signup"
+	AuditActionResendConfirmation    = "resend_confirmation_code"
+	AuditActionSignin                = "signin"
+	AuditActionRefresh               = "refresh"
+	AuditActionChangePassword        = "change_password"
+	AuditActionForgotPassword        = "forgot_password"
+	AuditActionConfirmForgotPassword = "confirm_forgot_password"
+	AuditActionInvite                = "invite"
+	AuditActionRespondToInvitation   = "respond_to_invitation"
+	AuditActionChangeProfile         = "change_profile"
+	AuditActionSignout               = "signout"
+	AuditActionGlobalSignout         = "global_signout"
+	AuditActionDisableUser           = "disable_user"
+	AuditActionForgetDevice          = "forget_device"
+	AuditActionUpdateDeviceStatus    = "update_device_status"
+	AuditActionPasswordlessStart     = "passwordless_start"
+	AuditActionPasswordlessVerify    = "passwordless_verify"
+	AuditActionMagicLinkStart        = "magic_link_start"
+	AuditActionMagicLinkCallback     = "magic_link_callback"
+	AuditActionOAuthLogin            = "oauth_login"
+	AuditActionOAuthCallback         = "oauth_callback"
+	AuditActionAuthorize             = "authorize"
+	AuditActionLockout               = "lockout"
+	AuditActionLockoutRejected       = "lockout_rejected"
+	AuditActionUnlock                = "unlock"
+	AuditActionCreateUser            = "create_user"
+	AuditActionEnableUser            = "enable_user"
+	AuditActionDeleteUser            = "delete_user"
+	AuditActionCreateGroup           = "create_group"
+	AuditActionDeleteGroup           = "delete_group"
+	AuditActionAddGroupMember        = "add_group_member"
+	AuditActionRemoveGroupMember     = "remove_group_member"
+	AuditActionReplayWebhooks        = "replay_webhooks"
+)
+
+// 監査ログの結果
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	ActorSub  string    `json:"actor_sub,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Actor リクエストの実行者を表します
+type Actor struct {
+	Sub       string
+	IP        string
+	UserAgent string
+}
+
+type actorContextKey struct{}
+
+// WithActor コンテキストに実行者を設定します
+func WithActor(ctx context.Context, a *Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, a)
+}
+
+// ActorFromContext コンテキストから実行者を取得します（未設定の場合は空の実行者）
+func ActorFromContext(ctx context.Context) *Actor {
+	if a, ok := ctx.Value(actorContextKey{}).(*Actor); ok {
+		return a
+	}
+	return new(Actor)
+}
@@ -0,0 +1,35 @@
+package model
+
+// CUSTOM_AUTHでトリガに渡すClientMetadataのキーと、認証方法
+const (
+	CustomAuthMethodKey       = "method"
+	CustomAuthMethodEmailOTP  = "email_otp"
+	CustomAuthMethodMagicLink = "magic_link"
+)
+
+// 最初のチャレンジで認証方法を選ぶ（公開パラメータ step=method のチャレンジに認証方法を回答する）
+const (
+	CustomChallengeStepKey    = "step"
+	CustomChallengeStepMethod = "method"
+)
+
+// CustomAuthReq CUSTOM_AUTHの開始（MetadataのCustomAuthMethodKeyの認証方法を選ぶ）
+type CustomAuthReq struct {
+	Email    string
+	Metadata map[string]string
+}
+
+// CustomChallenge CUSTOM_AUTHで提示されたチャレンジ
+type CustomChallenge struct {
+	Session string
+	// Parameters トリガが設定した公開パラメータ
+	Parameters map[string]string
+}
+
+// CustomChallengeAnswerReq チャレンジへの回答（Metadataは検証のトリガに渡る）
+type CustomChallengeAnswerReq struct {
+	Email    string
+	Session  string
+	Answer   string
+	Metadata map[string]string
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// Claims 検証済みのIDトークンから取り出した情報
+type Claims struct {
+	Sub   string
+	Email string
+	// Groups 所属グループ（CognitoのグループやIdPのロール）
+	Groups []string
+	// JTI, OriginJTI トークン自体と、元になった認証（リフレッシュトークン）の識別子
+	JTI       string
+	OriginJTI string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type claimsContextKey struct{}
+
+// WithClaims コンテキストに検証済みのトークンの情報を設定します
+func WithClaims(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, c)
+}
+
+// ClaimsFromContext コンテキストから検証済みのトークンの情報を取得します（未認証の場合はnil）
+func ClaimsFromContext(ctx context.Context) *Claims {
+	c, _ := ctx.Value(claimsContextKey{}).(*Claims)
+	return c
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// バックエンドに依存しないアカウントの状態に関するエラー
+var (
+	ErrUserAlreadyExists    = errors.New("user already exists")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserAlreadyConfirmed = errors.New("user already confirmed")
+	ErrUserNotConfirmed     = errors.New("user is not confirmed")
+	ErrGroupAlreadyExists   = errors.New("group already exists")
+	ErrGroupNotFound        = errors.New("group not found")
+	// ErrNotAuthorized メールアドレス、パスワードが誤っている、または無効化されたアカウント（どれかは区別しない）
+	ErrNotAuthorized = errors.New("incorrect username or password")
+	// ErrInvalidCode 確認コード、リセットコード、招待の仮パスワードが誤っている、または期限切れ
+	ErrInvalidCode = errors.New("invalid or expired code")
+	// ErrTooManyRequests バックエンドのAPI制限を超えた（時間をおいて再試行する）
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrInvalidMagicLink 署名、有効期限が不正、または使用済みのマジックリンク
+	ErrInvalidMagicLink = errors.New("invalid magic link")
+)
+
+// LockedError 失敗の繰り返しにより一時的に操作を拒否していることを表します
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	// 秒単位に切り上げて表示する
+	return fmt.Sprintf("temporarily locked, retry after %s", (e.RetryAfter + time.Second - 1).Truncate(time.Second))
+}
+
+// InvalidChallengeAnswerError チャレンジへの回答が誤っていたことを表します
+//
+// 再回答できる場合はSessionに次のチャレンジのセッションが入り、空の場合は最初からやり直す必要があります。
+type InvalidChallengeAnswerError struct {
+	Session string
+}
+
+func (e *InvalidChallengeAnswerError) Error() string {
+	if e.Session == "" {
+		return "invalid challenge answer, no attempts left"
+	}
+	return "invalid challenge answer"
+}
+
+// NotSupportedError 認証バックエンドが対応していない操作であることを表します
+type NotSupportedError struct {
+	Backend   string
+	Operation string
+}
+
+func (e *NotSupportedError) Error() string {
+	return fmt.Sprintf("%s is not supported by %s backend", e.Operation, e.Backend)
+}
@@ -0,0 +1,25 @@
+package model
+
+// LegacyUser 移行元のシステムのアカウント
+type LegacyUser struct {
+	Email string
+	Name  string
+	// Attributes 移行先にそのまま設定する追加の属性（例: custom:legacy_id）
+	Attributes map[string]string
+}
+
+// UserAttributes 移行先のユーザプールに設定する属性を返します
+//
+// 移行元でメールアドレスを確認済みとみなし、email_verifiedをtrueにします（パスワードのリセットに必要）。
+func (u *LegacyUser) UserAttributes() map[string]string {
+	attrs := make(map[string]string, len(u.Attributes)+3)
+	for k, v := range u.Attributes {
+		attrs[k] = v
+	}
+	attrs["email"] = u.Email
+	attrs["email_verified"] = "true"
+	if u.Name != "" {
+		attrs["name"] = u.Name
+	}
+	return attrs
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// MagicLinkClaims マジックリンクのトークンに含める情報
+type MagicLinkClaims struct {
+	// ID 使用済みの記録に使う一意な値
+	ID        string    `json:"jti"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"-"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidOAuthState 認可リクエストと対応しない、または使用済みのstate
+var ErrInvalidOAuthState = errors.New("invalid oauth state")
+
+// OAuthState 認可リクエストからコールバックまで保持する値
+type OAuthState struct {
+	CodeVerifier     string `json:"code_verifier"`
+	IdentityProvider string `json:"identity_provider,omitempty"`
+}
+
+// OAuthError 認可サーバが返したエラー（RFC 6749 5.2）
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("oauth error: %s", e.Code)
+	}
+	return fmt.Sprintf("oauth error: %s: %s", e.Code, e.Description)
+}
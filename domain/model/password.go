@@ -0,0 +1,94 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 個人情報として扱う部分文字列の最小長（短すぎるものは偶然一致するため除外する）
+const minPersonalTokenLength = 3
+
+// PasswordPolicy パスワードの要件
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowPersonal bool
+}
+
+// PasswordPolicyError パスワードが要件を満たさない理由を表します
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, ", ")
+}
+
+// Validate パスワードを検証します。personalにはメールアドレスや名前など、含めてはいけない情報を渡します
+func (p *PasswordPolicy) Validate(password string, personal ...string) error {
+	var v []string
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		v = append(v, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		v = append(v, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' ':
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		v = append(v, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		v = append(v, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		v = append(v, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		v = append(v, "must contain a symbol")
+	}
+	if p.DisallowPersonal && containsPersonal(password, personal) {
+		v = append(v, "must not contain your email address or name")
+	}
+	if len(v) > 0 {
+		return &PasswordPolicyError{Violations: v}
+	}
+	return nil
+}
+
+func containsPersonal(password string, personal []string) bool {
+	lp := strings.ToLower(password)
+	for _, s := range personal {
+		s = strings.ToLower(s)
+		// メールアドレスはローカル部の各語、名前は空白区切りの各語を確認する（"com"などのドメインは対象外）
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			s = s[:i]
+		}
+		for _, tok := range strings.FieldsFunc(s, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '.' || r == '_' || r == '-' || r == '+'
+		}) {
+			if utf8.RuneCountInString(tok) >= minPersonalTokenLength && strings.Contains(lp, tok) {
+				return true
+			}
+		}
+	}
+	return false
+}
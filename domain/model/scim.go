@@ -0,0 +1,29 @@
+package model
+
+import "fmt"
+
+// SCIMのエラーレスポンスのscimType（RFC 7644 3.12）
+const (
+	SCIMInvalidFilter = "invalidFilter"
+	SCIMInvalidPath   = "invalidPath"
+	SCIMInvalidSyntax = "invalidSyntax"
+	SCIMInvalidValue  = "invalidValue"
+	SCIMMutability    = "mutability"
+	SCIMNoTarget      = "noTarget"
+	SCIMUniqueness    = "uniqueness"
+)
+
+// SCIMError SCIMのリクエストが不正であることを表します
+type SCIMError struct {
+	Status int
+	// Type 該当するscimTypeがなければ空
+	Type   string
+	Detail string
+}
+
+func (e *SCIMError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("scim: %d %s", e.Status, e.Detail)
+	}
+	return fmt.Sprintf("scim: %d %s: %s", e.Status, e.Type, e.Detail)
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type User struct {
 	Email string
 	Name  string
@@ -17,14 +19,55 @@ type ConfirmAndSigninReq struct {
 	Password         string `json:"password" validate:"required"`
 }
 
+type ResendConfirmationCodeReq struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
 type SigninReq struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// Device 記憶済みのデバイスからのログインの場合に指定する
+	Device *DeviceCredentials `json:"device,omitempty"`
+	// RememberDevice 新しいデバイスを記憶する（DeviceNameが空の場合はユーザエージェントを名前にする）
+	RememberDevice bool   `json:"remember_device"`
+	DeviceName     string `json:"device_name"`
 }
 
 type RefreshReq struct {
 	Sub          string `json:"sub" validate:"required"`
 	RefreshToken string `json:"refresh_token" validate:"required"`
+	// DeviceKey デバイスの追跡が有効な場合、ログイン時のデバイスキーを指定する
+	DeviceKey string `json:"device_key"`
+}
+
+// DeviceCredentials デバイス認証に使う情報（クライアントで保存する）
+type DeviceCredentials struct {
+	Key      string `json:"key" validate:"required"`
+	GroupKey string `json:"group_key" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type Device struct {
+	Key                 string     `json:"device_key"`
+	Name                string     `json:"name"`
+	Remembered          bool       `json:"remembered"`
+	CreatedAt           time.Time  `json:"created_at"`
+	LastAuthenticatedAt time.Time  `json:"last_authenticated_at"`
+	LastIP              string     `json:"last_ip,omitempty"`
+	LastUserAgent       string     `json:"last_user_agent,omitempty"`
+	LastSeenAt          *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// DeviceActivity デバイスの最終利用状況
+type DeviceActivity struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	At        time.Time `json:"at"`
+}
+
+type UpdateDeviceStatusReq struct {
+	DeviceKey  string `json:"device_key" validate:"required"`
+	Remembered bool   `json:"remembered"`
 }
 
 type ChangePasswordReq struct {
@@ -65,7 +108,13 @@ type GetUserReq struct {
 	Sub string `json:"sub" validate:"required"`
 }
 
+type DisableUserReq struct {
+	Sub string `json:"sub" validate:"required"`
+}
+
 type Token struct {
 	IDToken      string  `json:"id_token"`
 	RefreshToken *string `json:"refresh_token,omitempty"`
+	// NewDevice 新しく登録したデバイス（以降のログイン、リフレッシュで使う）
+	NewDevice *DeviceCredentials `json:"new_device,omitempty"`
 }
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrEmptyWebhookFilter 全ての配信に一致する再送の条件
+var ErrEmptyWebhookFilter = errors.New("replay needs event_id or since")
+
+// Webhookで通知するユーザのライフサイクルのイベント
+const (
+	EventUserSignedUp       = "user.signed_up"
+	EventUserConfirmed      = "user.confirmed"
+	EventUserInvited        = "user.invited"
+	EventUserCreated        = "user.created"
+	EventUserProfileChanged = "user.profile_changed"
+	EventUserEnabled        = "user.enabled"
+	EventUserDisabled       = "user.disabled"
+	EventUserDeleted        = "user.deleted"
+)
+
+// EventTypes 購読できるイベントの種類
+var EventTypes = []string{
+	EventUserSignedUp,
+	EventUserConfirmed,
+	EventUserInvited,
+	EventUserCreated,
+	EventUserProfileChanged,
+	EventUserEnabled,
+	EventUserDisabled,
+	EventUserDeleted,
+}
+
+// Event Webhookの本文（dataのキーはsub、email、nameなどイベントにより異なる）
+type Event struct {
+	ID   string            `json:"id"`
+	Type string            `json:"type"`
+	Time time.Time         `json:"time"`
+	Data map[string]string `json:"data"`
+}
+
+// WebhookEndpoint 配信先（Eventsが空の場合は全てのイベントを購読する）
+type WebhookEndpoint struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string
+}
+
+// Subscribes イベントを購読しているか判定します
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhookの配信の状態
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	// WebhookFailed 再試行の上限に達した（再送するまで配信しない）
+	WebhookFailed = "failed"
+)
+
+// WebhookDelivery 1つのイベントの1つの配信先への配信（イベントIDと配信先で一意）
+type WebhookDelivery struct {
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Endpoint      string          `json:"endpoint"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookDeliveryFilter 配信の一覧、再送の条件（空の項目は条件にしない）
+type WebhookDeliveryFilter struct {
+	EventID   string
+	EventType string
+	Endpoint  string
+	Status    string
+	// Since, Until イベントの発生日時の範囲（Untilは含まない）
+	Since time.Time
+	Until time.Time
+	Limit int
+}
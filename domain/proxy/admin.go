@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// UserAdminProxy 管理者によるユーザの操作を抽象化します（無効化、招待などはUserProxyの操作を使う）
+type UserAdminProxy interface {
+	UserProxy
+	// ImportUser ユーザを作成します（存在する場合はmodel.ErrUserAlreadyExists、API制限の場合はmodel.ErrTooManyRequests）
+	ImportUser(ctx context.Context, req *model.ImportUserReq) error
+	// ListUsers 1ページ分のユーザを返します（nextが空の場合は最後のページ、グループは含まない）
+	ListUsers(ctx context.Context, pageToken string) (users []*model.UserRecord, next string, err error)
+	// DescribeUser グループを含めてユーザを返します
+	DescribeUser(ctx context.Context, email string) (*model.UserRecord, error)
+	EnableUser(ctx context.Context, email string) error
+	DeleteUser(ctx context.Context, email string) error
+	// ResetPassword 現在のパスワードを無効にし、リセットコードをメールで送ります
+	ResetPassword(ctx context.Context, email string) error
+	AddUserToGroup(ctx context.Context, email, group string) error
+	RemoveUserFromGroup(ctx context.Context, email, group string) error
+	// ListGroups 1ページ分のグループを返します（nextが空の場合は最後のページ、メンバーは含まない）
+	ListGroups(ctx context.Context, pageToken string) (groups []*model.GroupRecord, next string, err error)
+	// DescribeGroup メンバーを含めてグループを返します（存在しない場合はmodel.ErrGroupNotFound）
+	DescribeGroup(ctx context.Context, name string) (*model.GroupRecord, error)
+	// CreateGroup 空のグループを作成します（存在する場合はmodel.ErrGroupAlreadyExists）
+	CreateGroup(ctx context.Context, name string) error
+	// DeleteGroup グループを削除します（メンバーのユーザは削除しない）
+	DeleteGroup(ctx context.Context, name string) error
+}
@@ -0,0 +1,12 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// AuditSink 監査ログの書き込みを抽象化します
+type AuditSink interface {
+	Write(ctx context.Context, ev *model.AuditEvent) error
+}
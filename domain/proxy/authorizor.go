@@ -1,6 +1,8 @@
 package proxy
 
+import "github.com/taniyuu/gin-cognito-sample/domain/model"
+
 // AuthorizarProxy 認可操作を抽象化します
 type AuthorizarProxy interface {
-	ValidateJWT(token string) (sub, email string, err error)
+	ValidateJWT(token string) (*model.Claims, error)
 }
@@ -0,0 +1,17 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// DeviceActivityStore デバイスの最終利用状況（IP、ユーザエージェント）の保存を抽象化します
+type DeviceActivityStore interface {
+	// Touch デバイスの利用を記録します（最後の利用からttl経過すると記録は消えます）
+	Touch(ctx context.Context, deviceKey string, a *model.DeviceActivity, ttl time.Duration) error
+	// Get 記録のあるデバイスの利用状況を返します
+	Get(ctx context.Context, deviceKeys []string) (map[string]*model.DeviceActivity, error)
+	Delete(ctx context.Context, deviceKey string) error
+}
@@ -0,0 +1,9 @@
+package proxy
+
+import "context"
+
+// HealthChecker 依存先の状態確認を抽象化します
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
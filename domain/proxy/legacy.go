@@ -0,0 +1,15 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// LegacyUserStore 移行元のシステムのアカウントの参照を抽象化します
+type LegacyUserStore interface {
+	// Authenticate パスワードを照合します（存在しない、誤っている場合はmodel.ErrNotAuthorized）
+	Authenticate(ctx context.Context, email, password string) (*model.LegacyUser, error)
+	// Lookup パスワードを照合せずに参照します（存在しない場合はmodel.ErrUserNotFound）
+	Lookup(ctx context.Context, email string) (*model.LegacyUser, error)
+}
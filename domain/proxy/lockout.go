@@ -0,0 +1,16 @@
+package proxy
+
+import (
+	"context"
+	"time"
+)
+
+// LockoutStore 認証失敗回数の保存を抽象化します
+type LockoutStore interface {
+	// Get keyの失敗回数と最後に失敗した時刻を取得します（記録がない場合は0回）
+	Get(ctx context.Context, key string) (failures int, last time.Time, err error)
+	// Fail keyの失敗を記録し、失敗回数を返します。最後の失敗からttl経過すると記録は消えます
+	Fail(ctx context.Context, key string, ttl time.Duration) (failures int, err error)
+	// Reset keyの記録を削除します
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// MagicLinkTokenizer マジックリンクのトークンの発行と検証を抽象化します
+type MagicLinkTokenizer interface {
+	Mint(email string, ttl time.Duration) (string, error)
+	// Parse 署名と有効期限を検証します（不正な場合はmodel.ErrInvalidMagicLink）
+	Parse(token string) (*model.MagicLinkClaims, error)
+}
+
+// ReplayStore 一度しか使えない値の使用を記録します
+type ReplayStore interface {
+	// Consume idの使用を記録し、初めての使用であればtrueを返します（記録はttl経過後に消える）
+	Consume(ctx context.Context, id string, ttl time.Duration) (bool, error)
+}
@@ -0,0 +1,12 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// Mailer メール送信を抽象化します
+type Mailer interface {
+	Send(ctx context.Context, m *model.Mail) error
+}
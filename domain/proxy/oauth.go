@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// OAuthProxy 認可コードフロー（PKCE）の認可サーバを抽象化します
+type OAuthProxy interface {
+	// AuthorizeURL ブラウザをリダイレクトさせる認可エンドポイントのURLを返します（identityProviderは空でもよい）
+	AuthorizeURL(state, codeChallenge, identityProvider string) string
+	// ExchangeCode 認可コードをトークンに交換します
+	ExchangeCode(ctx context.Context, code, codeVerifier string) (*model.Token, error)
+}
+
+// OAuthStateStore 認可リクエストのstateと対応する値を保持します
+type OAuthStateStore interface {
+	Save(ctx context.Context, state string, s *model.OAuthState, ttl time.Duration) error
+	// Take stateの値を取り出して削除します（存在しない場合はmodel.ErrInvalidOAuthState）
+	Take(ctx context.Context, state string) (*model.OAuthState, error)
+}
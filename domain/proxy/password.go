@@ -0,0 +1,15 @@
+package proxy
+
+import "context"
+
+// BreachedPasswordChecker 漏洩済みパスワードの照合を抽象化します
+type BreachedPasswordChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordHasher パスワードのハッシュ化と照合を抽象化します
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify ハッシュの形式から方式を判別して照合します（方式を変更しても既存のハッシュを照合できる）
+	Verify(hash, password string) (bool, error)
+}
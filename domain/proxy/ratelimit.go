@@ -0,0 +1,13 @@
+package proxy
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitStore トークンバケットの状態保存を抽象化します
+type RateLimitStore interface {
+	// Take keyのバケットからトークンを1つ消費します（rateは1秒あたりの補充数、burstはバケット容量）
+	// 消費できない場合は、次に消費できるまでの待ち時間を返します
+	Take(ctx context.Context, key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error)
+}
@@ -0,0 +1,18 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// RevocationStore 失効させたトークンの保存を抽象化します
+type RevocationStore interface {
+	// RevokeToken jti/origin_jtiを失効させます（untilを過ぎると記録は消えます）
+	RevokeToken(ctx context.Context, id string, until time.Time) error
+	// RevokeSubject subに対してbeforeより前に発行されたトークンを失効させます（ttl経過すると記録は消えます）
+	RevokeSubject(ctx context.Context, sub string, before time.Time, ttl time.Duration) error
+	// IsRevoked トークンが失効しているか確認します
+	IsRevoked(ctx context.Context, c *model.Claims) (bool, error)
+}
@@ -0,0 +1,8 @@
+package proxy
+
+import "crypto/x509"
+
+// ServiceIdentityMapper クライアント証明書からサービスIDへの対応付けを抽象化します
+type ServiceIdentityMapper interface {
+	MapCertificate(cert *x509.Certificate) (identity string, ok bool)
+}
@@ -0,0 +1,12 @@
+package proxy
+
+import "github.com/taniyuu/gin-cognito-sample/domain/model"
+
+// TokenIssuer IDトークンの発行と検証を抽象化します（Cognitoを使わないバックエンドで使う）
+type TokenIssuer interface {
+	AuthorizarProxy
+	// IssueIDToken Sub、Email、Groups、OriginJTIを入れたIDトークンを発行します（JTIと有効期間は発行時に決める）
+	IssueIDToken(c *model.Claims) (string, error)
+	// PublicJWKS 検証用の公開鍵をJWKS（JSON）で返します
+	PublicJWKS() ([]byte, error)
+}
@@ -10,6 +10,7 @@ import (
 type UserProxy interface {
 	Signup(ctx context.Context, req *model.CreateReq) (uuid string, err error)
 	ConfirmAndSignin(ctx context.Context, req *model.ConfirmAndSigninReq) (*model.Token, error)
+	ResendConfirmationCode(ctx context.Context, req *model.ResendConfirmationCodeReq) error
 	Signin(ctx context.Context, req *model.SigninReq) (*model.Token, error)
 	Refresh(ctx context.Context, req *model.RefreshReq) (*model.Token, error)
 	ChangePassword(ctx context.Context, email string, req *model.ChangePasswordReq) error
@@ -18,7 +19,14 @@ type UserProxy interface {
 	GetProfile(ctx context.Context, email string) (*model.User, error)
 	ChangeProfile(ctx context.Context, email string, req *model.ChangeProfileReq) error
 	Signout(ctx context.Context, req *model.SignoutReq) error
+	GlobalSignout(ctx context.Context, email string) error
 	Invite(ctx context.Context, req *model.InviteReq) (sub string, err error)
 	RespondToInvitation(ctx context.Context, req *model.RespondToInvitationReq) (*model.Token, error)
 	GetUser(ctx context.Context, req *model.GetUserReq) (*model.User, error)
+	DisableUser(ctx context.Context, req *model.DisableUserReq) error
+	ListDevices(ctx context.Context, email string) ([]*model.Device, error)
+	ForgetDevice(ctx context.Context, email, deviceKey string) error
+	UpdateDeviceStatus(ctx context.Context, email string, req *model.UpdateDeviceStatusReq) error
+	InitiateCustomAuth(ctx context.Context, req *model.CustomAuthReq) (*model.CustomChallenge, error)
+	RespondToCustomChallenge(ctx context.Context, req *model.CustomChallengeAnswerReq) (*model.Token, error)
 }
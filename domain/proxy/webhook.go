@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// EventPublisher ユーザのライフサイクルのイベントの通知を抽象化します
+type EventPublisher interface {
+	Publish(ctx context.Context, ev *model.Event) error
+}
+
+// WebhookOutbox 配信前のWebhookを保存するアウトボックスを抽象化します（再起動しても配信を失わない）
+type WebhookOutbox interface {
+	// Enqueue 配信をまとめて保存します（全て保存されるか、全て保存されない）
+	Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error
+	// Claim 配信時刻を過ぎた未配信の配信を返し、lease後まで他のワーカーに返さないようにします
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*model.WebhookDelivery, error)
+	// Update 配信の結果（状態、試行回数、次の試行時刻、エラー、配信日時）を保存します
+	Update(ctx context.Context, d *model.WebhookDelivery) error
+	// List 条件に合う配信を新しい順に返します
+	List(ctx context.Context, f *model.WebhookDeliveryFilter) ([]*model.WebhookDelivery, error)
+	// Replay 条件に合う配信を試行回数0の未配信に戻し、件数を返します
+	Replay(ctx context.Context, f *model.WebhookDeliveryFilter, now time.Time) (int, error)
+}
@@ -0,0 +1,279 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// ListUsersの1ページの件数（APIの上限）
+const listUsersLimit = 60
+
+// NewCognitoAdminProxy UserAdminProxyを生成します（regionが空の場合はAWSの共有設定に従う）
+//
+// アプリクライアントを指定しないため、UserProxyの操作のうちログインなどクライアントを使うものは使えません。
+func NewCognitoAdminProxy(region, poolID string) proxy.UserAdminProxy {
+	opts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+	var clientID, clientSecret string
+	return &cognitoIdpClient{
+		idp:          cognitoidentityprovider.New(session.Must(session.NewSessionWithOptions(opts))),
+		poolID:       &poolID,
+		clientID:     &clientID,
+		clientSecret: &clientSecret,
+	}
+}
+
+// ImportUser AdminCreateUserでユーザを作成します
+func (cic *cognitoIdpClient) ImportUser(ctx context.Context, req *model.ImportUserReq) error {
+	acui := &cognitoidentityprovider.AdminCreateUserInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(req.Email),
+		UserAttributes: []*cognitoidentityprovider.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(req.Email)},
+		},
+	}
+	for k, v := range req.Attributes {
+		acui.UserAttributes = append(acui.UserAttributes, &cognitoidentityprovider.AttributeType{Name: aws.String(k), Value: aws.String(v)})
+	}
+	if req.SendInvitation {
+		acui.DesiredDeliveryMediums = aws.StringSlice([]string{cognitoidentityprovider.DeliveryMediumTypeEmail})
+	} else {
+		acui.MessageAction = aws.String(cognitoidentityprovider.MessageActionTypeSuppress)
+	}
+	if req.TemporaryPassword != "" {
+		acui.TemporaryPassword = aws.String(req.TemporaryPassword)
+	}
+	if _, err := cic.idp.AdminCreateUserWithContext(ctx, acui); err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// ListUsers ListUsersで1ページ分のユーザを返します
+func (cic *cognitoIdpClient) ListUsers(ctx context.Context, pageToken string) ([]*model.UserRecord, string, error) {
+	lui := &cognitoidentityprovider.ListUsersInput{
+		UserPoolId: cic.poolID,
+		Limit:      aws.Int64(listUsersLimit),
+	}
+	if pageToken != "" {
+		lui.PaginationToken = aws.String(pageToken)
+	}
+	luo, err := cic.idp.ListUsersWithContext(ctx, lui)
+	if err != nil {
+		return nil, "", convertError(err)
+	}
+	users := make([]*model.UserRecord, 0, len(luo.Users))
+	for _, u := range luo.Users {
+		users = append(users, userRecord(u))
+	}
+	return users, aws.StringValue(luo.PaginationToken), nil
+}
+
+func userRecord(u *cognitoidentityprovider.UserType) *model.UserRecord {
+	attrs := make(map[string]string, len(u.Attributes))
+	for _, a := range u.Attributes {
+		attrs[aws.StringValue(a.Name)] = aws.StringValue(a.Value)
+	}
+	return &model.UserRecord{
+		Username:   aws.StringValue(u.Username),
+		Status:     aws.StringValue(u.UserStatus),
+		Enabled:    aws.BoolValue(u.Enabled),
+		CreatedAt:  aws.TimeValue(u.UserCreateDate),
+		UpdatedAt:  aws.TimeValue(u.UserLastModifiedDate),
+		Attributes: attrs,
+	}
+}
+
+// DescribeUser AdminGetUserとAdminListGroupsForUserでユーザを返します
+func (cic *cognitoIdpClient) DescribeUser(ctx context.Context, email string) (*model.UserRecord, error) {
+	aguo, err := cic.idp.AdminGetUserWithContext(ctx, &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	u := userRecord(&cognitoidentityprovider.UserType{
+		Username:             aguo.Username,
+		UserStatus:           aguo.UserStatus,
+		Enabled:              aguo.Enabled,
+		UserCreateDate:       aguo.UserCreateDate,
+		UserLastModifiedDate: aguo.UserLastModifiedDate,
+		Attributes:           aguo.UserAttributes,
+	})
+	algfui := &cognitoidentityprovider.AdminListGroupsForUserInput{
+		UserPoolId: cic.poolID,
+		Username:   aguo.Username,
+	}
+	for {
+		algfuo, err := cic.idp.AdminListGroupsForUserWithContext(ctx, algfui)
+		if err != nil {
+			return nil, convertError(err)
+		}
+		for _, g := range algfuo.Groups {
+			u.Groups = append(u.Groups, aws.StringValue(g.GroupName))
+		}
+		if algfuo.NextToken == nil {
+			return u, nil
+		}
+		algfui.NextToken = algfuo.NextToken
+	}
+}
+
+// EnableUser 無効化したユーザを有効にします
+func (cic *cognitoIdpClient) EnableUser(ctx context.Context, email string) error {
+	if _, err := cic.idp.AdminEnableUserWithContext(ctx, &cognitoidentityprovider.AdminEnableUserInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+	}); err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// DeleteUser ユーザを削除します
+func (cic *cognitoIdpClient) DeleteUser(ctx context.Context, email string) error {
+	if _, err := cic.idp.AdminDeleteUserWithContext(ctx, &cognitoidentityprovider.AdminDeleteUserInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+	}); err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// ResetPassword AdminResetUserPasswordでパスワードをリセットします（ユーザはRESET_REQUIREDになる）
+func (cic *cognitoIdpClient) ResetPassword(ctx context.Context, email string) error {
+	if _, err := cic.idp.AdminResetUserPasswordWithContext(ctx, &cognitoidentityprovider.AdminResetUserPasswordInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+	}); err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// AddUserToGroup ユーザを既存のグループに追加します（グループがない場合はmodel.ErrGroupNotFound）
+func (cic *cognitoIdpClient) AddUserToGroup(ctx context.Context, email, group string) error {
+	if _, err := cic.idp.AdminAddUserToGroupWithContext(ctx, &cognitoidentityprovider.AdminAddUserToGroupInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+		GroupName:  aws.String(group),
+	}); err != nil {
+		return convertGroupError(err)
+	}
+	return nil
+}
+
+// RemoveUserFromGroup ユーザをグループから外します
+func (cic *cognitoIdpClient) RemoveUserFromGroup(ctx context.Context, email, group string) error {
+	if _, err := cic.idp.AdminRemoveUserFromGroupWithContext(ctx, &cognitoidentityprovider.AdminRemoveUserFromGroupInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+		GroupName:  aws.String(group),
+	}); err != nil {
+		return convertGroupError(err)
+	}
+	return nil
+}
+
+// ListGroups ListGroupsで1ページ分のグループを返します
+func (cic *cognitoIdpClient) ListGroups(ctx context.Context, pageToken string) ([]*model.GroupRecord, string, error) {
+	lgi := &cognitoidentityprovider.ListGroupsInput{
+		UserPoolId: cic.poolID,
+		Limit:      aws.Int64(listUsersLimit),
+	}
+	if pageToken != "" {
+		lgi.NextToken = aws.String(pageToken)
+	}
+	lgo, err := cic.idp.ListGroupsWithContext(ctx, lgi)
+	if err != nil {
+		return nil, "", convertError(err)
+	}
+	groups := make([]*model.GroupRecord, 0, len(lgo.Groups))
+	for _, g := range lgo.Groups {
+		groups = append(groups, groupRecord(g))
+	}
+	return groups, aws.StringValue(lgo.NextToken), nil
+}
+
+func groupRecord(g *cognitoidentityprovider.GroupType) *model.GroupRecord {
+	return &model.GroupRecord{
+		Name:      aws.StringValue(g.GroupName),
+		CreatedAt: aws.TimeValue(g.CreationDate),
+		UpdatedAt: aws.TimeValue(g.LastModifiedDate),
+	}
+}
+
+// DescribeGroup GetGroupとListUsersInGroupでグループを返します
+func (cic *cognitoIdpClient) DescribeGroup(ctx context.Context, name string) (*model.GroupRecord, error) {
+	ggo, err := cic.idp.GetGroupWithContext(ctx, &cognitoidentityprovider.GetGroupInput{
+		UserPoolId: cic.poolID,
+		GroupName:  aws.String(name),
+	})
+	if err != nil {
+		return nil, convertGroupError(err)
+	}
+	g := groupRecord(ggo.Group)
+	luigi := &cognitoidentityprovider.ListUsersInGroupInput{
+		UserPoolId: cic.poolID,
+		GroupName:  aws.String(name),
+		Limit:      aws.Int64(listUsersLimit),
+	}
+	for {
+		luigo, err := cic.idp.ListUsersInGroupWithContext(ctx, luigi)
+		if err != nil {
+			return nil, convertGroupError(err)
+		}
+		for _, u := range luigo.Users {
+			r := userRecord(u)
+			g.Members = append(g.Members, &model.GroupMember{Sub: r.Attributes["sub"], Username: r.Username})
+		}
+		if luigo.NextToken == nil {
+			return g, nil
+		}
+		luigi.NextToken = luigo.NextToken
+	}
+}
+
+// CreateGroup グループを作成します
+func (cic *cognitoIdpClient) CreateGroup(ctx context.Context, name string) error {
+	if _, err := cic.idp.CreateGroupWithContext(ctx, &cognitoidentityprovider.CreateGroupInput{
+		UserPoolId: cic.poolID,
+		GroupName:  aws.String(name),
+	}); err != nil {
+		if isAWSErrorCode(err, cognitoidentityprovider.ErrCodeGroupExistsException) {
+			return errors.Wrap(model.ErrGroupAlreadyExists, name)
+		}
+		return convertError(err)
+	}
+	return nil
+}
+
+// DeleteGroup グループを削除します
+func (cic *cognitoIdpClient) DeleteGroup(ctx context.Context, name string) error {
+	if _, err := cic.idp.DeleteGroupWithContext(ctx, &cognitoidentityprovider.DeleteGroupInput{
+		UserPoolId: cic.poolID,
+		GroupName:  aws.String(name),
+	}); err != nil {
+		return convertGroupError(err)
+	}
+	return nil
+}
+
+// convertGroupError グループの操作ではResourceNotFoundExceptionをグループがないものとして扱います
+func convertGroupError(err error) error {
+	if isAWSErrorCode(err, cognitoidentityprovider.ErrCodeResourceNotFoundException) {
+		return errors.Wrap(model.ErrGroupNotFound, err.Error())
+	}
+	return convertError(err)
+}
@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/taniyuu/gin-cognito-sample/domain/model"
 	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
 	"github.com/lestrrat-go/jwx/v2/jwk"
@@ -20,20 +23,36 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ヘルスチェックでのDescribeUserPoolのタイムアウト
+const cognitoCheckTimeout = 2 * time.Second
+
+// ログインに使う認証フロー
+const (
+	// AuthFlowUserPassword パスワードをそのまま送る（アプリクライアントでALLOW_USER_PASSWORD_AUTHが必要）
+	AuthFlowUserPassword = "user_password"
+	// AuthFlowUserSRP パスワードを送らずにSRPで検証する（ALLOW_USER_SRP_AUTHが必要）
+	AuthFlowUserSRP = "user_srp"
+)
+
 // Amazon Cognitoに対する操作を提供します
 type cognitoIdpClient struct {
 	idp                            *cognitoidentityprovider.CognitoIdentityProvider
 	poolID, clientID, clientSecret *string
+	authFlow                       string
+	// legacy ユーザプールに存在しないアカウントをログイン時に移行する移行元（nilの場合は移行しない）
+	legacy proxy.LegacyUserStore
 }
 
-// NewCognitoProxy AuthenticatorProxyを生成します
-func NewCognitoProxy(poolID, clientID, clientSecret string) proxy.UserProxy {
+// NewCognitoProxy AuthenticatorProxyを生成します（legacyを指定すると、ログイン時に移行元からアカウントを移行する）
+func NewCognitoProxy(poolID, clientID, clientSecret, authFlow string, legacy proxy.LegacyUserStore) proxy.UserProxy {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 	return &cognitoIdpClient{
 		cognitoidentityprovider.New(sess),
 		&poolID, &clientID, &clientSecret,
+		authFlow,
+		legacy,
 	}
 }
 
@@ -77,7 +96,7 @@ func (cic *cognitoIdpClient) Signup(ctx context.Context, req *model.CreateReq) (
 
 	suo, err := cic.idp.SignUpWithContext(ctx, newUserData)
 	if err != nil {
-		return "", errors.WithStack(err)
+		return "", convertError(err)
 	}
 	log.Default().Println(suo)
 	return *suo.UserSub, nil
@@ -87,8 +106,8 @@ func (cic *cognitoIdpClient) Signup(ctx context.Context, req *model.CreateReq) (
 func (cic *cognitoIdpClient) ConfirmAndSignin(ctx context.Context, req *model.ConfirmAndSigninReq) (*model.Token, error) {
 	// 確認した後ログイン失敗の事象を回避するために一度ログインを試行する
 	_, err := cic.Signin(ctx, &model.SigninReq{Email: req.Email, Password: req.Password})
-	if err != nil && strings.HasPrefix(errors.Unwrap(err).Error(), "NotAuthorizedException") {
-		return nil, errors.WithStack(err)
+	if errors.Is(err, model.ErrNotAuthorized) {
+		return nil, err
 	}
 
 	csi := &cognitoidentityprovider.ConfirmSignUpInput{
@@ -99,7 +118,7 @@ func (cic *cognitoIdpClient) ConfirmAndSignin(ctx context.Context, req *model.Co
 	}
 	_, err = cic.idp.ConfirmSignUpWithContext(ctx, csi)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, convertError(err)
 	}
 
 	resp, err := cic.Signin(ctx, &model.SigninReq{Email: req.Email, Password: req.Password})
@@ -109,16 +128,205 @@ func (cic *cognitoIdpClient) ConfirmAndSignin(ctx context.Context, req *model.Co
 	return resp, nil
 }
 
-// Signin ログイン
+// ResendConfirmationCode 確認コード再送
+func (cic *cognitoIdpClient) ResendConfirmationCode(ctx context.Context, req *model.ResendConfirmationCodeReq) error {
+	rcci := &cognitoidentityprovider.ResendConfirmationCodeInput{
+		ClientId:   cic.clientID,
+		SecretHash: aws.String(cic.calcSecretHash(req.Email)),
+		Username:   aws.String(req.Email),
+	}
+	rcco, err := cic.idp.ResendConfirmationCodeWithContext(ctx, rcci)
+	if err != nil {
+		return convertError(err)
+	}
+	log.Default().Println(rcco)
+	return nil
+}
+
+// Signin ログイン（記憶済みのデバイスであればデバイス認証を行い、新しいデバイスは登録する）
 func (cic *cognitoIdpClient) Signin(ctx context.Context, req *model.SigninReq) (*model.Token, error) {
 	aiao, err := cic.initiateAuthWithContext(ctx, req)
+	if errors.Is(err, model.ErrUserNotFound) && cic.legacy != nil {
+		if err = cic.migrateUser(ctx, req); err != nil {
+			return nil, err
+		}
+		aiao, err = cic.initiateAuthWithContext(ctx, req)
+	}
+	if errors.Is(err, model.ErrUserNotFound) {
+		// 存在しないアカウントは誤ったパスワードと区別しない
+		return nil, errors.Wrap(model.ErrNotAuthorized, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
+	result := aiao.AuthenticationResult
+	if aws.StringValue(aiao.ChallengeName) == cognitoidentityprovider.ChallengeNameTypeDeviceSrpAuth && req.Device != nil {
+		if result, err = cic.respondToDeviceSRPAuth(ctx, aiao, req.Device); err != nil {
+			return nil, err
+		}
+	}
 	// MFAなどの場合nilの可能性もあるので注意
-	return &model.Token{
-		IDToken:      *aiao.AuthenticationResult.IdToken,
-		RefreshToken: aiao.AuthenticationResult.RefreshToken}, nil
+	if result == nil {
+		return nil, errors.WithStack(fmt.Errorf("unsupported challenge: %s", aws.StringValue(aiao.ChallengeName)))
+	}
+	token := &model.Token{
+		IDToken:      *result.IdToken,
+		RefreshToken: result.RefreshToken}
+	if result.NewDeviceMetadata != nil {
+		if token.NewDevice, err = cic.confirmDevice(ctx, result, req); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// migrateUser 移行元でパスワードを照合し、確認済みのアカウントとしてユーザプールに作成します
+//
+// User Migrationトリガを設定できない場合に使います（トリガと同じ属性で作成する）。
+func (cic *cognitoIdpClient) migrateUser(ctx context.Context, req *model.SigninReq) error {
+	u, err := cic.legacy.Authenticate(ctx, req.Email, req.Password)
+	if err != nil {
+		return err
+	}
+	acui := &cognitoidentityprovider.AdminCreateUserInput{
+		UserPoolId:    cic.poolID,
+		Username:      aws.String(req.Email),
+		MessageAction: aws.String(cognitoidentityprovider.MessageActionTypeSuppress),
+	}
+	for k, v := range u.UserAttributes() {
+		acui.UserAttributes = append(acui.UserAttributes, &cognitoidentityprovider.AttributeType{Name: aws.String(k), Value: aws.String(v)})
+	}
+	if _, err := cic.idp.AdminCreateUserWithContext(ctx, acui); err != nil {
+		if isAWSErrorCode(err, cognitoidentityprovider.ErrCodeUsernameExistsException) {
+			// 同時に行われた別のログインで移行済み
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	asupi := &cognitoidentityprovider.AdminSetUserPasswordInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(req.Email),
+		Password:   aws.String(req.Password),
+		Permanent:  aws.Bool(true),
+	}
+	if _, err := cic.idp.AdminSetUserPasswordWithContext(ctx, asupi); err != nil {
+		// パスワードポリシーを満たさない場合など、仮パスワードのアカウントを残さないよう削除する
+		adui := &cognitoidentityprovider.AdminDeleteUserInput{
+			UserPoolId: cic.poolID,
+			Username:   aws.String(req.Email),
+		}
+		if _, derr := cic.idp.AdminDeleteUserWithContext(ctx, adui); derr != nil {
+			// 削除できないと、次のログインは移行されずに仮パスワードのアカウントで失敗し続ける
+			derr = errors.Wrapf(derr, "delete half-migrated user %s", req.Email)
+			log.Default().Printf("%+v", derr)
+			return errors.Wrapf(err, "set migrated user password (cleanup failed: %v)", derr)
+		}
+		return errors.Wrap(err, "set migrated user password")
+	}
+	log.Default().Printf("migrated legacy user %s", req.Email)
+	return nil
+}
+
+// respondToDeviceSRPAuth DEVICE_SRP_AUTH、DEVICE_PASSWORD_VERIFIERチャレンジに応答します
+func (cic *cognitoIdpClient) respondToDeviceSRPAuth(
+	ctx context.Context,
+	aiao *cognitoidentityprovider.InitiateAuthOutput,
+	device *model.DeviceCredentials,
+) (*cognitoidentityprovider.AuthenticationResultType, error) {
+	username := aws.StringValue(aiao.ChallengeParameters["USERNAME"])
+	srp, err := newSRPSession()
+	if err != nil {
+		return nil, err
+	}
+	rtaci := &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:      cic.clientID,
+		ChallengeName: aws.String(cognitoidentityprovider.ChallengeNameTypeDeviceSrpAuth),
+		Session:       aiao.Session,
+		ChallengeResponses: map[string]*string{
+			"USERNAME":    aws.String(username),
+			"DEVICE_KEY":  aws.String(device.Key),
+			"SRP_A":       aws.String(srp.SRPA()),
+			"SECRET_HASH": aws.String(cic.calcSecretHash(username)),
+		},
+	}
+	rtaco, err := cic.idp.RespondToAuthChallengeWithContext(ctx, rtaci)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	params := rtaco.ChallengeParameters
+	if v := aws.StringValue(params["USERNAME"]); v != "" {
+		username = v
+	}
+	signature, timestamp, err := srp.passwordClaim(
+		device.GroupKey, device.Key, device.Password,
+		aws.StringValue(params["SALT"]), aws.StringValue(params["SRP_B"]), aws.StringValue(params["SECRET_BLOCK"]),
+		time.Now())
+	if err != nil {
+		return nil, err
+	}
+	rtaci = &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:      cic.clientID,
+		ChallengeName: aws.String(cognitoidentityprovider.ChallengeNameTypeDevicePasswordVerifier),
+		Session:       rtaco.Session,
+		ChallengeResponses: map[string]*string{
+			"USERNAME":                    aws.String(username),
+			"DEVICE_KEY":                  aws.String(device.Key),
+			"PASSWORD_CLAIM_SECRET_BLOCK": params["SECRET_BLOCK"],
+			"PASSWORD_CLAIM_SIGNATURE":    aws.String(signature),
+			"TIMESTAMP":                   aws.String(timestamp),
+			"SECRET_HASH":                 aws.String(cic.calcSecretHash(username)),
+		},
+	}
+	if rtaco, err = cic.idp.RespondToAuthChallengeWithContext(ctx, rtaci); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rtaco.AuthenticationResult, nil
+}
+
+// confirmDevice ログインしたデバイスを登録し、記憶するかを設定します
+func (cic *cognitoIdpClient) confirmDevice(
+	ctx context.Context,
+	result *cognitoidentityprovider.AuthenticationResultType,
+	req *model.SigninReq,
+) (*model.DeviceCredentials, error) {
+	device := &model.DeviceCredentials{
+		Key:      aws.StringValue(result.NewDeviceMetadata.DeviceKey),
+		GroupKey: aws.StringValue(result.NewDeviceMetadata.DeviceGroupKey),
+	}
+	password, verifier, salt, err := newDeviceVerifier(device.GroupKey, device.Key)
+	if err != nil {
+		return nil, err
+	}
+	device.Password = password
+	cdi := &cognitoidentityprovider.ConfirmDeviceInput{
+		AccessToken: result.AccessToken,
+		DeviceKey:   aws.String(device.Key),
+		DeviceSecretVerifierConfig: &cognitoidentityprovider.DeviceSecretVerifierConfigType{
+			PasswordVerifier: aws.String(verifier),
+			Salt:             aws.String(salt),
+		},
+	}
+	if req.DeviceName != "" {
+		cdi.DeviceName = aws.String(req.DeviceName)
+	}
+	cdo, err := cic.idp.ConfirmDeviceWithContext(ctx, cdi)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	log.Default().Println(cdo)
+	status := cognitoidentityprovider.DeviceRememberedStatusTypeNotRemembered
+	if req.RememberDevice {
+		status = cognitoidentityprovider.DeviceRememberedStatusTypeRemembered
+	}
+	udsi := &cognitoidentityprovider.UpdateDeviceStatusInput{
+		AccessToken:            result.AccessToken,
+		DeviceKey:              aws.String(device.Key),
+		DeviceRememberedStatus: aws.String(status),
+	}
+	if _, err := cic.idp.UpdateDeviceStatusWithContext(ctx, udsi); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return device, nil
 }
 
 // Refresh トークンリフレッシュ
@@ -131,9 +339,12 @@ func (cic *cognitoIdpClient) Refresh(ctx context.Context, req *model.RefreshReq)
 			"SECRET_HASH":   aws.String(cic.calcSecretHash(req.Sub)),
 		},
 	}
+	if req.DeviceKey != "" {
+		iai.AuthParameters["DEVICE_KEY"] = aws.String(req.DeviceKey)
+	}
 	iao, err := cic.idp.InitiateAuthWithContext(ctx, iai)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, convertError(err)
 	}
 	log.Default().Println(iao)
 	return &model.Token{IDToken: *iao.AuthenticationResult.IdToken}, nil
@@ -163,7 +374,7 @@ func (cic *cognitoIdpClient) ForgotPassword(ctx context.Context, req *model.Forg
 	}
 	_, err := cic.idp.ForgotPasswordWithContext(ctx, fpi)
 	if err != nil {
-		return errors.WithStack(err)
+		return convertError(err)
 	}
 	return nil
 }
@@ -179,7 +390,7 @@ func (cic *cognitoIdpClient) ConfirmForgotPassword(ctx context.Context, req *mod
 	}
 	_, err := cic.idp.ConfirmForgotPasswordWithContext(ctx, cfpi)
 	if err != nil {
-		return errors.WithStack(err)
+		return convertError(err)
 	}
 	return nil
 }
@@ -192,7 +403,7 @@ func (cic *cognitoIdpClient) GetProfile(ctx context.Context, email string) (*mod
 	}
 	aguo, err := cic.idp.AdminGetUserWithContext(ctx, agui)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, convertError(err)
 	}
 	log.Default().Println(aguo)
 	return cic.convertToUserModel(aguo.UserAttributes), nil
@@ -230,6 +441,20 @@ func (cic *cognitoIdpClient) Signout(ctx context.Context, req *model.SignoutReq)
 	return nil
 }
 
+// GlobalSignout 全てのリフレッシュトークンを失効
+func (cic *cognitoIdpClient) GlobalSignout(ctx context.Context, email string) error {
+	augsoi := &cognitoidentityprovider.AdminUserGlobalSignOutInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+	}
+	augsoo, err := cic.idp.AdminUserGlobalSignOutWithContext(ctx, augsoi)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	log.Default().Println(augsoo)
+	return nil
+}
+
 // Invite 招待
 func (cic *cognitoIdpClient) Invite(ctx context.Context, req *model.InviteReq) (string, error) {
 	// 招待は２重送信を拒否する（アカウントの存在を確認してから送信する）
@@ -296,9 +521,175 @@ func (cic *cognitoIdpClient) RespondToInvitation(ctx context.Context, req *model
 
 // GetUser subで検索
 func (cic *cognitoIdpClient) GetUser(ctx context.Context, req *model.GetUserReq) (*model.User, error) {
+	ut, err := cic.findUserBySub(ctx, req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	return cic.convertToUserModel(ut.Attributes), nil
+}
+
+// DisableUser subで検索したユーザを無効化
+func (cic *cognitoIdpClient) DisableUser(ctx context.Context, req *model.DisableUserReq) error {
+	ut, err := cic.findUserBySub(ctx, req.Sub)
+	if err != nil {
+		return err
+	}
+	adui := &cognitoidentityprovider.AdminDisableUserInput{
+		UserPoolId: cic.poolID,
+		Username:   ut.Username,
+	}
+	aduo, err := cic.idp.AdminDisableUserWithContext(ctx, adui)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	log.Default().Println(aduo)
+	return nil
+}
+
+// ListDevices ユーザのデバイス一覧
+func (cic *cognitoIdpClient) ListDevices(ctx context.Context, email string) ([]*model.Device, error) {
+	var devices []*model.Device
+	aldi := &cognitoidentityprovider.AdminListDevicesInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+		Limit:      aws.Int64(60),
+	}
+	for {
+		aldo, err := cic.idp.AdminListDevicesWithContext(ctx, aldi)
+		if err != nil {
+			return nil, convertError(err)
+		}
+		for _, d := range aldo.Devices {
+			devices = append(devices, convertToDeviceModel(d))
+		}
+		if aws.StringValue(aldo.PaginationToken) == "" {
+			return devices, nil
+		}
+		aldi.PaginationToken = aldo.PaginationToken
+	}
+}
+
+// ForgetDevice デバイスの登録を削除（以降そのデバイスキーでのリフレッシュはできない）
+func (cic *cognitoIdpClient) ForgetDevice(ctx context.Context, email, deviceKey string) error {
+	afdi := &cognitoidentityprovider.AdminForgetDeviceInput{
+		UserPoolId: cic.poolID,
+		Username:   aws.String(email),
+		DeviceKey:  aws.String(deviceKey),
+	}
+	afdo, err := cic.idp.AdminForgetDeviceWithContext(ctx, afdi)
+	if err != nil {
+		return convertError(err)
+	}
+	log.Default().Println(afdo)
+	return nil
+}
+
+// UpdateDeviceStatus デバイスを記憶するかを変更
+func (cic *cognitoIdpClient) UpdateDeviceStatus(ctx context.Context, email string, req *model.UpdateDeviceStatusReq) error {
+	status := cognitoidentityprovider.DeviceRememberedStatusTypeNotRemembered
+	if req.Remembered {
+		status = cognitoidentityprovider.DeviceRememberedStatusTypeRemembered
+	}
+	audsi := &cognitoidentityprovider.AdminUpdateDeviceStatusInput{
+		UserPoolId:             cic.poolID,
+		Username:               aws.String(email),
+		DeviceKey:              aws.String(req.DeviceKey),
+		DeviceRememberedStatus: aws.String(status),
+	}
+	audso, err := cic.idp.AdminUpdateDeviceStatusWithContext(ctx, audsi)
+	if err != nil {
+		return convertError(err)
+	}
+	log.Default().Println(audso)
+	return nil
+}
+
+// InitiateCustomAuth CUSTOM_AUTHでログインを開始（チャレンジはトリガで作成する）
+//
+// InitiateAuthのClientMetadataはチャレンジ作成のトリガに渡らないため、最初のチャレンジに認証方法を回答し、
+// 認証方法毎のチャレンジを返します。
+func (cic *cognitoIdpClient) InitiateCustomAuth(ctx context.Context, req *model.CustomAuthReq) (*model.CustomChallenge, error) {
+	iai := &cognitoidentityprovider.InitiateAuthInput{
+		ClientId: cic.clientID,
+		AuthFlow: aws.String(cognitoidentityprovider.AuthFlowTypeCustomAuth),
+		AuthParameters: map[string]*string{
+			"USERNAME":    aws.String(req.Email),
+			"SECRET_HASH": aws.String(cic.calcSecretHash(req.Email)),
+		},
+	}
+	iao, err := cic.idp.InitiateAuthWithContext(ctx, iai)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	log.Default().Println(iao)
+	if aws.StringValue(iao.ChallengeName) != cognitoidentityprovider.ChallengeNameTypeCustomChallenge ||
+		aws.StringValue(iao.ChallengeParameters[model.CustomChallengeStepKey]) != model.CustomChallengeStepMethod {
+		return nil, errors.WithStack(fmt.Errorf("unexpected challenge: %s", aws.StringValue(iao.ChallengeName)))
+	}
+	rtaci := &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:      cic.clientID,
+		ChallengeName: iao.ChallengeName,
+		Session:       iao.Session,
+		ChallengeResponses: map[string]*string{
+			"USERNAME":    aws.String(req.Email),
+			"ANSWER":      aws.String(req.Metadata[model.CustomAuthMethodKey]),
+			"SECRET_HASH": aws.String(cic.calcSecretHash(req.Email)),
+		},
+		ClientMetadata: aws.StringMap(req.Metadata),
+	}
+	rtaco, err := cic.idp.RespondToAuthChallengeWithContext(ctx, rtaci)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	log.Default().Println(rtaco)
+	if aws.StringValue(rtaco.ChallengeName) != cognitoidentityprovider.ChallengeNameTypeCustomChallenge {
+		return nil, errors.WithStack(fmt.Errorf("unexpected challenge: %s", aws.StringValue(rtaco.ChallengeName)))
+	}
+	return &model.CustomChallenge{
+		Session:    aws.StringValue(rtaco.Session),
+		Parameters: aws.StringValueMap(rtaco.ChallengeParameters),
+	}, nil
+}
+
+// RespondToCustomChallenge CUSTOM_CHALLENGEに回答
+func (cic *cognitoIdpClient) RespondToCustomChallenge(ctx context.Context, req *model.CustomChallengeAnswerReq) (*model.Token, error) {
+	rtaci := &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:      cic.clientID,
+		ChallengeName: aws.String(cognitoidentityprovider.ChallengeNameTypeCustomChallenge),
+		Session:       aws.String(req.Session),
+		ChallengeResponses: map[string]*string{
+			"USERNAME":    aws.String(req.Email),
+			"ANSWER":      aws.String(req.Answer),
+			"SECRET_HASH": aws.String(cic.calcSecretHash(req.Email)),
+		},
+		ClientMetadata: aws.StringMap(req.Metadata),
+	}
+	rtaco, err := cic.idp.RespondToAuthChallengeWithContext(ctx, rtaci)
+	if err != nil {
+		// 回答の誤りが上限に達した場合や、セッションが無効な場合
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cognitoidentityprovider.ErrCodeNotAuthorizedException {
+			return nil, errors.Wrap(&model.InvalidChallengeAnswerError{}, aerr.Message())
+		}
+		return nil, convertError(err)
+	}
+	log.Default().Println(rtaco)
+	if rtaco.AuthenticationResult == nil {
+		// 誤った回答で、再回答できる場合は次のチャレンジが返る
+		if aws.StringValue(rtaco.ChallengeName) == cognitoidentityprovider.ChallengeNameTypeCustomChallenge {
+			return nil, errors.WithStack(&model.InvalidChallengeAnswerError{Session: aws.StringValue(rtaco.Session)})
+		}
+		return nil, errors.WithStack(fmt.Errorf("unexpected challenge: %s", aws.StringValue(rtaco.ChallengeName)))
+	}
+	return &model.Token{
+		IDToken:      *rtaco.AuthenticationResult.IdToken,
+		RefreshToken: rtaco.AuthenticationResult.RefreshToken,
+	}, nil
+}
+
+func (cic *cognitoIdpClient) findUserBySub(ctx context.Context, sub string) (*cognitoidentityprovider.UserType, error) {
 	lui := &cognitoidentityprovider.ListUsersInput{
 		UserPoolId: cic.poolID,
-		Filter:     aws.String(fmt.Sprintf(`sub = "%s"`, req.Sub)),
+		Filter:     aws.String(fmt.Sprintf(`sub = "%s"`, sub)),
 	}
 	luo, err := cic.idp.ListUsersWithContext(ctx, lui)
 	if err != nil {
@@ -306,9 +697,60 @@ func (cic *cognitoIdpClient) GetUser(ctx context.Context, req *model.GetUserReq)
 	}
 	log.Default().Println(luo)
 	if len(luo.Users) == 0 {
-		return nil, errors.WithStack(fmt.Errorf("user not found"))
+		return nil, errors.WithStack(model.ErrUserNotFound)
+	}
+	return luo.Users[0], nil
+}
+
+// Name ヘルスチェック名
+func (cic *cognitoIdpClient) Name() string {
+	return "cognito"
+}
+
+// Check ユーザプールを参照できることを確認します
+func (cic *cognitoIdpClient) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, cognitoCheckTimeout)
+	defer cancel()
+	_, err := cic.idp.DescribeUserPoolWithContext(ctx, &cognitoidentityprovider.DescribeUserPoolInput{
+		UserPoolId: cic.poolID,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// convertError アカウントの状態を表すCognitoのエラーをドメインのエラーに変換します
+func convertError(err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return errors.WithStack(err)
 	}
-	return cic.convertToUserModel(luo.Users[0].Attributes), nil
+	switch {
+	case aerr.Code() == cognitoidentityprovider.ErrCodeUsernameExistsException:
+		return errors.Wrap(model.ErrUserAlreadyExists, aerr.Message())
+	case aerr.Code() == cognitoidentityprovider.ErrCodeUserNotFoundException:
+		return errors.Wrap(model.ErrUserNotFound, aerr.Message())
+	case aerr.Code() == cognitoidentityprovider.ErrCodeInvalidParameterException &&
+		strings.Contains(aerr.Message(), "already confirmed"):
+		return errors.Wrap(model.ErrUserAlreadyConfirmed, aerr.Message())
+	case aerr.Code() == cognitoidentityprovider.ErrCodeTooManyRequestsException:
+		return errors.Wrap(model.ErrTooManyRequests, aerr.Message())
+	case aerr.Code() == cognitoidentityprovider.ErrCodeNotAuthorizedException:
+		return errors.Wrap(model.ErrNotAuthorized, aerr.Message())
+	case aerr.Code() == cognitoidentityprovider.ErrCodeUserNotConfirmedException:
+		return errors.Wrap(model.ErrUserNotConfirmed, aerr.Message())
+	case aerr.Code() == cognitoidentityprovider.ErrCodeCodeMismatchException,
+		aerr.Code() == cognitoidentityprovider.ErrCodeExpiredCodeException:
+		return errors.Wrap(model.ErrInvalidCode, aerr.Message())
+	}
+	return errors.WithStack(err)
+}
+
+// isAWSErrorCode WithStackなどで包まれたAWSのエラーのコードを判定します
+func isAWSErrorCode(err error, code string) bool {
+	aerr, ok := errors.Cause(err).(awserr.Error)
+	return ok && aerr.Code() == code
 }
 
 func (cic *cognitoIdpClient) calcSecretHash(username string) string {
@@ -318,6 +760,9 @@ func (cic *cognitoIdpClient) calcSecretHash(username string) string {
 }
 
 func (cic *cognitoIdpClient) initiateAuthWithContext(ctx context.Context, req *model.SigninReq) (*cognitoidentityprovider.InitiateAuthOutput, error) {
+	if cic.authFlow == AuthFlowUserSRP {
+		return cic.initiateSRPAuthWithContext(ctx, req)
+	}
 	iai := &cognitoidentityprovider.InitiateAuthInput{
 		ClientId: cic.clientID,
 		AuthFlow: aws.String(cognitoidentityprovider.AuthFlowTypeUserPasswordAuth),
@@ -327,14 +772,84 @@ func (cic *cognitoIdpClient) initiateAuthWithContext(ctx context.Context, req *m
 			"SECRET_HASH": aws.String(cic.calcSecretHash(req.Email)),
 		},
 	}
+	if req.Device != nil {
+		iai.AuthParameters["DEVICE_KEY"] = aws.String(req.Device.Key)
+	}
 	aiao, err := cic.idp.InitiateAuthWithContext(ctx, iai)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, convertError(err)
 	}
 	log.Default().Println(aiao)
 	return aiao, nil
 }
 
+// initiateSRPAuthWithContext USER_SRP_AUTHで認証し、PASSWORD_VERIFIERチャレンジに応答します
+//
+// 応答後の結果（トークンまたは次のチャレンジ）をUSER_PASSWORD_AUTHと同じ形で返します。
+func (cic *cognitoIdpClient) initiateSRPAuthWithContext(ctx context.Context, req *model.SigninReq) (*cognitoidentityprovider.InitiateAuthOutput, error) {
+	srp, err := newSRPSession()
+	if err != nil {
+		return nil, err
+	}
+	iai := &cognitoidentityprovider.InitiateAuthInput{
+		ClientId: cic.clientID,
+		AuthFlow: aws.String(cognitoidentityprovider.AuthFlowTypeUserSrpAuth),
+		AuthParameters: map[string]*string{
+			"USERNAME":    aws.String(req.Email),
+			"SRP_A":       aws.String(srp.SRPA()),
+			"SECRET_HASH": aws.String(cic.calcSecretHash(req.Email)),
+		},
+	}
+	if req.Device != nil {
+		iai.AuthParameters["DEVICE_KEY"] = aws.String(req.Device.Key)
+	}
+	iao, err := cic.idp.InitiateAuthWithContext(ctx, iai)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if aws.StringValue(iao.ChallengeName) != cognitoidentityprovider.ChallengeNameTypePasswordVerifier {
+		return nil, errors.WithStack(fmt.Errorf("unexpected challenge: %s", aws.StringValue(iao.ChallengeName)))
+	}
+	params := iao.ChallengeParameters
+	// メールアドレスをエイリアスにしている場合、SRPの計算には内部のユーザ名を使う
+	username := aws.StringValue(params["USER_ID_FOR_SRP"])
+	// ユーザプールIDの"_"以降がSRPのプール名になる
+	poolName := (*cic.poolID)[strings.Index(*cic.poolID, "_")+1:]
+	signature, timestamp, err := srp.passwordClaim(
+		poolName, username, req.Password,
+		aws.StringValue(params["SALT"]), aws.StringValue(params["SRP_B"]), aws.StringValue(params["SECRET_BLOCK"]),
+		time.Now())
+	if err != nil {
+		return nil, err
+	}
+	rtaci := &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:      cic.clientID,
+		ChallengeName: iao.ChallengeName,
+		Session:       iao.Session,
+		ChallengeResponses: map[string]*string{
+			"USERNAME":                    aws.String(username),
+			"PASSWORD_CLAIM_SECRET_BLOCK": params["SECRET_BLOCK"],
+			"PASSWORD_CLAIM_SIGNATURE":    aws.String(signature),
+			"TIMESTAMP":                   aws.String(timestamp),
+			"SECRET_HASH":                 aws.String(cic.calcSecretHash(username)),
+		},
+	}
+	if req.Device != nil {
+		rtaci.ChallengeResponses["DEVICE_KEY"] = aws.String(req.Device.Key)
+	}
+	rtaco, err := cic.idp.RespondToAuthChallengeWithContext(ctx, rtaci)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	log.Default().Println(rtaco)
+	return &cognitoidentityprovider.InitiateAuthOutput{
+		AuthenticationResult: rtaco.AuthenticationResult,
+		ChallengeName:        rtaco.ChallengeName,
+		ChallengeParameters:  rtaco.ChallengeParameters,
+		Session:              rtaco.Session,
+	}, nil
+}
+
 func (cic *cognitoIdpClient) convertToUserModel(attrs []*cognitoidentityprovider.AttributeType) *model.User {
 	u := new(model.User)
 	for _, attr := range attrs {
@@ -348,37 +863,141 @@ func (cic *cognitoIdpClient) convertToUserModel(attrs []*cognitoidentityprovider
 	return u
 }
 
+func convertToDeviceModel(d *cognitoidentityprovider.DeviceType) *model.Device {
+	m := &model.Device{
+		Key:                 aws.StringValue(d.DeviceKey),
+		CreatedAt:           aws.TimeValue(d.DeviceCreateDate),
+		LastAuthenticatedAt: aws.TimeValue(d.DeviceLastAuthenticatedDate),
+	}
+	for _, attr := range d.DeviceAttributes {
+		switch aws.StringValue(attr.Name) {
+		case "device_name":
+			m.Name = aws.StringValue(attr.Value)
+		case "dev:device_remembered_status":
+			m.Remembered = aws.StringValue(attr.Value) == cognitoidentityprovider.DeviceRememberedStatusTypeRemembered
+		case "last_ip_used":
+			m.LastIP = aws.StringValue(attr.Value)
+		}
+	}
+	return m
+}
+
+// JWKSの再取得間隔と、鮮度チェックで許容する最終取得からの経過時間
+const (
+	jwksRefreshInterval = time.Hour
+	jwksMaxAge          = 3 * jwksRefreshInterval
+)
+
 // NewCognitoAuthorizar AuthorizarProxyを生成する
 type cognitoAuthorizar struct {
+	mu                       sync.RWMutex
 	jwk                      jwk.Set
+	fetchedAt                time.Time
+	jwkURL                   string
 	region, poolID, clientID string
 }
 
-func NewCognitoAuthorizar(region, poolID, clientID string) proxy.AuthorizarProxy {
+// NewCognitoAuthorizar ctxが終了するまでJWKSを定期的に再取得します
+func NewCognitoAuthorizar(ctx context.Context, region, poolID, clientID string) proxy.AuthorizarProxy {
 	jwkURL := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s/.well-known/jwks.json", region, poolID)
-	jset, err := jwk.Fetch(context.Background(), jwkURL)
-	if err != nil {
+	ca := &cognitoAuthorizar{
+		jwkURL: jwkURL, region: region, poolID: poolID, clientID: clientID,
+	}
+	if err := ca.refresh(ctx); err != nil {
 		log.Fatal(err)
 	}
-	return &cognitoAuthorizar{
-		jset, region, poolID, clientID,
+	go ca.refreshLoop(ctx)
+	return ca
+}
+
+// Name ヘルスチェック名
+func (ca *cognitoAuthorizar) Name() string {
+	return "jwks"
+}
+
+// Check JWKSが取得済み、かつ古すぎないことを確認します
+func (ca *cognitoAuthorizar) Check(ctx context.Context) error {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+	if ca.jwk == nil || ca.jwk.Len() == 0 {
+		return errors.WithStack(fmt.Errorf("jwks not loaded"))
+	}
+	if age := time.Since(ca.fetchedAt); age > jwksMaxAge {
+		return errors.WithStack(fmt.Errorf("jwks is stale: fetched %s ago", age.Truncate(time.Second)))
+	}
+	return nil
+}
+
+func (ca *cognitoAuthorizar) refresh(ctx context.Context) error {
+	jset, err := jwk.Fetch(ctx, ca.jwkURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.jwk, ca.fetchedAt = jset, time.Now()
+	return nil
+}
+
+func (ca *cognitoAuthorizar) refreshLoop(ctx context.Context) {
+	t := time.NewTicker(jwksRefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			// 失敗しても前回のJWKSで検証を続ける（鮮度はヘルスチェックで検知する）
+			if err := ca.refresh(ctx); err != nil {
+				log.Default().Printf("%+v", err)
+			}
+		}
 	}
 }
 
-func (ca *cognitoAuthorizar) ValidateJWT(idToken string) (string, string, error) {
+func (ca *cognitoAuthorizar) ValidateJWT(idToken string) (*model.Claims, error) {
+	ca.mu.RLock()
+	jset := ca.jwk
+	ca.mu.RUnlock()
 	// IDトークンの検証を行う
 	jt, err := jwt.Parse(
 		[]byte(idToken),
-		jwt.WithKeySet(ca.jwk),
+		jwt.WithKeySet(jset),
 		jwt.WithValidate(true),
 		jwt.WithIssuer(fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", ca.region, ca.poolID)),
 		jwt.WithAudience(ca.clientID),
 		jwt.WithClaimValue("token_use", "id"),
 	)
 	if err != nil {
-		return "", "", errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 	log.Default().Printf("%+v", jt.PrivateClaims())
 	email, _ := jt.Get("email")
-	return jt.Subject(), fmt.Sprint(email), nil
+	originJTI, _ := jt.Get("origin_jti")
+	groups, _ := jt.Get("cognito:groups")
+	return &model.Claims{
+		Sub:       jt.Subject(),
+		Email:     fmt.Sprint(email),
+		Groups:    stringsClaim(groups),
+		JTI:       jt.JwtID(),
+		OriginJTI: stringClaim(originJTI),
+		IssuedAt:  jt.IssuedAt(),
+		ExpiresAt: jt.Expiration(),
+	}, nil
+}
+
+func stringClaim(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func stringsClaim(v interface{}) []string {
+	vs, _ := v.([]interface{})
+	ss := make([]string, 0, len(vs))
+	for _, v := range vs {
+		if s, ok := v.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
 }
@@ -0,0 +1,295 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/memory"
+)
+
+// cognitoReply 模擬するCognitoの応答（errCodeが空でなければ400のエラー）
+type cognitoReply struct {
+	errCode string
+	body    interface{}
+}
+
+// fakeCognito Cognito Identity ProviderのJSON APIを模したサーバ
+//
+// 操作（InitiateAuth等）ごとに応答を順に返し、尽きた後は最後の応答を繰り返します。
+type fakeCognito struct {
+	*httptest.Server
+	mu      sync.Mutex
+	replies map[string][]cognitoReply
+	// calls 呼び出された操作の順序
+	calls []string
+}
+
+func newFakeCognito(t *testing.T, replies map[string][]cognitoReply) *fakeCognito {
+	t.Helper()
+	f := &fakeCognito{replies: replies}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSCognitoIdentityProviderService.")
+		f.mu.Lock()
+		f.calls = append(f.calls, op)
+		rs := f.replies[op]
+		if len(rs) == 0 {
+			f.mu.Unlock()
+			t.Errorf("unexpected call %s", op)
+			http.Error(w, "unexpected call", http.StatusInternalServerError)
+			return
+		}
+		reply := rs[0]
+		if len(rs) > 1 {
+			f.replies[op] = rs[1:]
+		}
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if reply.errCode != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": reply.errCode, "message": reply.errCode + " from the fake"})
+			return
+		}
+		if reply.body == nil {
+			reply.body = map[string]interface{}{}
+		}
+		json.NewEncoder(w).Encode(reply.body)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeCognito) called(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == op {
+			n++
+		}
+	}
+	return n
+}
+
+func newTestCognitoClient(t *testing.T, f *fakeCognito, authFlow string, legacy *fakeLegacy) *cognitoIdpClient {
+	t.Helper()
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(f.URL),
+		Region:      aws.String("ap-northeast-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolID, clientID, clientSecret := "ap-northeast-1_EXAMPLE", "client-1", "secret"
+	cic := &cognitoIdpClient{idp: cognitoidentityprovider.New(sess), poolID: &poolID, clientID: &clientID, clientSecret: &clientSecret, authFlow: authFlow}
+	if legacy != nil {
+		cic.legacy = legacy
+	}
+	return cic
+}
+
+// fakeLegacy パスワードが一致する1件のアカウントを持つ移行元
+type fakeLegacy struct {
+	email, password string
+}
+
+func (fl *fakeLegacy) Authenticate(ctx context.Context, email, password string) (*model.LegacyUser, error) {
+	if email != fl.email || password != fl.password {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "legacy password mismatch")
+	}
+	return &model.LegacyUser{Email: email}, nil
+}
+
+func (fl *fakeLegacy) Lookup(ctx context.Context, email string) (*model.LegacyUser, error) {
+	if email != fl.email {
+		return nil, errors.WithStack(model.ErrUserNotFound)
+	}
+	return &model.LegacyUser{Email: email}, nil
+}
+
+// tokens ログインに成功した応答
+var tokens = cognitoReply{body: map[string]interface{}{
+	"AuthenticationResult": map[string]interface{}{"IdToken": "id-token", "RefreshToken": "refresh-token"},
+}}
+
+// passwordVerifier USER_SRP_AUTHのPASSWORD_VERIFIERチャレンジ
+var passwordVerifier = cognitoReply{body: map[string]interface{}{
+	"ChallengeName": "PASSWORD_VERIFIER",
+	"ChallengeParameters": map[string]string{
+		"USER_ID_FOR_SRP": "d4f1c2a0", "SALT": "1f2e3d", "SRP_B": "2", "SECRET_BLOCK": "c2VjcmV0",
+	},
+}}
+
+func TestSigninConvertsCognitoErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		authFlow string
+		replies  map[string][]cognitoReply
+		want     error
+	}{
+		{"wrong password", AuthFlowUserPassword, map[string][]cognitoReply{"InitiateAuth": {{errCode: "NotAuthorizedException"}}}, model.ErrNotAuthorized},
+		{"unknown user", AuthFlowUserPassword, map[string][]cognitoReply{"InitiateAuth": {{errCode: "UserNotFoundException"}}}, model.ErrNotAuthorized},
+		{"not confirmed", AuthFlowUserPassword, map[string][]cognitoReply{"InitiateAuth": {{errCode: "UserNotConfirmedException"}}}, model.ErrUserNotConfirmed},
+		{"throttled", AuthFlowUserPassword, map[string][]cognitoReply{"InitiateAuth": {{errCode: "TooManyRequestsException"}}}, model.ErrTooManyRequests},
+		{"srp unknown user", AuthFlowUserSRP, map[string][]cognitoReply{"InitiateAuth": {{errCode: "UserNotFoundException"}}}, model.ErrNotAuthorized},
+		{"srp wrong password", AuthFlowUserSRP, map[string][]cognitoReply{
+			"InitiateAuth":           {passwordVerifier},
+			"RespondToAuthChallenge": {{errCode: "NotAuthorizedException"}},
+		}, model.ErrNotAuthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cic := newTestCognitoClient(t, newFakeCognito(t, tt.replies), tt.authFlow, nil)
+			_, err := cic.Signin(context.Background(), &model.SigninReq{Email: "taro@example.com", Password: "x"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// ユーザプールに存在しないアカウントは移行元で照合して移行する
+func TestSigninMigratesLegacyUser(t *testing.T) {
+	f := newFakeCognito(t, map[string][]cognitoReply{
+		"InitiateAuth":         {{errCode: "UserNotFoundException"}, tokens},
+		"AdminCreateUser":      {{}},
+		"AdminSetUserPassword": {{}},
+	})
+	cic := newTestCognitoClient(t, f, AuthFlowUserPassword, &fakeLegacy{"taro@example.com", "legacy-pass"})
+	token, err := cic.Signin(context.Background(), &model.SigninReq{Email: "taro@example.com", Password: "legacy-pass"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if token.IDToken != "id-token" {
+		t.Errorf("token = %+v", token)
+	}
+	if f.called("AdminCreateUser") != 1 || f.called("InitiateAuth") != 2 {
+		t.Errorf("calls = %v", f.calls)
+	}
+
+	// 移行元でも一致しない場合は移行しない
+	f = newFakeCognito(t, map[string][]cognitoReply{"InitiateAuth": {{errCode: "UserNotFoundException"}}})
+	cic = newTestCognitoClient(t, f, AuthFlowUserPassword, &fakeLegacy{"taro@example.com", "legacy-pass"})
+	_, err = cic.Signin(context.Background(), &model.SigninReq{Email: "taro@example.com", Password: "wrong"})
+	if !errors.Is(err, model.ErrNotAuthorized) || f.called("AdminCreateUser") != 0 {
+		t.Errorf("err = %v, calls = %v; want ErrNotAuthorized without migration", err, f.calls)
+	}
+}
+
+// 移行先でパスワードを設定できない場合は、作成したアカウントを削除する
+func TestSigninMigrationCleanup(t *testing.T) {
+	tests := []struct {
+		name       string
+		deleteUser cognitoReply
+		// wantCleanupErr 削除の失敗をエラーとログに含める
+		wantCleanupErr bool
+	}{
+		{"deleted", cognitoReply{}, false},
+		{"delete fails", cognitoReply{errCode: "InternalErrorException"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.Default().SetOutput(&logs)
+			defer log.Default().SetOutput(os.Stderr)
+
+			f := newFakeCognito(t, map[string][]cognitoReply{
+				"InitiateAuth":         {{errCode: "UserNotFoundException"}},
+				"AdminCreateUser":      {{}},
+				"AdminSetUserPassword": {{errCode: "InvalidPasswordException"}},
+				"AdminDeleteUser":      {tt.deleteUser},
+			})
+			cic := newTestCognitoClient(t, f, AuthFlowUserPassword, &fakeLegacy{"taro@example.com", "short"})
+			_, err := cic.Signin(context.Background(), &model.SigninReq{Email: "taro@example.com", Password: "short"})
+			if err == nil || !strings.Contains(err.Error(), "InvalidPasswordException") {
+				t.Fatalf("err = %v, want the set password error", err)
+			}
+			if f.called("AdminDeleteUser") != 1 || f.called("InitiateAuth") != 1 {
+				t.Errorf("calls = %v", f.calls)
+			}
+			if got := strings.Contains(err.Error(), "InternalErrorException"); got != tt.wantCleanupErr {
+				t.Errorf("err = %v, want the cleanup error: %v", err, tt.wantCleanupErr)
+			}
+			if got := strings.Contains(logs.String(), "delete half-migrated user taro@example.com"); got != tt.wantCleanupErr {
+				t.Errorf("logs = %q, want the cleanup error logged: %v", logs.String(), tt.wantCleanupErr)
+			}
+		})
+	}
+}
+
+func TestConfirmAndSigninRejectsWrongPassword(t *testing.T) {
+	f := newFakeCognito(t, map[string][]cognitoReply{"InitiateAuth": {{errCode: "NotAuthorizedException"}}})
+	cic := newTestCognitoClient(t, f, AuthFlowUserPassword, nil)
+	_, err := cic.ConfirmAndSignin(context.Background(), &model.ConfirmAndSigninReq{Email: "taro@example.com", Password: "x", ConfirmationCode: "123456"})
+	if !errors.Is(err, model.ErrNotAuthorized) {
+		t.Errorf("err = %v, want %v", err, model.ErrNotAuthorized)
+	}
+	if f.called("ConfirmSignUp") != 0 {
+		t.Errorf("ConfirmSignUp called after a wrong password")
+	}
+
+	// 未確認のアカウントは確認してからログインする
+	f = newFakeCognito(t, map[string][]cognitoReply{
+		"InitiateAuth":  {{errCode: "UserNotConfirmedException"}, tokens},
+		"ConfirmSignUp": {{}},
+	})
+	cic = newTestCognitoClient(t, f, AuthFlowUserPassword, nil)
+	if _, err := cic.ConfirmAndSignin(context.Background(), &model.ConfirmAndSigninReq{Email: "taro@example.com", Password: "x", ConfirmationCode: "123456"}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+}
+
+// auditSink 監査ログを捨てるAuditSink
+type auditSink struct{}
+
+func (auditSink) Write(ctx context.Context, ev *model.AuditEvent) error {
+	return nil
+}
+
+// Cognitoの誤ったパスワードのエラーでロックアウトが働く
+func TestLockoutOverCognito(t *testing.T) {
+	f := newFakeCognito(t, map[string][]cognitoReply{"InitiateAuth": {{errCode: "NotAuthorizedException"}}})
+	cic := newTestCognitoClient(t, f, AuthFlowUserPassword, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = model.WithActor(ctx, &model.Actor{IP: "192.0.2.1"})
+	lu := usecase.NewLockoutUsecase(usecase.NewUserUsecase(cic, auditSink{}, nil, nil, time.Hour), memory.NewLockoutStore(ctx), auditSink{}, usecase.LockoutPolicy{
+		AccountMaxFailures: 2,
+		BaseDelay:          time.Hour,
+		MaxDelay:           time.Hour,
+		LockoutDuration:    time.Hour,
+		ResetAfter:         time.Hour,
+	})
+	req := &viewmodel.SigninReq{SigninReq: model.SigninReq{Email: "taro@example.com", Password: "wrong"}}
+	if _, err := lu.Signin(ctx, req); !errors.Is(err, model.ErrNotAuthorized) {
+		t.Fatalf("first attempt err = %v, want %v", err, model.ErrNotAuthorized)
+	}
+	// 失敗した後はBaseDelayの間、試行を拒否する
+	_, err := lu.Signin(ctx, req)
+	var le *model.LockedError
+	if !errors.As(err, &le) {
+		t.Fatalf("err = %v, want a lockout", err)
+	}
+	if n := f.called("InitiateAuth"); n != 1 {
+		t.Errorf("InitiateAuth called %d times, want 1 (the locked attempt must not reach Cognito)", n)
+	}
+}
@@ -0,0 +1,117 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// トークンエンドポイント呼び出しのタイムアウトと、読み込むレスポンスの上限
+const (
+	hostedUITokenTimeout = 10 * time.Second
+	maxTokenResponseSize = 1 << 20
+)
+
+// CognitoのホストされたUI（ドメインの/oauth2/authorize、/oauth2/token）で認可コードフローを行います
+type hostedUIClient struct {
+	domain                 string
+	clientID, clientSecret string
+	redirectURI            string
+	scopes                 []string
+	hc                     *http.Client
+}
+
+// NewHostedUIProxy OAuthProxyを生成します
+//
+// domainはユーザプールのドメイン（https://<prefix>.auth.<region>.amazoncognito.com やカスタムドメイン）です。
+func NewHostedUIProxy(domain, clientID, clientSecret, redirectURI string, scopes []string) proxy.OAuthProxy {
+	return &hostedUIClient{
+		strings.TrimRight(domain, "/"),
+		clientID, clientSecret,
+		redirectURI,
+		scopes,
+		&http.Client{Timeout: hostedUITokenTimeout},
+	}
+}
+
+// AuthorizeURL 認可エンドポイントのURLを返します
+func (hc *hostedUIClient) AuthorizeURL(state, codeChallenge, identityProvider string) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {hc.clientID},
+		"redirect_uri":          {hc.redirectURI},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	if len(hc.scopes) > 0 {
+		q.Set("scope", strings.Join(hc.scopes, " "))
+	}
+	if identityProvider != "" {
+		// ホストされたUIのログイン画面を飛ばしてIdPに直接リダイレクトさせる
+		q.Set("identity_provider", identityProvider)
+	}
+	return hc.domain + "/oauth2/authorize?" + q.Encode()
+}
+
+// ExchangeCode 認可コードをトークンに交換します
+func (hc *hostedUIClient) ExchangeCode(ctx context.Context, code, codeVerifier string) (*model.Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {hc.clientID},
+		"code":          {code},
+		"redirect_uri":  {hc.redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hc.domain+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if hc.clientSecret != "" {
+		req.SetBasicAuth(hc.clientID, hc.clientSecret)
+	}
+	resp, err := hc.hc.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseSize))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		oerr := new(model.OAuthError)
+		if err := json.Unmarshal(b, oerr); err != nil || oerr.Code == "" {
+			return nil, errors.WithStack(fmt.Errorf("token endpoint returned %s", resp.Status))
+		}
+		return nil, errors.WithStack(oerr)
+	}
+	var tr struct {
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(b, &tr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if tr.IDToken == "" {
+		return nil, errors.WithStack(fmt.Errorf("token endpoint returned no id_token (is the openid scope allowed?)"))
+	}
+	token := &model.Token{IDToken: tr.IDToken}
+	if tr.RefreshToken != "" {
+		token.RefreshToken = &tr.RefreshToken
+	}
+	return token, nil
+}
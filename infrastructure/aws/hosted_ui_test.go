@@ -0,0 +1,186 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+const (
+	testClientID    = "client-1"
+	testRedirectURI = "https://app.example.com/oauth/callback"
+)
+
+// testTokenEndpoint ホストされたUIの/oauth2/tokenを模したサーバ
+//
+// codesに登録した認可コードとcode_challengeで、RFC 7636のS256の検証を行います。
+func testTokenEndpoint(t *testing.T, clientSecret string, codes map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oauthError := func(status int, code string) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": code})
+		}
+		if r.URL.Path != "/oauth2/token" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if clientSecret != "" {
+			if id, secret, ok := r.BasicAuth(); !ok || id != testClientID || secret != clientSecret {
+				oauthError(http.StatusUnauthorized, "invalid_client")
+				return
+			}
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != testClientID || r.PostForm.Get("redirect_uri") != testRedirectURI {
+			oauthError(http.StatusBadRequest, "invalid_request")
+			return
+		}
+		challenge, ok := codes[r.PostForm.Get("code")]
+		if !ok {
+			oauthError(http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			oauthError(http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id_token": "id-token", "access_token": "access-token", "refresh_token": "refresh-token",
+			"token_type": "Bearer", "expires_in": 3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAuthorizeURL(t *testing.T) {
+	op := NewHostedUIProxy("https://auth.example.com/", testClientID, "", testRedirectURI, []string{"openid", "email"})
+	u, err := url.Parse(op.AuthorizeURL("state-1", "challenge-1", "Google"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != "https://auth.example.com/oauth2/authorize" {
+		t.Errorf("endpoint = %s", u)
+	}
+	want := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"state":                 {"state-1"},
+		"code_challenge":        {"challenge-1"},
+		"code_challenge_method": {"S256"},
+		"scope":                 {"openid email"},
+		"identity_provider":     {"Google"},
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v[0] {
+			t.Errorf("%s = %q, want %q", k, got, v[0])
+		}
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	// RFC 7636 付録Bの例
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	tests := []struct {
+		name         string
+		clientSecret string
+		sentSecret   string
+		code         string
+		verifier     string
+		// wantOAuthErr トークンエンドポイントが返すエラーのコード（空の場合は成功）
+		wantOAuthErr string
+	}{
+		{name: "public client", code: "code-1", verifier: verifier},
+		{name: "confidential client", clientSecret: "s3cret", sentSecret: "s3cret", code: "code-1", verifier: verifier},
+		{name: "wrong client secret", clientSecret: "s3cret", sentSecret: "wrong", code: "code-1", verifier: verifier, wantOAuthErr: "invalid_client"},
+		{name: "wrong code verifier", code: "code-1", verifier: "not-the-verifier", wantOAuthErr: "invalid_grant"},
+		{name: "unknown code", code: "code-2", verifier: verifier, wantOAuthErr: "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := testTokenEndpoint(t, tt.clientSecret, map[string]string{"code-1": challenge})
+			op := NewHostedUIProxy(srv.URL, testClientID, tt.sentSecret, testRedirectURI, nil)
+			token, err := op.ExchangeCode(context.Background(), tt.code, tt.verifier)
+			if tt.wantOAuthErr != "" {
+				var oerr *model.OAuthError
+				if !errors.As(err, &oerr) || oerr.Code != tt.wantOAuthErr {
+					t.Errorf("err = %v, want %s", err, tt.wantOAuthErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if token.IDToken != "id-token" || token.RefreshToken == nil || *token.RefreshToken != "refresh-token" {
+				t.Errorf("token = %+v", token)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeUnexpectedResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"server error without an OAuth error", http.StatusBadGateway, `<html>bad gateway</html>`, "502 Bad Gateway"},
+		{"error without a code", http.StatusBadRequest, `{"message":"bad"}`, "400 Bad Request"},
+		{"no id_token", http.StatusOK, `{"access_token":"a","token_type":"Bearer"}`, "no id_token"},
+		{"malformed JSON", http.StatusOK, `{"id_token":`, "unexpected end of JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			op := NewHostedUIProxy(srv.URL, testClientID, "", testRedirectURI, nil)
+			_, err := op.ExchangeCode(context.Background(), "code-1", "verifier")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+			var oerr *model.OAuthError
+			if errors.As(err, &oerr) {
+				t.Errorf("err = %v, want it not to be an OAuth error", err)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeHonoursContext(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+	op := NewHostedUIProxy(srv.URL, testClientID, "", testRedirectURI, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := op.ExchangeCode(ctx, "code-1", "verifier"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,184 @@
+package aws
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CognitoのSRP-6aで使うRFC 5054の3072bitグループ
+const srpNHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64" +
+	"ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6B" +
+	"F12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+	"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB31" +
+	"43DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+
+// 認証キーを導出する際のHKDFのinfo
+const srpDerivedKeyInfo = "Caldera Derived Key"
+
+// Cognitoが期待するタイムスタンプの書式（日は0埋めしない）
+const srpTimestampLayout = "Mon Jan 2 15:04:05 MST 2006"
+
+var (
+	srpN, _ = new(big.Int).SetString(srpNHex, 16)
+	srpG    = big.NewInt(2)
+	srpK    = hexHashInt(padHex(srpN) + padHex(srpG))
+)
+
+// srpSession 1回のSRP認証で使う秘密値aと公開値A
+type srpSession struct {
+	a, A *big.Int
+}
+
+func newSRPSession() (*srpSession, error) {
+	for {
+		a, err := randomInt(128)
+		if err != nil {
+			return nil, err
+		}
+		A := new(big.Int).Exp(srpG, a, srpN)
+		// A mod N が0の場合はやり直す
+		if A.Sign() != 0 {
+			return &srpSession{a, A}, nil
+		}
+	}
+}
+
+// SRPA チャレンジに送るAを16進数で返します
+func (s *srpSession) SRPA() string {
+	return s.A.Text(16)
+}
+
+// passwordClaim PASSWORD_VERIFIER/DEVICE_PASSWORD_VERIFIERチャレンジへの署名を計算します
+//
+// ユーザの場合poolNameはユーザプールIDの"_"以降、デバイスの場合はデバイスグループキーで、usernameはデバイスキーです。
+func (s *srpSession) passwordClaim(poolName, username, password, saltHex, srpBHex, secretBlock string, now time.Time) (signature, timestamp string, err error) {
+	B, ok := new(big.Int).SetString(srpBHex, 16)
+	if !ok || new(big.Int).Mod(B, srpN).Sign() == 0 {
+		return "", "", errors.WithStack(fmt.Errorf("invalid SRP_B"))
+	}
+	salt, ok := new(big.Int).SetString(saltHex, 16)
+	if !ok {
+		return "", "", errors.WithStack(fmt.Errorf("invalid SALT"))
+	}
+	u := srpU(s.A, B)
+	if u.Sign() == 0 {
+		return "", "", errors.WithStack(fmt.Errorf("invalid SRP_B"))
+	}
+	x := srpX(salt, poolName, username, password)
+	S := s.premasterSecret(B, u, x)
+	key := hkdf(hexBytes(padHex(S)), hexBytes(padHex(u)))
+
+	block, err := base64.StdEncoding.DecodeString(secretBlock)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	timestamp = now.UTC().Format(srpTimestampLayout)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(poolName))
+	mac.Write([]byte(username))
+	mac.Write(block)
+	mac.Write([]byte(timestamp))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), timestamp, nil
+}
+
+// srpU スクランブルパラメータ u = H(PAD(A) | PAD(B))
+func srpU(A, B *big.Int) *big.Int {
+	return hexHashInt(padHex(A) + padHex(B))
+}
+
+// srpX 秘密の値 x = H(PAD(salt) | H(poolName | username | ":" | password))
+func srpX(salt *big.Int, poolName, username, password string) *big.Int {
+	return hexHashInt(padHex(salt) + hashHex([]byte(poolName+username+":"+password)))
+}
+
+// premasterSecret S = (B - k * g^x) ^ (a + u * x) mod N
+func (s *srpSession) premasterSecret(B, u, x *big.Int) *big.Int {
+	gx := new(big.Int).Exp(srpG, x, srpN)
+	base := new(big.Int).Sub(B, new(big.Int).Mul(srpK, gx))
+	base.Mod(base, srpN)
+	exp := new(big.Int).Add(s.a, new(big.Int).Mul(u, x))
+	return new(big.Int).Exp(base, exp, srpN)
+}
+
+// newDeviceVerifier ConfirmDeviceで登録するデバイスのパスワードと検証子を生成します
+func newDeviceVerifier(deviceGroupKey, deviceKey string) (password, verifier, salt string, err error) {
+	pw := make([]byte, 40)
+	if _, err := rand.Read(pw); err != nil {
+		return "", "", "", errors.WithStack(err)
+	}
+	password = base64.StdEncoding.EncodeToString(pw)
+	s, err := randomInt(16)
+	if err != nil {
+		return "", "", "", err
+	}
+	v := new(big.Int).Exp(srpG, srpX(s, deviceGroupKey, deviceKey, password), srpN)
+	return password,
+		base64.StdEncoding.EncodeToString(hexBytes(padHex(v))),
+		base64.StdEncoding.EncodeToString(hexBytes(padHex(s))),
+		nil
+}
+
+// padHex 符号付きの値として解釈されないよう、先頭ビットが立つ場合は"00"を付けた偶数桁の16進数にします
+func padHex(n *big.Int) string {
+	h := n.Text(16)
+	if len(h)%2 == 1 {
+		h = "0" + h
+	} else if strings.ContainsRune("89abcdef", rune(h[0])) {
+		h = "00" + h
+	}
+	return h
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf("%064x", sum[:])
+}
+
+// hexHashInt 16進数文字列をバイト列として扱ったSHA-256を整数で返します
+func hexHashInt(h string) *big.Int {
+	n, _ := new(big.Int).SetString(hashHex(hexBytes(h)), 16)
+	return n
+}
+
+func hexBytes(h string) []byte {
+	b, _ := hex.DecodeString(h)
+	return b
+}
+
+// hkdf HKDF-SHA256で16byteの鍵を導出します
+func hkdf(ikm, salt []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(srpDerivedKeyInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:16]
+}
+
+func randomInt(size int) (*big.Int, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// 参照値はCognitoのSDK（amazon-cognito-identity-js、pycognito）と同じ手順の別実装で計算したもの
+//
+// Bはサーバ側の b と検証子 v = g^x から B = k*v + g^b として作り、
+// Sはクライアント側の式とサーバ側の式 (A * v^u)^b の両方で一致することを確認済み
+const (
+	testSRPa = "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90" +
+		"a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90" +
+		"a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90" +
+		"a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+	testSRPA = "319de7c59b46d165608c21962459554324e58b8bf38e063bc026b6a0d1bd756b" +
+		"c13d4412b7c5dc0d62e617d2634098ceb0b8bd9db7baeee8ef1d1d0b297a5e36" +
+		"d5fe014a06dddba54ec10e1907d841566d1faf8772f9e5272e080da3314b0155" +
+		"87a66229404fdccba681aa355704577be097060f596b97a62306d1011cbd33e6" +
+		"1de392c34aab3b7b1aaa59b357e398a26c3f41cc98a3233c85cf91fa70c9e32a" +
+		"ffba00dbe4c762887bd4f5ae3a8356859acc01e3d156ab2a6846f03e65ca7f59" +
+		"4070f66d9510d6cf4a7f322a89577e8009efe50bd260fea04bdf518c045f2d37" +
+		"18eacb2d78d747cdf2844586b10e64f1b1b4afca1f05dcd341a1291c94d8c477" +
+		"ac32b4f83d32571965db0800afc7429ebd6e0c01c1eeb19a94fbc1c10760d0c8" +
+		"d45805edfda26feecc8c9d97cfc1dc84a76c95021ad1569139a9fcba78ea1181" +
+		"41551d4ef5c66b8cdfef5043d095ce3fcd8ca63a933c9434e6b47f5b15d9d918" +
+		"6073a008640b46aab1c74f2a9bf36e0ddc8a1bce28747e14d35401d30877c3da"
+	testSRPB = "46193ab38b77437813fa01f42d843c37b41fe2b957b0d7d4192dba0a6ad44fd8" +
+		"4a8c5ae00c140758d9c124253362eb9c0ff6fb195eeba0f43d66c9e240fa7a46" +
+		"9ade3dfd87480c0183858b3d52a95f2734c08a4849634605c2f101cc6bb80c8f" +
+		"564dd4462919b23c374e1492ac97320870e61077ff56470a943b0198574e15c8" +
+		"5dff51f35f4cc69a9565a6b7e41461239c4c7c12ffb58c827a56798727f2a9d1" +
+		"c5193230edfb96894af47a232d743b5e95a8c85f3a9b549f80c2af92f136780a" +
+		"aa719e3b180792e1b1d22c234231515a523e76dd5712ccfc90051cc3d5c10979" +
+		"a1d4f7a3eca25d94a2c7f2899a0e9d504ff9e6fb1e4051fa5329606e689e9e18" +
+		"5a0d5497792873118c5a5eab66d1089a3bd799f611e1522e57962c37534cecb2" +
+		"4ea8c91e76e3cf482cfbf1bf0c1907d88511d5dd88013db03723b0bbf6c8f940" +
+		"f1401f42df81e695afdb3fd7d3f806232e674c1c8ba8a9f79d599b33adf1af01" +
+		"693914dade035df88ee7592eb4d9f85d4993b6c40603296538aace1c91c86418"
+	testSRPS = "7c313693f37aea21cc44976c9b35510873f2430a14bb680aeaea190982aec0b0" +
+		"e80b1f9edb23bf17129f9c835375655b3895c2c79a89c0d9d08d672f496d9760" +
+		"77674a278f91a3f48a588f71ab2975f412faedf442bf386b575faa39785031a6" +
+		"b8fe8c645504eb5246d8ee8be83541631866ff38a61e56169cc4dd32dbb3ee01" +
+		"f190cf6cd387932860aa44702370474d57577b1088a7128790b79f943374e1da" +
+		"164dbd765965cc654239ea9ee83a39c8d1c00c651633d1b4298b60c12558ef8f" +
+		"b3d70d837553a76ab396ca48aa4d60f03c7645880f4aabf8cc32e0dbeddf95e5" +
+		"f6c67312c7408d288a06e3e658c3d3dc1f18deefe83db971b2ff4795bdde0bb7" +
+		"b0ce75d26348ed6e9676529e6deddc509bbfcda51b94059307daee7848f36669" +
+		"c98dccb4d9abf35cfe78a3d08d9f8d3f60708648a9f67ca9f2d745500052fa54" +
+		"670818f851285fa4e361bd1a76396944479c66a35e9f49471bb7006b8fa8c1ae" +
+		"1c08884b4bd7aa8eecb6c1d6a720c42637c31cb6d167a27778205cdae55c4a3a"
+)
+
+const (
+	testSRPPoolName    = "AbCdEfGhI"
+	testSRPUsername    = "taro"
+	testSRPPassword    = "P@ssw0rd!"
+	testSRPSalt        = "8f3e0c1a2b4d5e6f708192a3b4c5d6e7"
+	testSRPSecretBlock = "c2VjcmV0LWJsb2NrLWZyb20tY29nbml0bw=="
+)
+
+func hexInt(t *testing.T, h string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(h, 16)
+	if !ok {
+		t.Fatalf("invalid hex %q", h)
+	}
+	return n
+}
+
+func testSRPSession(t *testing.T) *srpSession {
+	t.Helper()
+	a := hexInt(t, testSRPa)
+	return &srpSession{a, new(big.Int).Exp(srpG, a, srpN)}
+}
+
+// k = H(PAD(N) | PAD(g)) はCognitoのSDKの定数と一致すること
+func TestSRPMultiplier(t *testing.T) {
+	if got, want := srpK.Text(16), "538282c4354742d7cbbde2359fcf67f9f5b3a6b08791e5011b43b8a5b66d9ee6"; got != want {
+		t.Errorf("k = %s, want %s", got, want)
+	}
+}
+
+func TestSRPVectors(t *testing.T) {
+	s := testSRPSession(t)
+	if got := s.SRPA(); got != testSRPA {
+		t.Errorf("A = %s, want %s", got, testSRPA)
+	}
+	B := hexInt(t, testSRPB)
+	u := srpU(s.A, B)
+	if got, want := u.Text(16), "159c70b5405bc0ffa4b4977ad75fc0b592585e57ae67bde148f798be3dbd8b34"; got != want {
+		t.Errorf("u = %s, want %s", got, want)
+	}
+	x := srpX(hexInt(t, testSRPSalt), testSRPPoolName, testSRPUsername, testSRPPassword)
+	if got, want := x.Text(16), "d52fd1392c04b8c08b26ddf1c2cdb0ef85e63c8607d427e2d0b8b27c9709b03a"; got != want {
+		t.Errorf("x = %s, want %s", got, want)
+	}
+	S := s.premasterSecret(B, u, x)
+	if got := S.Text(16); got != testSRPS {
+		t.Errorf("S = %s, want %s", got, testSRPS)
+	}
+	key := hkdf(hexBytes(padHex(S)), hexBytes(padHex(u)))
+	if got, want := hex.EncodeToString(key), "c810ad458a46d20873799980991f54e2"; got != want {
+		t.Errorf("HKDF key = %s, want %s", got, want)
+	}
+}
+
+func TestPasswordClaim(t *testing.T) {
+	s := testSRPSession(t)
+	now := time.Date(2017, time.June, 5, 18, 4, 5, 0, time.FixedZone("JST", 9*60*60))
+	signature, timestamp, err := s.passwordClaim(testSRPPoolName, testSRPUsername, testSRPPassword, testSRPSalt, testSRPB, testSRPSecretBlock, now)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// 日は0埋めせず、UTCで表す
+	if want := "Mon Jun 5 09:04:05 UTC 2017"; timestamp != want {
+		t.Errorf("timestamp = %q, want %q", timestamp, want)
+	}
+	if want := "2yrZx0zBygA1IiQhpkKfaRv5D5r+Oc6pLU7ynl5DFz4="; signature != want {
+		t.Errorf("signature = %s, want %s", signature, want)
+	}
+}
+
+func TestPasswordClaimInvalidB(t *testing.T) {
+	s := testSRPSession(t)
+	for _, B := range []string{"0", srpNHex, "zz"} {
+		if _, _, err := s.passwordClaim(testSRPPoolName, testSRPUsername, testSRPPassword, testSRPSalt, B, testSRPSecretBlock, time.Now()); err == nil {
+			t.Errorf("SRP_B %.8s...: want an error", B)
+		}
+	}
+}
+
+// 登録した検証子でサーバ側が計算する署名と、デバイスのパスワードから計算する署名が一致すること
+func TestDeviceVerifierRoundTrip(t *testing.T) {
+	const groupKey, deviceKey = "-AbCdEfGh", "us-east-1_0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"
+	password, verifier, salt, err := newDeviceVerifier(groupKey, deviceKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	vb, _ := base64.StdEncoding.DecodeString(verifier)
+	sb, _ := base64.StdEncoding.DecodeString(salt)
+	v, saltHex := new(big.Int).SetBytes(vb), hex.EncodeToString(sb)
+
+	// サーバ側: B = k*v + g^b、S = (A * v^u)^b
+	s := testSRPSession(t)
+	b := big.NewInt(0x0badc0ffee)
+	B := new(big.Int).Mul(srpK, v)
+	B.Add(B, new(big.Int).Exp(srpG, b, srpN)).Mod(B, srpN)
+	u := srpU(s.A, B)
+	S := new(big.Int).Exp(new(big.Int).Mul(s.A, new(big.Int).Exp(v, u, srpN)), b, srpN)
+	key := hkdf(hexBytes(padHex(S)), hexBytes(padHex(u)))
+
+	now := time.Now()
+	signature, timestamp, err := s.passwordClaim(groupKey, deviceKey, password, saltHex, B.Text(16), testSRPSecretBlock, now)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	block, _ := base64.StdEncoding.DecodeString(testSRPSecretBlock)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(groupKey + deviceKey))
+	mac.Write(block)
+	mac.Write([]byte(timestamp))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature = %s, want %s", signature, want)
+	}
+}
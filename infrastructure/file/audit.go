@@ -0,0 +1,52 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+
+	"github.com/pkg/errors"
+)
+
+// 監査ログをJSON Lines形式で書き込みます
+type jsonLinesAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesAuditSink ファイルに追記するAuditSinkを生成します（pathが空の場合は標準出力）
+func NewJSONLinesAuditSink(path string) (proxy.AuditSink, error) {
+	if path == "" {
+		return &jsonLinesAuditSink{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &jsonLinesAuditSink{w: f}, nil
+}
+
+// Write 1イベントを1行として書き込みます
+func (s *jsonLinesAuditSink) Write(ctx context.Context, ev *model.AuditEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return errors.WithStack(err)
+	}
+	// 監査ログは耐久性を優先してイベントごとに同期する
+	if f, ok := s.w.(*os.File); ok && f != os.Stdout {
+		if err := f.Sync(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// k-anonymityの範囲検索で使うSHA-1ハッシュの接頭辞の長さ
+const hashPrefixLength = 5
+
+// ローカルの漏洩パスワード一覧（SHA-1）と照合します
+//
+// pathがディレクトリの場合は接頭辞5文字毎の範囲ファイル（<PREFIX>.txt、各行 SUFFIX:COUNT）を照合の都度参照し、
+// ファイルの場合は全行（HASH または HASH:COUNT）をメモリに読み込みます。
+type breachedPasswordChecker struct {
+	dir    string
+	hashes map[string]struct{}
+}
+
+// NewBreachedPasswordChecker BreachedPasswordCheckerを生成します
+func NewBreachedPasswordChecker(path string) (proxy.BreachedPasswordChecker, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if fi.IsDir() {
+		return &breachedPasswordChecker{dir: path}, nil
+	}
+	bc := &breachedPasswordChecker{hashes: map[string]struct{}{}}
+	err = scanHashes(path, func(h string) bool {
+		bc.hashes[h] = struct{}{}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// IsBreached パスワードが一覧に含まれるか確認します
+func (bc *breachedPasswordChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if bc.hashes != nil {
+		_, ok := bc.hashes[h]
+		return ok, nil
+	}
+	prefix, suffix := h[:hashPrefixLength], h[hashPrefixLength:]
+	found := false
+	err := scanHashes(filepath.Join(bc.dir, prefix+".txt"), func(s string) bool {
+		found = s == suffix
+		return !found
+	})
+	if os.IsNotExist(errors.Cause(err)) {
+		return false, nil
+	}
+	return found, err
+}
+
+// scanHashes 各行の":"より前を大文字にしてfnに渡します（fnがfalseを返すと中断する）
+func scanHashes(path string, fn func(h string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if line == "" {
+			continue
+		}
+		if !fn(strings.ToUpper(line)) {
+			return nil
+		}
+	}
+	return errors.WithStack(sc.Err())
+}
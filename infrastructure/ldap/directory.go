@@ -0,0 +1,386 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// backendName NotSupportedErrorに入れるバックエンド名
+const backendName = "ldap"
+
+// objectGUIDAttribute Active Directoryのバイナリの識別子（subにはUUIDの文字列にして使う）
+const objectGUIDAttribute = "objectGUID"
+
+// DirectoryOptions 接続先と、エントリの検索・属性の読み替えの設定
+type DirectoryOptions struct {
+	// URL ldap://host:389 または ldaps://host:636
+	URL      string
+	StartTLS bool
+	// BindDN, BindPassword 検索に使うサービスアカウント（空の場合は匿名で検索する）
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter %sをエスケープしたメールアドレスに置き換えて検索する
+	UserFilter string
+	// SubAttribute 変わらない識別子（OpenLDAPはentryUUID、Active DirectoryはobjectGUID）
+	SubAttribute   string
+	EmailAttribute string
+	NameAttribute  string
+	// GroupAttribute 所属グループのDN（memberOfなど、先頭のRDNの値をグループ名にする）
+	GroupAttribute string
+	Timeout        time.Duration
+}
+
+// ディレクトリへのバインドでログインし、IDトークンはTokenIssuerで発行します
+//
+// アカウントの作成や変更はディレクトリ側で行うため、それらの操作には対応しません。
+type directoryProxy struct {
+	opts   DirectoryOptions
+	issuer proxy.TokenIssuer
+}
+
+// NewDirectoryProxy LDAP（Active Directoryを含む）を使うUserProxyを生成します
+func NewDirectoryProxy(opts DirectoryOptions, issuer proxy.TokenIssuer) proxy.UserProxy {
+	return &directoryProxy{opts, issuer}
+}
+
+// Signin サービスアカウントでエントリを検索し、そのDNとパスワードでバインドします
+func (d *directoryProxy) Signin(ctx context.Context, req *model.SigninReq) (*model.Token, error) {
+	// パスワードが空のバインドは匿名バインドとして成功するサーバがあるため、先に拒否する
+	if req.Password == "" {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "empty password")
+	}
+	conn, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	e, err := d.findEntry(ctx, conn, d.emailFilter(req.Email))
+	if errors.Is(err, model.ErrUserNotFound) {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(e.DN, req.Password); err != nil {
+		// Active Directoryでは無効化、期限切れのアカウントも同じ結果コードになる
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, errors.Wrap(model.ErrNotAuthorized, "bind failed")
+		}
+		return nil, ctxError(ctx, err)
+	}
+	sub := d.subOf(e)
+	if sub == "" {
+		return nil, errors.WithStack(fmt.Errorf("%s not found on %s", d.opts.SubAttribute, e.DN))
+	}
+	idToken, err := d.issuer.IssueIDToken(&model.Claims{
+		Sub:    sub,
+		Email:  e.GetAttributeValue(d.opts.EmailAttribute),
+		Groups: d.groupsOf(e),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// リフレッシュトークンは発行しない（IDトークンの期限が切れたら再度ログインする）
+	return &model.Token{IDToken: idToken}, nil
+}
+
+// GetProfile メールアドレスでエントリを取得します
+func (d *directoryProxy) GetProfile(ctx context.Context, email string) (*model.User, error) {
+	return d.getUser(ctx, d.emailFilter(email))
+}
+
+// GetUser subでエントリを取得します
+func (d *directoryProxy) GetUser(ctx context.Context, req *model.GetUserReq) (*model.User, error) {
+	filter, err := d.subFilter(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	return d.getUser(ctx, filter)
+}
+
+// Signout サーバ側にセッションを持たないため何もしません（IDトークンの失効はユースケースで行う）
+func (d *directoryProxy) Signout(ctx context.Context, req *model.SignoutReq) error {
+	return nil
+}
+
+// GlobalSignout サーバ側にセッションを持たないため何もしません（IDトークンの失効はユースケースで行う）
+func (d *directoryProxy) GlobalSignout(ctx context.Context, email string) error {
+	return nil
+}
+
+// Signup ディレクトリ側で作成するため対応しません
+func (d *directoryProxy) Signup(ctx context.Context, req *model.CreateReq) (string, error) {
+	return "", notSupported("Signup")
+}
+
+// ConfirmAndSignin ディレクトリ側で作成するため対応しません
+func (d *directoryProxy) ConfirmAndSignin(ctx context.Context, req *model.ConfirmAndSigninReq) (*model.Token, error) {
+	return nil, notSupported("ConfirmAndSignin")
+}
+
+// ResendConfirmationCode ディレクトリ側で作成するため対応しません
+func (d *directoryProxy) ResendConfirmationCode(ctx context.Context, req *model.ResendConfirmationCodeReq) error {
+	return notSupported("ResendConfirmationCode")
+}
+
+// Refresh リフレッシュトークンを発行しないため対応しません
+func (d *directoryProxy) Refresh(ctx context.Context, req *model.RefreshReq) (*model.Token, error) {
+	return nil, notSupported("Refresh")
+}
+
+// ChangePassword ディレクトリ側で変更するため対応しません
+func (d *directoryProxy) ChangePassword(ctx context.Context, email string, req *model.ChangePasswordReq) error {
+	return notSupported("ChangePassword")
+}
+
+// ForgotPassword ディレクトリ側で再設定するため対応しません
+func (d *directoryProxy) ForgotPassword(ctx context.Context, req *model.ForgotPasswordReq) error {
+	return notSupported("ForgotPassword")
+}
+
+// ConfirmForgotPassword ディレクトリ側で再設定するため対応しません
+func (d *directoryProxy) ConfirmForgotPassword(ctx context.Context, req *model.ConfirmForgotPasswordReq) error {
+	return notSupported("ConfirmForgotPassword")
+}
+
+// ChangeProfile ディレクトリ側で変更するため対応しません
+func (d *directoryProxy) ChangeProfile(ctx context.Context, email string, req *model.ChangeProfileReq) error {
+	return notSupported("ChangeProfile")
+}
+
+// Invite ディレクトリ側で作成するため対応しません
+func (d *directoryProxy) Invite(ctx context.Context, req *model.InviteReq) (string, error) {
+	return "", notSupported("Invite")
+}
+
+// RespondToInvitation ディレクトリ側で作成するため対応しません
+func (d *directoryProxy) RespondToInvitation(ctx context.Context, req *model.RespondToInvitationReq) (*model.Token, error) {
+	return nil, notSupported("RespondToInvitation")
+}
+
+// DisableUser ディレクトリ側で無効化するため対応しません
+func (d *directoryProxy) DisableUser(ctx context.Context, req *model.DisableUserReq) error {
+	return notSupported("DisableUser")
+}
+
+// ListDevices デバイスの記憶には対応しません
+func (d *directoryProxy) ListDevices(ctx context.Context, email string) ([]*model.Device, error) {
+	return nil, notSupported("ListDevices")
+}
+
+// ForgetDevice デバイスの記憶には対応しません
+func (d *directoryProxy) ForgetDevice(ctx context.Context, email, deviceKey string) error {
+	return notSupported("ForgetDevice")
+}
+
+// UpdateDeviceStatus デバイスの記憶には対応しません
+func (d *directoryProxy) UpdateDeviceStatus(ctx context.Context, email string, req *model.UpdateDeviceStatusReq) error {
+	return notSupported("UpdateDeviceStatus")
+}
+
+// InitiateCustomAuth カスタム認証（Cognitoのトリガ）には対応しません
+func (d *directoryProxy) InitiateCustomAuth(ctx context.Context, req *model.CustomAuthReq) (*model.CustomChallenge, error) {
+	return nil, notSupported("InitiateCustomAuth")
+}
+
+// RespondToCustomChallenge カスタム認証（Cognitoのトリガ）には対応しません
+func (d *directoryProxy) RespondToCustomChallenge(ctx context.Context, req *model.CustomChallengeAnswerReq) (*model.Token, error) {
+	return nil, notSupported("RespondToCustomChallenge")
+}
+
+// Name ヘルスチェック名
+func (d *directoryProxy) Name() string {
+	return "ldap"
+}
+
+// Check 接続し、サービスアカウントでバインドできることを確認します
+func (d *directoryProxy) Check(ctx context.Context) error {
+	conn, err := d.connect(ctx)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// directoryConn ctxが終了すると閉じる接続（応答しないサーバで期限を過ぎて待ち続けないようにする）
+type directoryConn struct {
+	*goldap.Conn
+	done chan struct{}
+}
+
+// Close 接続を閉じ、ctxの監視を止めます
+func (c *directoryConn) Close() {
+	close(c.done)
+	c.Conn.Close()
+}
+
+// connect 接続し、サービスアカウントでバインドします
+func (d *directoryProxy) connect(ctx context.Context) (*directoryConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dialer := &net.Dialer{Timeout: d.opts.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	lc, err := goldap.DialURL(d.opts.URL, goldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	lc.SetTimeout(d.opts.Timeout)
+	conn := &directoryConn{lc, make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			// 実行中の操作は接続が閉じられたエラーで戻る
+			lc.Close()
+		case <-conn.done:
+		}
+	}()
+	if d.opts.StartTLS {
+		u, err := url.Parse(d.opts.URL)
+		if err != nil {
+			conn.Close()
+			return nil, errors.WithStack(err)
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, ctxError(ctx, err)
+		}
+	}
+	if d.opts.BindDN != "" {
+		if err := conn.Bind(d.opts.BindDN, d.opts.BindPassword); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(ctxError(ctx, err), "bind service account")
+		}
+	}
+	return conn, nil
+}
+
+// ctxError ctxが終了して中断された場合は、接続のエラーの代わりにctxのエラーを返します
+func ctxError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return errors.WithStack(ctx.Err())
+	}
+	return errors.WithStack(err)
+}
+
+func (d *directoryProxy) getUser(ctx context.Context, filter string) (*model.User, error) {
+	conn, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	e, err := d.findEntry(ctx, conn, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &model.User{
+		Email: e.GetAttributeValue(d.opts.EmailAttribute),
+		Name:  e.GetAttributeValue(d.opts.NameAttribute),
+	}, nil
+}
+
+// findEntry 1件だけ一致するエントリを返します（一致しない場合はErrUserNotFound）
+func (d *directoryProxy) findEntry(ctx context.Context, conn *directoryConn, filter string) (*goldap.Entry, error) {
+	attrs := []string{d.opts.SubAttribute, d.opts.EmailAttribute, d.opts.NameAttribute}
+	if d.opts.GroupAttribute != "" {
+		attrs = append(attrs, d.opts.GroupAttribute)
+	}
+	// 2件まで取得して、一意に決まらない場合を検出する
+	sr, err := conn.Search(goldap.NewSearchRequest(
+		d.opts.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(d.opts.Timeout.Seconds()), false, filter, attrs, nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, ctxError(ctx, err)
+	}
+	switch {
+	case sr == nil || len(sr.Entries) == 0:
+		return nil, errors.WithStack(model.ErrUserNotFound)
+	case len(sr.Entries) > 1:
+		return nil, errors.WithStack(fmt.Errorf("multiple entries match %s", filter))
+	}
+	return sr.Entries[0], nil
+}
+
+func (d *directoryProxy) emailFilter(email string) string {
+	return strings.ReplaceAll(d.opts.UserFilter, "%s", goldap.EscapeFilter(email))
+}
+
+// subFilter subの属性で検索するフィルタ（objectGUIDはバイナリの値で比較する）
+func (d *directoryProxy) subFilter(sub string) (string, error) {
+	if !strings.EqualFold(d.opts.SubAttribute, objectGUIDAttribute) {
+		return fmt.Sprintf("(%s=%s)", d.opts.SubAttribute, goldap.EscapeFilter(sub)), nil
+	}
+	b, err := guidBytes(sub)
+	if err != nil {
+		return "", errors.Wrap(model.ErrUserNotFound, err.Error())
+	}
+	var sb strings.Builder
+	for _, c := range b {
+		fmt.Fprintf(&sb, `\%02x`, c)
+	}
+	return fmt.Sprintf("(%s=%s)", d.opts.SubAttribute, sb.String()), nil
+}
+
+func (d *directoryProxy) subOf(e *goldap.Entry) string {
+	if strings.EqualFold(d.opts.SubAttribute, objectGUIDAttribute) {
+		return formatGUID(e.GetRawAttributeValue(d.opts.SubAttribute))
+	}
+	return e.GetAttributeValue(d.opts.SubAttribute)
+}
+
+// groupsOf グループのDNの先頭のRDNの値（CN=Admins,OU=Groups,... → Admins）
+func (d *directoryProxy) groupsOf(e *goldap.Entry) []string {
+	if d.opts.GroupAttribute == "" {
+		return nil
+	}
+	var groups []string
+	for _, v := range e.GetAttributeValues(d.opts.GroupAttribute) {
+		dn, err := goldap.ParseDN(v)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			groups = append(groups, v)
+			continue
+		}
+		groups = append(groups, dn.RDNs[0].Attributes[0].Value)
+	}
+	return groups
+}
+
+// formatGUID objectGUIDを文字列にします（先頭の3つのフィールドはリトルエンディアン）
+func formatGUID(b []byte) string {
+	if len(b) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+		b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6], b[8:10], b[10:])
+}
+
+// guidBytes formatGUIDの逆変換
+func guidBytes(s string) ([]byte, error) {
+	u, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(u) != 16 {
+		return nil, fmt.Errorf("malformed GUID %q", s)
+	}
+	return []byte{u[3], u[2], u[1], u[0], u[5], u[4], u[7], u[6],
+		u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15]}, nil
+}
+
+func notSupported(op string) error {
+	return errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: op})
+}
@@ -0,0 +1,245 @@
+package ldap
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// recordingIssuer 発行を求められたクレームを記録するTokenIssuer
+type recordingIssuer struct {
+	claims *model.Claims
+}
+
+func (ri *recordingIssuer) IssueIDToken(c *model.Claims) (string, error) {
+	ri.claims = c
+	return "id-token", nil
+}
+
+func (ri *recordingIssuer) ValidateJWT(token string) (*model.Claims, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (ri *recordingIssuer) PublicJWKS() ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+// objectGUID 3a2b1c0d-5e4f-7a6b-8c9d-0e1f2a3b4c5d のバイト列（先頭の3つのフィールドはリトルエンディアン）
+var testGUID = string([]byte{0x0d, 0x1c, 0x2b, 0x3a, 0x4f, 0x5e, 0x6b, 0x7a, 0x8c, 0x9d, 0x0e, 0x1f, 0x2a, 0x3b, 0x4c, 0x5d})
+
+func testEntries() []testEntry {
+	return []testEntry{
+		{"cn=Taro,ou=People,dc=example,dc=com", map[string][]string{
+			"objectClass":  {"person"},
+			"mail":         {"taro@example.com"},
+			"displayName":  {"Taro"},
+			"entryUUID":    {"6f1c2e4a-0000-4000-8000-000000000001"},
+			"objectGUID":   {testGUID},
+			"memberOf":     {"CN=Admins,OU=Groups,DC=example,DC=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			"userPassword": {"taro-secret"},
+		}},
+		{"cn=Hanako,ou=People,dc=example,dc=com", map[string][]string{
+			"objectClass":  {"person"},
+			"mail":         {"shared@example.com"},
+			"entryUUID":    {"6f1c2e4a-0000-4000-8000-000000000002"},
+			"userPassword": {"hanako-secret"},
+		}},
+		{"cn=Jiro,ou=People,dc=example,dc=com", map[string][]string{
+			"objectClass":  {"person"},
+			"mail":         {"shared@example.com"},
+			"entryUUID":    {"6f1c2e4a-0000-4000-8000-000000000003"},
+			"userPassword": {"jiro-secret"},
+		}},
+	}
+}
+
+func testOptions(s *testServer) DirectoryOptions {
+	return DirectoryOptions{
+		URL:            s.URL(),
+		BindDN:         s.serviceDN,
+		BindPassword:   s.servicePassword,
+		BaseDN:         "dc=example,dc=com",
+		UserFilter:     "(&(objectClass=person)(mail=%s))",
+		SubAttribute:   "entryUUID",
+		EmailAttribute: "mail",
+		NameAttribute:  "displayName",
+		GroupAttribute: "memberOf",
+		Timeout:        5 * time.Second,
+	}
+}
+
+func TestSignin(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		password   string
+		wantErr    error
+		wantErrMsg string
+		wantClaims *model.Claims
+		// wantOps 期待するサーバへの操作（nilの場合は確認しない）
+		wantOps []string
+	}{
+		{
+			name:     "search then bind",
+			email:    "taro@example.com",
+			password: "taro-secret",
+			wantClaims: &model.Claims{
+				Sub:    "6f1c2e4a-0000-4000-8000-000000000001",
+				Email:  "taro@example.com",
+				Groups: []string{"Admins", "staff"},
+			},
+			wantOps: []string{
+				"bind cn=svc,dc=example,dc=com",
+				"search (&(objectClass=person)(mail=taro@example.com))",
+				"bind cn=Taro,ou=People,dc=example,dc=com",
+			},
+		},
+		{
+			name:     "wrong password",
+			email:    "taro@example.com",
+			password: "wrong",
+			wantErr:  model.ErrNotAuthorized,
+		},
+		{
+			name:     "unknown user",
+			email:    "nobody@example.com",
+			password: "taro-secret",
+			wantErr:  model.ErrNotAuthorized,
+		},
+		{
+			// サーバは空のパスワードのバインドを成功させるため、接続前に拒否しなければならない
+			name:     "empty password",
+			email:    "taro@example.com",
+			password: "",
+			wantErr:  model.ErrNotAuthorized,
+			wantOps:  []string{},
+		},
+		{
+			// エスケープしないと (mail=*) が全てのエントリに一致する
+			name:     "filter escaping",
+			email:    "*",
+			password: "taro-secret",
+			wantErr:  model.ErrNotAuthorized,
+			wantOps: []string{
+				"bind cn=svc,dc=example,dc=com",
+				`search (&(objectClass=person)(mail=\2a))`,
+			},
+		},
+		{
+			name:     "filter injection",
+			email:    "taro@example.com)(objectClass=*",
+			password: "taro-secret",
+			wantErr:  model.ErrNotAuthorized,
+		},
+		{
+			name:       "multiple matches",
+			email:      "shared@example.com",
+			password:   "hanako-secret",
+			wantErrMsg: "multiple entries match",
+			wantOps: []string{
+				"bind cn=svc,dc=example,dc=com",
+				"search (&(objectClass=person)(mail=shared@example.com))",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testEntries()...)
+			ri := new(recordingIssuer)
+			d := NewDirectoryProxy(testOptions(s), ri)
+			token, err := d.Signin(context.Background(), &model.SigninReq{Email: tt.email, Password: tt.password})
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantErrMsg != "":
+				if err == nil || errors.Is(err, model.ErrNotAuthorized) || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Errorf("err = %v, want %q", err, tt.wantErrMsg)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("%+v", err)
+				}
+				if token.IDToken != "id-token" {
+					t.Errorf("IDToken = %q, want the issued token", token.IDToken)
+				}
+				if !reflect.DeepEqual(ri.claims, tt.wantClaims) {
+					t.Errorf("claims = %+v, want %+v", ri.claims, tt.wantClaims)
+				}
+			}
+			if tt.wantOps != nil {
+				if got := s.Ops(); !reflect.DeepEqual(got, tt.wantOps) && !(len(got) == 0 && len(tt.wantOps) == 0) {
+					t.Errorf("operations = %q, want %q", got, tt.wantOps)
+				}
+			}
+		})
+	}
+}
+
+// Active DirectoryのobjectGUIDをsubにし、subからエントリを引けること
+func TestObjectGUID(t *testing.T) {
+	s := newTestServer(t, testEntries()...)
+	opts := testOptions(s)
+	opts.SubAttribute = "objectGUID"
+	ri := new(recordingIssuer)
+	d := NewDirectoryProxy(opts, ri)
+	ctx := context.Background()
+
+	if _, err := d.Signin(ctx, &model.SigninReq{Email: "taro@example.com", Password: "taro-secret"}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	const want = "3a2b1c0d-5e4f-7a6b-8c9d-0e1f2a3b4c5d"
+	if ri.claims.Sub != want {
+		t.Fatalf("sub = %q, want %q", ri.claims.Sub, want)
+	}
+	user, err := d.GetUser(ctx, &model.GetUserReq{Sub: want})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if user.Email != "taro@example.com" || user.Name != "Taro" {
+		t.Errorf("user = %+v, want taro", user)
+	}
+	if _, err := d.GetUser(ctx, &model.GetUserReq{Sub: "not-a-guid"}); !errors.Is(err, model.ErrUserNotFound) {
+		t.Errorf("malformed GUID err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestGUIDRoundTrip(t *testing.T) {
+	b, err := guidBytes(formatGUID([]byte(testGUID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testGUID {
+		t.Errorf("guidBytes(formatGUID(b)) = %x, want %x", b, testGUID)
+	}
+	if got := formatGUID([]byte{1, 2, 3}); got != "" {
+		t.Errorf("formatGUID(short) = %q, want empty", got)
+	}
+}
+
+// 応答しないディレクトリでも、ctxの期限でログインを打ち切ること
+func TestSigninHonoursContext(t *testing.T) {
+	s := newTestServer(t, testEntries()...)
+	s.hang = true
+	opts := testOptions(s)
+	opts.Timeout = time.Minute
+	d := NewDirectoryProxy(opts, new(recordingIssuer))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := d.Signin(ctx, &model.SigninReq{Email: "taro@example.com", Password: "taro-secret"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Signin returned after %s, want it to stop at the deadline", elapsed)
+	}
+}
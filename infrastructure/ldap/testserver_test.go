@@ -0,0 +1,228 @@
+package ldap
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// testEntry テスト用のディレクトリのエントリ（userPasswordはバインドに使い、検索結果には含めない）
+type testEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// testServer 簡易バインド、検索（and/or/not/等価/存在のフィルタ）、アンバインドだけに応答するインプロセスのLDAPサーバ
+type testServer struct {
+	t                          *testing.T
+	ln                         net.Listener
+	entries                    []testEntry
+	serviceDN, servicePassword string
+	// hang trueの場合は検索に応答しない
+	hang bool
+
+	mu sync.Mutex
+	// ops 受け付けた操作（"bind <dn>"、"search <filter>"）
+	ops []string
+}
+
+func newTestServer(t *testing.T, entries ...testEntry) *testServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{t: t, ln: ln, entries: entries, serviceDN: "cn=svc,dc=example,dc=com", servicePassword: "svc-secret"}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *testServer) URL() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *testServer) Ops() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ops...)
+}
+
+func (s *testServer) record(op string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, op)
+}
+
+func (s *testServer) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *testServer) handle(c net.Conn) {
+	defer c.Close()
+	bound := ""
+	for {
+		p, err := ber.ReadPacket(c)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+		id, _ := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			s.record("bind " + dn)
+			code := uint16(goldap.LDAPResultInvalidCredentials)
+			switch {
+			// パスワードが空のバインドは認証なしのバインドとして成功させる（RFC 4513 5.1.2）
+			case password == "":
+				code, bound = goldap.LDAPResultSuccess, ""
+			case dn == s.serviceDN && password == s.servicePassword:
+				code, bound = goldap.LDAPResultSuccess, dn
+			case s.checkPassword(dn, password):
+				code, bound = goldap.LDAPResultSuccess, dn
+			}
+			s.write(c, id, result(goldap.ApplicationBindResponse, code))
+		case goldap.ApplicationSearchRequest:
+			filter, _ := goldap.DecompileFilter(op.Children[6])
+			s.record("search " + filter)
+			if s.hang {
+				// 接続が閉じられるまで待つ
+				ber.ReadPacket(c)
+				return
+			}
+			if bound != s.serviceDN {
+				s.write(c, id, result(goldap.ApplicationSearchResultDone, goldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			base, _ := op.Children[0].Value.(string)
+			sizeLimit, _ := op.Children[3].Value.(int64)
+			var attrs []string
+			for _, a := range op.Children[7].Children {
+				attrs = append(attrs, a.Value.(string))
+			}
+			code := uint16(goldap.LDAPResultSuccess)
+			sent := int64(0)
+			for _, e := range s.entries {
+				if !strings.HasSuffix(strings.ToLower(e.dn), strings.ToLower(base)) || !matches(e, op.Children[6]) {
+					continue
+				}
+				if sizeLimit > 0 && sent == sizeLimit {
+					code = goldap.LDAPResultSizeLimitExceeded
+					break
+				}
+				s.write(c, id, searchEntry(e, attrs))
+				sent++
+			}
+			s.write(c, id, result(goldap.ApplicationSearchResultDone, code))
+		case goldap.ApplicationUnbindRequest:
+			return
+		default:
+			s.t.Errorf("unexpected LDAP operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+func (s *testServer) checkPassword(dn, password string) bool {
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) {
+			for _, pw := range e.attrs["userPassword"] {
+				if pw == password {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s *testServer) write(c net.Conn, id int64, op *ber.Packet) {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAPMessage")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	c.Write(p.Bytes())
+}
+
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return p
+}
+
+func searchEntry(e testEntry, attrs []string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "SearchResultEntry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, name := range attrs {
+		values, ok := e.attrs[name]
+		if !ok {
+			continue
+		}
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		a.AppendChild(vals)
+		list.AppendChild(a)
+	}
+	p.AppendChild(list)
+	return p
+}
+
+// matches フィルタを評価します（属性名は大文字小文字を区別せず、値はバイト列で比較する）
+func matches(e testEntry, f *ber.Packet) bool {
+	values := func(name string) []string {
+		for k, v := range e.attrs {
+			if strings.EqualFold(k, name) {
+				return v
+			}
+		}
+		return nil
+	}
+	switch f.Tag {
+	case goldap.FilterAnd:
+		for _, c := range f.Children {
+			if !matches(e, c) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, c := range f.Children {
+			if matches(e, c) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return !matches(e, f.Children[0])
+	case goldap.FilterEqualityMatch:
+		want := f.Children[1].Data.Bytes()
+		for _, v := range values(f.Children[0].Data.String()) {
+			if bytes.EqualFold([]byte(v), want) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterPresent:
+		return len(values(f.Data.String())) > 0
+	}
+	return false
+}
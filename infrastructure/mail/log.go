@@ -0,0 +1,23 @@
+package mail
+
+import (
+	"context"
+	"log"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 送信せずにログへ出力します（開発用）
+type logMailer struct{}
+
+// NewLogMailer Mailerを生成します
+func NewLogMailer() proxy.Mailer {
+	return &logMailer{}
+}
+
+// Send メールの内容をログに出力します
+func (lm *logMailer) Send(ctx context.Context, m *model.Mail) error {
+	log.Default().Printf("mail to=%s subject=%q\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// SMTPサーバ経由でメールを送信します
+type smtpMailer struct {
+	addr, from string
+	auth       smtp.Auth
+}
+
+// NewSMTPMailer Mailerを生成します（usernameが空の場合は認証しない）
+func NewSMTPMailer(addr, username, password, from string) proxy.Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{addr, from, auth}
+}
+
+// Send メールを送信します
+func (sm *smtpMailer) Send(ctx context.Context, m *model.Mail) error {
+	// ヘッダインジェクションを防ぐ
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return errors.WithStack(fmt.Errorf("invalid mail header"))
+	}
+	msg := "From: " + sm.from + "\r\n" +
+		"To: " + m.To + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("UTF-8", m.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + m.Body
+	if err := smtp.SendMail(sm.addr, sm.auth, sm.from, []string{m.To}, []byte(msg)); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
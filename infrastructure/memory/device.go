@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 期限切れの利用状況を削除する間隔
+const deviceActivityReapInterval = time.Minute
+
+type deviceActivity struct {
+	model.DeviceActivity
+	expires time.Time
+}
+
+// プロセス内でデバイスの最終利用状況を管理します（複数台構成では共有されない）
+type deviceActivityStore struct {
+	mu         sync.RWMutex
+	activities map[string]deviceActivity
+}
+
+// NewDeviceActivityStore ctxが終了するまで期限切れの記録を定期的に削除します
+func NewDeviceActivityStore(ctx context.Context) proxy.DeviceActivityStore {
+	s := &deviceActivityStore{activities: map[string]deviceActivity{}}
+	go s.reapLoop(ctx)
+	return s
+}
+
+// Touch デバイスの利用を記録します
+func (s *deviceActivityStore) Touch(ctx context.Context, deviceKey string, a *model.DeviceActivity, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activities[deviceKey] = deviceActivity{*a, time.Now().Add(ttl)}
+	return nil
+}
+
+// Get 記録のあるデバイスの利用状況を返します
+func (s *deviceActivityStore) Get(ctx context.Context, deviceKeys []string) (map[string]*model.DeviceActivity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := map[string]*model.DeviceActivity{}
+	now := time.Now()
+	for _, k := range deviceKeys {
+		if a, ok := s.activities[k]; ok && now.Before(a.expires) {
+			da := a.DeviceActivity
+			res[k] = &da
+		}
+	}
+	return res, nil
+}
+
+// Delete デバイスの記録を削除します
+func (s *deviceActivityStore) Delete(ctx context.Context, deviceKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.activities, deviceKey)
+	return nil
+}
+
+func (s *deviceActivityStore) reapLoop(ctx context.Context) {
+	t := time.NewTicker(deviceActivityReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for k, a := range s.activities {
+				if now.After(a.expires) {
+					delete(s.activities, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
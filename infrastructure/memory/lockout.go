@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 期限切れの失敗記録を削除する間隔
+const lockoutReapInterval = time.Minute
+
+type failureRecord struct {
+	failures int
+	last     time.Time
+	expires  time.Time
+}
+
+// プロセス内で認証失敗回数を管理します
+type lockoutStore struct {
+	mu      sync.Mutex
+	records map[string]*failureRecord
+}
+
+// NewLockoutStore ctxが終了するまで期限切れの記録を定期的に削除します
+func NewLockoutStore(ctx context.Context) proxy.LockoutStore {
+	s := &lockoutStore{records: map[string]*failureRecord{}}
+	go s.reapLoop(ctx)
+	return s
+}
+
+// Get keyの失敗回数と最後に失敗した時刻を取得します
+func (s *lockoutStore) Get(ctx context.Context, key string) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok || time.Now().After(r.expires) {
+		return 0, time.Time{}, nil
+	}
+	return r.failures, r.last, nil
+}
+
+// Fail keyの失敗を記録します
+func (s *lockoutStore) Fail(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok || now.After(r.expires) {
+		r = new(failureRecord)
+		s.records[key] = r
+	}
+	r.failures++
+	r.last, r.expires = now, now.Add(ttl)
+	return r.failures, nil
+}
+
+// Reset keyの記録を削除します
+func (s *lockoutStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *lockoutStore) reapLoop(ctx context.Context) {
+	t := time.NewTicker(lockoutReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for k, r := range s.records {
+				if now.After(r.expires) {
+					delete(s.records, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 期限切れのstateを削除する間隔
+const oauthStateReapInterval = time.Minute
+
+type oauthState struct {
+	model.OAuthState
+	expires time.Time
+}
+
+// プロセス内で認可リクエストのstateを管理します（複数台構成では共有されない）
+type oauthStateStore struct {
+	mu     sync.Mutex
+	states map[string]oauthState
+}
+
+// NewOAuthStateStore ctxが終了するまで期限切れのstateを定期的に削除します
+func NewOAuthStateStore(ctx context.Context) proxy.OAuthStateStore {
+	s := &oauthStateStore{states: map[string]oauthState{}}
+	go s.reapLoop(ctx)
+	return s
+}
+
+// Save stateの値を保存します
+func (s *oauthStateStore) Save(ctx context.Context, state string, v *model.OAuthState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = oauthState{*v, time.Now().Add(ttl)}
+	return nil
+}
+
+// Take stateの値を取り出して削除します
+func (s *oauthStateStore) Take(ctx context.Context, state string) (*model.OAuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.states[state]
+	delete(s.states, state)
+	if !ok || !time.Now().Before(v.expires) {
+		return nil, errors.WithStack(model.ErrInvalidOAuthState)
+	}
+	return &v.OAuthState, nil
+}
+
+func (s *oauthStateStore) reapLoop(ctx context.Context) {
+	t := time.NewTicker(oauthStateReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for k, v := range s.states {
+				if now.After(v.expires) {
+					delete(s.states, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 満杯になったバケットを削除する間隔
+const rateLimitReapInterval = time.Minute
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	rate     float64
+	capacity float64
+}
+
+// プロセス内でトークンバケットを管理します（複数台構成ではインスタンス毎の制限になる）
+type rateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewRateLimitStore ctxが終了するまで不要なバケットを定期的に削除します
+func NewRateLimitStore(ctx context.Context) proxy.RateLimitStore {
+	s := &rateLimitStore{buckets: map[string]*bucket{}}
+	go s.reapLoop(ctx)
+	return s
+}
+
+// Take keyのバケットからトークンを1つ消費します
+func (s *rateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.rate, b.capacity = rate, float64(burst)
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait, nil
+}
+
+func (s *rateLimitStore) reapLoop(ctx context.Context) {
+	t := time.NewTicker(rateLimitReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.reap(now)
+		}
+	}
+}
+
+// reap 補充により満杯になっているバケットは初期状態と同じなので削除する
+func (s *rateLimitStore) reap(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.capacity {
+			delete(s.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 期限切れの使用記録を削除する間隔
+const replayReapInterval = time.Minute
+
+// プロセス内で使用済みの値を管理します（複数台構成では共有されない）
+type replayStore struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewReplayStore ctxが終了するまで期限切れの記録を定期的に削除します
+func NewReplayStore(ctx context.Context) proxy.ReplayStore {
+	s := &replayStore{used: map[string]time.Time{}}
+	go s.reapLoop(ctx)
+	return s
+}
+
+// Consume idの使用を記録し、初めての使用であればtrueを返します
+func (s *replayStore) Consume(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exp, ok := s.used[id]; ok && time.Now().Before(exp) {
+		return false, nil
+	}
+	s.used[id] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (s *replayStore) reapLoop(ctx context.Context) {
+	t := time.NewTicker(replayReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for k, exp := range s.used {
+				if now.After(exp) {
+					delete(s.used, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 期限切れの失効記録を削除する間隔
+const revocationReapInterval = time.Minute
+
+type subjectRevocation struct {
+	before, expires time.Time
+}
+
+// プロセス内で失効させたトークンを管理します（複数台構成では失効が共有されない）
+type revocationStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+}
+
+// NewRevocationStore ctxが終了するまで期限切れの記録を定期的に削除します
+func NewRevocationStore(ctx context.Context) proxy.RevocationStore {
+	s := &revocationStore{tokens: map[string]time.Time{}, subjects: map[string]subjectRevocation{}}
+	go s.reapLoop(ctx)
+	return s
+}
+
+// RevokeToken jti/origin_jtiを失効させます
+func (s *revocationStore) RevokeToken(ctx context.Context, id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[id] = until
+	return nil
+}
+
+// RevokeSubject subに対してbeforeより前に発行されたトークンを失効させます
+func (s *revocationStore) RevokeSubject(ctx context.Context, sub string, before time.Time, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.subjects[sub]; ok && cur.before.After(before) {
+		before = cur.before
+	}
+	s.subjects[sub] = subjectRevocation{before, time.Now().Add(ttl)}
+	return nil
+}
+
+// IsRevoked トークンが失効しているか確認します
+func (s *revocationStore) IsRevoked(ctx context.Context, c *model.Claims) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, id := range []string{c.JTI, c.OriginJTI} {
+		if _, ok := s.tokens[id]; ok && id != "" {
+			return true, nil
+		}
+	}
+	if r, ok := s.subjects[c.Sub]; ok && c.IssuedAt.Before(r.before) {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *revocationStore) reapLoop(ctx context.Context) {
+	t := time.NewTicker(revocationReapInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for k, until := range s.tokens {
+				if now.After(until) {
+					delete(s.tokens, k)
+				}
+			}
+			for k, r := range s.subjects {
+				if now.After(r.expires) {
+					delete(s.subjects, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
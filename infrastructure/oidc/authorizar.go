@@ -0,0 +1,270 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// ディスカバリとJWKSの再取得間隔と、鮮度チェックで許容する最終取得からの経過時間
+const (
+	refreshInterval = time.Hour
+	maxAge          = 3 * refreshInterval
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// Issuer 信頼する発行者と、その発行者のトークンの検証・読み替えの設定
+type Issuer struct {
+	// Issuer issクレームと完全一致させる（末尾のスラッシュも含む）
+	Issuer string
+	// Audiences いずれかがaudに含まれていれば受け付ける
+	Audiences []string
+	// SubClaim, EmailClaim, GroupsClaim 各値を取り出すクレーム名
+	// （入れ子のクレームは realm_access.roles のようにドット区切りで指定する）
+	SubClaim    string
+	EmailClaim  string
+	GroupsClaim string
+}
+
+// issuerKeys 発行者ごとのディスカバリの結果とJWKS
+type issuerKeys struct {
+	Issuer
+	jwksURI   string
+	jwk       jwk.Set
+	fetchedAt time.Time
+}
+
+// OIDCディスカバリで取得したJWKSでIDトークンを検証します（Auth0、Keycloakなど）
+type oidcAuthorizar struct {
+	mu      sync.RWMutex
+	issuers map[string]*issuerKeys
+	hc      *http.Client
+}
+
+// NewOIDCAuthorizar 各発行者のディスカバリを行い、ctxが終了するまでJWKSを定期的に再取得します
+func NewOIDCAuthorizar(ctx context.Context, issuers []Issuer) proxy.AuthorizarProxy {
+	oa := &oidcAuthorizar{
+		issuers: map[string]*issuerKeys{},
+		hc:      &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, is := range issuers {
+		ik := &issuerKeys{Issuer: is}
+		if err := oa.refresh(ctx, ik); err != nil {
+			log.Fatalf("%+v", err)
+		}
+		oa.issuers[is.Issuer] = ik
+	}
+	go oa.refreshLoop(ctx)
+	return oa
+}
+
+// Name ヘルスチェック名
+func (oa *oidcAuthorizar) Name() string {
+	return "oidc"
+}
+
+// Check 全ての発行者のJWKSが取得済み、かつ古すぎないことを確認します
+func (oa *oidcAuthorizar) Check(ctx context.Context) error {
+	oa.mu.RLock()
+	defer oa.mu.RUnlock()
+	for iss, ik := range oa.issuers {
+		if ik.jwk == nil || ik.jwk.Len() == 0 {
+			return errors.WithStack(fmt.Errorf("jwks not loaded: %s", iss))
+		}
+		if age := time.Since(ik.fetchedAt); age > maxAge {
+			return errors.WithStack(fmt.Errorf("jwks is stale: %s fetched %s ago", iss, age.Truncate(time.Second)))
+		}
+	}
+	return nil
+}
+
+// refresh ディスカバリでjwks_uriを確認し、JWKSを取得します
+func (oa *oidcAuthorizar) refresh(ctx context.Context, ik *issuerKeys) error {
+	jwksURI, err := oa.discover(ctx, ik.Issuer.Issuer)
+	if err != nil {
+		return err
+	}
+	jset, err := jwk.Fetch(ctx, jwksURI, jwk.WithHTTPClient(oa.hc))
+	if err != nil {
+		return errors.Wrapf(err, "fetch jwks of %s", ik.Issuer.Issuer)
+	}
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	ik.jwksURI, ik.jwk, ik.fetchedAt = jwksURI, jset, time.Now()
+	return nil
+}
+
+// discover 発行者の設定を取得し、jwks_uriを返します
+func (oa *oidcAuthorizar) discover(ctx context.Context, issuer string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	res, err := oa.hc.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "discover %s", issuer)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.WithStack(fmt.Errorf("discover %s: unexpected status %d", issuer, res.StatusCode))
+	}
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return "", errors.Wrapf(err, "discover %s", issuer)
+	}
+	// 設定のissuerは発行者と完全に一致しなければならない（OpenID Connect Discovery 4.3）
+	if doc.Issuer != issuer {
+		return "", errors.WithStack(fmt.Errorf("discover %s: issuer mismatch %q", issuer, doc.Issuer))
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.WithStack(fmt.Errorf("discover %s: jwks_uri not found", issuer))
+	}
+	return doc.JWKSURI, nil
+}
+
+func (oa *oidcAuthorizar) refreshLoop(ctx context.Context) {
+	t := time.NewTicker(refreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			// 失敗しても前回のJWKSで検証を続ける（鮮度はヘルスチェックで検知する）
+			for _, ik := range oa.issuers {
+				if err := oa.refresh(ctx, ik); err != nil {
+					log.Default().Printf("%+v", err)
+				}
+			}
+		}
+	}
+}
+
+// ValidateJWT issクレームで発行者を選び、その発行者のJWKSで検証します
+func (oa *oidcAuthorizar) ValidateJWT(idToken string) (*model.Claims, error) {
+	// 署名の検証前に発行者を知るため、一度検証せずに読む（信頼する発行者でなければここで拒否する）
+	unverified, err := jwt.ParseInsecure([]byte(idToken))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	oa.mu.RLock()
+	ik, ok := oa.issuers[unverified.Issuer()]
+	var jset jwk.Set
+	if ok {
+		jset = ik.jwk
+	}
+	oa.mu.RUnlock()
+	if !ok {
+		return nil, errors.WithStack(fmt.Errorf("untrusted issuer %q", unverified.Issuer()))
+	}
+
+	jt, err := jwt.Parse(
+		[]byte(idToken),
+		jwt.WithKeySet(jset),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(ik.Issuer.Issuer),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !containsAny(jt.Audience(), ik.Audiences) {
+		return nil, errors.WithStack(fmt.Errorf("aud not satisfied: %v", jt.Audience()))
+	}
+	sub := stringClaim(lookup(jt, ik.SubClaim))
+	if sub == "" {
+		return nil, errors.WithStack(fmt.Errorf("%s claim not found", ik.SubClaim))
+	}
+	return &model.Claims{
+		Sub:       subject(ik.Issuer.Issuer, sub),
+		Email:     stringClaim(lookup(jt, ik.EmailClaim)),
+		Groups:    stringsClaim(lookup(jt, ik.GroupsClaim)),
+		JTI:       jt.JwtID(),
+		IssuedAt:  jt.IssuedAt(),
+		ExpiresAt: jt.Expiration(),
+	}, nil
+}
+
+// subject 発行者ごとのsubを、発行者をまたいで一意な識別子にします
+//
+// 発行者が違えば同じsubでも別のユーザであるため、失効や監査ログで取り違えないよう発行者を前に付ける
+func subject(issuer, sub string) string {
+	return issuer + "#" + sub
+}
+
+// lookup クレームを取得します（名前そのものが無ければドット区切りで入れ子をたどる）
+//
+// Auth0の名前空間付きクレーム（https://example.com/groups）のように、名前自体にドットを含む場合があるため
+func lookup(jt jwt.Token, name string) interface{} {
+	if name == "" {
+		return nil
+	}
+	if v, ok := jt.Get(name); ok {
+		return v
+	}
+	path := strings.Split(name, ".")
+	v, ok := jt.Get(path[0])
+	if !ok {
+		return nil
+	}
+	for _, key := range path[1:] {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if v, ok = m[key]; !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if v == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringClaim(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// stringsClaim 配列のクレームを文字列の配列にします（空白区切りの文字列も受け付ける）
+func stringsClaim(v interface{}) []string {
+	switch v := v.(type) {
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	case []string:
+		return v
+	case string:
+		return strings.Fields(v)
+	}
+	return []string{}
+}
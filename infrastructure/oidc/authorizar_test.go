@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// testProvider ディスカバリとJWKSを返す発行者（/a、/b の2つの発行者が同じ鍵を使う）
+func testProvider(t *testing.T) (*httptest.Server, jwk.Key) {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	set.Add(pub)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	for _, path := range []string{"/a", "/b"} {
+		issuer := srv.URL + path
+		mux.HandleFunc(path+discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": srv.URL + "/jwks"})
+		})
+	}
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	})
+	return srv, key
+}
+
+func sign(t *testing.T, key jwk.Key, claims map[string]interface{}) string {
+	t.Helper()
+	tok := jwt.New()
+	now := time.Now()
+	claims[jwt.IssuedAtKey] = now
+	claims[jwt.ExpirationKey] = now.Add(time.Hour)
+	for k, v := range claims {
+		if err := tok.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := jwt.Sign(tok, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestValidateJWTPerIssuer(t *testing.T) {
+	srv, key := testProvider(t)
+	issA, issB := srv.URL+"/a", srv.URL+"/b"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	oa := NewOIDCAuthorizar(ctx, []Issuer{
+		{Issuer: issA, Audiences: []string{"app-a"}, SubClaim: "sub", EmailClaim: "email", GroupsClaim: "groups"},
+		{Issuer: issB, Audiences: []string{"app-b"}, SubClaim: "user_id", EmailClaim: "mail", GroupsClaim: "realm_access.roles"},
+	})
+
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		wantErr    bool
+		wantSub    string
+		wantEmail  string
+		wantGroups []string
+	}{
+		{
+			name:       "issuer a",
+			claims:     map[string]interface{}{"iss": issA, "aud": "app-a", "sub": "u1", "email": "a@example.com", "groups": []string{"admin"}},
+			wantSub:    issA + "#u1",
+			wantEmail:  "a@example.com",
+			wantGroups: []string{"admin"},
+		},
+		{
+			name: "issuer b with its own claims",
+			claims: map[string]interface{}{
+				"iss": issB, "aud": "app-b", "sub": "ignored", "user_id": "u1", "mail": "b@example.com",
+				"groups": []string{"admin"}, "realm_access": map[string]interface{}{"roles": []string{"staff"}},
+			},
+			wantSub:    issB + "#u1",
+			wantEmail:  "b@example.com",
+			wantGroups: []string{"staff"},
+		},
+		{
+			name:    "audience of another issuer",
+			claims:  map[string]interface{}{"iss": issA, "aud": "app-b", "sub": "u1"},
+			wantErr: true,
+		},
+		{
+			name:    "audience of another issuer (b)",
+			claims:  map[string]interface{}{"iss": issB, "aud": "app-a", "user_id": "u1"},
+			wantErr: true,
+		},
+		{
+			name:    "missing sub claim of the issuer",
+			claims:  map[string]interface{}{"iss": issB, "aud": "app-b", "sub": "u1"},
+			wantErr: true,
+		},
+		{
+			name:    "untrusted issuer",
+			claims:  map[string]interface{}{"iss": srv.URL + "/c", "aud": "app-a", "sub": "u1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := oa.ValidateJWT(sign(t, key, tt.claims))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("claims = %+v, want an error", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if claims.Sub != tt.wantSub || claims.Email != tt.wantEmail || !reflect.DeepEqual(claims.Groups, tt.wantGroups) {
+				t.Errorf("claims = %+v, want sub %q, email %q, groups %v", claims, tt.wantSub, tt.wantEmail, tt.wantGroups)
+			}
+		})
+	}
+}
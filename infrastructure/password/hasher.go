@@ -0,0 +1,118 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// ハッシュ方式
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// argon2idのパラメータ（OWASP Password Storage Cheat Sheetの推奨値）
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// bcryptMaxBytes bcryptが使うパスワードの長さ（超えた部分は無視されるため受け付けない）
+const bcryptMaxBytes = 72
+
+// 新しいハッシュをalgorithmで作り、照合は形式から方式を判別して行います
+type hasher struct {
+	algorithm string
+}
+
+// NewHasher algorithm（bcrypt、argon2id）でハッシュ化するPasswordHasherを生成します
+func NewHasher(algorithm string) (proxy.PasswordHasher, error) {
+	switch algorithm {
+	case AlgorithmBcrypt, AlgorithmArgon2id:
+		return &hasher{algorithm}, nil
+	}
+	return nil, errors.WithStack(fmt.Errorf("unknown password hash algorithm %q", algorithm))
+}
+
+// Hash bcryptは$2a$...、argon2idはPHC形式（$argon2id$v=19$m=...,t=...,p=...$salt$hash）で返します
+func (h *hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		if len(password) > bcryptMaxBytes {
+			return "", errors.WithStack(&model.PasswordPolicyError{
+				Violations: []string{fmt.Sprintf("must be at most %d bytes", bcryptMaxBytes)},
+			})
+		}
+		b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return string(b), nil
+	}
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.WithStack(err)
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify ハッシュの形式に応じて照合します
+func (h *hasher) Verify(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	}
+	return false, errors.WithStack(fmt.Errorf("unknown password hash format"))
+}
+
+func verifyArgon2id(hash, password string) (bool, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errors.WithStack(fmt.Errorf("malformed argon2id hash"))
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.WithStack(fmt.Errorf("unsupported argon2id version %q", parts[2]))
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errors.Wrap(err, "malformed argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errors.Wrap(err, "malformed argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errors.Wrap(err, "malformed argon2id key")
+	}
+	// 保存時のパラメータで計算する（推奨値を変えても既存のハッシュを照合できる）
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
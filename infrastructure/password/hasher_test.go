@@ -0,0 +1,138 @@
+package password
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+func TestHashVerifyRoundTrip(t *testing.T) {
+	tests := []struct {
+		algorithm  string
+		wantPrefix string
+	}{
+		{AlgorithmBcrypt, "$2a$"},
+		{AlgorithmArgon2id, fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", argon2.Version, argon2Memory, argon2Time, argon2Threads)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			h, err := NewHasher(tt.algorithm)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			hash, err := h.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if !strings.HasPrefix(hash, tt.wantPrefix) {
+				t.Errorf("hash = %q, want prefix %q", hash, tt.wantPrefix)
+			}
+			// 同じパスワードでもソルトが異なる
+			if again, _ := h.Hash("correct horse battery staple"); again == hash {
+				t.Error("two hashes of the same password are equal")
+			}
+			for password, want := range map[string]bool{"correct horse battery staple": true, "wrong": false, "": false} {
+				ok, err := h.Verify(hash, password)
+				if err != nil {
+					t.Fatalf("%+v", err)
+				}
+				if ok != want {
+					t.Errorf("Verify(%q) = %v, want %v", password, ok, want)
+				}
+			}
+		})
+	}
+}
+
+// 方式を変えても、保存済みのハッシュは保存時の方式とパラメータで照合できる
+func TestVerifyStoredHashes(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("s3cret"), salt, 3, 8*1024, 2, 24)
+	argonHash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 8*1024, 3, 2,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, algorithm := range []string{AlgorithmBcrypt, AlgorithmArgon2id} {
+		h, err := NewHasher(algorithm)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		for name, hash := range map[string]string{"argon2id m=8192,t=3,p=2": argonHash, "bcrypt cost 4": string(bcryptHash)} {
+			if ok, err := h.Verify(hash, "s3cret"); err != nil || !ok {
+				t.Errorf("%s hasher, %s: Verify = %v, %+v; want true", algorithm, name, ok, err)
+			}
+			if ok, err := h.Verify(hash, "other"); err != nil || ok {
+				t.Errorf("%s hasher, %s: Verify(other) = %v, %+v; want false", algorithm, name, ok, err)
+			}
+		}
+	}
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	h, err := NewHasher(AlgorithmArgon2id)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for _, hash := range []string{
+		"",
+		"plain",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5",
+		"$2a$10$short",
+	} {
+		if ok, err := h.Verify(hash, "s3cret"); err == nil || ok {
+			t.Errorf("Verify(%q) = %v, %v; want an error", hash, ok, err)
+		}
+	}
+}
+
+// bcryptは72バイトを超えた部分を無視するため、長いパスワードはポリシー違反にする
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	long := strings.Repeat("a", bcryptMaxBytes+1)
+	h, err := NewHasher(AlgorithmBcrypt)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := h.Hash(strings.Repeat("a", bcryptMaxBytes)); err != nil {
+		t.Errorf("%d bytes: %+v", bcryptMaxBytes, err)
+	}
+	_, err = h.Hash(long)
+	var pe *model.PasswordPolicyError
+	if !errors.As(err, &pe) {
+		t.Errorf("%d bytes: err = %v, want a PasswordPolicyError", len(long), err)
+	}
+	// 26文字でも72バイトを超える
+	if _, err := h.Hash(strings.Repeat("あい", 13)); !errors.As(err, &pe) {
+		t.Errorf("78 bytes of multibyte characters: err = %v, want a PasswordPolicyError", err)
+	}
+
+	// argon2idには長さの制限がない
+	h, err = NewHasher(AlgorithmArgon2id)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	hash, err := h.Hash(long)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if ok, _ := h.Verify(hash, long[:bcryptMaxBytes]); ok {
+		t.Error("argon2id matched a truncated password")
+	}
+}
+
+func TestNewHasherUnknownAlgorithm(t *testing.T) {
+	if _, err := NewHasher("md5"); err == nil {
+		t.Error("NewHasher(md5) succeeded")
+	}
+}
@@ -0,0 +1,306 @@
+package rdb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// listUsersLimit ListUsersの1ページの件数（Cognitoに合わせる）
+const listUsersLimit = 60
+
+// ImportUser 招待と同じ状態（仮パスワードの変更待ち）でユーザを作成します
+//
+// 属性はnameとemail_verifiedのみ受け付けます。仮パスワードが空の場合は生成し、SendInvitationの場合のみメールで送ります。
+func (p *sqlUserProxy) ImportUser(ctx context.Context, req *model.ImportUserReq) error {
+	for k := range req.Attributes {
+		if k != "name" && k != "email_verified" {
+			return errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: "attribute " + k})
+		}
+	}
+	sub, err := newUUID()
+	if err != nil {
+		return err
+	}
+	tempPassword := req.TemporaryPassword
+	if tempPassword == "" {
+		if tempPassword, err = randomURLSafe(tempPasswordSize); err != nil {
+			return err
+		}
+	}
+	email := normalizeEmail(req.Email)
+	if err := p.withTx(ctx, func(tx *sql.Tx) error {
+		if err := p.insertUser(ctx, tx, &userRow{sub, email, req.Attributes["name"], "", statusForceChangePassword, true}); err != nil {
+			return err
+		}
+		return p.saveCode(ctx, tx, sub, purposeInvite, tempPassword, p.opts.InvitationTTL)
+	}); err != nil {
+		return err
+	}
+	if !req.SendInvitation {
+		return nil
+	}
+	return p.sendCode(ctx, email, "You have been invited", tempPassword, p.opts.InvitationTTL)
+}
+
+// ListUsers メールアドレス順に返します（ページトークンは前のページの最後のメールアドレス）
+func (p *sqlUserProxy) ListUsers(ctx context.Context, pageToken string) ([]*model.UserRecord, string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT sub, email, name, status, enabled, created_at, updated_at
+		FROM users WHERE email > $1 ORDER BY email LIMIT `+strconv.Itoa(listUsersLimit), pageToken)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	defer rows.Close()
+	var users []*model.UserRecord
+	for rows.Next() {
+		u, err := scanUserRecord(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if len(users) < listUsersLimit {
+		return users, "", nil
+	}
+	return users, users[len(users)-1].Username, nil
+}
+
+// DescribeUser グループを含めてユーザを返します
+func (p *sqlUserProxy) DescribeUser(ctx context.Context, email string) (*model.UserRecord, error) {
+	u, err := scanUserRecord(p.db.QueryRowContext(ctx, `SELECT sub, email, name, status, enabled, created_at, updated_at
+		FROM users WHERE email = $1`, normalizeEmail(email)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.WithStack(model.ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Groups, err = p.groupsOf(ctx, u.Attributes["sub"]); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// EnableUser 無効化したユーザを有効にします
+func (p *sqlUserProxy) EnableUser(ctx context.Context, email string) error {
+	return p.updateUser(ctx, `UPDATE users SET enabled = $1, updated_at = $2 WHERE email = $3`,
+		true, time.Now().UTC(), normalizeEmail(email))
+}
+
+// DeleteUser ユーザとコード、リフレッシュトークン、グループを削除します
+func (p *sqlUserProxy) DeleteUser(ctx context.Context, email string) error {
+	return p.withTx(ctx, func(tx *sql.Tx) error {
+		u, err := p.findByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+		for _, table := range []string{"user_groups", "refresh_tokens", "user_codes", "users"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE sub = $1`, u.sub); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+// ResetPassword パスワードを消去してリセットコードをメールで送り、全てのリフレッシュトークンを失効させます
+//
+// ConfirmForgotPasswordで新しいパスワードを設定するまでログインできません。
+func (p *sqlUserProxy) ResetPassword(ctx context.Context, email string) error {
+	u, err := p.findByEmail(ctx, p.db, email)
+	if err != nil {
+		return err
+	}
+	if u.status != statusConfirmed {
+		return errors.WithStack(model.ErrUserNotConfirmed)
+	}
+	code, err := newNumericCode()
+	if err != nil {
+		return err
+	}
+	if err := p.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = '', updated_at = $1 WHERE sub = $2`,
+			time.Now().UTC(), u.sub); err != nil {
+			return errors.WithStack(err)
+		}
+		return p.saveCode(ctx, tx, u.sub, purposeReset, code, p.opts.ResetCodeTTL)
+	}); err != nil {
+		return err
+	}
+	if err := p.revokeAll(ctx, u.sub); err != nil {
+		return err
+	}
+	return p.sendCode(ctx, u.email, "Your password has been reset", code, p.opts.ResetCodeTTL)
+}
+
+// AddUserToGroup ユーザをグループに追加します（グループがなければ作成する、追加済みの場合は何もしない）
+func (p *sqlUserProxy) AddUserToGroup(ctx context.Context, email, group string) error {
+	u, err := p.findByEmail(ctx, p.db, email)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return p.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO groups (name, created_at, updated_at) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO NOTHING`, group, now, now); err != nil {
+			return errors.WithStack(err)
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO user_groups (sub, group_name) VALUES ($1, $2) ON CONFLICT (sub, group_name) DO NOTHING`, u.sub, group)
+		return errors.WithStack(err)
+	})
+}
+
+// RemoveUserFromGroup ユーザをグループから外します（メンバーでない場合は何もしない）
+func (p *sqlUserProxy) RemoveUserFromGroup(ctx context.Context, email, group string) error {
+	u, err := p.findByEmail(ctx, p.db, email)
+	if err != nil {
+		return err
+	}
+	if _, err := p.findGroup(ctx, group); err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `DELETE FROM user_groups WHERE sub = $1 AND group_name = $2`, u.sub, group)
+	return errors.WithStack(err)
+}
+
+// ListGroups 名前順に返します（ページトークンは前のページの最後のグループ名）
+func (p *sqlUserProxy) ListGroups(ctx context.Context, pageToken string) ([]*model.GroupRecord, string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT name, created_at, updated_at
+		FROM groups WHERE name > $1 ORDER BY name LIMIT `+strconv.Itoa(listUsersLimit), pageToken)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	defer rows.Close()
+	var groups []*model.GroupRecord
+	for rows.Next() {
+		g := new(model.GroupRecord)
+		if err := rows.Scan(&g.Name, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if len(groups) < listUsersLimit {
+		return groups, "", nil
+	}
+	return groups, groups[len(groups)-1].Name, nil
+}
+
+// DescribeGroup メンバーをメールアドレス順に含めてグループを返します
+func (p *sqlUserProxy) DescribeGroup(ctx context.Context, name string) (*model.GroupRecord, error) {
+	g, err := p.findGroup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT u.sub, u.email FROM user_groups g JOIN users u ON u.sub = g.sub
+		WHERE g.group_name = $1 ORDER BY u.email`, name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := new(model.GroupMember)
+		if err := rows.Scan(&m.Sub, &m.Username); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		g.Members = append(g.Members, m)
+	}
+	return g, errors.WithStack(rows.Err())
+}
+
+// CreateGroup メンバーのいないグループを作成します
+func (p *sqlUserProxy) CreateGroup(ctx context.Context, name string) error {
+	if _, err := p.findGroup(ctx, name); err == nil {
+		return errors.Wrap(model.ErrGroupAlreadyExists, name)
+	} else if !errors.Is(err, model.ErrGroupNotFound) {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err := p.db.ExecContext(ctx, `INSERT INTO groups (name, created_at, updated_at) VALUES ($1, $2, $3)`, name, now, now)
+	return errors.WithStack(err)
+}
+
+// DeleteGroup グループとメンバーシップを削除します
+func (p *sqlUserProxy) DeleteGroup(ctx context.Context, name string) error {
+	return p.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_groups WHERE group_name = $1`, name); err != nil {
+			return errors.WithStack(err)
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE name = $1`, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return errors.WithStack(err)
+		} else if n == 0 {
+			return errors.Wrap(model.ErrGroupNotFound, name)
+		}
+		return nil
+	})
+}
+
+func (p *sqlUserProxy) findGroup(ctx context.Context, name string) (*model.GroupRecord, error) {
+	g := new(model.GroupRecord)
+	err := p.db.QueryRowContext(ctx, `SELECT name, created_at, updated_at FROM groups WHERE name = $1`, name).
+		Scan(&g.Name, &g.CreatedAt, &g.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrap(model.ErrGroupNotFound, name)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return g, nil
+}
+
+// groupsOf グループ名の昇順に返します
+func (p *sqlUserProxy) groupsOf(ctx context.Context, sub string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT group_name FROM user_groups WHERE sub = $1 ORDER BY group_name`, sub)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	var groups []string
+	for rows.Next() {
+		var g string
+		if err := rows.Scan(&g); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, errors.WithStack(rows.Err())
+}
+
+// scanner *sql.Rowと*sql.Rowsのどちらでも読み込めるようにする
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUserRecord sub, email, name, status, enabled, created_at, updated_atの順の行を読み込みます
+func scanUserRecord(row scanner) (*model.UserRecord, error) {
+	var sub, email, name string
+	u := new(model.UserRecord)
+	if err := row.Scan(&sub, &email, &name, &u.Status, &u.Enabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	u.Username = email
+	u.Attributes = map[string]string{
+		"sub":            sub,
+		"email":          email,
+		"email_verified": strconv.FormatBool(u.Status != statusUnconfirmed),
+	}
+	if name != "" {
+		u.Attributes["name"] = name
+	}
+	return u, nil
+}
@@ -0,0 +1,61 @@
+package rdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+
+	"github.com/pkg/errors"
+)
+
+const createAuditTable = `CREATE TABLE IF NOT EXISTS audit_events (
+	occurred_at TIMESTAMP NOT NULL,
+	action      TEXT NOT NULL,
+	actor_sub   TEXT NOT NULL,
+	target      TEXT NOT NULL,
+	ip          TEXT NOT NULL,
+	user_agent  TEXT NOT NULL,
+	outcome     TEXT NOT NULL,
+	reason      TEXT NOT NULL
+)`
+
+// 監査ログをSQLデータベースに書き込みます
+type sqlAuditSink struct {
+	db *sql.DB
+}
+
+// NewSQLAuditSink SQLデータベースに書き込むAuditSinkを生成します（テーブルがなければ作成する）
+func NewSQLAuditSink(db *sql.DB) (proxy.AuditSink, error) {
+	if _, err := db.Exec(createAuditTable); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &sqlAuditSink{db}, nil
+}
+
+// Write 1イベントを1行として書き込みます
+func (s *sqlAuditSink) Write(ctx context.Context, ev *model.AuditEvent) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_events (occurred_at, action, actor_sub, target, ip, user_agent, outcome, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ev.Time.UTC(), ev.Action, ev.ActorSub, ev.Target, ev.IP, ev.UserAgent, ev.Outcome, ev.Reason,
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Name ヘルスチェック名
+func (s *sqlAuditSink) Name() string {
+	return "audit_db"
+}
+
+// Check データベースに接続できることを確認します
+func (s *sqlAuditSink) Check(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package rdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// DefaultLegacyUserQuery 移行元のアカウントを参照する既定のクエリ
+const DefaultLegacyUserQuery = `SELECT email, name, password_hash FROM users WHERE lower(email) = $1`
+
+// 移行元のシステムのデータベースを読み取り専用で参照します
+//
+// クエリは小文字にしたメールアドレスを$1で受け取り、email、name、password_hashの順に返す。
+// 4列目以降は列名を属性名として移行先に設定する（例: id AS "custom:legacy_id"）。
+type sqlLegacyUserStore struct {
+	db        *sql.DB
+	query     string
+	hasher    proxy.PasswordHasher
+	dummyHash string
+}
+
+// NewSQLLegacyUserStore LegacyUserStoreを生成します（パスワードハッシュはbcrypt、argon2idに対応）
+func NewSQLLegacyUserStore(db *sql.DB, query string, hasher proxy.PasswordHasher) (proxy.LegacyUserStore, error) {
+	dummyHash, err := hasher.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+	return &sqlLegacyUserStore{db, query, hasher, dummyHash}, nil
+}
+
+// Authenticate パスワードを照合します
+func (s *sqlLegacyUserStore) Authenticate(ctx context.Context, email, password string) (*model.LegacyUser, error) {
+	u, hash, err := s.find(ctx, email)
+	if errors.Is(err, model.ErrUserNotFound) {
+		_, _ = s.hasher.Verify(s.dummyHash, password)
+		return nil, errors.Wrap(model.ErrNotAuthorized, "legacy user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		// パスワードを設定していないアカウント（移行元でもパスワードではログインできない）
+		return nil, errors.Wrap(model.ErrNotAuthorized, "legacy user has no password")
+	}
+	ok, err := s.hasher.Verify(hash, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "legacy password mismatch")
+	}
+	return u, nil
+}
+
+// Lookup パスワードを照合せずに参照します
+func (s *sqlLegacyUserStore) Lookup(ctx context.Context, email string) (*model.LegacyUser, error) {
+	u, _, err := s.find(ctx, email)
+	return u, err
+}
+
+func (s *sqlLegacyUserStore) find(ctx context.Context, email string) (*model.LegacyUser, string, error) {
+	rows, err := s.db.QueryContext(ctx, s.query, normalizeEmail(email))
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if len(cols) < 3 {
+		return nil, "", errors.WithStack(fmt.Errorf("legacy user query must return email, name and password_hash, got %d columns", len(cols)))
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		return nil, "", errors.WithStack(model.ErrUserNotFound)
+	}
+	vals := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if rows.Next() {
+		return nil, "", errors.WithStack(fmt.Errorf("legacy user query returned multiple rows for %s", email))
+	}
+	u := &model.LegacyUser{Email: normalizeEmail(vals[0].String), Name: vals[1].String, Attributes: map[string]string{}}
+	for i, c := range cols[3:] {
+		if v := vals[i+3]; v.Valid {
+			u.Attributes[c] = v.String
+		}
+	}
+	return u, vals[2].String, nil
+}
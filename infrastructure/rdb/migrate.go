@@ -0,0 +1,110 @@
+package rdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migration バージョン毎のスキーマ変更（SQLiteとPostgreSQLの両方で動くSQLに限る）
+type migration struct {
+	version int
+	stmts   []string
+}
+
+// userMigrations SQLバックエンドのスキーマ（適用済みの内容は変更せず、末尾に追加する）
+var userMigrations = []migration{
+	{1, []string{
+		`CREATE TABLE users (
+			sub           TEXT PRIMARY KEY,
+			email         TEXT NOT NULL UNIQUE,
+			name          TEXT NOT NULL,
+			password_hash TEXT NOT NULL,
+			status        TEXT NOT NULL,
+			enabled       BOOLEAN NOT NULL,
+			created_at    TIMESTAMP NOT NULL,
+			updated_at    TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE user_codes (
+			sub        TEXT NOT NULL,
+			purpose    TEXT NOT NULL,
+			code_hash  TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			attempts   INTEGER NOT NULL,
+			PRIMARY KEY (sub, purpose)
+		)`,
+		`CREATE TABLE refresh_tokens (
+			id         TEXT PRIMARY KEY,
+			sub        TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		)`,
+		`CREATE INDEX refresh_tokens_sub ON refresh_tokens (sub)`,
+	}},
+	{2, []string{
+		`CREATE TABLE user_groups (
+			sub        TEXT NOT NULL,
+			group_name TEXT NOT NULL,
+			PRIMARY KEY (sub, group_name)
+		)`,
+	}},
+	{3, []string{
+		// メンバーのいないグループも保持できるようにする（既存のグループはメンバーから作る）
+		`CREATE TABLE groups (
+			name       TEXT PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		)`,
+		`INSERT INTO groups (name, created_at, updated_at)
+			SELECT DISTINCT group_name, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM user_groups`,
+	}},
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// migrate 未適用のスキーマ変更をバージョン毎にトランザクションで適用します
+//
+// 複数のインスタンスが同時に起動した場合、後から適用しようとした方はバージョンの重複で失敗する（再起動で回復する）。
+func migrate(ctx context.Context, db *sql.DB, migrations []migration) error {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return errors.WithStack(err)
+	}
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return errors.Wrapf(err, "migration %d", m.version)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range m.stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, m.version, time.Now().UTC()); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
@@ -0,0 +1,639 @@
+package rdb
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// backendName NotSupportedErrorに入れるバックエンド名
+const backendName = "sql"
+
+// アカウントの状態（Cognitoのユーザステータスに合わせる）
+const (
+	statusUnconfirmed         = "UNCONFIRMED"
+	statusConfirmed           = "CONFIRMED"
+	statusForceChangePassword = "FORCE_CHANGE_PASSWORD"
+)
+
+// 確認コードの用途
+const (
+	purposeConfirm = "confirm"
+	purposeReset   = "reset"
+	purposeInvite  = "invite"
+)
+
+const (
+	// maxCodeAttempts 同じコードに回答できる回数（超えるとコードを破棄する）
+	maxCodeAttempts = 5
+	// tempPasswordSize, refreshTokenSize 乱数のバイト数
+	tempPasswordSize = 12
+	refreshTokenSize = 32
+)
+
+// SQLUserOptions コードとリフレッシュトークンの有効期間
+type SQLUserOptions struct {
+	ConfirmationCodeTTL time.Duration
+	ResetCodeTTL        time.Duration
+	// InvitationTTL 招待の仮パスワードの有効期間
+	InvitationTTL   time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// SQLデータベースでアカウントを管理し、IDトークンはTokenIssuerで発行します
+type sqlUserProxy struct {
+	db     *sql.DB
+	hasher proxy.PasswordHasher
+	issuer proxy.TokenIssuer
+	mailer proxy.Mailer
+	opts   SQLUserOptions
+	// dummyHash 存在しないアカウントでも照合を行い、応答時間で存在が分からないようにする
+	dummyHash string
+}
+
+type userRow struct {
+	sub, email, name, passwordHash, status string
+	enabled                                bool
+}
+
+// queryer, execer *sql.DBと*sql.Txのどちらでも使えるようにする
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// NewSQLUserProxy SQLデータベースを使うUserProxyを生成します（未適用のスキーマ変更を適用する）
+func NewSQLUserProxy(
+	ctx context.Context,
+	db *sql.DB,
+	hasher proxy.PasswordHasher,
+	issuer proxy.TokenIssuer,
+	mailer proxy.Mailer,
+	opts SQLUserOptions,
+) (proxy.UserProxy, error) {
+	return newSQLUserProxy(ctx, db, hasher, issuer, mailer, opts)
+}
+
+// NewSQLUserAdminProxy 管理者の操作を含めたUserAdminProxyを生成します
+func NewSQLUserAdminProxy(
+	ctx context.Context,
+	db *sql.DB,
+	hasher proxy.PasswordHasher,
+	issuer proxy.TokenIssuer,
+	mailer proxy.Mailer,
+	opts SQLUserOptions,
+) (proxy.UserAdminProxy, error) {
+	return newSQLUserProxy(ctx, db, hasher, issuer, mailer, opts)
+}
+
+func newSQLUserProxy(
+	ctx context.Context,
+	db *sql.DB,
+	hasher proxy.PasswordHasher,
+	issuer proxy.TokenIssuer,
+	mailer proxy.Mailer,
+	opts SQLUserOptions,
+) (*sqlUserProxy, error) {
+	if err := migrate(ctx, db, userMigrations); err != nil {
+		return nil, err
+	}
+	dummyHash, err := hasher.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+	return &sqlUserProxy{db, hasher, issuer, mailer, opts, dummyHash}, nil
+}
+
+// Signup サインアップ（確認コードをメールで送る）
+func (p *sqlUserProxy) Signup(ctx context.Context, req *model.CreateReq) (string, error) {
+	hash, err := p.hasher.Hash(req.Password)
+	if err != nil {
+		return "", err
+	}
+	sub, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	email := normalizeEmail(req.Email)
+	code, err := newNumericCode()
+	if err != nil {
+		return "", err
+	}
+	if err := p.withTx(ctx, func(tx *sql.Tx) error {
+		if err := p.insertUser(ctx, tx, &userRow{sub, email, req.Name, hash, statusUnconfirmed, true}); err != nil {
+			return err
+		}
+		return p.saveCode(ctx, tx, sub, purposeConfirm, code, p.opts.ConfirmationCodeTTL)
+	}); err != nil {
+		return "", err
+	}
+	return sub, p.sendCode(ctx, email, "Your verification code", code, p.opts.ConfirmationCodeTTL)
+}
+
+// ConfirmAndSignin 確認コードでアカウントを確認し、ログインします
+func (p *sqlUserProxy) ConfirmAndSignin(ctx context.Context, req *model.ConfirmAndSigninReq) (*model.Token, error) {
+	u, err := p.findByEmail(ctx, p.db, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if u.status != statusUnconfirmed {
+		return nil, errors.WithStack(model.ErrUserAlreadyConfirmed)
+	}
+	if err := p.consumeCode(ctx, u.sub, purposeConfirm, req.ConfirmationCode); err != nil {
+		return nil, err
+	}
+	if err := p.updateUser(ctx, `UPDATE users SET status = $1, updated_at = $2 WHERE sub = $3`,
+		statusConfirmed, time.Now().UTC(), u.sub); err != nil {
+		return nil, err
+	}
+	return p.Signin(ctx, &model.SigninReq{Email: req.Email, Password: req.Password})
+}
+
+// ResendConfirmationCode 確認コードを再発行します
+func (p *sqlUserProxy) ResendConfirmationCode(ctx context.Context, req *model.ResendConfirmationCodeReq) error {
+	u, err := p.findByEmail(ctx, p.db, req.Email)
+	if err != nil {
+		return err
+	}
+	if u.status != statusUnconfirmed {
+		return errors.WithStack(model.ErrUserAlreadyConfirmed)
+	}
+	code, err := newNumericCode()
+	if err != nil {
+		return err
+	}
+	if err := p.saveCode(ctx, p.db, u.sub, purposeConfirm, code, p.opts.ConfirmationCodeTTL); err != nil {
+		return err
+	}
+	return p.sendCode(ctx, u.email, "Your verification code", code, p.opts.ConfirmationCodeTTL)
+}
+
+// Signin パスワードでログインします（デバイスの記憶には対応しない）
+func (p *sqlUserProxy) Signin(ctx context.Context, req *model.SigninReq) (*model.Token, error) {
+	u, err := p.findByEmail(ctx, p.db, req.Email)
+	if errors.Is(err, model.ErrUserNotFound) {
+		_, _ = p.hasher.Verify(p.dummyHash, req.Password)
+		return nil, errors.Wrap(model.ErrNotAuthorized, "user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.passwordHash == "" {
+		// 招待に応答していない（仮パスワードはRespondToInvitationでのみ使える）
+		_, _ = p.hasher.Verify(p.dummyHash, req.Password)
+		return nil, errors.Wrap(model.ErrNotAuthorized, "password change required")
+	}
+	ok, err := p.hasher.Verify(u.passwordHash, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "password mismatch")
+	}
+	if !u.enabled {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "user is disabled")
+	}
+	if u.status == statusUnconfirmed {
+		return nil, errors.WithStack(model.ErrUserNotConfirmed)
+	}
+	return p.issueTokens(ctx, u)
+}
+
+// Refresh リフレッシュトークンでIDトークンを再発行します（リフレッシュトークンは変わらない）
+func (p *sqlUserProxy) Refresh(ctx context.Context, req *model.RefreshReq) (*model.Token, error) {
+	var (
+		id, sub, email string
+		expiresAt      time.Time
+		revokedAt      sql.NullTime
+		enabled        bool
+	)
+	err := p.db.QueryRowContext(ctx, `SELECT r.id, r.sub, r.expires_at, r.revoked_at, u.email, u.enabled
+		FROM refresh_tokens r JOIN users u ON u.sub = r.sub WHERE r.token_hash = $1`,
+		hashSecret(req.RefreshToken),
+	).Scan(&id, &sub, &expiresAt, &revokedAt, &email, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "unknown refresh token")
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	switch {
+	case sub != req.Sub:
+		return nil, errors.Wrap(model.ErrNotAuthorized, "refresh token of another user")
+	case revokedAt.Valid:
+		return nil, errors.Wrap(model.ErrNotAuthorized, "refresh token revoked")
+	case !time.Now().Before(expiresAt):
+		return nil, errors.Wrap(model.ErrNotAuthorized, "refresh token expired")
+	case !enabled:
+		return nil, errors.Wrap(model.ErrNotAuthorized, "user is disabled")
+	}
+	groups, err := p.groupsOf(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := p.issuer.IssueIDToken(&model.Claims{Sub: sub, Email: email, Groups: groups, OriginJTI: id})
+	if err != nil {
+		return nil, err
+	}
+	return &model.Token{IDToken: idToken}, nil
+}
+
+// ChangePassword パスワードを変更します
+func (p *sqlUserProxy) ChangePassword(ctx context.Context, email string, req *model.ChangePasswordReq) error {
+	hash, err := p.hasher.Hash(req.ProposedPassword)
+	if err != nil {
+		return err
+	}
+	return p.updateUser(ctx, `UPDATE users SET password_hash = $1, updated_at = $2 WHERE email = $3`,
+		hash, time.Now().UTC(), normalizeEmail(email))
+}
+
+// ForgotPassword リセットコードをメールで送ります
+func (p *sqlUserProxy) ForgotPassword(ctx context.Context, req *model.ForgotPasswordReq) error {
+	u, err := p.findByEmail(ctx, p.db, req.Email)
+	if err != nil {
+		return err
+	}
+	if u.status != statusConfirmed {
+		return errors.WithStack(model.ErrUserNotConfirmed)
+	}
+	code, err := newNumericCode()
+	if err != nil {
+		return err
+	}
+	if err := p.saveCode(ctx, p.db, u.sub, purposeReset, code, p.opts.ResetCodeTTL); err != nil {
+		return err
+	}
+	return p.sendCode(ctx, u.email, "Your password reset code", code, p.opts.ResetCodeTTL)
+}
+
+// ConfirmForgotPassword リセットコードでパスワードを再設定し、全てのリフレッシュトークンを失効させます
+func (p *sqlUserProxy) ConfirmForgotPassword(ctx context.Context, req *model.ConfirmForgotPasswordReq) error {
+	u, err := p.findByEmail(ctx, p.db, req.Email)
+	if err != nil {
+		return err
+	}
+	hash, err := p.hasher.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+	if err := p.consumeCode(ctx, u.sub, purposeReset, req.Code); err != nil {
+		return err
+	}
+	if err := p.updateUser(ctx, `UPDATE users SET password_hash = $1, updated_at = $2 WHERE sub = $3`,
+		hash, time.Now().UTC(), u.sub); err != nil {
+		return err
+	}
+	return p.revokeAll(ctx, u.sub)
+}
+
+// GetProfile メールアドレスでアカウントを取得します
+func (p *sqlUserProxy) GetProfile(ctx context.Context, email string) (*model.User, error) {
+	u, err := p.findByEmail(ctx, p.db, email)
+	if err != nil {
+		return nil, err
+	}
+	return &model.User{Email: u.email, Name: u.name}, nil
+}
+
+// ChangeProfile 名前を変更します
+func (p *sqlUserProxy) ChangeProfile(ctx context.Context, email string, req *model.ChangeProfileReq) error {
+	return p.updateUser(ctx, `UPDATE users SET name = $1, updated_at = $2 WHERE email = $3`,
+		req.Name, time.Now().UTC(), normalizeEmail(email))
+}
+
+// Signout リフレッシュトークンを失効させます（不明なトークンは無視する）
+func (p *sqlUserProxy) Signout(ctx context.Context, req *model.SignoutReq) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE token_hash = $2 AND revoked_at IS NULL`,
+		time.Now().UTC(), hashSecret(req.RefreshToken))
+	return errors.WithStack(err)
+}
+
+// GlobalSignout ユーザの全てのリフレッシュトークンを失効させます
+func (p *sqlUserProxy) GlobalSignout(ctx context.Context, email string) error {
+	u, err := p.findByEmail(ctx, p.db, email)
+	if err != nil {
+		return err
+	}
+	return p.revokeAll(ctx, u.sub)
+}
+
+// Invite 仮パスワードを発行してメールで送ります（仮パスワードではログインできず、RespondToInvitationで使う）
+func (p *sqlUserProxy) Invite(ctx context.Context, req *model.InviteReq) (string, error) {
+	sub, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	tempPassword, err := randomURLSafe(tempPasswordSize)
+	if err != nil {
+		return "", err
+	}
+	email := normalizeEmail(req.Email)
+	if err := p.withTx(ctx, func(tx *sql.Tx) error {
+		if err := p.insertUser(ctx, tx, &userRow{sub, email, "", "", statusForceChangePassword, true}); err != nil {
+			return err
+		}
+		return p.saveCode(ctx, tx, sub, purposeInvite, tempPassword, p.opts.InvitationTTL)
+	}); err != nil {
+		return "", err
+	}
+	return sub, p.sendCode(ctx, email, "You have been invited", tempPassword, p.opts.InvitationTTL)
+}
+
+// RespondToInvitation 仮パスワードを確認し、名前とパスワードを設定してログインします
+func (p *sqlUserProxy) RespondToInvitation(ctx context.Context, req *model.RespondToInvitationReq) (*model.Token, error) {
+	u, err := p.findByEmail(ctx, p.db, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if u.status != statusForceChangePassword {
+		return nil, errors.WithStack(model.ErrUserAlreadyConfirmed)
+	}
+	hash, err := p.hasher.Hash(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeCode(ctx, u.sub, purposeInvite, req.ConfirmationCode); err != nil {
+		return nil, err
+	}
+	if err := p.updateUser(ctx,
+		`UPDATE users SET name = $1, password_hash = $2, status = $3, updated_at = $4 WHERE sub = $5`,
+		req.Name, hash, statusConfirmed, time.Now().UTC(), u.sub); err != nil {
+		return nil, err
+	}
+	u.name, u.passwordHash, u.status = req.Name, hash, statusConfirmed
+	if !u.enabled {
+		return nil, errors.Wrap(model.ErrNotAuthorized, "user is disabled")
+	}
+	return p.issueTokens(ctx, u)
+}
+
+// GetUser subでアカウントを取得します
+func (p *sqlUserProxy) GetUser(ctx context.Context, req *model.GetUserReq) (*model.User, error) {
+	u, err := p.findUser(ctx, p.db, `sub = $1`, req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	return &model.User{Email: u.email, Name: u.name}, nil
+}
+
+// DisableUser アカウントを無効化し、全てのリフレッシュトークンを失効させます
+func (p *sqlUserProxy) DisableUser(ctx context.Context, req *model.DisableUserReq) error {
+	if err := p.updateUser(ctx, `UPDATE users SET enabled = $1, updated_at = $2 WHERE sub = $3`,
+		false, time.Now().UTC(), req.Sub); err != nil {
+		return err
+	}
+	return p.revokeAll(ctx, req.Sub)
+}
+
+// ListDevices デバイスの記憶には対応しません
+func (p *sqlUserProxy) ListDevices(ctx context.Context, email string) ([]*model.Device, error) {
+	return nil, errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: "ListDevices"})
+}
+
+// ForgetDevice デバイスの記憶には対応しません
+func (p *sqlUserProxy) ForgetDevice(ctx context.Context, email, deviceKey string) error {
+	return errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: "ForgetDevice"})
+}
+
+// UpdateDeviceStatus デバイスの記憶には対応しません
+func (p *sqlUserProxy) UpdateDeviceStatus(ctx context.Context, email string, req *model.UpdateDeviceStatusReq) error {
+	return errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: "UpdateDeviceStatus"})
+}
+
+// InitiateCustomAuth カスタム認証（Cognitoのトリガ）には対応しません
+func (p *sqlUserProxy) InitiateCustomAuth(ctx context.Context, req *model.CustomAuthReq) (*model.CustomChallenge, error) {
+	return nil, errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: "InitiateCustomAuth"})
+}
+
+// RespondToCustomChallenge カスタム認証（Cognitoのトリガ）には対応しません
+func (p *sqlUserProxy) RespondToCustomChallenge(ctx context.Context, req *model.CustomChallengeAnswerReq) (*model.Token, error) {
+	return nil, errors.WithStack(&model.NotSupportedError{Backend: backendName, Operation: "RespondToCustomChallenge"})
+}
+
+// Name ヘルスチェック名
+func (p *sqlUserProxy) Name() string {
+	return "user_db"
+}
+
+// Check データベースに接続できることを確認します
+func (p *sqlUserProxy) Check(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// issueTokens リフレッシュトークンを保存し（ハッシュのみ）、その識別子をorigin_jtiにしたIDトークンを発行します
+func (p *sqlUserProxy) issueTokens(ctx context.Context, u *userRow) (*model.Token, error) {
+	id, err := randomURLSafe(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomURLSafe(refreshTokenSize)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if _, err := p.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, sub, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		id, u.sub, hashSecret(refreshToken), now, now.Add(p.opts.RefreshTokenTTL),
+	); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	groups, err := p.groupsOf(ctx, u.sub)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := p.issuer.IssueIDToken(&model.Claims{Sub: u.sub, Email: u.email, Groups: groups, OriginJTI: id})
+	if err != nil {
+		return nil, err
+	}
+	return &model.Token{IDToken: idToken, RefreshToken: &refreshToken}, nil
+}
+
+func (p *sqlUserProxy) revokeAll(ctx context.Context, sub string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE sub = $2 AND revoked_at IS NULL`,
+		time.Now().UTC(), sub)
+	return errors.WithStack(err)
+}
+
+func (p *sqlUserProxy) findByEmail(ctx context.Context, q queryer, email string) (*userRow, error) {
+	return p.findUser(ctx, q, `email = $1`, normalizeEmail(email))
+}
+
+func (p *sqlUserProxy) findUser(ctx context.Context, q queryer, cond string, arg interface{}) (*userRow, error) {
+	u := new(userRow)
+	err := q.QueryRowContext(ctx,
+		`SELECT sub, email, name, password_hash, status, enabled FROM users WHERE `+cond, arg,
+	).Scan(&u.sub, &u.email, &u.name, &u.passwordHash, &u.status, &u.enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.WithStack(model.ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+// insertUser 同じメールアドレスのアカウントがあればErrUserAlreadyExistsを返します
+func (p *sqlUserProxy) insertUser(ctx context.Context, tx *sql.Tx, u *userRow) error {
+	if _, err := p.findByEmail(ctx, tx, u.email); err == nil {
+		return errors.WithStack(model.ErrUserAlreadyExists)
+	} else if !errors.Is(err, model.ErrUserNotFound) {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `INSERT INTO users
+		(sub, email, name, password_hash, status, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		u.sub, u.email, u.name, u.passwordHash, u.status, u.enabled, now, now)
+	return errors.WithStack(err)
+}
+
+// updateUser 1件も更新されなければErrUserNotFoundを返します
+func (p *sqlUserProxy) updateUser(ctx context.Context, query string, args ...interface{}) error {
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		return errors.WithStack(model.ErrUserNotFound)
+	}
+	return nil
+}
+
+// saveCode コードのハッシュを保存します（同じ用途の未使用のコードは置き換える）
+func (p *sqlUserProxy) saveCode(ctx context.Context, e execer, sub, purpose, code string, ttl time.Duration) error {
+	_, err := e.ExecContext(ctx, `INSERT INTO user_codes (sub, purpose, code_hash, expires_at, attempts)
+		VALUES ($1, $2, $3, $4, 0)
+		ON CONFLICT (sub, purpose) DO UPDATE SET code_hash = excluded.code_hash, expires_at = excluded.expires_at, attempts = 0`,
+		sub, purpose, hashSecret(code), time.Now().UTC().Add(ttl))
+	return errors.WithStack(err)
+}
+
+// consumeCode コードを照合し、一致すれば破棄します（誤りがmaxCodeAttempts回に達した場合も破棄する）
+func (p *sqlUserProxy) consumeCode(ctx context.Context, sub, purpose, code string) error {
+	var (
+		codeHash  string
+		expiresAt time.Time
+		attempts  int
+	)
+	err := p.db.QueryRowContext(ctx,
+		`SELECT code_hash, expires_at, attempts FROM user_codes WHERE sub = $1 AND purpose = $2`, sub, purpose,
+	).Scan(&codeHash, &expiresAt, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(model.ErrInvalidCode, "no code issued")
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !time.Now().Before(expiresAt) {
+		if _, err := p.db.ExecContext(ctx, `DELETE FROM user_codes WHERE sub = $1 AND purpose = $2`, sub, purpose); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.Wrap(model.ErrInvalidCode, "code expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(code)), []byte(codeHash)) != 1 {
+		if attempts+1 >= maxCodeAttempts {
+			_, err = p.db.ExecContext(ctx, `DELETE FROM user_codes WHERE sub = $1 AND purpose = $2`, sub, purpose)
+		} else {
+			_, err = p.db.ExecContext(ctx,
+				`UPDATE user_codes SET attempts = attempts + 1 WHERE sub = $1 AND purpose = $2`, sub, purpose)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.Wrap(model.ErrInvalidCode, "code mismatch")
+	}
+	// 同時に回答された場合も1回しか使えないよう、削除できた場合のみ成功とする
+	res, err := p.db.ExecContext(ctx,
+		`DELETE FROM user_codes WHERE sub = $1 AND purpose = $2 AND code_hash = $3`, sub, purpose, codeHash)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return errors.Wrap(model.ErrInvalidCode, "code already used")
+	}
+	return nil
+}
+
+func (p *sqlUserProxy) sendCode(ctx context.Context, to, subject, code string, ttl time.Duration) error {
+	return p.mailer.Send(ctx, &model.Mail{
+		To:      to,
+		Subject: subject,
+		Body:    fmt.Sprintf("Your code is %s\nIt expires in %s.\n", code, ttl),
+	})
+}
+
+func (p *sqlUserProxy) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// hashSecret 推測されにくい値（コード、トークン）をそのまま保存しないためのハッシュ
+func hashSecret(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// newNumericCode 6桁の数字のコード
+func newNumericCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return fmt.Sprintf("%06d", n), nil
+}
+
+func randomURLSafe(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newUUID subに使うUUID（バージョン4）
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
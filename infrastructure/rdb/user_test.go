@@ -0,0 +1,351 @@
+package rdb
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/password"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+)
+
+const testPassword = "correct horse battery staple"
+
+// testMailer 送ったメールを記録するMailer
+type testMailer struct {
+	mu   sync.Mutex
+	sent []*model.Mail
+}
+
+func (tm *testMailer) Send(ctx context.Context, m *model.Mail) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.sent = append(tm.sent, m)
+	return nil
+}
+
+var codePattern = regexp.MustCompile(`Your code is (\S+)`)
+
+// lastCode 最後に送ったメールのコード（確認コード、リセットコード、仮パスワード）
+func (tm *testMailer) lastCode(t *testing.T) string {
+	t.Helper()
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if len(tm.sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	m := codePattern.FindStringSubmatch(tm.sent[len(tm.sent)-1].Body)
+	if m == nil {
+		t.Fatalf("no code in %q", tm.sent[len(tm.sent)-1].Body)
+	}
+	return m[1]
+}
+
+// openTestDB テスト毎のインメモリのSQLiteデータベース
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 接続毎に別のデータベースになるため、1つの接続を使い続ける
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestIssuer(t *testing.T) proxy.TokenIssuer {
+	t.Helper()
+	keyPEM, err := token.GenerateKeyPEM()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	ti, err := token.NewLocalIssuer(keyPEM, "http://localhost:3000", "gin-cognito-sample", time.Hour)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return ti
+}
+
+func newTestProxy(t *testing.T, db *sql.DB) (*sqlUserProxy, *testMailer) {
+	t.Helper()
+	hasher, err := password.NewHasher(password.AlgorithmArgon2id)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	mailer := new(testMailer)
+	p, err := newSQLUserProxy(context.Background(), db, hasher, newTestIssuer(t), mailer, SQLUserOptions{
+		ConfirmationCodeTTL: time.Hour,
+		ResetCodeTTL:        time.Hour,
+		InvitationTTL:       time.Hour,
+		RefreshTokenTTL:     time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return p, mailer
+}
+
+// signedUp サインアップして確認したアカウントのsubとトークンを返します
+func signedUp(t *testing.T, p *sqlUserProxy, m *testMailer, email string) (string, *model.Token) {
+	t.Helper()
+	ctx := context.Background()
+	sub, err := p.Signup(ctx, &model.CreateReq{Email: email, Name: "Taro", Password: testPassword})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tok, err := p.ConfirmAndSignin(ctx, &model.ConfirmAndSigninReq{Email: email, ConfirmationCode: m.lastCode(t), Password: testPassword})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return sub, tok
+}
+
+func TestSignupConfirmSignin(t *testing.T) {
+	p, m := newTestProxy(t, openTestDB(t))
+	ctx := context.Background()
+
+	sub, err := p.Signup(ctx, &model.CreateReq{Email: " Taro@Example.com ", Name: "Taro", Password: testPassword})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if m.sent[0].To != "taro@example.com" {
+		t.Errorf("mail to %q", m.sent[0].To)
+	}
+	code := m.lastCode(t)
+	if _, err := p.Signup(ctx, &model.CreateReq{Email: "taro@example.com", Name: "Taro", Password: testPassword}); !errors.Is(err, model.ErrUserAlreadyExists) {
+		t.Errorf("duplicate signup: err = %v, want %v", err, model.ErrUserAlreadyExists)
+	}
+	if _, err := p.Signin(ctx, &model.SigninReq{Email: "taro@example.com", Password: testPassword}); !errors.Is(err, model.ErrUserNotConfirmed) {
+		t.Errorf("signin before confirmation: err = %v, want %v", err, model.ErrUserNotConfirmed)
+	}
+	if _, err := p.ConfirmAndSignin(ctx, &model.ConfirmAndSigninReq{Email: "taro@example.com", ConfirmationCode: "wrong", Password: testPassword}); !errors.Is(err, model.ErrInvalidCode) {
+		t.Errorf("wrong code: err = %v, want %v", err, model.ErrInvalidCode)
+	}
+
+	tok, err := p.ConfirmAndSignin(ctx, &model.ConfirmAndSigninReq{Email: "taro@example.com", ConfirmationCode: code, Password: testPassword})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	c, err := p.issuer.ValidateJWT(tok.IDToken)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if c.Sub != sub || c.Email != "taro@example.com" || tok.RefreshToken == nil || c.OriginJTI == "" {
+		t.Errorf("claims = %+v, token = %+v", c, tok)
+	}
+	if _, err := p.ConfirmAndSignin(ctx, &model.ConfirmAndSigninReq{Email: "taro@example.com", ConfirmationCode: code, Password: testPassword}); !errors.Is(err, model.ErrUserAlreadyConfirmed) {
+		t.Errorf("second confirmation: err = %v, want %v", err, model.ErrUserAlreadyConfirmed)
+	}
+
+	for _, tt := range []struct {
+		email, password string
+		want            error
+	}{
+		{"TARO@example.com", testPassword, nil},
+		{"taro@example.com", "wrong", model.ErrNotAuthorized},
+		{"jiro@example.com", testPassword, model.ErrNotAuthorized},
+	} {
+		_, err := p.Signin(ctx, &model.SigninReq{Email: tt.email, Password: tt.password})
+		if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+			t.Errorf("signin %s/%s: err = %v, want %v", tt.email, tt.password, err, tt.want)
+		}
+	}
+}
+
+func TestConsumeCode(t *testing.T) {
+	const code = "123456"
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// answers 順に回答するコードと期待するエラー（nilは成功）
+		answers []string
+		want    []error
+	}{
+		{"correct", time.Hour, []string{code}, []error{nil}},
+		{"single use", time.Hour, []string{code, code}, []error{nil, model.ErrInvalidCode}},
+		{"expired", -time.Second, []string{code}, []error{model.ErrInvalidCode}},
+		{"wrong then correct", time.Hour,
+			[]string{"000000", "000000", "000000", "000000", code},
+			[]error{model.ErrInvalidCode, model.ErrInvalidCode, model.ErrInvalidCode, model.ErrInvalidCode, nil}},
+		{"attempt cap discards the code", time.Hour,
+			[]string{"000000", "000000", "000000", "000000", "000000", code},
+			[]error{model.ErrInvalidCode, model.ErrInvalidCode, model.ErrInvalidCode, model.ErrInvalidCode, model.ErrInvalidCode, model.ErrInvalidCode}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProxy(t, openTestDB(t))
+			ctx := context.Background()
+			if err := p.saveCode(ctx, p.db, "sub-1", purposeConfirm, code, tt.ttl); err != nil {
+				t.Fatalf("%+v", err)
+			}
+			for i, answer := range tt.answers {
+				err := p.consumeCode(ctx, "sub-1", purposeConfirm, answer)
+				if tt.want[i] == nil && err != nil || !errors.Is(err, tt.want[i]) {
+					t.Fatalf("answer %d: err = %v, want %v", i+1, err, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// 用途の異なるコードでは確認できない
+	p, _ := newTestProxy(t, openTestDB(t))
+	ctx := context.Background()
+	if err := p.saveCode(ctx, p.db, "sub-1", purposeReset, code, time.Hour); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := p.consumeCode(ctx, "sub-1", purposeConfirm, code); !errors.Is(err, model.ErrInvalidCode) {
+		t.Errorf("other purpose: err = %v, want %v", err, model.ErrInvalidCode)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup 状態を変え、Refreshに渡すリクエストを返す
+		setup func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq
+		// wantReason 空でない場合、ErrNotAuthorizedとその理由
+		wantReason string
+	}{
+		{"valid", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			return &model.RefreshReq{Sub: sub, RefreshToken: refreshToken}
+		}, ""},
+		{"unknown", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			return &model.RefreshReq{Sub: sub, RefreshToken: "unknown"}
+		}, "unknown refresh token"},
+		{"other user", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			other, _ := signedUp(t, p, m, "jiro@example.com")
+			return &model.RefreshReq{Sub: other, RefreshToken: refreshToken}
+		}, "refresh token of another user"},
+		{"revoked", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			if err := p.Signout(context.Background(), &model.SignoutReq{RefreshToken: refreshToken}); err != nil {
+				t.Fatalf("%+v", err)
+			}
+			return &model.RefreshReq{Sub: sub, RefreshToken: refreshToken}
+		}, "refresh token revoked"},
+		{"expired", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			if _, err := p.db.Exec(`UPDATE refresh_tokens SET expires_at = $1`, time.Now().UTC().Add(-time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			return &model.RefreshReq{Sub: sub, RefreshToken: refreshToken}
+		}, "refresh token expired"},
+		{"disabled user", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			// DisableUserはトークンも失効させるため、無効化だけを行う
+			if _, err := p.db.Exec(`UPDATE users SET enabled = $1 WHERE sub = $2`, false, sub); err != nil {
+				t.Fatal(err)
+			}
+			return &model.RefreshReq{Sub: sub, RefreshToken: refreshToken}
+		}, "user is disabled"},
+		{"password reset revokes", func(t *testing.T, p *sqlUserProxy, m *testMailer, sub, refreshToken string) *model.RefreshReq {
+			ctx := context.Background()
+			if err := p.ForgotPassword(ctx, &model.ForgotPasswordReq{Email: "taro@example.com"}); err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if err := p.ConfirmForgotPassword(ctx, &model.ConfirmForgotPasswordReq{Email: "taro@example.com", Code: m.lastCode(t), Password: "another password"}); err != nil {
+				t.Fatalf("%+v", err)
+			}
+			return &model.RefreshReq{Sub: sub, RefreshToken: refreshToken}
+		}, "refresh token revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, m := newTestProxy(t, openTestDB(t))
+			sub, tok := signedUp(t, p, m, "taro@example.com")
+			got, err := p.Refresh(context.Background(), tt.setup(t, p, m, sub, *tok.RefreshToken))
+			if tt.wantReason != "" {
+				if !errors.Is(err, model.ErrNotAuthorized) || !strings.Contains(err.Error(), tt.wantReason) {
+					t.Errorf("err = %v, want %v (%s)", err, model.ErrNotAuthorized, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			c, err := p.issuer.ValidateJWT(got.IDToken)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			first, _ := p.issuer.ValidateJWT(tok.IDToken)
+			// リフレッシュトークンは変わらず、IDトークンは同じリフレッシュトークンに紐づく
+			if got.RefreshToken != nil || c.Sub != sub || c.OriginJTI != first.OriginJTI {
+				t.Errorf("token = %+v, claims = %+v", got, c)
+			}
+		})
+	}
+}
+
+func TestInviteAndRespond(t *testing.T) {
+	p, m := newTestProxy(t, openTestDB(t))
+	ctx := context.Background()
+
+	sub, err := p.Invite(ctx, &model.InviteReq{Email: "hanako@example.com"})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tempPassword := m.lastCode(t)
+	if _, err := p.Invite(ctx, &model.InviteReq{Email: "hanako@example.com"}); !errors.Is(err, model.ErrUserAlreadyExists) {
+		t.Errorf("second invitation: err = %v, want %v", err, model.ErrUserAlreadyExists)
+	}
+	// 仮パスワードではログインできない
+	if _, err := p.Signin(ctx, &model.SigninReq{Email: "hanako@example.com", Password: tempPassword}); !errors.Is(err, model.ErrNotAuthorized) {
+		t.Errorf("signin with the temporary password: err = %v, want %v", err, model.ErrNotAuthorized)
+	}
+	req := &model.RespondToInvitationReq{Email: "hanako@example.com", Name: "Hanako", Password: testPassword, ConfirmationCode: "wrong"}
+	if _, err := p.RespondToInvitation(ctx, req); !errors.Is(err, model.ErrInvalidCode) {
+		t.Errorf("wrong temporary password: err = %v, want %v", err, model.ErrInvalidCode)
+	}
+
+	req.ConfirmationCode = tempPassword
+	tok, err := p.RespondToInvitation(ctx, req)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if c, err := p.issuer.ValidateJWT(tok.IDToken); err != nil || c.Sub != sub {
+		t.Errorf("claims = %+v, err = %v", c, err)
+	}
+	if u, err := p.GetProfile(ctx, "hanako@example.com"); err != nil || u.Name != "Hanako" {
+		t.Errorf("profile = %+v, err = %v", u, err)
+	}
+	if _, err := p.RespondToInvitation(ctx, req); !errors.Is(err, model.ErrUserAlreadyConfirmed) {
+		t.Errorf("second response: err = %v, want %v", err, model.ErrUserAlreadyConfirmed)
+	}
+	if _, err := p.Signin(ctx, &model.SigninReq{Email: "hanako@example.com", Password: testPassword}); err != nil {
+		t.Errorf("signin with the new password: %+v", err)
+	}
+}
+
+// 起動の度にmigrateしても、適用済みのバージョンは適用せずデータを保つ
+func TestMigrateIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	p, m := newTestProxy(t, db)
+	signedUp(t, p, m, "taro@example.com")
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := migrate(ctx, db, userMigrations); err != nil {
+			t.Fatalf("migrate %d: %+v", i+2, err)
+		}
+	}
+	var n, max int
+	if err := db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&n, &max); err != nil {
+		t.Fatal(err)
+	}
+	last := userMigrations[len(userMigrations)-1].version
+	if n != len(userMigrations) || max != last {
+		t.Errorf("schema_migrations has %d rows up to %d, want %d up to %d", n, max, len(userMigrations), last)
+	}
+
+	p, _ = newTestProxy(t, db)
+	if _, err := p.Signin(ctx, &model.SigninReq{Email: "taro@example.com", Password: testPassword}); err != nil {
+		t.Errorf("signin after restart: %+v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package rdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+
+	"github.com/pkg/errors"
+)
+
+// 利用者のデータベースとは別に置けるよう、監査ログと同様にスキーマのバージョンは管理しない
+var createWebhookTables = []string{
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		event_id        TEXT NOT NULL,
+		event_type      TEXT NOT NULL,
+		endpoint        TEXT NOT NULL,
+		payload         TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL,
+		next_attempt_at TIMESTAMP NOT NULL,
+		last_error      TEXT NOT NULL,
+		created_at      TIMESTAMP NOT NULL,
+		delivered_at    TIMESTAMP,
+		PRIMARY KEY (event_id, endpoint)
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_created ON webhook_deliveries (created_at)`,
+}
+
+const webhookColumns = `event_id, event_type, endpoint, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at`
+
+// 配信前のWebhookをSQLデータベースに保存します
+type sqlWebhookOutbox struct {
+	db *sql.DB
+}
+
+// NewSQLWebhookOutbox SQLデータベースに保存するWebhookOutboxを生成します（テーブルがなければ作成する）
+func NewSQLWebhookOutbox(db *sql.DB) (proxy.WebhookOutbox, error) {
+	for _, stmt := range createWebhookTables {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return &sqlWebhookOutbox{db}, nil
+}
+
+// Enqueue 1つのトランザクションで保存します
+func (s *sqlWebhookOutbox) Enqueue(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer tx.Rollback()
+	for _, d := range deliveries {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries (`+webhookColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULL)`,
+			d.EventID, d.EventType, d.Endpoint, string(d.Payload), d.Status, d.Attempts,
+			d.NextAttemptAt.UTC(), d.LastError, d.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// Claim 次の試行時刻をlease後にずらせた配信だけを返します（他のワーカーが先にずらした配信は返さない）
+func (s *sqlWebhookOutbox) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*model.WebhookDelivery, error) {
+	now = now.UTC()
+	due, err := s.query(ctx,
+		`SELECT `+webhookColumns+` FROM webhook_deliveries
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at LIMIT $3`,
+		model.WebhookPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	until := now.Add(lease)
+	var claimed []*model.WebhookDelivery
+	for _, d := range due {
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE webhook_deliveries SET next_attempt_at = $1
+			WHERE event_id = $2 AND endpoint = $3 AND status = $4 AND next_attempt_at <= $5`,
+			until, d.EventID, d.Endpoint, model.WebhookPending, now)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, errors.WithStack(err)
+		} else if n == 1 {
+			d.NextAttemptAt = until
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
+
+// Update 配信の結果を保存します
+func (s *sqlWebhookOutbox) Update(ctx context.Context, d *model.WebhookDelivery) error {
+	var deliveredAt interface{}
+	if d.DeliveredAt != nil {
+		deliveredAt = d.DeliveredAt.UTC()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5
+		WHERE event_id = $6 AND endpoint = $7`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastError, deliveredAt, d.EventID, d.Endpoint)
+	return errors.WithStack(err)
+}
+
+// List 条件に合う配信を新しい順に返します
+func (s *sqlWebhookOutbox) List(ctx context.Context, f *model.WebhookDeliveryFilter) ([]*model.WebhookDelivery, error) {
+	where, args := webhookWhere(f, 1)
+	args = append(args, f.Limit)
+	return s.query(ctx,
+		`SELECT `+webhookColumns+` FROM webhook_deliveries`+where+
+			fmt.Sprintf(` ORDER BY created_at DESC, event_id, endpoint LIMIT $%d`, len(args)),
+		args...)
+}
+
+// Replay 条件に合う配信を未配信に戻します
+func (s *sqlWebhookOutbox) Replay(ctx context.Context, f *model.WebhookDeliveryFilter, now time.Time) (int, error) {
+	where, args := webhookWhere(f, 3)
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = $2, last_error = '', delivered_at = NULL`+where,
+		append([]interface{}{model.WebhookPending, now.UTC()}, args...)...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(n), nil
+}
+
+// Name ヘルスチェック名
+func (s *sqlWebhookOutbox) Name() string {
+	return "webhook_outbox"
+}
+
+// Check データベースに接続できることを確認します
+func (s *sqlWebhookOutbox) Check(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *sqlWebhookOutbox) query(ctx context.Context, query string, args ...interface{}) ([]*model.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		d := new(model.WebhookDelivery)
+		var payload string
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.EventID, &d.EventType, &d.Endpoint, &payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		d.Payload = []byte(payload)
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, errors.WithStack(rows.Err())
+}
+
+// webhookWhere 条件のWHERE句を$nから始まるプレースホルダで組み立てます
+func webhookWhere(f *model.WebhookDeliveryFilter, n int) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, fmt.Sprintf(cond, n+len(args)))
+		args = append(args, arg)
+	}
+	if f.EventID != "" {
+		add("event_id = $%d", f.EventID)
+	}
+	if f.EventType != "" {
+		add("event_type = $%d", f.EventType)
+	}
+	if f.Endpoint != "" {
+		add("endpoint = $%d", f.Endpoint)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= $%d", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		add("created_at < $%d", f.Until.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
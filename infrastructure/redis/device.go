@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// Redis互換のサーバでデバイスの最終利用状況を管理します（複数台で共有できる）
+type deviceActivityStore struct {
+	rc     redis.UniversalClient
+	prefix string
+}
+
+// NewDeviceActivityStore DeviceActivityStoreを生成します
+func NewDeviceActivityStore(rc redis.UniversalClient, prefix string) proxy.DeviceActivityStore {
+	return &deviceActivityStore{rc, prefix}
+}
+
+// Touch デバイスの利用を記録します
+func (s *deviceActivityStore) Touch(ctx context.Context, deviceKey string, a *model.DeviceActivity, ttl time.Duration) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(s.rc.Set(ctx, s.prefix+deviceKey, b, ttl).Err())
+}
+
+// Get 記録のあるデバイスの利用状況を返します
+func (s *deviceActivityStore) Get(ctx context.Context, deviceKeys []string) (map[string]*model.DeviceActivity, error) {
+	res := map[string]*model.DeviceActivity{}
+	if len(deviceKeys) == 0 {
+		return res, nil
+	}
+	keys := make([]string, len(deviceKeys))
+	for i, k := range deviceKeys {
+		keys[i] = s.prefix + k
+	}
+	vals, err := s.rc.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i, v := range vals {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		a := new(model.DeviceActivity)
+		if err := json.Unmarshal([]byte(str), a); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		res[deviceKeys[i]] = a
+	}
+	return res, nil
+}
+
+// Delete デバイスの記録を削除します
+func (s *deviceActivityStore) Delete(ctx context.Context, deviceKey string) error {
+	return errors.WithStack(s.rc.Del(ctx, s.prefix+deviceKey).Err())
+}
+
+// Name ヘルスチェック名
+func (s *deviceActivityStore) Name() string {
+	return "device_activity_redis"
+}
+
+// Check Redisに接続できることを確認します
+func (s *deviceActivityStore) Check(ctx context.Context) error {
+	return errors.WithStack(s.rc.Ping(ctx).Err())
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// Redis互換のサーバで認証失敗回数を管理します（複数台で共有できる）
+type lockoutStore struct {
+	rc     redis.UniversalClient
+	prefix string
+}
+
+// NewLockoutStore LockoutStoreを生成します
+func NewLockoutStore(rc redis.UniversalClient, prefix string) proxy.LockoutStore {
+	return &lockoutStore{rc, prefix}
+}
+
+// Get keyの失敗回数と最後に失敗した時刻を取得します
+func (s *lockoutStore) Get(ctx context.Context, key string) (int, time.Time, error) {
+	vals, err := s.rc.HMGet(ctx, s.prefix+key, "failures", "last").Result()
+	if err != nil {
+		return 0, time.Time{}, errors.WithStack(err)
+	}
+	var rec struct {
+		Failures int   `redis:"failures"`
+		Last     int64 `redis:"last"`
+	}
+	if err := redis.NewSliceResult(vals, nil).Scan(&rec); err != nil {
+		return 0, time.Time{}, errors.WithStack(err)
+	}
+	if rec.Failures == 0 {
+		return 0, time.Time{}, nil
+	}
+	return rec.Failures, time.Unix(0, rec.Last*int64(time.Millisecond)), nil
+}
+
+// Fail keyの失敗を記録します
+func (s *lockoutStore) Fail(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	k := s.prefix + key
+	var incr *redis.IntCmd
+	_, err := s.rc.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.HIncrBy(ctx, k, "failures", 1)
+		p.HSet(ctx, k, "last", time.Now().UnixNano()/int64(time.Millisecond))
+		p.PExpire(ctx, k, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(incr.Val()), nil
+}
+
+// Reset keyの記録を削除します
+func (s *lockoutStore) Reset(ctx context.Context, key string) error {
+	return errors.WithStack(s.rc.Del(ctx, s.prefix+key).Err())
+}
+
+// Name ヘルスチェック名
+func (s *lockoutStore) Name() string {
+	return "lockout_redis"
+}
+
+// Check Redisに接続できることを確認します
+func (s *lockoutStore) Check(ctx context.Context) error {
+	return errors.WithStack(s.rc.Ping(ctx).Err())
+}
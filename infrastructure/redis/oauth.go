@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// Redis互換のサーバで認可リクエストのstateを管理します（複数台で共有できる）
+type oauthStateStore struct {
+	rc     redis.UniversalClient
+	prefix string
+}
+
+// NewOAuthStateStore OAuthStateStoreを生成します
+func NewOAuthStateStore(rc redis.UniversalClient, prefix string) proxy.OAuthStateStore {
+	return &oauthStateStore{rc, prefix}
+}
+
+// Save stateの値を保存します
+func (s *oauthStateStore) Save(ctx context.Context, state string, v *model.OAuthState, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(s.rc.Set(ctx, s.prefix+state, b, ttl).Err())
+}
+
+// Take stateの値を取り出して削除します
+func (s *oauthStateStore) Take(ctx context.Context, state string) (*model.OAuthState, error) {
+	k := s.prefix + state
+	var get *redis.StringCmd
+	_, err := s.rc.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, k)
+		p.Del(ctx, k)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, errors.WithStack(model.ErrInvalidOAuthState)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	v := new(model.OAuthState)
+	if err := json.Unmarshal([]byte(get.Val()), v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return v, nil
+}
+
+// Name ヘルスチェック名
+func (s *oauthStateStore) Name() string {
+	return "oauth_state_redis"
+}
+
+// Check Redisに接続できることを確認します
+func (s *oauthStateStore) Check(ctx context.Context) error {
+	return errors.WithStack(s.rc.Ping(ctx).Err())
+}
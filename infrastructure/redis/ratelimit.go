@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// トークンバケットを原子的に更新する（Redis互換のサーバで動作するようLuaスクリプトで実装）
+// KEYS[1]: バケット ARGV: 補充レート(1秒あたり), 容量, 現在時刻(ms)
+// 戻り値: {許可(1/0), 待ち時間(ms)}
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, wait}
+`)
+
+// Redis互換のサーバでトークンバケットを管理します（複数台で制限を共有できる）
+type rateLimitStore struct {
+	rc     redis.UniversalClient
+	prefix string
+}
+
+// NewRateLimitStore RateLimitStoreを生成します
+func NewRateLimitStore(rc redis.UniversalClient, prefix string) proxy.RateLimitStore {
+	return &rateLimitStore{rc, prefix}
+}
+
+// Take keyのバケットからトークンを1つ消費します
+func (s *rateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	res, err := takeScript.Run(ctx, s.rc, []string{s.prefix + key},
+		rate, burst, time.Now().UnixNano()/int64(time.Millisecond)).Int64Slice()
+	if err != nil {
+		return false, 0, errors.WithStack(err)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// Name ヘルスチェック名
+func (s *rateLimitStore) Name() string {
+	return "ratelimit_redis"
+}
+
+// Check Redisに接続できることを確認します
+func (s *rateLimitStore) Check(ctx context.Context) error {
+	return errors.WithStack(s.rc.Ping(ctx).Err())
+}
@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// Redis互換のサーバで使用済みの値を管理します（複数台で共有できる）
+type replayStore struct {
+	rc     redis.UniversalClient
+	prefix string
+}
+
+// NewReplayStore ReplayStoreを生成します
+func NewReplayStore(rc redis.UniversalClient, prefix string) proxy.ReplayStore {
+	return &replayStore{rc, prefix}
+}
+
+// Consume idの使用を記録し、初めての使用であればtrueを返します
+func (s *replayStore) Consume(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	ok, err := s.rc.SetNX(ctx, s.prefix+id, 1, ttl).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return ok, nil
+}
+
+// Name ヘルスチェック名
+func (s *replayStore) Name() string {
+	return "replay_redis"
+}
+
+// Check Redisに接続できることを確認します
+func (s *replayStore) Check(ctx context.Context) error {
+	return errors.WithStack(s.rc.Ping(ctx).Err())
+}
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 既存の記録より新しい場合のみ失効時刻を更新する
+// KEYS[1]: subのキー ARGV: 失効時刻(ms), TTL(ms)
+var revokeSubjectScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]))
+if cur == nil or cur < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// Redis互換のサーバで失効させたトークンを管理します（複数台で共有できる）
+type revocationStore struct {
+	rc     redis.UniversalClient
+	prefix string
+}
+
+// NewRevocationStore RevocationStoreを生成します
+func NewRevocationStore(rc redis.UniversalClient, prefix string) proxy.RevocationStore {
+	return &revocationStore{rc, prefix}
+}
+
+// RevokeToken jti/origin_jtiを失効させます
+func (s *revocationStore) RevokeToken(ctx context.Context, id string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return errors.WithStack(s.rc.Set(ctx, s.prefix+"jti:"+id, 1, ttl).Err())
+}
+
+// RevokeSubject subに対してbeforeより前に発行されたトークンを失効させます
+func (s *revocationStore) RevokeSubject(ctx context.Context, sub string, before time.Time, ttl time.Duration) error {
+	err := revokeSubjectScript.Run(ctx, s.rc, []string{s.prefix + "sub:" + sub},
+		before.UnixNano()/int64(time.Millisecond), ttl.Milliseconds()).Err()
+	return errors.WithStack(err)
+}
+
+// IsRevoked トークンが失効しているか確認します
+func (s *revocationStore) IsRevoked(ctx context.Context, c *model.Claims) (bool, error) {
+	keys := []string{s.prefix + "sub:" + c.Sub}
+	for _, id := range []string{c.JTI, c.OriginJTI} {
+		if id != "" {
+			keys = append(keys, s.prefix+"jti:"+id)
+		}
+	}
+	vals, err := s.rc.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	for _, v := range vals[1:] {
+		if v != nil {
+			return true, nil
+		}
+	}
+	if v, ok := vals[0].(string); ok {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		before := time.Unix(0, ms*int64(time.Millisecond))
+		return c.IssuedAt.Before(before), nil
+	}
+	return false, nil
+}
+
+// Name ヘルスチェック名
+func (s *revocationStore) Name() string {
+	return "revocation_redis"
+}
+
+// Check Redisに接続できることを確認します
+func (s *revocationStore) Check(ctx context.Context) error {
+	return errors.WithStack(s.rc.Ping(ctx).Err())
+}
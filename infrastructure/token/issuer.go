@@ -0,0 +1,159 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 一時的に生成する署名鍵の長さ
+const generatedKeyBits = 2048
+
+// RSAの秘密鍵でIDトークンを署名（RS256）、検証します
+type localIssuer struct {
+	key      jwk.Key
+	pub      jwk.Set
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+// NewLocalIssuer PEM形式のRSA秘密鍵からTokenIssuerを生成します（kidは公開鍵のサムプリント）
+func NewLocalIssuer(keyPEM []byte, issuer, audience string, ttl time.Duration) (proxy.TokenIssuer, error) {
+	key, err := jwk.ParseKey(keyPEM, jwk.WithPEM(true))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse signing key")
+	}
+	if _, ok := key.(jwk.RSAPrivateKey); !ok {
+		return nil, errors.WithStack(fmt.Errorf("signing key must be an RSA private key, got %s", key.KeyType()))
+	}
+	if err := jwk.AssignKeyID(key); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := key.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := pub.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	set := jwk.NewSet()
+	set.Add(pub)
+	return &localIssuer{key, set, issuer, audience, ttl}, nil
+}
+
+// GenerateKeyPEM 署名鍵を生成します（鍵ファイルを指定しない開発環境向け、再起動で発行済みのトークンは無効になる）
+func GenerateKeyPEM() ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, generatedKeyBits)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+}
+
+// IssueIDToken Cognitoと同じ形のIDトークンを発行します
+func (li *localIssuer) IssueIDToken(c *model.Claims) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", errors.WithStack(err)
+	}
+	now := time.Now()
+	t := jwt.New()
+	for k, v := range map[string]interface{}{
+		jwt.IssuerKey:     li.issuer,
+		jwt.AudienceKey:   li.audience,
+		jwt.SubjectKey:    c.Sub,
+		jwt.JwtIDKey:      base64.RawURLEncoding.EncodeToString(jti),
+		jwt.IssuedAtKey:   now,
+		jwt.ExpirationKey: now.Add(li.ttl),
+		"email":           c.Email,
+		"token_use":       "id",
+	} {
+		if err := t.Set(k, v); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	if c.OriginJTI != "" {
+		if err := t.Set("origin_jti", c.OriginJTI); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	if len(c.Groups) > 0 {
+		if err := t.Set("groups", c.Groups); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	b, err := jwt.Sign(t, jwt.WithKey(jwa.RS256, li.key))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(b), nil
+}
+
+// ValidateJWT 自身が発行したIDトークンを検証します
+func (li *localIssuer) ValidateJWT(idToken string) (*model.Claims, error) {
+	jt, err := jwt.Parse(
+		[]byte(idToken),
+		jwt.WithKeySet(li.pub),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(li.issuer),
+		jwt.WithAudience(li.audience),
+		jwt.WithClaimValue("token_use", "id"),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	email, _ := jt.Get("email")
+	originJTI, _ := jt.Get("origin_jti")
+	groups, _ := jt.Get("groups")
+	return &model.Claims{
+		Sub:       jt.Subject(),
+		Email:     stringClaim(email),
+		Groups:    stringsClaim(groups),
+		JTI:       jt.JwtID(),
+		OriginJTI: stringClaim(originJTI),
+		IssuedAt:  jt.IssuedAt(),
+		ExpiresAt: jt.Expiration(),
+	}, nil
+}
+
+// PublicJWKS 検証用の公開鍵を返します
+func (li *localIssuer) PublicJWKS() ([]byte, error) {
+	b, err := json.Marshal(li.pub)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b, nil
+}
+
+func stringClaim(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func stringsClaim(v interface{}) []string {
+	vs, _ := v.([]interface{})
+	ss := make([]string, 0, len(vs))
+	for _, v := range vs {
+		if s, ok := v.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
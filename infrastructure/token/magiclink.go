@@ -0,0 +1,89 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 同じ鍵で別の用途の署名と取り違えないよう、署名対象に付ける接頭辞
+const magicLinkSigningPrefix = "magic-link."
+
+type magicLinkPayload struct {
+	model.MagicLinkClaims
+	Exp int64 `json:"exp"`
+}
+
+// HMAC-SHA256で署名したマジックリンクのトークン（<payload>.<signature>、いずれもbase64url）を扱います
+type hmacMagicLinkTokenizer struct {
+	secret []byte
+}
+
+// NewHMACMagicLinkTokenizer サーバとトリガで共有する秘密鍵からMagicLinkTokenizerを生成します
+func NewHMACMagicLinkTokenizer(secret string) proxy.MagicLinkTokenizer {
+	return &hmacMagicLinkTokenizer{[]byte(secret)}
+}
+
+// Mint emailに紐づくトークンを発行します
+func (t *hmacMagicLinkTokenizer) Mint(email string, ttl time.Duration) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", errors.WithStack(err)
+	}
+	b, err := json.Marshal(&magicLinkPayload{
+		MagicLinkClaims: model.MagicLinkClaims{
+			ID:    base64.RawURLEncoding.EncodeToString(id),
+			Email: email,
+		},
+		Exp: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(t.sign(payload)), nil
+}
+
+// Parse 署名と有効期限を検証します
+func (t *hmacMagicLinkTokenizer) Parse(token string) (*model.MagicLinkClaims, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, errors.Wrap(model.ErrInvalidMagicLink, "malformed token")
+	}
+	payload := token[:i]
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(sig, t.sign(payload)) {
+		return nil, errors.Wrap(model.ErrInvalidMagicLink, "bad signature")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.Wrap(model.ErrInvalidMagicLink, "malformed payload")
+	}
+	p := new(magicLinkPayload)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, errors.Wrap(model.ErrInvalidMagicLink, "malformed payload")
+	}
+	p.ExpiresAt = time.Unix(p.Exp, 0)
+	if !time.Now().Before(p.ExpiresAt) {
+		return nil, errors.Wrap(model.ErrInvalidMagicLink, "expired")
+	}
+	if p.ID == "" || p.Email == "" {
+		return nil, errors.Wrap(model.ErrInvalidMagicLink, "missing claims")
+	}
+	return &p.MagicLinkClaims, nil
+}
+
+func (t *hmacMagicLinkTokenizer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(magicLinkSigningPrefix + payload))
+	return mac.Sum(nil)
+}
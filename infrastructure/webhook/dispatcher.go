@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// Webhookのリクエストヘッダ
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	// HeaderSignature t=<UNIX時刻>,v1=<"<UNIX時刻>.<本文>"のHMAC-SHA256（16進数）>
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// 1回に取り出す配信の数（並行して送る）
+	claimBatchSize = 20
+	// エラーとして保存する応答の長さ
+	maxErrorBodySize = 256
+)
+
+// Policy 配信の再試行の設定
+type Policy struct {
+	// MaxAttempts 試行回数の上限（超えるとfailedにする）
+	MaxAttempts int
+	// BaseDelay, MaxDelay n回目の失敗の後はBaseDelay*2^(n-1)（MaxDelayまで）待つ
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout 1回の送信の時間制限
+	Timeout time.Duration
+	// PollInterval アウトボックスを確認する間隔
+	PollInterval time.Duration
+}
+
+// アウトボックスに保存したイベントを購読している配信先に送ります
+type dispatcher struct {
+	ob        proxy.WebhookOutbox
+	endpoints map[string]*model.WebhookEndpoint
+	order     []*model.WebhookEndpoint
+	policy    Policy
+	hc        *http.Client
+	// wake 保存されたイベントをすぐに送る
+	wake chan struct{}
+}
+
+// NewDispatcher イベントをアウトボックスに保存するEventPublisherを生成し、ctxが終了するまで配信します
+//
+// 配信は少なくとも1回（重複しうる）のため、受信側はX-Webhook-Idで重複を除いてください。
+func NewDispatcher(
+	ctx context.Context,
+	ob proxy.WebhookOutbox,
+	endpoints []*model.WebhookEndpoint,
+	policy Policy,
+) proxy.EventPublisher {
+	d := &dispatcher{
+		ob:        ob,
+		endpoints: make(map[string]*model.WebhookEndpoint, len(endpoints)),
+		order:     endpoints,
+		policy:    policy,
+		hc:        &http.Client{Timeout: policy.Timeout},
+		wake:      make(chan struct{}, 1),
+	}
+	for _, e := range endpoints {
+		d.endpoints[e.Name] = e
+	}
+	go d.run(ctx)
+	return d
+}
+
+// Publish イベントを購読している配信先毎にアウトボックスに保存します（送信は非同期）
+func (d *dispatcher) Publish(ctx context.Context, ev *model.Event) error {
+	if ev.ID == "" {
+		id, err := newEventID()
+		if err != nil {
+			return err
+		}
+		ev.ID = id
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	ev.Time = ev.Time.UTC()
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var deliveries []*model.WebhookDelivery
+	for _, e := range d.order {
+		if !e.Subscribes(ev.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			EventID:       ev.ID,
+			EventType:     ev.Type,
+			Endpoint:      e.Name,
+			Payload:       payload,
+			Status:        model.WebhookPending,
+			NextAttemptAt: ev.Time,
+			CreatedAt:     ev.Time,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := d.ob.Enqueue(ctx, deliveries); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Name ヘルスチェック名
+func (d *dispatcher) Name() string {
+	if hc, ok := d.ob.(proxy.HealthChecker); ok {
+		return hc.Name()
+	}
+	return "webhook_outbox"
+}
+
+// Check アウトボックスの状態を確認します
+func (d *dispatcher) Check(ctx context.Context) error {
+	if hc, ok := d.ob.(proxy.HealthChecker); ok {
+		return hc.Check(ctx)
+	}
+	return nil
+}
+
+func (d *dispatcher) run(ctx context.Context) {
+	t := time.NewTicker(d.policy.PollInterval)
+	defer t.Stop()
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// dispatch 配信時刻を過ぎた配信がなくなるまで送ります
+func (d *dispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		// 送信中に他のインスタンスが同じ配信を取り出さないよう、時間制限より長く確保する
+		batch, err := d.ob.Claim(ctx, time.Now(), 2*d.policy.Timeout+time.Minute, claimBatchSize)
+		if err != nil {
+			log.Default().Printf("%+v", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for _, dl := range batch {
+			wg.Add(1)
+			go func(dl *model.WebhookDelivery) {
+				defer wg.Done()
+				d.deliver(ctx, dl)
+			}(dl)
+		}
+		wg.Wait()
+		if len(batch) < claimBatchSize {
+			return
+		}
+	}
+}
+
+// deliver 1つの配信を送り、結果を保存します
+func (d *dispatcher) deliver(ctx context.Context, dl *model.WebhookDelivery) {
+	err := d.send(ctx, dl)
+	if ctx.Err() != nil {
+		// 停止による中断は試行に数えない（確保の期限が切れると再度送る）
+		return
+	}
+	now := time.Now()
+	dl.Attempts++
+	if err == nil {
+		dl.Status = model.WebhookDelivered
+		dl.LastError = ""
+		dl.DeliveredAt = &now
+	} else {
+		log.Default().Printf("webhook %s to %s failed (attempt %d): %v", dl.EventID, dl.Endpoint, dl.Attempts, err)
+		dl.LastError = err.Error()
+		if dl.Attempts >= d.policy.MaxAttempts {
+			dl.Status = model.WebhookFailed
+		} else {
+			dl.NextAttemptAt = now.Add(d.backoff(dl.Attempts))
+		}
+	}
+	// 停止中でも結果は保存する
+	if err := d.ob.Update(context.Background(), dl); err != nil {
+		log.Default().Printf("%+v", err)
+	}
+}
+
+// send 2xxの応答を成功とします
+func (d *dispatcher) send(ctx context.Context, dl *model.WebhookDelivery) error {
+	e, ok := d.endpoints[dl.Endpoint]
+	if !ok {
+		return errors.WithStack(fmt.Errorf("endpoint %q is not configured", dl.Endpoint))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, dl.EventID)
+	req.Header.Set(HeaderEventType, dl.EventType)
+	// 署名は送信毎に作るため、秘密鍵を替えても未配信のイベントは新しい鍵で署名される
+	req.Header.Set(HeaderSignature, Sign(e.Secret, time.Now(), dl.Payload))
+	resp, err := d.hc.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.WithStack(fmt.Errorf("endpoint returned %s: %s", resp.Status, bytes.TrimSpace(b)))
+	}
+	return nil
+}
+
+// backoff n回目の失敗の後の待ち時間（同時に失敗した配信が揃って再試行しないよう最大20%ずらす）
+func (d *dispatcher) backoff(attempts int) time.Duration {
+	delay := d.policy.MaxDelay
+	if attempts-1 < 32 {
+		if b := d.policy.BaseDelay << uint(attempts-1); b > 0 && b < delay {
+			delay = b
+		}
+	}
+	return delay + time.Duration(mrand.Int63n(int64(delay)/5+1))
+}
+
+// Sign 配信先で検証するためのX-Webhook-Signatureの値を返します
+func Sign(secret string, t time.Time, payload []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newEventID イベントIDに使うUUID（バージョン4）
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// ParseEndpoints name=value形式の設定から配信先を組み立てます
+//
+// urlsは名前毎のURL、secretsは名前毎の署名鍵（必須）、eventsは名前と購読するイベントの組（名前毎に繰り返す、ない場合は全て）です。
+func ParseEndpoints(urls, secrets, events []string) ([]*model.WebhookEndpoint, error) {
+	byName := map[string]*model.WebhookEndpoint{}
+	var endpoints []*model.WebhookEndpoint
+	for _, r := range urls {
+		name, v, err := splitRule(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byName[name]; ok {
+			return nil, errors.WithStack(fmt.Errorf("duplicate webhook endpoint %q", name))
+		}
+		if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.WithStack(fmt.Errorf("invalid webhook URL %q", v))
+		}
+		e := &model.WebhookEndpoint{Name: name, URL: v}
+		byName[name] = e
+		endpoints = append(endpoints, e)
+	}
+	for _, r := range secrets {
+		name, v, err := splitRule(r)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := byName[name]
+		if !ok {
+			return nil, errors.WithStack(fmt.Errorf("webhook secret for unknown endpoint %q", name))
+		}
+		e.Secret = v
+	}
+	known := make(map[string]bool, len(model.EventTypes))
+	for _, t := range model.EventTypes {
+		known[t] = true
+	}
+	for _, r := range events {
+		name, v, err := splitRule(r)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := byName[name]
+		if !ok {
+			return nil, errors.WithStack(fmt.Errorf("webhook events for unknown endpoint %q", name))
+		}
+		if !known[v] {
+			types := append([]string(nil), model.EventTypes...)
+			sort.Strings(types)
+			return nil, errors.WithStack(fmt.Errorf("unknown webhook event %q (one of %s)", v, strings.Join(types, ", ")))
+		}
+		e.Events = append(e.Events, v)
+	}
+	for _, e := range endpoints {
+		if e.Secret == "" {
+			return nil, errors.WithStack(fmt.Errorf("missing webhook secret for endpoint %q", e.Name))
+		}
+	}
+	return endpoints, nil
+}
+
+func splitRule(r string) (string, string, error) {
+	kv := strings.SplitN(r, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return "", "", errors.WithStack(fmt.Errorf("invalid webhook rule %q (name=value)", r))
+	}
+	return kv[0], kv[1], nil
+}
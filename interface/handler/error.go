@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+func writeError(c *gin.Context, err error) {
+	log.Default().Printf("%+v", err)
+	var le *model.LockedError
+	if errors.As(err, &le) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(le.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"message": "too many failed attempts",
+		})
+		return
+	}
+	var pe *model.PasswordPolicyError
+	if errors.As(err, &pe) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message":    "password does not meet policy",
+			"violations": pe.Violations,
+		})
+		return
+	}
+	if errors.Is(err, model.ErrInvalidMagicLink) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "invalid or expired link",
+		})
+		return
+	}
+	if errors.Is(err, model.ErrInvalidOAuthState) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "invalid or expired state",
+		})
+		return
+	}
+	var oe *model.OAuthError
+	if errors.As(err, &oe) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message":           "oauth error",
+			"error":             oe.Code,
+			"error_description": oe.Description,
+		})
+		return
+	}
+	var ce *model.InvalidChallengeAnswerError
+	if errors.As(err, &ce) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "invalid code",
+			// 空の場合は最初からやり直す
+			"session": ce.Session,
+		})
+		return
+	}
+	if errors.Is(err, model.ErrNotAuthorized) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "incorrect email or password",
+		})
+		return
+	}
+	if errors.Is(err, model.ErrUserNotConfirmed) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "user is not confirmed",
+		})
+		return
+	}
+	if errors.Is(err, model.ErrInvalidCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "invalid or expired code",
+		})
+		return
+	}
+	var ne *model.NotSupportedError
+	if errors.As(err, &ne) {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"message": "not supported by the authentication backend",
+		})
+		return
+	}
+	// 適当なエラーレスポンス
+	c.JSON(500, gin.H{
+		"message": "server error",
+	})
+}
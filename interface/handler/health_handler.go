@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 各チェックのタイムアウト
+const healthCheckTimeout = 3 * time.Second
+
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+type HealthHandler struct {
+	checkers []proxy.HealthChecker
+	// cacheTTL 確認結果を使い回す期間（プローブ毎に依存先へ問い合わせないため、0で毎回確認する）
+	cacheTTL time.Duration
+
+	mu        sync.Mutex
+	last      *healthReport
+	checkedAt time.Time
+}
+
+// NewHealthHandler checkersを確認対象とします
+func NewHealthHandler(cacheTTL time.Duration, checkers ...proxy.HealthChecker) *HealthHandler {
+	return &HealthHandler{checkers: checkers, cacheTTL: cacheTTL}
+}
+
+type checkResult struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Liveness プロセスが応答できることのみを返します
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, healthReport{Status: healthStatusOK})
+}
+
+// Readiness 依存先を並行に確認し、チェックごとの結果を返します（cacheTTLの間は前回の結果を返す）
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.report()
+	if report.Status != healthStatusOK {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// report 確認中に届いたプローブは、その確認の結果を待って使う
+func (h *HealthHandler) report() *healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.last != nil && time.Since(h.checkedAt) < h.cacheTTL {
+		return h.last
+	}
+	h.last, h.checkedAt = h.check(), time.Now()
+	return h.last
+}
+
+// check 結果を他のプローブとも共有するため、リクエストのcontextは使わない
+func (h *HealthHandler) check() *healthReport {
+	report := &healthReport{Status: healthStatusOK, Checks: make(map[string]checkResult, len(h.checkers))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, hc := range h.checkers {
+		wg.Add(1)
+		go func(hc proxy.HealthChecker) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := hc.Check(ctx)
+			r := checkResult{Status: healthStatusOK, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				r.Status, r.Error = healthStatusFail, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[hc.Name()] = r
+			if err != nil {
+				report.Status = healthStatusFail
+			}
+		}(hc)
+	}
+	wg.Wait()
+	return report
+}
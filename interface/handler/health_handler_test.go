@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingChecker 確認の回数を数えるHealthChecker（errがあれば失敗する）
+type countingChecker struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (cc *countingChecker) Name() string {
+	return "counting"
+}
+
+func (cc *countingChecker) Check(ctx context.Context) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.calls++
+	return cc.err
+}
+
+func probe(t *testing.T, hh *HealthHandler) (int, healthReport) {
+	t.Helper()
+	engine := gin.New()
+	engine.GET("/readyz", hh.Readiness)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report healthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	return w.Code, report
+}
+
+func TestReadinessCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		cacheTTL  time.Duration
+		wantCalls int
+	}{
+		{"cached", time.Hour, 1},
+		{"cache disabled", 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := new(countingChecker)
+			hh := NewHealthHandler(tt.cacheTTL, cc)
+			for i := 0; i < 3; i++ {
+				if code, report := probe(t, hh); code != http.StatusOK || report.Checks["counting"].Status != healthStatusOK {
+					t.Fatalf("probe %d: status %d, report %+v", i+1, code, report)
+				}
+			}
+			if cc.calls != tt.wantCalls {
+				t.Errorf("Check called %d times, want %d", cc.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// 失敗した結果もcacheTTLの間は使い回し、期限が切れたら確認し直す
+func TestReadinessCacheExpires(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cc := &countingChecker{err: fmt.Errorf("unreachable")}
+	hh := NewHealthHandler(50*time.Millisecond, cc)
+	for i := 0; i < 2; i++ {
+		code, report := probe(t, hh)
+		if code != http.StatusServiceUnavailable || report.Checks["counting"].Error != "unreachable" {
+			t.Fatalf("probe %d: status %d, report %+v", i+1, code, report)
+		}
+	}
+	if cc.calls != 1 {
+		t.Errorf("Check called %d times, want 1", cc.calls)
+	}
+
+	cc.mu.Lock()
+	cc.err = nil
+	cc.mu.Unlock()
+	time.Sleep(60 * time.Millisecond)
+	if code, _ := probe(t, hh); code != http.StatusOK {
+		t.Errorf("after the TTL: status %d, want 200", code)
+	}
+	if cc.calls != 2 {
+		t.Errorf("Check called %d times, want 2", cc.calls)
+	}
+}
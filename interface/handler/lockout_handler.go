@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type LockoutHandler struct {
+	lu usecase.LockoutUsecase
+	v  *validator.Validate
+}
+
+func NewLockoutHandler(lu usecase.LockoutUsecase) *LockoutHandler {
+	return &LockoutHandler{lu, validator.New()}
+}
+
+func (h *LockoutHandler) Unlock(c *gin.Context) {
+	req := new(viewmodel.UnlockReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	err := h.lu.Unlock(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
+func (h *LockoutHandler) errorResponse(c *gin.Context, err error) {
+	writeError(c, err)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type MagicLinkHandler struct {
+	mu usecase.MagicLinkUsecase
+	v  *validator.Validate
+}
+
+func NewMagicLinkHandler(mu usecase.MagicLinkUsecase) *MagicLinkHandler {
+	return &MagicLinkHandler{mu, validator.New()}
+}
+
+func (h *MagicLinkHandler) Start(c *gin.Context) {
+	req := new(viewmodel.MagicLinkStartReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	err := h.mu.StartMagicLink(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
+func (h *MagicLinkHandler) Callback(c *gin.Context) {
+	req := new(viewmodel.MagicLinkCallbackReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	// トークンをリファラで漏らさない
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "no-store")
+
+	resp, err := h.mu.CompleteMagicLink(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
+func (h *MagicLinkHandler) errorResponse(c *gin.Context, err error) {
+	writeError(c, err)
+}
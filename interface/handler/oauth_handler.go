@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// stateをブラウザに結びつけるCookie（ログインCSRF対策）
+const (
+	oauthStateCookie     = "oauth_state"
+	oauthStateCookiePath = "/oauth/callback"
+)
+
+type OAuthHandler struct {
+	ou usecase.OAuthUsecase
+	v  *validator.Validate
+}
+
+func NewOAuthHandler(ou usecase.OAuthUsecase) *OAuthHandler {
+	return &OAuthHandler{ou, validator.New()}
+}
+
+func (h *OAuthHandler) Login(c *gin.Context) {
+	req := new(viewmodel.OAuthLoginReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	resp, err := h.ou.Login(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	// IdPからのトップレベルのリダイレクトで送られるようSameSite=Laxにする
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, resp.State, int(resp.StateTTL.Seconds()), oauthStateCookiePath, "", isSecure(c), true)
+	c.Redirect(http.StatusFound, resp.URL)
+}
+
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	req := new(viewmodel.OAuthCallbackReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	cookie, _ := c.Cookie(oauthStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, "", -1, oauthStateCookiePath, "", isSecure(c), true)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(req.State)) != 1 {
+		h.errorResponse(c, errors.Wrap(model.ErrInvalidOAuthState, "state does not match cookie"))
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+
+	resp, err := h.ou.Callback(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
+func (h *OAuthHandler) errorResponse(c *gin.Context, err error) {
+	writeError(c, err)
+}
+
+// isSecure TLS、またはTLSを終端するプロキシ経由のリクエストか判定します
+func isSecure(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
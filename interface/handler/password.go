@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"log"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// PasswordValidator Cognitoに送る前にパスワードを検証します
+type PasswordValidator struct {
+	policy model.PasswordPolicy
+	bc     proxy.BreachedPasswordChecker
+}
+
+// NewPasswordValidator PasswordValidatorを生成します（漏洩パスワードを照合しない場合bcはnil）
+func NewPasswordValidator(policy model.PasswordPolicy, bc proxy.BreachedPasswordChecker) *PasswordValidator {
+	return &PasswordValidator{policy, bc}
+}
+
+// Validate ポリシーと漏洩パスワードの一覧で検証します
+func (pv *PasswordValidator) Validate(ctx context.Context, password string, personal ...string) error {
+	err := pv.policy.Validate(password, personal...)
+	if pv.bc == nil {
+		return err
+	}
+	breached, berr := pv.bc.IsBreached(ctx, password)
+	if berr != nil {
+		// 照合できない場合はポリシーの検証結果のみで判断する
+		log.Default().Printf("%+v", berr)
+		return err
+	}
+	if !breached {
+		return err
+	}
+	pe, ok := err.(*model.PasswordPolicyError)
+	if !ok {
+		pe = new(model.PasswordPolicyError)
+	}
+	pe.Violations = append(pe.Violations, "has appeared in a data breach")
+	return pe
+}
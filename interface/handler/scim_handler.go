@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// SCIMのレスポンスのContent-Type（RFC 7644 3.1）
+const scimContentType = "application/scim+json"
+
+type SCIMHandler struct {
+	su usecase.SCIMUsecase
+}
+
+func NewSCIMHandler(su usecase.SCIMUsecase) *SCIMHandler {
+	return &SCIMHandler{su}
+}
+
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	q, ok := h.query(c)
+	if !ok {
+		return
+	}
+	res, err := h.su.ListUsers(c.Request.Context(), q)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	q, ok := h.query(c)
+	if !ok {
+		return
+	}
+	res, err := h.su.GetUser(c.Request.Context(), c.Param("id"), q)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	req := new(viewmodel.SCIMUser)
+	if !h.bind(c, req) {
+		return
+	}
+	res, err := h.su.CreateUser(c.Request.Context(), req)
+	h.respond(c, http.StatusCreated, res, err)
+}
+
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	req := new(viewmodel.SCIMUser)
+	if !h.bind(c, req) {
+		return
+	}
+	res, err := h.su.ReplaceUser(c.Request.Context(), c.Param("id"), req)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	req := new(viewmodel.SCIMPatchOp)
+	if !h.bind(c, req) {
+		return
+	}
+	res, err := h.su.PatchUser(c.Request.Context(), c.Param("id"), req)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.su.DeleteUser(c.Request.Context(), c.Param("id")); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	q, ok := h.query(c)
+	if !ok {
+		return
+	}
+	res, err := h.su.ListGroups(c.Request.Context(), q)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	q, ok := h.query(c)
+	if !ok {
+		return
+	}
+	res, err := h.su.GetGroup(c.Request.Context(), c.Param("id"), q)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	req := new(viewmodel.SCIMGroup)
+	if !h.bind(c, req) {
+		return
+	}
+	res, err := h.su.CreateGroup(c.Request.Context(), req)
+	h.respond(c, http.StatusCreated, res, err)
+}
+
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	req := new(viewmodel.SCIMGroup)
+	if !h.bind(c, req) {
+		return
+	}
+	res, err := h.su.ReplaceGroup(c.Request.Context(), c.Param("id"), req)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	req := new(viewmodel.SCIMPatchOp)
+	if !h.bind(c, req) {
+		return
+	}
+	res, err := h.su.PatchGroup(c.Request.Context(), c.Param("id"), req)
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	if err := h.su.DeleteGroup(c.Request.Context(), c.Param("id")); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	h.respond(c, http.StatusOK, h.su.ServiceProviderConfig(), nil)
+}
+
+func (h *SCIMHandler) ListSchemas(c *gin.Context) {
+	h.respond(c, http.StatusOK, h.su.ListSchemas(), nil)
+}
+
+func (h *SCIMHandler) GetSchema(c *gin.Context) {
+	res, err := h.su.GetSchema(c.Param("id"))
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) ListResourceTypes(c *gin.Context) {
+	h.respond(c, http.StatusOK, h.su.ListResourceTypes(), nil)
+}
+
+func (h *SCIMHandler) GetResourceType(c *gin.Context) {
+	res, err := h.su.GetResourceType(c.Param("id"))
+	h.respond(c, http.StatusOK, res, err)
+}
+
+func (h *SCIMHandler) query(c *gin.Context) (*viewmodel.SCIMQuery, bool) {
+	q := new(viewmodel.SCIMQuery)
+	if err := c.ShouldBindQuery(q); err != nil {
+		h.errorResponse(c, errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidValue, Detail: err.Error()}))
+		return nil, false
+	}
+	return q, true
+}
+
+// bind application/scim+jsonもJSONとして読み込みます
+func (h *SCIMHandler) bind(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidSyntax, Detail: err.Error()}))
+		return false
+	}
+	return true
+}
+
+func (h *SCIMHandler) respond(c *gin.Context, status int, res interface{}, err error) {
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	c.Render(status, scimJSON{res})
+}
+
+// errorResponse SCIMのエラーレスポンス（RFC 7644 3.12）を返します
+func (h *SCIMHandler) errorResponse(c *gin.Context, err error) {
+	log.Default().Printf("%+v", err)
+	status, typ, detail := http.StatusInternalServerError, "", "server error"
+	var se *model.SCIMError
+	var ne *model.NotSupportedError
+	switch {
+	case errors.As(err, &se):
+		status, typ, detail = se.Status, se.Type, se.Detail
+	case errors.Is(err, model.ErrUserNotFound):
+		status, detail = http.StatusNotFound, "user not found"
+	case errors.Is(err, model.ErrGroupNotFound):
+		status, detail = http.StatusNotFound, "group not found"
+	case errors.Is(err, model.ErrUserAlreadyExists):
+		status, typ, detail = http.StatusConflict, model.SCIMUniqueness, "userName already exists"
+	case errors.Is(err, model.ErrGroupAlreadyExists):
+		status, typ, detail = http.StatusConflict, model.SCIMUniqueness, "displayName already exists"
+	case errors.As(err, &ne):
+		status, detail = http.StatusNotImplemented, "not supported by the authentication backend"
+	case errors.Is(err, model.ErrTooManyRequests):
+		status, detail = http.StatusTooManyRequests, "too many requests"
+	}
+	c.Render(status, scimJSON{&viewmodel.SCIMErrorResp{
+		Schemas:  []string{viewmodel.SCIMSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: typ,
+		Detail:   detail,
+	}})
+}
+
+// scimJSON Content-Typeをapplication/scim+jsonとしてJSONを書き込みます
+type scimJSON struct {
+	data interface{}
+}
+
+func (r scimJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return errors.WithStack(json.NewEncoder(w).Encode(r.data))
+}
+
+func (r scimJSON) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", scimContentType)
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// fakeSCIMUsecase errを返すか、リクエストのuserNameをそのまま返すSCIMUsecase（使わない操作は未実装）
+type fakeSCIMUsecase struct {
+	usecase.SCIMUsecase
+	err error
+}
+
+func (u *fakeSCIMUsecase) ListUsers(ctx context.Context, q *viewmodel.SCIMQuery) (*viewmodel.SCIMListResponse, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	return &viewmodel.SCIMListResponse{Schemas: []string{viewmodel.SCIMSchemaListResponse}, StartIndex: 1, Resources: []map[string]interface{}{}}, nil
+}
+
+func (u *fakeSCIMUsecase) CreateUser(ctx context.Context, req *viewmodel.SCIMUser) (map[string]interface{}, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	return map[string]interface{}{"id": "sub-1", "userName": req.UserName}, nil
+}
+
+func (u *fakeSCIMUsecase) DeleteUser(ctx context.Context, id string) error {
+	return u.err
+}
+
+func scimEngine(su usecase.SCIMUsecase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewSCIMHandler(su)
+	engine := gin.New()
+	engine.GET("/scim/v2/Users", h.ListUsers)
+	engine.POST("/scim/v2/Users", h.CreateUser)
+	engine.DELETE("/scim/v2/Users/:id", h.DeleteUser)
+	return engine
+}
+
+func TestSCIMHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		method string
+		target string
+		body   string
+		want   viewmodel.SCIMErrorResp
+	}{
+		{
+			name: "scim error", method: http.MethodGet, target: "/scim/v2/Users?filter=x",
+			err:  errors.WithStack(&model.SCIMError{Status: http.StatusBadRequest, Type: model.SCIMInvalidFilter, Detail: "expected an operator after x"}),
+			want: viewmodel.SCIMErrorResp{Status: "400", ScimType: model.SCIMInvalidFilter, Detail: "expected an operator after x"},
+		},
+		{
+			name: "user not found", method: http.MethodDelete, target: "/scim/v2/Users/sub-9",
+			err:  errors.Wrap(model.ErrUserNotFound, "sub-9"),
+			want: viewmodel.SCIMErrorResp{Status: "404", Detail: "user not found"},
+		},
+		{
+			name: "group not found", method: http.MethodDelete, target: "/scim/v2/Users/sub-9",
+			err:  errors.WithStack(model.ErrGroupNotFound),
+			want: viewmodel.SCIMErrorResp{Status: "404", Detail: "group not found"},
+		},
+		{
+			name: "user exists", method: http.MethodPost, target: "/scim/v2/Users", body: `{"userName":"taro@example.com"}`,
+			err:  errors.WithStack(model.ErrUserAlreadyExists),
+			want: viewmodel.SCIMErrorResp{Status: "409", ScimType: model.SCIMUniqueness, Detail: "userName already exists"},
+		},
+		{
+			name: "not supported", method: http.MethodPost, target: "/scim/v2/Users", body: `{"userName":"taro@example.com"}`,
+			err:  errors.WithStack(&model.NotSupportedError{Backend: "ldap", Operation: "ImportUser"}),
+			want: viewmodel.SCIMErrorResp{Status: "501", Detail: "not supported by the authentication backend"},
+		},
+		{
+			name: "throttled", method: http.MethodGet, target: "/scim/v2/Users",
+			err:  errors.WithStack(model.ErrTooManyRequests),
+			want: viewmodel.SCIMErrorResp{Status: "429", Detail: "too many requests"},
+		},
+		{
+			// 内部のエラーの内容は返さない
+			name: "server error", method: http.MethodGet, target: "/scim/v2/Users",
+			err:  errors.WithStack(fmt.Errorf("dial tcp: connection refused")),
+			want: viewmodel.SCIMErrorResp{Status: "500", Detail: "server error"},
+		},
+		{
+			name: "malformed body", method: http.MethodPost, target: "/scim/v2/Users", body: `{"userName":`,
+			want: viewmodel.SCIMErrorResp{Status: "400", ScimType: model.SCIMInvalidSyntax},
+		},
+		{
+			name: "malformed query", method: http.MethodGet, target: "/scim/v2/Users?count=ten",
+			want: viewmodel.SCIMErrorResp{Status: "400", ScimType: model.SCIMInvalidValue},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			scimEngine(&fakeSCIMUsecase{err: tt.err}).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if want := tt.want.Status; fmt.Sprint(w.Code) != want {
+				t.Errorf("status = %d, want %s", w.Code, want)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != scimContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, scimContentType)
+			}
+			var got viewmodel.SCIMErrorResp
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v: %s", err, w.Body)
+			}
+			want := tt.want
+			want.Schemas = []string{viewmodel.SCIMSchemaError}
+			if want.Detail == "" {
+				// 読み込みのエラーの詳細はライブラリのメッセージのため比較しない
+				want.Detail = got.Detail
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSCIMHandlerSuccess(t *testing.T) {
+	engine := scimEngine(new(fakeSCIMUsecase))
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/scim/v2/Users?startIndex=1&count=10", "", http.StatusOK},
+		{http.MethodPost, "/scim/v2/Users", `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"taro@example.com"}`, http.StatusCreated},
+		{http.MethodDelete, "/scim/v2/Users/sub-1", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", scimContentType)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d (%s)", tt.method, tt.target, w.Code, tt.want, w.Body)
+		}
+		if tt.want != http.StatusNoContent && w.Header().Get("Content-Type") != scimContentType {
+			t.Errorf("%s %s: Content-Type = %q", tt.method, tt.target, w.Header().Get("Content-Type"))
+		}
+	}
+}
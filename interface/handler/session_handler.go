@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/interface/middleware"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type SessionHandler struct {
+	su usecase.SessionUsecase
+	v  *validator.Validate
+}
+
+func NewSessionHandler(su usecase.SessionUsecase) *SessionHandler {
+	return &SessionHandler{su, validator.New()}
+}
+
+func (h *SessionHandler) List(c *gin.Context) {
+	// gin.Contextからメールアドレスを取得
+	email, err := middleware.GetEmail(c)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	resp, err := h.su.ListSessions(c.Request.Context(), email)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
+func (h *SessionHandler) Forget(c *gin.Context) {
+	// gin.Contextからメールアドレスを取得
+	email, err := middleware.GetEmail(c)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	err = h.su.ForgetSession(c.Request.Context(), email, c.Param("device_key"))
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
+func (h *SessionHandler) Update(c *gin.Context) {
+	// gin.Contextからメールアドレスを取得
+	email, err := middleware.GetEmail(c)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	req := new(viewmodel.UpdateSessionReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	err = h.su.UpdateSession(c.Request.Context(), email, c.Param("device_key"), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
+func (h *SessionHandler) errorResponse(c *gin.Context, err error) {
+	writeError(c, err)
+}
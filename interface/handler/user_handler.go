@@ -1,8 +1,6 @@
 package handler
 
 import (
-	"log"
-
 	"github.com/gin-gonic/gin"
 
 	"github.com/taniyuu/gin-cognito-sample/application/usecase"
@@ -14,10 +12,11 @@ import (
 type UserHandler struct {
 	tu usecase.UserUsecase
 	v  *validator.Validate
+	pv *PasswordValidator
 }
 
-func NewUserHandler(tu usecase.UserUsecase) *UserHandler {
-	return &UserHandler{tu, validator.New()}
+func NewUserHandler(tu usecase.UserUsecase, pv *PasswordValidator) *UserHandler {
+	return &UserHandler{tu, validator.New(), pv}
 }
 
 func (h *UserHandler) Create(c *gin.Context) {
@@ -30,6 +29,10 @@ func (h *UserHandler) Create(c *gin.Context) {
 		h.errorResponse(c, err)
 		return
 	}
+	if err := h.pv.Validate(c.Request.Context(), req.Password, req.Email, req.Name); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
 
 	err := h.tu.Create(c.Request.Context(), req)
 	if err != nil {
@@ -58,6 +61,25 @@ func (h *UserHandler) Confirm(c *gin.Context) {
 	}
 }
 
+func (h *UserHandler) ResendConfirmationCode(c *gin.Context) {
+	req := new(viewmodel.ResendConfirmationCodeReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	err := h.tu.ResendConfirmationCode(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
 func (h *UserHandler) Signin(c *gin.Context) {
 	req := new(viewmodel.SigninReq)
 	if err := c.ShouldBindJSON(req); err != nil {
@@ -112,6 +134,10 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 		h.errorResponse(c, err)
 		return
 	}
+	if err := h.pv.Validate(c.Request.Context(), req.ProposedPassword, email); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
 
 	err = h.tu.ChangePassword(c.Request.Context(), email, req)
 	if err != nil {
@@ -150,6 +176,10 @@ func (h *UserHandler) ConfirmForgotPassword(c *gin.Context) {
 		h.errorResponse(c, err)
 		return
 	}
+	if err := h.pv.Validate(c.Request.Context(), req.Password, req.Email); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
 
 	err := h.tu.ConfirmForgotPassword(c.Request.Context(), req)
 	if err != nil {
@@ -218,6 +248,21 @@ func (h *UserHandler) Signout(c *gin.Context) {
 	}
 }
 
+func (h *UserHandler) GlobalSignout(c *gin.Context) {
+	// gin.Contextからメールアドレスを取得
+	email, err := middleware.GetEmail(c)
+	if err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	err = h.tu.GlobalSignout(c.Request.Context(), email)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
 func (h *UserHandler) Invite(c *gin.Context) {
 	req := new(viewmodel.InviteReq)
 	if err := c.ShouldBindJSON(req); err != nil {
@@ -247,6 +292,10 @@ func (h *UserHandler) RespondToInvitation(c *gin.Context) {
 		h.errorResponse(c, err)
 		return
 	}
+	if err := h.pv.Validate(c.Request.Context(), req.Password, req.Email, req.Name); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
 
 	resp, err := h.tu.RespondToInvitation(c.Request.Context(), req)
 	if err != nil {
@@ -271,10 +320,59 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	}
 }
 
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	req := new(viewmodel.DisableUserReq)
+	req.Sub = c.Param("id")
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	err := h.tu.DisableUserForAdmin(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.Status(200)
+	}
+}
+
+func (h *UserHandler) PasswordlessStart(c *gin.Context) {
+	req := new(viewmodel.PasswordlessStartReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	resp, err := h.tu.PasswordlessStart(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
+func (h *UserHandler) PasswordlessVerify(c *gin.Context) {
+	req := new(viewmodel.PasswordlessVerifyReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.errorResponse(c, err)
+		return
+	}
+
+	resp, err := h.tu.PasswordlessVerify(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
 func (h *UserHandler) errorResponse(c *gin.Context, err error) {
-	log.Default().Printf("%+v", err)
-	// 適当なエラーレスポンス
-	c.JSON(500, gin.H{
-		"message": "server error",
-	})
+	writeError(c, err)
 }
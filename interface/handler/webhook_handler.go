@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type WebhookHandler struct {
+	wu usecase.WebhookUsecase
+	v  *validator.Validate
+}
+
+func NewWebhookHandler(wu usecase.WebhookUsecase) *WebhookHandler {
+	return &WebhookHandler{wu, validator.New()}
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	req := new(viewmodel.WebhookDeliveriesReq)
+	if err := c.ShouldBindQuery(req); err != nil {
+		h.badRequest(c, errors.WithStack(err))
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.badRequest(c, errors.WithStack(err))
+		return
+	}
+
+	resp, err := h.wu.ListDeliveries(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
+func (h *WebhookHandler) Replay(c *gin.Context) {
+	req := new(viewmodel.ReplayWebhooksReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.badRequest(c, errors.WithStack(err))
+		return
+	}
+	if err := h.v.Struct(req); err != nil {
+		h.badRequest(c, errors.WithStack(err))
+		return
+	}
+
+	resp, err := h.wu.Replay(c.Request.Context(), req)
+	if err != nil {
+		h.errorResponse(c, err)
+	} else {
+		c.JSON(200, resp)
+	}
+}
+
+// badRequest 不正な条件を400で返します
+func (h *WebhookHandler) badRequest(c *gin.Context, err error) {
+	log.Default().Printf("%+v", err)
+	c.JSON(http.StatusBadRequest, gin.H{
+		"message": "invalid request",
+		"error":   errors.Cause(err).Error(),
+	})
+}
+
+func (h *WebhookHandler) errorResponse(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrEmptyWebhookFilter) {
+		h.badRequest(c, err)
+		return
+	}
+	writeError(c, err)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+)
+
+type fakeWebhookUsecase struct {
+	replays int
+}
+
+func (u *fakeWebhookUsecase) ListDeliveries(ctx context.Context, req *viewmodel.WebhookDeliveriesReq) (*viewmodel.WebhookDeliveriesResp, error) {
+	return &viewmodel.WebhookDeliveriesResp{}, nil
+}
+
+func (u *fakeWebhookUsecase) Replay(ctx context.Context, req *viewmodel.ReplayWebhooksReq) (*viewmodel.ReplayWebhooksResp, error) {
+	u.replays++
+	return &viewmodel.ReplayWebhooksResp{Replayed: 1}, nil
+}
+
+func TestWebhookHandlerReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"empty filter", `{}`, http.StatusBadRequest},
+		{"endpoint only", `{"endpoint":"crm"}`, http.StatusBadRequest},
+		{"unknown status", `{"event_id":"ev-1","status":"lost"}`, http.StatusBadRequest},
+		{"event id", `{"event_id":"ev-1"}`, http.StatusOK},
+		{"since", `{"since":"2026-01-02T03:04:05Z","endpoint":"crm"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wu := new(fakeWebhookUsecase)
+			engine := gin.New()
+			engine.POST("/webhooks/replay", NewWebhookHandler(wu).Replay)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks/replay", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+			if wantCalls := map[bool]int{true: 1, false: 0}[tt.want == http.StatusOK]; wu.replays != wantCalls {
+				t.Errorf("usecase called %d times, want %d", wu.replays, wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// WellKnownHandler 自前で発行したIDトークンを他のサービスが検証できるよう、公開鍵と発行者の情報を公開します
+type WellKnownHandler struct {
+	ti     proxy.TokenIssuer
+	issuer string
+}
+
+// NewWellKnownHandler issuerはこのサーバのURL（ディスカバリはissuerの下で公開される前提）
+func NewWellKnownHandler(ti proxy.TokenIssuer, issuer string) *WellKnownHandler {
+	return &WellKnownHandler{ti, issuer}
+}
+
+// JWKS 検証用の公開鍵
+func (h *WellKnownHandler) JWKS(c *gin.Context) {
+	b, err := h.ti.PublicJWKS()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/json", b)
+}
+
+// OpenIDConfiguration OIDCディスカバリの最小限の項目（IDトークンの検証に必要なもの）
+func (h *WellKnownHandler) OpenIDConfiguration(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                h.issuer,
+		"jwks_uri":                              strings.TrimSuffix(h.issuer, "/") + "/.well-known/jwks.json",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"subject_types_supported":               []string{"public"},
+		"response_types_supported":              []string{"id_token"},
+	})
+}
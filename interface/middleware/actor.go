@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+// Actor リクエスト元のIP、ユーザエージェントをリクエストコンテキストに設定します
+func Actor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := &model.Actor{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		c.Request = c.Request.WithContext(model.WithActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
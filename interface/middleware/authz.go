@@ -3,42 +3,150 @@ package middleware
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
 	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
 )
 
 const subContextKey string = "sub"
 const emailContextKey string = "email"
+const serviceContextKey string = "service"
+
+// サービスIDをsubとして扱う際の接頭辞（Cognitoのsubと衝突させない）
+const servicePrefix = "service:"
 
 // AuthzMiddleware アカウント認証操作を実行します
 type AuthzMiddleware struct {
 	ap proxy.AuthorizarProxy
+	as proxy.AuditSink
+	sm proxy.ServiceIdentityMapper
+	rs proxy.RevocationStore
+	// adminGroups 管理エンドポイントを使えるグループ
+	adminGroups []string
 }
 
-// NewAuthzMiddleware AuthzMiddlewareを生成します
-func NewAuthzMiddleware(ap proxy.AuthorizarProxy) *AuthzMiddleware {
-	return &AuthzMiddleware{ap}
+// NewAuthzMiddleware AuthzMiddlewareを生成します（mTLSを使わない場合smはnil）
+func NewAuthzMiddleware(
+	ap proxy.AuthorizarProxy,
+	as proxy.AuditSink,
+	sm proxy.ServiceIdentityMapper,
+	rs proxy.RevocationStore,
+	adminGroups []string,
+) *AuthzMiddleware {
+	return &AuthzMiddleware{ap, as, sm, rs, adminGroups}
 }
 
 // Authorization アカウントを認証しコンテキストに設定します
 func (am *AuthzMiddleware) Authorization() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		sub, email, err := am.ap.ValidateJWT(token)
-		if err != nil {
+		if err := am.authenticate(c); err != nil {
+			am.audit(c, err)
 			am.errorResponse(c, err)
 			c.Abort()
 			return
 		}
-		// ginコンテキストにsub, emailを入れる
-		c.Set(subContextKey, sub)
-		c.Set(emailContextKey, email)
 		c.Next()
 	}
 }
 
+// OptionalAuthorization Authorizationヘッダがある場合のみ認証します（不正なトークンは拒否する）
+func (am *AuthzMiddleware) OptionalAuthorization() gin.HandlerFunc {
+	authz := am.Authorization()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authz(c)
+	}
+}
+
+// authenticate トークンを検証し、失効していなければコンテキストに設定します
+func (am *AuthzMiddleware) authenticate(c *gin.Context) error {
+	token := c.GetHeader("Authorization")
+	claims, err := am.ap.ValidateJWT(token)
+	if err != nil {
+		return err
+	}
+	// 失効を確認できない場合は安全側に倒して拒否する
+	revoked, err := am.rs.IsRevoked(c.Request.Context(), claims)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errors.WithStack(fmt.Errorf("token revoked"))
+	}
+	// ginコンテキストにsub, emailを入れる
+	c.Set(subContextKey, claims.Sub)
+	c.Set(emailContextKey, claims.Email)
+	c.Request = c.Request.WithContext(model.WithClaims(c.Request.Context(), claims))
+	am.setActor(c, claims.Sub)
+	return nil
+}
+
+// AdminAuthorization 検証済みのクライアント証明書がサービスIDに対応付けられる場合はサービスとして、
+// それ以外は管理者のグループに所属するユーザのJWTで認証します（他のユーザは403）
+func (am *AuthzMiddleware) AdminAuthorization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id, ok := am.serviceIdentity(c); ok {
+			c.Set(subContextKey, servicePrefix+id)
+			c.Set(serviceContextKey, id)
+			am.setActor(c, servicePrefix+id)
+			c.Next()
+			return
+		}
+		if err := am.authenticate(c); err != nil {
+			am.audit(c, err)
+			am.errorResponse(c, err)
+			c.Abort()
+			return
+		}
+		if !am.isAdmin(model.ClaimsFromContext(c.Request.Context())) {
+			err := errors.WithStack(fmt.Errorf("not an administrator"))
+			log.Default().Printf("%+v", err)
+			am.audit(c, err)
+			c.AbortWithStatusJSON(403, gin.H{
+				"message": "forbidden",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// isAdmin 管理者のグループのいずれかに所属しているか
+func (am *AuthzMiddleware) isAdmin(claims *model.Claims) bool {
+	if claims == nil {
+		return false
+	}
+	for _, g := range claims.Groups {
+		for _, ag := range am.adminGroups {
+			if g == ag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (am *AuthzMiddleware) serviceIdentity(c *gin.Context) (string, bool) {
+	if am.sm == nil || c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+	// VerifiedChainsの先頭はクライアント証明書自身
+	return am.sm.MapCertificate(c.Request.TLS.VerifiedChains[0][0])
+}
+
+// setActor 監査ログのためリクエストコンテキストの実行者にもsubを入れる
+func (am *AuthzMiddleware) setActor(c *gin.Context, sub string) {
+	actor := *model.ActorFromContext(c.Request.Context())
+	actor.Sub = sub
+	c.Request = c.Request.WithContext(model.WithActor(c.Request.Context(), &actor))
+}
+
 func GetSub(c *gin.Context) (string, error) {
 	v := c.GetString(subContextKey)
 	if v == "" {
@@ -47,6 +155,11 @@ func GetSub(c *gin.Context) (string, error) {
 	return v, nil
 }
 
+// GetService mTLSで認証されたサービスIDを取得します（ユーザの場合は空）
+func GetService(c *gin.Context) string {
+	return c.GetString(serviceContextKey)
+}
+
 func GetEmail(c *gin.Context) (string, error) {
 	v := c.GetString(emailContextKey)
 	if v == "" {
@@ -62,3 +175,19 @@ func (am *AuthzMiddleware) errorResponse(c *gin.Context, err error) {
 		"message": "unauthorized",
 	})
 }
+
+// audit 認可失敗を監査ログに書き込みます
+func (am *AuthzMiddleware) audit(c *gin.Context, err error) {
+	ev := &model.AuditEvent{
+		Time:      time.Now(),
+		Action:    model.AuditActionAuthorize,
+		Target:    c.Request.Method + " " + c.FullPath(),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Outcome:   model.AuditOutcomeFailure,
+		Reason:    err.Error(),
+	}
+	if werr := am.as.Write(c.Request.Context(), ev); werr != nil {
+		log.Default().Printf("%+v", werr)
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/memory"
+)
+
+// トークン"admin"のユーザのみadminグループに所属させる
+type fakeAuthorizar struct{}
+
+func (fakeAuthorizar) ValidateJWT(token string) (*model.Claims, error) {
+	switch token {
+	case "user":
+		return &model.Claims{Sub: "user", Groups: []string{"staff"}}, nil
+	case "admin":
+		return &model.Claims{Sub: "admin", Groups: []string{"staff", "admin"}}, nil
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+type recordingSink struct {
+	events []*model.AuditEvent
+}
+
+func (s *recordingSink) Write(ctx context.Context, ev *model.AuditEvent) error {
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name      string
+		token     string
+		want      int
+		wantAudit bool
+	}{
+		{"admin group", "admin", http.StatusOK, false},
+		{"signed-in user without the group", "user", http.StatusForbidden, true},
+		{"invalid token", "bogus", http.StatusUnauthorized, true},
+		{"no token", "", http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := new(recordingSink)
+			am := NewAuthzMiddleware(fakeAuthorizar{}, as, nil, memory.NewRevocationStore(ctx), []string{"admin"})
+			engine := gin.New()
+			engine.POST("/unlock", am.AdminAuthorization(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/unlock", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := len(as.events) > 0; got != tt.wantAudit {
+				t.Errorf("audited = %v, want %v", got, tt.wantAudit)
+			}
+		})
+	}
+}
+
+func TestAdminAuthorizationNoAdminGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	am := NewAuthzMiddleware(fakeAuthorizar{}, new(recordingSink), nil, memory.NewRevocationStore(ctx), nil)
+	engine := gin.New()
+	engine.POST("/unlock", am.AdminAuthorization(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/unlock", nil)
+	req.Header.Set("Authorization", "admin")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// emailを探すために読むボディの上限
+const maxPeekBodySize = 64 << 10
+
+// RateLimit トークンバケットの補充レート（1分あたり）と容量
+type RateLimit struct {
+	PerMinute float64
+	Burst     int
+}
+
+// RateLimitMiddleware クライアントIP、アカウント（メールアドレス）毎にリクエストを制限します
+type RateLimitMiddleware struct {
+	store       proxy.RateLimitStore
+	ip, account RateLimit
+}
+
+// NewRateLimitMiddleware RateLimitMiddlewareを生成します（PerMinuteが0以下の制限は無効）
+func NewRateLimitMiddleware(store proxy.RateLimitStore, ip, account RateLimit) *RateLimitMiddleware {
+	return &RateLimitMiddleware{store, ip, account}
+}
+
+// Limit リクエストをIP、リクエストボディのemail毎に制限します
+func (rm *RateLimitMiddleware) Limit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := c.FullPath()
+		if wait, limited := rm.take(c, "ip:"+scope+":"+c.ClientIP(), rm.ip); limited {
+			rm.tooManyRequests(c, wait)
+			return
+		}
+		if email := peekEmail(c); email != "" {
+			if wait, limited := rm.take(c, "account:"+scope+":"+email, rm.account); limited {
+				rm.tooManyRequests(c, wait)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func (rm *RateLimitMiddleware) take(c *gin.Context, key string, l RateLimit) (time.Duration, bool) {
+	if l.PerMinute <= 0 {
+		return 0, false
+	}
+	ok, wait, err := rm.store.Take(c.Request.Context(), key, l.PerMinute/60, l.Burst)
+	if err != nil {
+		// ストア障害で全てのサインインを止めないよう、制限せずに通す
+		log.Default().Printf("%+v", err)
+		return 0, false
+	}
+	return wait, !ok
+}
+
+func (rm *RateLimitMiddleware) tooManyRequests(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"message": "too many requests",
+	})
+}
+
+// peekEmail ハンドラでも読めるようにボディを戻した上で、emailを取り出します
+func peekEmail(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	orig := c.Request.Body
+	b, err := ioutil.ReadAll(io.LimitReader(orig, maxPeekBodySize))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), orig), orig}
+	if err != nil {
+		return ""
+	}
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/memory"
+)
+
+// X-Forwarded-Forを変えても、信頼するプロキシ経由でなければ同じIPとして制限されること
+func TestRateLimitClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		// wantLimited 3回目のリクエストが制限されるか
+		wantLimited bool
+	}{
+		{"no trusted proxies", nil, true},
+		// httptestのリクエストの接続元は192.0.2.1
+		{"request from a trusted proxy", []string{"192.0.2.0/24"}, false},
+		{"request from an untrusted address", []string{"10.0.0.0/8"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rm := NewRateLimitMiddleware(memory.NewRateLimitStore(ctx), RateLimit{PerMinute: 1, Burst: 2}, RateLimit{})
+			engine := gin.New()
+			if err := engine.SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatal(err)
+			}
+			engine.POST("/signin", rm.Limit(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			var last int
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/signin", nil)
+				req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				last = w.Code
+			}
+			if got := last == http.StatusTooManyRequests; got != tt.wantLimited {
+				t.Errorf("third request status = %d, limited = %v, want %v", last, got, tt.wantLimited)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// SCIMのクライアント（IdP）を監査ログで表すサービスID
+const scimServiceID = "scim"
+
+// SCIMAuthorization IdPと共有したベアラートークンでSCIMのリクエストを認証します
+func SCIMAuthorization(token string, as proxy.AuditSink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := bearerToken(c.GetHeader("Authorization"))
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			err := errors.WithStack(fmt.Errorf("invalid scim token"))
+			log.Default().Printf("%+v", err)
+			scimAudit(c, as, err)
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			c.Header("Content-Type", "application/scim+json")
+			c.AbortWithStatusJSON(401, &viewmodel.SCIMErrorResp{
+				Schemas: []string{viewmodel.SCIMSchemaError},
+				Status:  "401",
+				Detail:  "unauthorized",
+			})
+			return
+		}
+		c.Set(subContextKey, servicePrefix+scimServiceID)
+		c.Set(serviceContextKey, scimServiceID)
+		actor := *model.ActorFromContext(c.Request.Context())
+		actor.Sub = servicePrefix + scimServiceID
+		c.Request = c.Request.WithContext(model.WithActor(c.Request.Context(), &actor))
+		c.Next()
+	}
+}
+
+// bearerToken Authorizationヘッダのベアラートークン（スキーム名は大文字小文字を区別しない、他の形式は空）
+func bearerToken(header string) string {
+	const scheme = "Bearer "
+	if len(header) < len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(scheme):])
+}
+
+// scimAudit 認可失敗を監査ログに書き込みます
+func scimAudit(c *gin.Context, as proxy.AuditSink, err error) {
+	ev := &model.AuditEvent{
+		Time:      time.Now(),
+		Action:    model.AuditActionAuthorize,
+		Target:    c.Request.Method + " " + c.FullPath(),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Outcome:   model.AuditOutcomeFailure,
+		Reason:    err.Error(),
+	}
+	if werr := as.Write(c.Request.Context(), ev); werr != nil {
+		log.Default().Printf("%+v", werr)
+	}
+}
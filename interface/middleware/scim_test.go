@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taniyuu/gin-cognito-sample/application/viewmodel"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+func TestSCIMAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const token = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name          string
+		authorization string
+		wantOK        bool
+	}{
+		{"bearer token", "Bearer " + token, true},
+		{"surrounding spaces", "Bearer  " + token + " ", true},
+		{"lowercase scheme", "bearer " + token, true},
+		{"uppercase scheme", "BEARER " + token, true},
+		{"bare token", token, false},
+		{"scheme without a space", "Bearer" + token, false},
+		{"missing header", "", false},
+		{"empty token", "Bearer ", false},
+		{"wrong token", "Bearer " + token[:31] + "0", false},
+		{"prefix of the token", "Bearer " + token[:16], false},
+		{"basic auth", "Basic " + token, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := new(recordingSink)
+			engine := gin.New()
+			var actor *model.Actor
+			engine.GET("/scim/v2/Users", SCIMAuthorization(token, as), func(c *gin.Context) {
+				actor = model.ActorFromContext(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if tt.wantOK {
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200", w.Code)
+				}
+				if actor == nil || actor.Sub != servicePrefix+scimServiceID {
+					t.Errorf("actor = %+v, want the scim service", actor)
+				}
+				if len(as.events) != 0 {
+					t.Errorf("audit events = %d, want none", len(as.events))
+				}
+				return
+			}
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != `Bearer realm="scim"` {
+				t.Errorf("WWW-Authenticate = %q", got)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/scim+json" {
+				t.Errorf("Content-Type = %q, want application/scim+json", got)
+			}
+			var body viewmodel.SCIMErrorResp
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%v: %s", err, w.Body)
+			}
+			if len(body.Schemas) != 1 || body.Schemas[0] != viewmodel.SCIMSchemaError || body.Status != "401" {
+				t.Errorf("body = %+v, want a SCIM error with status 401", body)
+			}
+			if len(as.events) != 1 || as.events[0].Outcome != model.AuditOutcomeFailure {
+				t.Errorf("audit events = %+v, want one failure", as.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config HTTPサーバの設定
+type Config struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	TLSCertFile     string
+	TLSKeyFile      string
+	// TLSReloadInterval 証明書ファイルの更新確認間隔
+	TLSReloadInterval time.Duration
+	// TLSClientCAFile 設定した場合はクライアント証明書を検証する（mTLS）
+	TLSClientCAFile string
+	TLSClientAuth   string
+}
+
+// Server HTTPサーバのライフサイクルを管理します
+type Server struct {
+	srv *http.Server
+	cfg Config
+	cr  *certReloader
+}
+
+// New Serverを生成します
+func New(h http.Handler, cfg Config) (*Server, error) {
+	s := &Server{
+		srv: &http.Server{
+			Addr:         cfg.Addr,
+			Handler:      h,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		},
+		cfg: cfg,
+	}
+	if cfg.TLSCertFile != "" {
+		cr, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc, err := newTLSConfig(cfg, cr)
+		if err != nil {
+			return nil, err
+		}
+		s.cr, s.srv.TLSConfig = cr, tc
+	}
+	return s, nil
+}
+
+// Run ctxが終了するまでリクエストを受け付け、終了後は処理中のリクエストをShutdownTimeoutまで待ちます
+func (s *Server) Run(ctx context.Context) error {
+	if s.cr != nil && s.cfg.TLSReloadInterval > 0 {
+		wctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go s.cr.watch(wctx, s.cfg.TLSReloadInterval)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if s.cr != nil {
+			log.Default().Printf("listening on %s (TLS)", s.cfg.Addr)
+			// 証明書はTLSConfig.GetCertificateから取得する
+			err = s.srv.ListenAndServeTLS("", "")
+		} else {
+			log.Default().Printf("listening on %s", s.cfg.Addr)
+			err = s.srv.ListenAndServe()
+		}
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		// 起動失敗など、シグナル以外で終了した場合
+		return errors.WithStack(err)
+	case <-ctx.Done():
+	}
+
+	log.Default().Println("shutting down server")
+	sctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(sctx); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := <-errCh; err != nil && err != http.ErrServerClosed {
+		return errors.WithStack(err)
+	}
+	return nil
+}
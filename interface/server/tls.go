@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// クライアント証明書の要求方法
+const (
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// certReloader 証明書ファイルの更新を検知して読み込み直します
+type certReloader struct {
+	mu                sync.RWMutex
+	cert              *tls.Certificate
+	certFile, keyFile string
+	modTime           time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate tls.Config.GetCertificateに設定します
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	mt, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert, cr.modTime = &cert, mt
+	return nil
+}
+
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{cr.certFile, cr.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, errors.WithStack(err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// watch ctxが終了するまで、interval毎にファイルの更新日時を確認します
+func (cr *certReloader) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			mt, err := cr.latestModTime()
+			cr.mu.RLock()
+			changed := err == nil && !mt.Equal(cr.modTime)
+			cr.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			// 書き換え途中で失敗した場合は前回の証明書を使い続け、次回再試行する
+			if err := cr.reload(); err != nil {
+				log.Default().Printf("%+v", err)
+				continue
+			}
+			log.Default().Printf("reloaded TLS certificate %s", cr.certFile)
+		}
+	}
+}
+
+func newTLSConfig(cfg Config, cr *certReloader) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cr.GetCertificate,
+	}
+	if cfg.TLSClientCAFile == "" {
+		return tc, nil
+	}
+	pem, err := ioutil.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.WithStack(fmt.Errorf("no certificates found in %s", cfg.TLSClientCAFile))
+	}
+	tc.ClientCAs = pool
+	switch cfg.TLSClientAuth {
+	case ClientAuthRequire:
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional, "":
+		// ブラウザなどJWTで認証するクライアントも受け付ける
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, errors.WithStack(fmt.Errorf("unknown client auth mode %q", cfg.TLSClientAuth))
+	}
+	return tc, nil
+}
+
+// クライアント証明書のサブジェクトCN/SANをサービスIDに対応付けます
+type certIdentityMapper struct {
+	rules map[string]string
+}
+
+// NewCertIdentityMapper "名前=サービスID" 形式の対応表からServiceIdentityMapperを生成します
+//
+// 名前にはサブジェクトのCN、DNS/URI/メールアドレスのSANのいずれかを指定します。
+func NewCertIdentityMapper(rules []string) (proxy.ServiceIdentityMapper, error) {
+	m := &certIdentityMapper{rules: make(map[string]string, len(rules))}
+	for _, r := range rules {
+		kv := strings.SplitN(r, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.WithStack(fmt.Errorf("invalid service identity rule %q", r))
+		}
+		m.rules[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+// MapCertificate 検証済みのクライアント証明書からサービスIDを取得します
+func (m *certIdentityMapper) MapCertificate(cert *x509.Certificate) (string, bool) {
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	for _, n := range names {
+		if id, ok := m.rules[n]; ok && n != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
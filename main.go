@@ -1,46 +1,227 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/taniyuu/gin-cognito-sample/application/usecase"
+	"github.com/taniyuu/gin-cognito-sample/config"
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
 	awsWrapper "github.com/taniyuu/gin-cognito-sample/infrastructure/aws"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/file"
+	ldapWrapper "github.com/taniyuu/gin-cognito-sample/infrastructure/ldap"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/mail"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/memory"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/oidc"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/password"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/rdb"
+	redisStore "github.com/taniyuu/gin-cognito-sample/infrastructure/redis"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/token"
+	"github.com/taniyuu/gin-cognito-sample/infrastructure/webhook"
 	"github.com/taniyuu/gin-cognito-sample/interface/handler"
 	"github.com/taniyuu/gin-cognito-sample/interface/middleware"
+	"github.com/taniyuu/gin-cognito-sample/interface/server"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	err := godotenv.Load()
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatalf("%+v", err)
 	}
+	log.Default().Printf("effective config:\n%s", cfg.Redacted())
 
-	cp := awsWrapper.NewCognitoProxy(
-		os.Getenv("COGNITO_POOL_ID"), os.Getenv("COGNITO_CLIENT_ID"), os.Getenv("COGNITO_CLIENT_SECRET"))
-	ap := awsWrapper.NewCognitoAuthorizar(os.Getenv("COGNITO_REGION"), os.Getenv("COGNITO_POOL_ID"), os.Getenv("COGNITO_CLIENT_ID"))
-	uu := usecase.NewUserUsecase(cp)
-	uh, am := handler.NewUserHandler(uu), middleware.NewAuthzMiddleware(ap)
+	// シグナル受信でサーバを停止し、リクエストの処理完了後にバックグラウンド処理を停止する
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var mailer proxy.Mailer
+	if cfg.Mail.SMTPAddr != "" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPAddr, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		mailer = mail.NewLogMailer()
+	}
+	up, ti := newUserProxy(workerCtx, cfg, mailer)
+	ap := newAuthorizar(workerCtx, cfg, ti)
+	as := newAuditSink(&cfg.Audit)
+	// /readyzで確認する依存先（メモリ上のストア、ファイルの監査ログ、自身で発行したIDトークンの検証は確認しない）
+	var checkers healthCheckers
+	checkers.add(up)
+	if ap != ti {
+		checkers.add(ap)
+	}
+	if cfg.Audit.DBDriver != "" {
+		checkers.add(as)
+	}
+	var sm proxy.ServiceIdentityMapper
+	if len(cfg.Server.ServiceIdentities) > 0 {
+		if sm, err = server.NewCertIdentityMapper(cfg.Server.ServiceIdentities); err != nil {
+			log.Fatalf("%+v", err)
+		}
+	}
+
+	var rc redis.UniversalClient
+	if cfg.Redis.Addr != "" {
+		rc = redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+	}
+	var ls proxy.LockoutStore
+	if cfg.Lockout.Store == config.StoreRedis {
+		ls = redisStore.NewLockoutStore(rc, "lockout:")
+		checkers.add(ls)
+	} else {
+		ls = memory.NewLockoutStore(workerCtx)
+	}
+	var rs proxy.RevocationStore
+	if cfg.Revocation.Store == config.StoreRedis {
+		rs = redisStore.NewRevocationStore(rc, "revocation:")
+		checkers.add(rs)
+	} else {
+		rs = memory.NewRevocationStore(workerCtx)
+	}
+	var ds proxy.DeviceActivityStore
+	if cfg.Device.ActivityStore == config.StoreRedis {
+		ds = redisStore.NewDeviceActivityStore(rc, "device:")
+		checkers.add(ds)
+	} else {
+		ds = memory.NewDeviceActivityStore(workerCtx)
+	}
+	var ep proxy.EventPublisher
+	var wh *handler.WebhookHandler
+	if len(cfg.Webhook.Endpoints) > 0 {
+		var ob proxy.WebhookOutbox
+		ep, ob = newWebhookDispatcher(workerCtx, &cfg.Webhook)
+		checkers.add(ep)
+		wh = handler.NewWebhookHandler(usecase.NewWebhookUsecase(ob, as))
+	}
+	su := usecase.NewSessionUsecase(usecase.NewUserUsecase(up, as, rs, ep, cfg.Revocation.TokenTTL), up, ds, as, cfg.Device.ActivityTTL)
+	var uu usecase.UserUsecase = su
+	if cfg.EnumerationProtection {
+		uu = usecase.NewEnumerationSafeUsecase(uu, mailer, cfg.EnumerationMinResponse)
+	}
+	lu := usecase.NewLockoutUsecase(uu, ls, as, usecase.LockoutPolicy{
+		AccountMaxFailures: cfg.Lockout.AccountMaxFailures,
+		IPMaxFailures:      cfg.Lockout.IPMaxFailures,
+		BaseDelay:          cfg.Lockout.BaseDelay,
+		MaxDelay:           cfg.Lockout.MaxDelay,
+		LockoutDuration:    cfg.Lockout.Duration,
+		ResetAfter:         cfg.Lockout.ResetAfter,
+	})
+	var bc proxy.BreachedPasswordChecker
+	if cfg.Password.BreachedFile != "" {
+		if bc, err = file.NewBreachedPasswordChecker(cfg.Password.BreachedFile); err != nil {
+			log.Fatalf("%+v", err)
+		}
+	}
+	pv := handler.NewPasswordValidator(model.PasswordPolicy{
+		MinLength:        cfg.Password.MinLength,
+		MaxLength:        cfg.Password.MaxLength,
+		RequireUpper:     cfg.Password.RequireUpper,
+		RequireLower:     cfg.Password.RequireLower,
+		RequireDigit:     cfg.Password.RequireDigit,
+		RequireSymbol:    cfg.Password.RequireSymbol,
+		DisallowPersonal: cfg.Password.DisallowPersonal,
+	}, bc)
+	uh, lh, am := handler.NewUserHandler(lu, pv), handler.NewLockoutHandler(lu), middleware.NewAuthzMiddleware(ap, as, sm, rs, cfg.AdminGroups)
+	sh := handler.NewSessionHandler(su)
+	var rls proxy.RateLimitStore
+	if cfg.RateLimit.Store == config.StoreRedis {
+		rls = redisStore.NewRateLimitStore(rc, "ratelimit:")
+		checkers.add(rls)
+	} else {
+		rls = memory.NewRateLimitStore(workerCtx)
+	}
+	var mh *handler.MagicLinkHandler
+	if cfg.MagicLink.Secret != "" {
+		var rps proxy.ReplayStore
+		if cfg.MagicLink.ReplayStore == config.StoreRedis {
+			rps = redisStore.NewReplayStore(rc, "magiclink:")
+			checkers.add(rps)
+		} else {
+			rps = memory.NewReplayStore(workerCtx)
+		}
+		mh = handler.NewMagicLinkHandler(usecase.NewMagicLinkUsecase(
+			up, token.NewHMACMagicLinkTokenizer(cfg.MagicLink.Secret), rps, mailer, as,
+			cfg.MagicLink.URL, cfg.MagicLink.TTL))
+	}
+	var oh *handler.OAuthHandler
+	if cfg.OAuth.Domain != "" {
+		var oss proxy.OAuthStateStore
+		if cfg.OAuth.StateStore == config.StoreRedis {
+			oss = redisStore.NewOAuthStateStore(rc, "oauth:")
+			checkers.add(oss)
+		} else {
+			oss = memory.NewOAuthStateStore(workerCtx)
+		}
+		op := awsWrapper.NewHostedUIProxy(
+			cfg.OAuth.Domain, cfg.Cognito.ClientID, cfg.Cognito.ClientSecret, cfg.OAuth.RedirectURI, cfg.OAuth.Scopes)
+		oh = handler.NewOAuthHandler(usecase.NewOAuthUsecase(op, oss, as, cfg.OAuth.IdentityProviders, cfg.OAuth.StateTTL))
+	}
+	rm := middleware.NewRateLimitMiddleware(rls,
+		middleware.RateLimit{PerMinute: cfg.RateLimit.IPPerMinute, Burst: cfg.RateLimit.IPBurst},
+		middleware.RateLimit{PerMinute: cfg.RateLimit.AccountPerMinute, Burst: cfg.RateLimit.AccountBurst})
+	var scimh *handler.SCIMHandler
+	if cfg.SCIM.Token != "" {
+		adp, ok := up.(proxy.UserAdminProxy)
+		if !ok {
+			log.Fatalf("AUTH_BACKEND=%s does not support SCIM provisioning", cfg.Backend)
+		}
+		scimh = handler.NewSCIMHandler(usecase.NewSCIMUsecase(
+			adp, as, rs, ep, cfg.Revocation.TokenTTL, cfg.SCIM.BaseURL, cfg.SCIM.SendInvitation))
+	}
+	hh := handler.NewHealthHandler(cfg.Server.ReadinessCacheTTL, checkers...)
 
 	engine := gin.Default()
+	// ginは既定で全ての接続元のX-Forwarded-Forを信頼するため、指定したプロキシ以外はクライアントIPの詐称を許さない
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	engine.Use(middleware.Actor())
 	// 認可なしエンドポイント
 	engine.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "hello world",
 		})
 	})
-	engine.POST("/signup", uh.Create)
-	engine.POST("/confirm-signup", uh.Confirm)
-	engine.POST("/signin", uh.Signin)
-	engine.POST("/refresh-token", uh.Refresh)
-	engine.POST("/forgot-password", uh.ForgotPassword)
-	engine.POST("/confirm-forgot-password", uh.ConfirmForgotPassword)
-	engine.POST("/signout", uh.Signout)
-	engine.POST("/respond-to-invitation", uh.RespondToInvitation)
+	engine.GET("/healthz", hh.Liveness)
+	engine.GET("/readyz", hh.Readiness)
+	if ti != nil {
+		wh := handler.NewWellKnownHandler(ti, cfg.LocalJWT.Issuer)
+		engine.GET("/.well-known/jwks.json", wh.JWKS)
+		engine.GET("/.well-known/openid-configuration", wh.OpenIDConfiguration)
+	}
+	engine.POST("/signup", rm.Limit(), uh.Create)
+	engine.POST("/confirm-signup", rm.Limit(), uh.Confirm)
+	engine.POST("/resend-confirmation-code", rm.Limit(), uh.ResendConfirmationCode)
+	engine.POST("/signin", rm.Limit(), uh.Signin)
+	engine.POST("/refresh-token", rm.Limit(), uh.Refresh)
+	engine.POST("/forgot-password", rm.Limit(), uh.ForgotPassword)
+	engine.POST("/passwordless/start", rm.Limit(), uh.PasswordlessStart)
+	engine.POST("/passwordless/verify", rm.Limit(), uh.PasswordlessVerify)
+	if mh != nil {
+		engine.POST("/magic-link/start", rm.Limit(), mh.Start)
+		engine.GET("/magic-link/callback", rm.Limit(), mh.Callback)
+	}
+	if oh != nil {
+		engine.GET("/oauth/login", rm.Limit(), oh.Login)
+		engine.GET("/oauth/callback", oh.Callback)
+	}
+	engine.POST("/confirm-forgot-password", rm.Limit(), uh.ConfirmForgotPassword)
+	// IDトークンが添えられていれば、そのトークンも失効させる
+	engine.POST("/signout", am.OptionalAuthorization(), uh.Signout)
+	engine.POST("/respond-to-invitation", rm.Limit(), uh.RespondToInvitation)
 	// 認可エンドポイント
 	authz := engine.Group("/", am.Authorization())
 	{
@@ -52,8 +233,220 @@ func main() {
 		authz.GET("/profile", uh.GetProfile)
 		authz.PUT("/profile", uh.ChangeProfile)
 		authz.POST("/change-password", uh.ChangePassword)
-		authz.POST("/invite", uh.Invite)
-		authz.GET("/users/:id", uh.GetUser)
+		authz.POST("/global-signout", uh.GlobalSignout)
+		authz.GET("/sessions", sh.List)
+		authz.PUT("/sessions/:device_key", sh.Update)
+		authz.DELETE("/sessions/:device_key", sh.Forget)
+	}
+	// 管理エンドポイント（ADMIN_GROUPSのユーザか、mTLSのサービス認証のみ）
+	admin := engine.Group("/", am.AdminAuthorization())
+	{
+		admin.POST("/invite", uh.Invite)
+		admin.GET("/users/:id", uh.GetUser)
+		admin.POST("/users/:id/disable", uh.DisableUser)
+		admin.POST("/unlock", lh.Unlock)
+		if wh != nil {
+			admin.GET("/webhooks/deliveries", wh.ListDeliveries)
+			admin.POST("/webhooks/replay", wh.Replay)
+		}
+	}
+	// SCIMエンドポイント（IdPと共有したベアラートークンで認証する）
+	if scimh != nil {
+		scim := engine.Group("/scim/v2", middleware.SCIMAuthorization(cfg.SCIM.Token, as))
+		scim.GET("/Users", scimh.ListUsers)
+		scim.POST("/Users", scimh.CreateUser)
+		scim.GET("/Users/:id", scimh.GetUser)
+		scim.PUT("/Users/:id", scimh.ReplaceUser)
+		scim.PATCH("/Users/:id", scimh.PatchUser)
+		scim.DELETE("/Users/:id", scimh.DeleteUser)
+		scim.GET("/Groups", scimh.ListGroups)
+		scim.POST("/Groups", scimh.CreateGroup)
+		scim.GET("/Groups/:id", scimh.GetGroup)
+		scim.PUT("/Groups/:id", scimh.ReplaceGroup)
+		scim.PATCH("/Groups/:id", scimh.PatchGroup)
+		scim.DELETE("/Groups/:id", scimh.DeleteGroup)
+		scim.GET("/ServiceProviderConfig", scimh.ServiceProviderConfig)
+		scim.GET("/Schemas", scimh.ListSchemas)
+		scim.GET("/Schemas/:id", scimh.GetSchema)
+		scim.GET("/ResourceTypes", scimh.ListResourceTypes)
+		scim.GET("/ResourceTypes/:id", scimh.GetResourceType)
+	}
+
+	srv, err := server.New(engine, server.Config{
+		Addr:              cfg.Server.Addr,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ShutdownTimeout:   cfg.Server.ShutdownTimeout,
+		TLSCertFile:       cfg.Server.TLSCertFile,
+		TLSKeyFile:        cfg.Server.TLSKeyFile,
+		TLSReloadInterval: cfg.Server.TLSReloadInterval,
+		TLSClientCAFile:   cfg.Server.TLSClientCAFile,
+		TLSClientAuth:     cfg.Server.TLSClientAuth,
+	})
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	if err := srv.Run(ctx); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	stopWorkers()
+	log.Default().Println("server stopped")
+}
+
+// healthCheckers /readyzで確認する依存先
+type healthCheckers []proxy.HealthChecker
+
+// add depを確認対象に加えます（HealthCheckerを実装していなければ起動しない）
+func (hcs *healthCheckers) add(dep interface{}) {
+	hc, ok := dep.(proxy.HealthChecker)
+	if !ok {
+		log.Fatalf("%T does not implement HealthChecker", dep)
+	}
+	*hcs = append(*hcs, hc)
+}
+
+// newUserProxy 設定に応じた認証バックエンドを生成します（Cognito以外の場合はIDトークンを発行するTokenIssuerも返す）
+func newUserProxy(ctx context.Context, cfg *config.Config, mailer proxy.Mailer) (proxy.UserProxy, proxy.TokenIssuer) {
+	if cfg.Backend == config.BackendCognito {
+		return awsWrapper.NewCognitoProxy(cfg.Cognito.PoolID, cfg.Cognito.ClientID, cfg.Cognito.ClientSecret, cfg.Cognito.AuthFlow,
+			newLegacyUserStore(&cfg.Legacy)), nil
+	}
+	var keyPEM []byte
+	var err error
+	if cfg.LocalJWT.KeyFile != "" {
+		keyPEM, err = ioutil.ReadFile(cfg.LocalJWT.KeyFile)
+	} else {
+		log.Default().Println("LOCAL_JWT_KEY_FILE is not set, ID tokens are signed with a temporary key")
+		keyPEM, err = token.GenerateKeyPEM()
+	}
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	ti, err := token.NewLocalIssuer(keyPEM, cfg.LocalJWT.Issuer, cfg.LocalJWT.Audience, cfg.LocalJWT.TTL)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	if cfg.Backend == config.BackendLDAP {
+		return ldapWrapper.NewDirectoryProxy(ldapWrapper.DirectoryOptions{
+			URL:            cfg.LDAP.URL,
+			StartTLS:       cfg.LDAP.StartTLS,
+			BindDN:         cfg.LDAP.BindDN,
+			BindPassword:   cfg.LDAP.BindPassword,
+			BaseDN:         cfg.LDAP.BaseDN,
+			UserFilter:     cfg.LDAP.UserFilter,
+			SubAttribute:   cfg.LDAP.SubAttribute,
+			EmailAttribute: cfg.LDAP.EmailAttribute,
+			NameAttribute:  cfg.LDAP.NameAttribute,
+			GroupAttribute: cfg.LDAP.GroupAttribute,
+			Timeout:        cfg.LDAP.Timeout,
+		}, ti), ti
+	}
+	hasher, err := password.NewHasher(cfg.SQL.PasswordHash)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	db, err := sql.Open(cfg.SQL.Driver, cfg.SQL.DSN)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	up, err := rdb.NewSQLUserProxy(ctx, db, hasher, ti, mailer, rdb.SQLUserOptions{
+		ConfirmationCodeTTL: cfg.SQL.ConfirmationCodeTTL,
+		ResetCodeTTL:        cfg.SQL.ResetCodeTTL,
+		InvitationTTL:       cfg.SQL.InvitationTTL,
+		RefreshTokenTTL:     cfg.SQL.RefreshTokenTTL,
+	})
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	return up, ti
+}
+
+// newLegacyUserStore ログイン時にCognitoへ移行するアカウントの移行元を生成します（設定がない場合はnil）
+func newLegacyUserStore(cfg *config.LegacyConfig) proxy.LegacyUserStore {
+	if cfg.DSN == "" {
+		return nil
+	}
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	hasher, err := password.NewHasher(password.AlgorithmBcrypt)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	ls, err := rdb.NewSQLLegacyUserStore(db, cfg.Query, hasher)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	return ls
+}
+
+// newAuthorizar 設定に応じたIDトークンの検証方式を生成します（tiはCognito以外のバックエンドの場合のみ）
+func newAuthorizar(ctx context.Context, cfg *config.Config, ti proxy.TokenIssuer) proxy.AuthorizarProxy {
+	switch {
+	case cfg.Authorizer == config.AuthorizerOIDC:
+		// 設定の検証で確認済みのため、ここではエラーにならない
+		ics, err := cfg.OIDC.IssuerConfigs()
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		issuers := make([]oidc.Issuer, 0, len(ics))
+		for _, ic := range ics {
+			issuers = append(issuers, oidc.Issuer{
+				Issuer:      ic.Issuer,
+				Audiences:   ic.Audiences,
+				SubClaim:    ic.SubClaim,
+				EmailClaim:  ic.EmailClaim,
+				GroupsClaim: ic.GroupsClaim,
+			})
+		}
+		return oidc.NewOIDCAuthorizar(ctx, issuers)
+	case cfg.Authorizer == config.AuthorizerLocal, cfg.Authorizer == "" && ti != nil:
+		return ti
+	}
+	return awsWrapper.NewCognitoAuthorizar(ctx, cfg.Cognito.Region, cfg.Cognito.PoolID, cfg.Cognito.ClientID)
+}
+
+// newWebhookDispatcher アウトボックスに保存してWebhookを配信するEventPublisherを生成します
+func newWebhookDispatcher(ctx context.Context, cfg *config.WebhookConfig) (proxy.EventPublisher, proxy.WebhookOutbox) {
+	endpoints, err := webhook.ParseEndpoints(cfg.Endpoints, cfg.Secrets, cfg.Events)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	db, err := sql.Open(cfg.OutboxDriver, cfg.OutboxDSN)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	ob, err := rdb.NewSQLWebhookOutbox(db)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	return webhook.NewDispatcher(ctx, ob, endpoints, webhook.Policy{
+		MaxAttempts:  cfg.MaxAttempts,
+		BaseDelay:    cfg.BaseDelay,
+		MaxDelay:     cfg.MaxDelay,
+		Timeout:      cfg.Timeout,
+		PollInterval: cfg.PollInterval,
+	}), ob
+}
+
+// newAuditSink 設定に応じた監査ログの書き込み先を生成します
+func newAuditSink(cfg *config.AuditConfig) proxy.AuditSink {
+	if cfg.DBDriver != "" {
+		db, err := sql.Open(cfg.DBDriver, cfg.DBDSN)
+		if err != nil {
+			log.Fatal(err)
+		}
+		as, err := rdb.NewSQLAuditSink(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return as
+	}
+	as, err := file.NewJSONLinesAuditSink(cfg.LogFile)
+	if err != nil {
+		log.Fatal(err)
 	}
-	engine.Run(":3000")
+	return as
 }
@@ -0,0 +1,149 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+)
+
+const customChallengeName = "CUSTOM_CHALLENGE"
+
+// 認証方法のチャレンジに付けるメタデータと、非公開パラメータのキー
+const (
+	methodChallengeMetadata = "METHOD"
+	privateMethodKey        = "method"
+)
+
+// Challenge 認証方法毎に作成するチャレンジ
+type Challenge struct {
+	Public, Private map[string]string
+	// Metadata 同じセッションの次のチャレンジ作成時に参照できる値（クライアントには返らない）
+	Metadata string
+}
+
+// ChallengeMethod CUSTOM_AUTHの認証方法毎のチャレンジの作成と検証を抽象化します
+type ChallengeMethod interface {
+	// Create チャレンジを作成します（prevは同じセッションで前回作成したチャレンジのメタデータ、初回は空）
+	Create(ctx context.Context, userAttributes map[string]string, clientMetadata map[string]string, prev string) (*Challenge, error)
+	// Verify 回答を検証します
+	Verify(ctx context.Context, private map[string]string, answer string) (bool, error)
+}
+
+// CustomAuth CUSTOM_AUTHのDefine/Create/Verify Auth Challengeトリガ
+//
+// 最初のチャレンジで認証方法（Methodsのキー）を回答させ、以降は選ばれた認証方法のチャレンジを行います。
+// InitiateAuthのClientMetadataはCreate Auth Challengeに渡らないため、認証方法は回答時のClientMetadataで受け取ります。
+type CustomAuth struct {
+	Methods map[string]ChallengeMethod
+	// MaxAttempts 認証方法のチャレンジに回答できる回数
+	MaxAttempts int
+}
+
+// DefineAuthChallenge これまでの回答から、次のチャレンジ、トークンの発行、認証の失敗を決めます
+func (ca *CustomAuth) DefineAuthChallenge(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsDefineAuthChallenge,
+) (*events.CognitoEventUserPoolsDefineAuthChallenge, error) {
+	s := ev.Request.Session
+	fail := func() (*events.CognitoEventUserPoolsDefineAuthChallenge, error) {
+		ev.Response.IssueTokens, ev.Response.FailAuthentication = false, true
+		return ev, nil
+	}
+	if ev.Request.UserNotFound {
+		return fail()
+	}
+	for _, r := range s {
+		// SRPなど他のチャレンジとの組み合わせは扱わない
+		if r.ChallengeName != customChallengeName {
+			return fail()
+		}
+	}
+	switch {
+	case len(s) == 0:
+		// 認証方法の選択
+	case !s[0].ChallengeResult:
+		return fail()
+	case len(s) > 1 && s[len(s)-1].ChallengeResult:
+		ev.Response.IssueTokens, ev.Response.FailAuthentication = true, false
+		return ev, nil
+	case len(s)-1 >= ca.MaxAttempts:
+		return fail()
+	}
+	ev.Response.ChallengeName = customChallengeName
+	ev.Response.IssueTokens, ev.Response.FailAuthentication = false, false
+	return ev, nil
+}
+
+// CreateAuthChallenge 最初は認証方法の選択、以降は認証方法のチャレンジを作成します
+func (ca *CustomAuth) CreateAuthChallenge(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsCreateAuthChallenge,
+) (*events.CognitoEventUserPoolsCreateAuthChallenge, error) {
+	if ev.Request.ChallengeName != customChallengeName {
+		return ev, nil
+	}
+	s := ev.Request.Session
+	if len(s) == 0 {
+		ev.Response.PublicChallengeParameters = map[string]string{
+			model.CustomChallengeStepKey: model.CustomChallengeStepMethod,
+		}
+		ev.Response.PrivateChallengeParameters = map[string]string{
+			model.CustomChallengeStepKey: model.CustomChallengeStepMethod,
+		}
+		ev.Response.ChallengeMetadata = methodChallengeMetadata
+		return ev, nil
+	}
+
+	name := ev.Request.ClientMetadata[model.CustomAuthMethodKey]
+	m, ok := ca.Methods[name]
+	if !ok {
+		return nil, errors.WithStack(fmt.Errorf("unknown custom auth method %q", name))
+	}
+	prev := ""
+	if len(s) > 1 {
+		prev = s[len(s)-1].ChallengeMetadata
+	}
+	ch, err := m.Create(ctx, ev.Request.UserAttributes, ev.Request.ClientMetadata, prev)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Private == nil {
+		ch.Private = map[string]string{}
+	}
+	ch.Private[privateMethodKey] = name
+	ev.Response.PublicChallengeParameters = ch.Public
+	ev.Response.PrivateChallengeParameters = ch.Private
+	ev.Response.ChallengeMetadata = ch.Metadata
+	return ev, nil
+}
+
+// VerifyAuthChallenge 回答を検証します
+func (ca *CustomAuth) VerifyAuthChallenge(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsVerifyAuthChallenge,
+) (*events.CognitoEventUserPoolsVerifyAuthChallenge, error) {
+	answer, _ := ev.Request.ChallengeAnswer.(string)
+	private := ev.Request.PrivateChallengeParameters
+	if private[model.CustomChallengeStepKey] == model.CustomChallengeStepMethod {
+		_, ok := ca.Methods[answer]
+		ev.Response.AnswerCorrect = ok
+		return ev, nil
+	}
+	m, ok := ca.Methods[private[privateMethodKey]]
+	if !ok {
+		ev.Response.AnswerCorrect = false
+		return ev, nil
+	}
+	correct, err := m.Verify(ctx, private, answer)
+	if err != nil {
+		// 検証できない場合は誤りとして扱う
+		log.Default().Printf("%+v", err)
+	}
+	ev.Response.AnswerCorrect = correct && err == nil
+	return ev, nil
+}
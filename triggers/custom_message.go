@@ -0,0 +1,95 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// カスタムメッセージトリガのtriggerSourceとテンプレートの種類
+var customMessageKinds = map[string]string{
+	"CustomMessage_SignUp":              MessageSignUp,
+	"CustomMessage_ResendCode":          MessageSignUp,
+	"CustomMessage_ForgotPassword":      MessageForgotPassword,
+	"CustomMessage_UpdateUserAttribute": MessageVerifyAttribute,
+	"CustomMessage_VerifyUserAttribute": MessageVerifyAttribute,
+	"CustomMessage_AdminCreateUser":     MessageInvitation,
+	"CustomMessage_Authentication":      MessageMFA,
+}
+
+// ロケールを指定するclientMetadataのキー（ユーザのlocale属性がない場合に使う）
+const localeMetadataKey = "locale"
+
+// CustomMessage Cognitoが送る確認コード、招待、MFAのメッセージをユーザのロケールのテンプレートで作るCustom Messageトリガ
+//
+// テンプレートがない種類、またはテンプレートで定義していない部分はCognitoの既定のメッセージのままにします。
+type CustomMessage struct {
+	Templates *Templates
+	AppName   string
+}
+
+// CustomMessage メッセージを作ります
+func (cm *CustomMessage) CustomMessage(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsCustomMessage,
+) (*events.CognitoEventUserPoolsCustomMessage, error) {
+	kind, ok := customMessageKinds[ev.TriggerSource]
+	if !ok {
+		return ev, nil
+	}
+	attrs := ev.Request.UserAttributes
+	data := &MessageData{
+		Code:     ev.Request.CodeParameter,
+		Username: ev.Request.UsernameParameter,
+		Name:     stringAttribute(attrs, "name"),
+		Email:    stringAttribute(attrs, "email"),
+		AppName:  cm.AppName,
+	}
+	m, err := cm.Templates.Render(kind, messageLocale(stringAttribute(attrs, "locale"), ev.Request.ClientMetadata), data, true)
+	if err != nil || m == nil {
+		return ev, err
+	}
+	// プレースホルダがないメッセージはCognitoが拒否するため、ここでテンプレートの誤りとして返す
+	for _, s := range []string{m.Email, m.SMS} {
+		if err := checkPlaceholders(s, data); err != nil {
+			return nil, err
+		}
+	}
+	if m.Email != "" {
+		ev.Response.EmailMessage = m.Email
+		ev.Response.EmailSubject = m.Subject
+	}
+	if m.SMS != "" {
+		ev.Response.SMSMessage = m.SMS
+	}
+	return ev, nil
+}
+
+func checkPlaceholders(s string, data *MessageData) error {
+	if s == "" {
+		return nil
+	}
+	for _, p := range []string{data.Code, data.Username} {
+		if p != "" && !strings.Contains(s, p) {
+			return errors.WithStack(fmt.Errorf("custom message does not contain the placeholder %q", p))
+		}
+	}
+	return nil
+}
+
+// messageLocale ユーザのlocale属性、clientMetadataのlocaleの順に使います
+func messageLocale(attr string, clientMetadata map[string]string) string {
+	if attr != "" {
+		return attr
+	}
+	return clientMetadata[localeMetadataKey]
+}
+
+// stringAttribute カスタムメッセージのuserAttributesは文字列以外も含むため、文字列の属性だけを返します
+func stringAttribute(attrs map[string]interface{}, name string) string {
+	s, _ := attrs[name].(string)
+	return s
+}
@@ -0,0 +1,96 @@
+package triggers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// コードを保持するチャレンジのメタデータの接頭辞（CODE-<コード>-<有効期限のUNIX時間>）
+const codeMetadataPrefix = "CODE-"
+
+// EmailOTP メールで送ったワンタイムコードで認証します
+//
+// 誤った回答の後の再チャレンジでは、有効期限内であれば同じコードを使い、メールは再送しません。
+type EmailOTP struct {
+	Mailer     proxy.Mailer
+	CodeLength int
+	TTL        time.Duration
+}
+
+// Create コードを生成してメールで送ります
+func (eo *EmailOTP) Create(ctx context.Context, userAttributes map[string]string, clientMetadata map[string]string, prev string) (*Challenge, error) {
+	code, expires, ok := parseCodeMetadata(prev)
+	if !ok || !time.Now().Before(expires) {
+		var err error
+		if code, err = eo.newCode(); err != nil {
+			return nil, err
+		}
+		expires = time.Now().Add(eo.TTL)
+		email := userAttributes["email"]
+		if email == "" {
+			return nil, errors.WithStack(fmt.Errorf("user has no email attribute"))
+		}
+		if err := eo.Mailer.Send(ctx, &model.Mail{
+			To:      email,
+			Subject: "Your sign-in code",
+			Body: fmt.Sprintf("Your sign-in code is %s\nIt expires in %s.\n"+
+				"If you did not try to sign in, you can ignore this email.\n", code, eo.TTL),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return &Challenge{
+		Public:   map[string]string{model.CustomAuthMethodKey: model.CustomAuthMethodEmailOTP},
+		Private:  map[string]string{"code": code, "expires_at": exp},
+		Metadata: codeMetadataPrefix + code + "-" + exp,
+	}, nil
+}
+
+// Verify コードと有効期限を検証します
+func (eo *EmailOTP) Verify(ctx context.Context, private map[string]string, answer string) (bool, error) {
+	exp, err := strconv.ParseInt(private["expires_at"], 10, 64)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if !time.Now().Before(time.Unix(exp, 0)) {
+		return false, nil
+	}
+	code := private["code"]
+	return code != "" && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(answer)), []byte(code)) == 1, nil
+}
+
+func (eo *EmailOTP) newCode() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(eo.CodeLength)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return fmt.Sprintf("%0*d", eo.CodeLength, n), nil
+}
+
+func parseCodeMetadata(m string) (string, time.Time, bool) {
+	if !strings.HasPrefix(m, codeMetadataPrefix) {
+		return "", time.Time{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(m, codeMetadataPrefix), "-", 2)
+	if len(parts) != 2 {
+		return "", time.Time{}, false
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return parts[0], time.Unix(exp, 0), true
+}
@@ -0,0 +1,117 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// Handler イベントのtriggerSourceに応じて各トリガを呼び出します
+//
+// 1つのLambda関数をユーザプールの複数のトリガに設定して使います。
+// nilのトリガのイベントは未対応のtriggerSourceとしてエラーにします。
+type Handler struct {
+	CustomAuth         *CustomAuth
+	UserMigration      *UserMigration
+	PreSignUp          *PreSignUp
+	PostConfirmation   *PostConfirmation
+	PreAuthentication  *PreAuthentication
+	PreTokenGeneration *PreTokenGeneration
+	CustomMessage      *CustomMessage
+}
+
+// Handle Lambdaのハンドラ
+func (h *Handler) Handle(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var header events.CognitoEventUserPoolsHeader
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	switch header.TriggerSource {
+	case "DefineAuthChallenge_Authentication":
+		if h.CustomAuth == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsDefineAuthChallenge)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.CustomAuth.DefineAuthChallenge(ctx, ev)
+	case "CreateAuthChallenge_Authentication":
+		if h.CustomAuth == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsCreateAuthChallenge)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.CustomAuth.CreateAuthChallenge(ctx, ev)
+	case "VerifyAuthChallengeResponse_Authentication":
+		if h.CustomAuth == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsVerifyAuthChallenge)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.CustomAuth.VerifyAuthChallenge(ctx, ev)
+	case migrateAuthentication, migrateForgotPassword:
+		if h.UserMigration == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsMigrateUser)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.UserMigration.MigrateUser(ctx, ev)
+	case preSignUpSignUp, preSignUpAdminCreateUser, preSignUpExternalProvider:
+		if h.PreSignUp == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsPreSignup)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.PreSignUp.PreSignUp(ctx, ev)
+	case postConfirmationConfirmSignUp, "PostConfirmation_ConfirmForgotPassword":
+		if h.PostConfirmation == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsPostConfirmation)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.PostConfirmation.PostConfirmation(ctx, ev)
+	case "PreAuthentication_Authentication":
+		if h.PreAuthentication == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsPreAuthentication)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.PreAuthentication.PreAuthentication(ctx, ev)
+	case "TokenGeneration_HostedAuth", "TokenGeneration_Authentication", "TokenGeneration_NewPasswordChallenge",
+		"TokenGeneration_AuthenticateDevice", "TokenGeneration_RefreshTokens":
+		if h.PreTokenGeneration == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsPreTokenGen)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.PreTokenGeneration.PreTokenGeneration(ctx, ev)
+	default:
+		if _, ok := customMessageKinds[header.TriggerSource]; !ok || h.CustomMessage == nil {
+			break
+		}
+		ev := new(events.CognitoEventUserPoolsCustomMessage)
+		if err := json.Unmarshal(raw, ev); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return h.CustomMessage.CustomMessage(ctx, ev)
+	}
+	return nil, errors.WithStack(fmt.Errorf("unsupported trigger source %q", header.TriggerSource))
+}
@@ -0,0 +1,32 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// 設定していないトリガのイベントはpanicせずに未対応のエラーになること
+func TestHandleUnconfiguredTrigger(t *testing.T) {
+	h := new(Handler)
+	for _, source := range []string{
+		"DefineAuthChallenge_Authentication",
+		"CreateAuthChallenge_Authentication",
+		"VerifyAuthChallengeResponse_Authentication",
+		migrateAuthentication,
+		preSignUpSignUp,
+		postConfirmationConfirmSignUp,
+		"PreAuthentication_Authentication",
+		"TokenGeneration_Authentication",
+		"CustomMessage_SignUp",
+	} {
+		t.Run(source, func(t *testing.T) {
+			raw, _ := json.Marshal(map[string]interface{}{"triggerSource": source, "request": map[string]interface{}{}})
+			_, err := h.Handle(context.Background(), raw)
+			if err == nil || !strings.Contains(err.Error(), "unsupported trigger source") {
+				t.Errorf("err = %v, want unsupported trigger source", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// 受け付けるイベントの大きさ（Lambdaの同期呼び出しの上限と同じ）
+const maxHarnessEventSize = 6 << 20
+
+// harnessError Lambdaが関数のエラーを返す時の形式
+type harnessError struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+// NewHarness Lambdaを使わずにトリガを確認するためのHTTPハンドラを生成します
+//
+// 任意のパスへのPOSTの本文を記録したイベントのJSONとしてHandleに渡し、返されたイベントのJSONを返します。
+// Lambda Runtime Interface Emulatorと同じ/2015-03-31/functions/function/invocationsでも受け付けます。
+// エラーは500とLambdaと同じ{"errorMessage", "errorType"}で返します。
+func NewHarness(h *Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeHarnessError(w, http.StatusMethodNotAllowed, errors.WithStack(fmt.Errorf("POST a trigger event")))
+			return
+		}
+		raw, err := ioutil.ReadAll(io.LimitReader(r.Body, maxHarnessEventSize))
+		if err != nil {
+			writeHarnessError(w, http.StatusBadRequest, errors.WithStack(err))
+			return
+		}
+		if !json.Valid(raw) {
+			writeHarnessError(w, http.StatusBadRequest, errors.WithStack(fmt.Errorf("request body is not JSON")))
+			return
+		}
+		res, err := h.Handle(r.Context(), raw)
+		if err != nil {
+			writeHarnessError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeHarnessJSON(w, http.StatusOK, res)
+	})
+}
+
+func writeHarnessError(w http.ResponseWriter, status int, err error) {
+	log.Default().Printf("%+v", err)
+	writeHarnessJSON(w, status, &harnessError{
+		ErrorMessage: errors.Cause(err).Error(),
+		ErrorType:    fmt.Sprintf("%T", errors.Cause(err)),
+	})
+}
+
+func writeHarnessJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Default().Printf("%+v", errors.WithStack(err))
+	}
+}
@@ -0,0 +1,40 @@
+package triggers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// MagicLink サーバが検証したマジックリンクのトークンを回答として受け付けます
+//
+// 使用済みかどうかはサーバで確認するため、ここでは署名、有効期限とメールアドレスの一致のみを検証します。
+type MagicLink struct {
+	Tokenizer proxy.MagicLinkTokenizer
+}
+
+// Create メールは送らず、検証に使うメールアドレスを保持します
+func (ml *MagicLink) Create(ctx context.Context, userAttributes map[string]string, clientMetadata map[string]string, prev string) (*Challenge, error) {
+	return &Challenge{
+		Public:   map[string]string{model.CustomAuthMethodKey: model.CustomAuthMethodMagicLink},
+		Private:  map[string]string{"email": userAttributes["email"]},
+		Metadata: "MAGIC_LINK",
+	}, nil
+}
+
+// Verify トークンがこのユーザに発行されたものか検証します
+func (ml *MagicLink) Verify(ctx context.Context, private map[string]string, answer string) (bool, error) {
+	claims, err := ml.Tokenizer.Parse(answer)
+	if errors.Is(err, model.ErrInvalidMagicLink) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	email := private["email"]
+	return email != "" && strings.EqualFold(claims.Email, email), nil
+}
@@ -0,0 +1,65 @@
+package triggers
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// 確認後トリガのtriggerSource（パスワードを忘れた場合の確認はPostConfirmation_ConfirmForgotPassword）
+const postConfirmationConfirmSignUp = "PostConfirmation_ConfirmSignUp"
+
+// PostConfirmation サインアップを確認したユーザを既定のグループに追加し、歓迎メールを送るPost Confirmationトリガ
+//
+// エラーを返すと確認そのものは済んだまま、クライアントにはエラーが返るため、失敗はログに書くだけにします。
+type PostConfirmation struct {
+	// Groups DefaultGroupsが空の場合はnilでよい
+	Groups        proxy.UserAdminProxy
+	DefaultGroups []string
+	// Mailer nilの場合は歓迎メールを送らない
+	Mailer    proxy.Mailer
+	Templates *Templates
+	AppName   string
+}
+
+// PostConfirmation サインアップの確認の時だけ処理します
+func (pc *PostConfirmation) PostConfirmation(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsPostConfirmation,
+) (*events.CognitoEventUserPoolsPostConfirmation, error) {
+	if ev.TriggerSource != postConfirmationConfirmSignUp {
+		return ev, nil
+	}
+	for _, g := range pc.DefaultGroups {
+		// ユーザ名はメールアドレスとは限らないため、イベントのユーザ名で追加する
+		if err := pc.Groups.AddUserToGroup(ctx, ev.UserName, g); err != nil {
+			log.Default().Printf("%+v", err)
+		}
+	}
+	if pc.Mailer != nil {
+		if err := pc.sendWelcome(ctx, ev); err != nil {
+			log.Default().Printf("%+v", err)
+		}
+	}
+	return ev, nil
+}
+
+func (pc *PostConfirmation) sendWelcome(ctx context.Context, ev *events.CognitoEventUserPoolsPostConfirmation) error {
+	attrs := ev.Request.UserAttributes
+	if attrs["email"] == "" {
+		return nil
+	}
+	m, err := pc.Templates.Render(MessageWelcome, messageLocale(attrs["locale"], ev.Request.ClientMetadata), &MessageData{
+		Name:    attrs["name"],
+		Email:   attrs["email"],
+		AppName: pc.AppName,
+	}, false)
+	if err != nil || m == nil {
+		return err
+	}
+	return pc.Mailer.Send(ctx, &model.Mail{To: attrs["email"], Subject: m.Subject, Body: m.Email})
+}
@@ -0,0 +1,48 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// PreAuthentication ドメイン、メールアドレスの確認、アプリクライアントでログインを制限するPre Authenticationトリガ
+//
+// エラーを返すとCognitoはログインを拒否し、メッセージをNotAuthorizedExceptionとして返します。
+type PreAuthentication struct {
+	// AllowedDomains 空の場合は制限しない
+	AllowedDomains []string
+	// RequireVerifiedEmail email_verifiedがtrueでないユーザを拒否する
+	RequireVerifiedEmail bool
+	// ClientIDs 空の場合は制限しない
+	ClientIDs []string
+}
+
+// PreAuthentication ログインを許可するか検証します
+func (pa *PreAuthentication) PreAuthentication(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsPreAuthentication,
+) (*events.CognitoEventUserPoolsPreAuthentication, error) {
+	if len(pa.ClientIDs) > 0 && !contains(pa.ClientIDs, ev.CallerContext.ClientID) {
+		return nil, errors.WithStack(fmt.Errorf("sign-in is not allowed for this app client"))
+	}
+	attrs := ev.Request.UserAttributes
+	if len(pa.AllowedDomains) > 0 && !domainIn(pa.AllowedDomains, attrs["email"]) {
+		return nil, errors.WithStack(fmt.Errorf("sign-in is not allowed for this email domain"))
+	}
+	if pa.RequireVerifiedEmail && attrs["email_verified"] != "true" {
+		return nil, errors.WithStack(fmt.Errorf("email address is not verified"))
+	}
+	return ev, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// サインアップ前トリガのtriggerSource
+const (
+	preSignUpSignUp           = "PreSignUp_SignUp"
+	preSignUpAdminCreateUser  = "PreSignUp_AdminCreateUser"
+	preSignUpExternalProvider = "PreSignUp_ExternalProvider"
+)
+
+// PreSignUp サインアップできるメールアドレスのドメインを制限し、指定したドメインのユーザを確認済みにするPre Sign-upトリガ
+//
+// 管理者が作成するユーザ（AdminCreateUser）は制限しません。
+// エラーを返すとCognitoはサインアップを拒否し、メッセージをUserLambdaValidationExceptionとして返します。
+type PreSignUp struct {
+	// AllowedDomains 空の場合は制限しない
+	AllowedDomains []string
+	// AutoConfirmDomains 確認コードを送らずに確認済みにし、メールアドレスも確認済みにする
+	AutoConfirmDomains []string
+}
+
+// PreSignUp ドメインを検証し、自動で確認するかを返します
+func (ps *PreSignUp) PreSignUp(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsPreSignup,
+) (*events.CognitoEventUserPoolsPreSignup, error) {
+	if ev.TriggerSource == preSignUpAdminCreateUser {
+		return ev, nil
+	}
+	email := ev.Request.UserAttributes["email"]
+	if len(ps.AllowedDomains) > 0 && !domainIn(ps.AllowedDomains, email) {
+		return nil, errors.WithStack(fmt.Errorf("sign-up is not allowed for this email domain"))
+	}
+	if domainIn(ps.AutoConfirmDomains, email) {
+		ev.Response.AutoConfirmUser = true
+		ev.Response.AutoVerifyEmail = true
+	}
+	return ev, nil
+}
+
+// domainIn メールアドレスのドメインがdomainsのいずれかと一致するか（大文字と小文字は区別しない）
+func domainIn(domains []string, email string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	domain := email[i+1:]
+	for _, d := range domains {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(d), "@"), domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+)
+
+// Cognitoが追加、変更、削除を受け付けないクレーム
+var reservedClaims = map[string]bool{
+	"acr": true, "amr": true, "aud": true, "at_hash": true, "auth_time": true, "azp": true,
+	"cognito:username": true, "cognito:groups": true, "cognito:roles": true, "cognito:preferred_role": true,
+	"exp": true, "iat": true, "identities": true, "iss": true, "jti": true, "nbf": true, "nonce": true,
+	"origin_jti": true, "sub": true, "token_use": true,
+}
+
+// PreTokenGeneration IDトークンにクレームとグループを追加するPre Token Generationトリガ
+//
+// 全てのtriggerSource（ログイン、トークンの更新、パスワードの変更等）で同じように処理します。
+type PreTokenGeneration struct {
+	// ClaimAttributes クレーム名と値を取るユーザ属性（属性が空の場合は追加しない）
+	ClaimAttributes map[string]string
+	// Claims 全てのトークンに追加するクレーム
+	Claims map[string]string
+	// Groups ユーザのグループに加えてcognito:groupsに入れるグループ
+	Groups []string
+	// SuppressClaims 除くクレーム
+	SuppressClaims []string
+}
+
+// PreTokenGeneration 追加するクレームとグループを返します
+func (pt *PreTokenGeneration) PreTokenGeneration(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsPreTokenGen,
+) (*events.CognitoEventUserPoolsPreTokenGen, error) {
+	claims := map[string]string{}
+	for k, v := range pt.Claims {
+		claims[k] = v
+	}
+	for claim, attr := range pt.ClaimAttributes {
+		if v := ev.Request.UserAttributes[attr]; v != "" {
+			claims[claim] = v
+		}
+	}
+	od := &ev.Response.ClaimsOverrideDetails
+	if len(claims) > 0 {
+		od.ClaimsToAddOrOverride = claims
+	}
+	od.ClaimsToSuppress = pt.SuppressClaims
+	if len(pt.Groups) > 0 {
+		// groupsToOverrideは置き換えになるため、ユーザのグループも含める
+		groups := append([]string(nil), ev.Request.GroupConfiguration.GroupsToOverride...)
+		seen := make(map[string]bool, len(groups))
+		for _, g := range groups {
+			seen[g] = true
+		}
+		for _, g := range pt.Groups {
+			if !seen[g] {
+				seen[g] = true
+				groups = append(groups, g)
+			}
+		}
+		od.GroupOverrideDetails = events.GroupConfiguration{
+			GroupsToOverride:   groups,
+			IAMRolesToOverride: ev.Request.GroupConfiguration.IAMRolesToOverride,
+			PreferredRole:      ev.Request.GroupConfiguration.PreferredRole,
+		}
+	}
+	return ev, nil
+}
+
+// ParseClaims claim=value形式の設定をクレーム名と値の組にします（Cognitoが受け付けないクレームはエラー）
+func ParseClaims(rules []string) (map[string]string, error) {
+	claims := make(map[string]string, len(rules))
+	for _, r := range rules {
+		kv := strings.SplitN(r, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.WithStack(fmt.Errorf("invalid claim rule %q (claim=value)", r))
+		}
+		if err := CheckClaim(kv[0]); err != nil {
+			return nil, err
+		}
+		if _, ok := claims[kv[0]]; ok {
+			return nil, errors.WithStack(fmt.Errorf("duplicate claim %q", kv[0]))
+		}
+		claims[kv[0]] = kv[1]
+	}
+	return claims, nil
+}
+
+// CheckClaim Cognitoが変更を受け付けるクレームか検証します
+func CheckClaim(claim string) error {
+	if reservedClaims[claim] {
+		return errors.WithStack(fmt.Errorf("claim %q cannot be changed by the pre token generation trigger", claim))
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package triggers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// fakeGroups 追加したグループを記録するUserAdminProxy（使わない操作は未実装）
+type fakeGroups struct {
+	proxy.UserAdminProxy
+	added []string
+}
+
+func (fg *fakeGroups) AddUserToGroup(ctx context.Context, username, group string) error {
+	fg.added = append(fg.added, username+":"+group)
+	return nil
+}
+
+// fakeMailer 送ったメールを記録するMailer
+type fakeMailer struct {
+	sent []*model.Mail
+}
+
+func (fm *fakeMailer) Send(ctx context.Context, m *model.Mail) error {
+	fm.sent = append(fm.sent, m)
+	return nil
+}
+
+func readEvent(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// lookupJSON JSONをデコードした値から.区切りのパスの値を返します
+func lookupJSON(v interface{}, path string) (interface{}, bool) {
+	for _, k := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// 記録したイベントをハーネス経由でHandleに渡し、返されたイベントの値を検証する
+func TestReplayTestdata(t *testing.T) {
+	templates, err := NewTemplates("", "en")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tests := []struct {
+		name    string
+		event   string
+		handler *Handler
+		// want パスと値（値はJSONをデコードした型）
+		want map[string]interface{}
+		// wantContains パスと含まれる文字列
+		wantContains map[string][]string
+		// wantErr 空でない場合、500とこのerrorMessageを返す
+		wantErr string
+	}{
+		{
+			name:    "pre sign-up auto-confirms the domain",
+			event:   "pre_signup.json",
+			handler: &Handler{PreSignUp: &PreSignUp{AutoConfirmDomains: []string{"@Example.com"}}},
+			want: map[string]interface{}{
+				"triggerSource":            "PreSignUp_SignUp",
+				"response.autoConfirmUser": true,
+				"response.autoVerifyEmail": true,
+				"response.autoVerifyPhone": false,
+			},
+		},
+		{
+			name:    "pre sign-up leaves other domains unconfirmed",
+			event:   "pre_signup.json",
+			handler: &Handler{PreSignUp: &PreSignUp{AutoConfirmDomains: []string{"example.org"}}},
+			want: map[string]interface{}{
+				"response.autoConfirmUser": false,
+				"response.autoVerifyEmail": false,
+			},
+		},
+		{
+			name:    "pre sign-up rejects the domain",
+			event:   "pre_signup.json",
+			handler: &Handler{PreSignUp: &PreSignUp{AllowedDomains: []string{"example.org"}}},
+			wantErr: "sign-up is not allowed for this email domain",
+		},
+		{
+			name:  "pre authentication allows the client and verified email",
+			event: "pre_authentication.json",
+			handler: &Handler{PreAuthentication: &PreAuthentication{
+				AllowedDomains: []string{"example.com"}, RequireVerifiedEmail: true, ClientIDs: []string{"1example23456789"},
+			}},
+			want: map[string]interface{}{
+				"userName": "d4f1c2a0-7c5e-4b7e-9d1a-0a1b2c3d4e5f",
+				"response": map[string]interface{}{},
+			},
+		},
+		{
+			name:    "pre authentication rejects the client",
+			event:   "pre_authentication.json",
+			handler: &Handler{PreAuthentication: &PreAuthentication{ClientIDs: []string{"other-client"}}},
+			wantErr: "sign-in is not allowed for this app client",
+		},
+		{
+			name:  "pre token generation adds claims and groups",
+			event: "pre_token_generation.json",
+			handler: &Handler{PreTokenGeneration: &PreTokenGeneration{
+				ClaimAttributes: map[string]string{"tenant": "custom:tenant_id", "department": "custom:department"},
+				Claims:          map[string]string{"plan": "pro"},
+				Groups:          []string{"admin", "staff"},
+				SuppressClaims:  []string{"email_verified"},
+			}},
+			want: map[string]interface{}{
+				"response.claimsOverrideDetails.claimsToAddOrOverride":                 map[string]interface{}{"tenant": "acme", "plan": "pro"},
+				"response.claimsOverrideDetails.claimsToSuppress":                      []interface{}{"email_verified"},
+				"response.claimsOverrideDetails.groupOverrideDetails.groupsToOverride": []interface{}{"admin", "staff"},
+			},
+		},
+		{
+			name:    "custom message in the user's locale",
+			event:   "custom_message.json",
+			handler: &Handler{CustomMessage: &CustomMessage{Templates: templates, AppName: "Example"}},
+			want: map[string]interface{}{
+				"response.emailSubject": "Example アカウントの確認",
+				"response.smsMessage":   "Example の確認コード: {####}",
+			},
+			wantContains: map[string][]string{
+				"response.emailMessage": {"Taro Yamada 様", "<strong>{####}</strong>"},
+			},
+		},
+		{
+			name:    "invitation in the default locale",
+			event:   "custom_message_invitation.json",
+			handler: &Handler{CustomMessage: &CustomMessage{Templates: templates, AppName: "Example"}},
+			want: map[string]interface{}{
+				"triggerSource":         "CustomMessage_AdminCreateUser",
+				"response.emailSubject": "You have been invited to Example",
+				"response.smsMessage":   "Example username: {username} temporary password: {####}",
+			},
+			wantContains: map[string][]string{
+				"response.emailMessage": {"Hello Taro Yamada,", "<strong>{username}</strong>", "<strong>{####}</strong>"},
+			},
+		},
+		{
+			name:    "post confirmation",
+			event:   "post_confirmation.json",
+			handler: &Handler{PostConfirmation: &PostConfirmation{}},
+			want: map[string]interface{}{
+				"triggerSource": "PostConfirmation_ConfirmSignUp",
+				"response":      map[string]interface{}{},
+			},
+		},
+		{
+			name:    "trigger not configured",
+			event:   "post_confirmation.json",
+			handler: &Handler{PreSignUp: new(PreSignUp)},
+			wantErr: `unsupported trigger source "PostConfirmation_ConfirmSignUp"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewHarness(tt.handler).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(readEvent(t, tt.event))))
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v: %s", err, w.Body)
+			}
+			if tt.wantErr != "" {
+				if w.Code != http.StatusInternalServerError || got["errorMessage"] != tt.wantErr {
+					t.Errorf("status %d, body %v; want 500 with %q", w.Code, got, tt.wantErr)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			for path, want := range tt.want {
+				if v, ok := lookupJSON(got, path); !ok || !reflect.DeepEqual(v, want) {
+					t.Errorf("%s = %#v, want %#v", path, v, want)
+				}
+			}
+			for path, subs := range tt.wantContains {
+				v, _ := lookupJSON(got, path)
+				s, _ := v.(string)
+				for _, sub := range subs {
+					if !strings.Contains(s, sub) {
+						t.Errorf("%s = %q, want it to contain %q", path, s, sub)
+					}
+				}
+			}
+		})
+	}
+}
+
+// 確認後トリガはイベントのユーザ名でグループに追加し、ユーザのロケールで歓迎メールを送る
+func TestReplayPostConfirmation(t *testing.T) {
+	templates, err := NewTemplates("", "en")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	groups, mailer := new(fakeGroups), new(fakeMailer)
+	h := &Handler{PostConfirmation: &PostConfirmation{
+		Groups: groups, DefaultGroups: []string{"members", "newcomers"}, Mailer: mailer, Templates: templates, AppName: "Example",
+	}}
+	if _, err := h.Handle(context.Background(), readEvent(t, "post_confirmation.json")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	const user = "d4f1c2a0-7c5e-4b7e-9d1a-0a1b2c3d4e5f"
+	if want := []string{user + ":members", user + ":newcomers"}; !reflect.DeepEqual(groups.added, want) {
+		t.Errorf("groups = %v, want %v", groups.added, want)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(mailer.sent))
+	}
+	if m := mailer.sent[0]; m.To != "taro@example.com" || m.Subject != "Example へようこそ" || !strings.Contains(m.Body, "Taro Yamada 様") {
+		t.Errorf("mail = %+v", m)
+	}
+}
@@ -0,0 +1,186 @@
+package triggers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// 組み込みのテンプレート（<種類>.<ロケール>.tmpl）
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// テンプレートの種類
+const (
+	MessageSignUp          = "signup"
+	MessageForgotPassword  = "forgot_password"
+	MessageVerifyAttribute = "verify_attribute"
+	MessageInvitation      = "invitation"
+	MessageMFA             = "mfa"
+	MessageWelcome         = "welcome"
+)
+
+// MessageData テンプレートに渡す値
+type MessageData struct {
+	// Code 確認コード（Cognitoが置き換える{####}のようなプレースホルダ）
+	Code string
+	// Username 招待時のユーザ名（Cognitoが置き換える{username}のようなプレースホルダ）
+	Username string
+	Name     string
+	Email    string
+	AppName  string
+}
+
+// Message テンプレートから作ったメッセージ（テンプレートで定義していない部分は空）
+type Message struct {
+	Subject string
+	Email   string
+	SMS     string
+}
+
+// 1つのテンプレートファイル（メール本文はHTMLとしてエスケープする）
+type messageTemplate struct {
+	text *template.Template
+	html *htmltemplate.Template
+}
+
+// Templates 種類とロケール毎のメッセージのテンプレート
+//
+// 各ファイルは{{define "subject"}}、{{define "email"}}、{{define "sms"}}のうち必要なものを定義します。
+type Templates struct {
+	byName        map[string]*messageTemplate
+	defaultLocale string
+}
+
+// NewTemplates 組み込みのテンプレートを読み込み、dirがあれば同じ名前のファイルで置き換えます
+func NewTemplates(dir, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		byName:        map[string]*messageTemplate{},
+		defaultLocale: normalizeLocale(defaultLocale),
+	}
+	sub, err := fs.Sub(builtinTemplates, "templates")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := t.load(sub); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := t.load(os.DirFS(dir)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Templates) load(fsys fs.FS) error {
+	names, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		kind, locale, ok := splitTemplateName(name)
+		if !ok {
+			return errors.WithStack(fmt.Errorf("template %q must be named <kind>.<locale>.tmpl", name))
+		}
+		mt := &messageTemplate{}
+		if mt.text, err = template.New(name).Option("missingkey=error").Parse(string(b)); err != nil {
+			return errors.WithStack(err)
+		}
+		if mt.html, err = htmltemplate.New(name).Option("missingkey=error").Parse(string(b)); err != nil {
+			return errors.WithStack(err)
+		}
+		t.byName[kind+"."+locale] = mt
+	}
+	return nil
+}
+
+// Render localeに最も近いロケールのテンプレートでメッセージを作ります（テンプレートがない場合はnil）
+//
+// htmlの場合はメール本文の値をHTMLとしてエスケープします（Cognitoが送るメールはHTMLとして扱われる）。
+func (t *Templates) Render(kind, locale string, data *MessageData, html bool) (*Message, error) {
+	mt := t.lookup(kind, locale)
+	if mt == nil {
+		return nil, nil
+	}
+	m := new(Message)
+	var err error
+	if m.Subject, err = executeText(mt.text, "subject", data); err != nil {
+		return nil, err
+	}
+	if m.SMS, err = executeText(mt.text, "sms", data); err != nil {
+		return nil, err
+	}
+	if !html {
+		if m.Email, err = executeText(mt.text, "email", data); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if mt.html.Lookup("email") != nil {
+		var buf bytes.Buffer
+		if err := mt.html.ExecuteTemplate(&buf, "email", data); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		m.Email = strings.TrimSpace(buf.String())
+	}
+	return m, nil
+}
+
+// lookup ja-jp、ja、既定のロケールの順に探します
+func (t *Templates) lookup(kind, locale string) *messageTemplate {
+	locale = normalizeLocale(locale)
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, locale[:i])
+		}
+	}
+	candidates = append(candidates, t.defaultLocale)
+	for _, l := range candidates {
+		if mt, ok := t.byName[kind+"."+l]; ok {
+			return mt
+		}
+	}
+	return nil
+}
+
+func executeText(tmpl *template.Template, name string, data *MessageData) (string, error) {
+	if tmpl.Lookup(name) == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// splitTemplateName signup.ja.tmplを種類とロケールに分けます
+func splitTemplateName(name string) (string, string, bool) {
+	base := strings.TrimSuffix(path.Base(name), ".tmpl")
+	i := strings.LastIndex(base, ".")
+	if i <= 0 || i == len(base)-1 {
+		return "", "", false
+	}
+	return base[:i], normalizeLocale(base[i+1:]), true
+}
+
+// normalizeLocale ja_JPとja-JPを同じロケールとして扱います
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
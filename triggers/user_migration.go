@@ -0,0 +1,54 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+
+	"github.com/taniyuu/gin-cognito-sample/domain/model"
+	"github.com/taniyuu/gin-cognito-sample/domain/proxy"
+)
+
+// ユーザ移行トリガのtriggerSource
+const (
+	migrateAuthentication = "UserMigration_Authentication"
+	migrateForgotPassword = "UserMigration_ForgotPassword"
+)
+
+// UserMigration ユーザプールに存在しないアカウントを移行元から移行するUser Migrationトリガ
+//
+// ログイン時はパスワードを照合して確認済み（CONFIRMED）で移行し、パスワードを忘れた場合はリセットが必要な状態で移行します。
+// エラーを返すとCognitoはUserNotFoundExceptionとして扱います。
+type UserMigration struct {
+	Store proxy.LegacyUserStore
+}
+
+// MigrateUser 移行元のアカウントの属性と移行後の状態を返します
+func (um *UserMigration) MigrateUser(
+	ctx context.Context,
+	ev *events.CognitoEventUserPoolsMigrateUser,
+) (*events.CognitoEventUserPoolsMigrateUser, error) {
+	var u *model.LegacyUser
+	var err error
+	switch ev.TriggerSource {
+	case migrateAuthentication:
+		if u, err = um.Store.Authenticate(ctx, ev.UserName, ev.CognitoEventUserPoolsMigrateUserRequest.Password); err != nil {
+			return nil, err
+		}
+		ev.CognitoEventUserPoolsMigrateUserResponse.FinalUserStatus = "CONFIRMED"
+	case migrateForgotPassword:
+		// パスワードは移行せず、Cognitoが送る確認コードで新しいパスワードを設定させる
+		if u, err = um.Store.Lookup(ctx, ev.UserName); err != nil {
+			return nil, err
+		}
+		ev.CognitoEventUserPoolsMigrateUserResponse.FinalUserStatus = "RESET_REQUIRED"
+	default:
+		return nil, errors.WithStack(fmt.Errorf("unsupported trigger source %q", ev.TriggerSource))
+	}
+	ev.CognitoEventUserPoolsMigrateUserResponse.UserAttributes = u.UserAttributes()
+	// 移行を知らせる招待メールは送らない
+	ev.CognitoEventUserPoolsMigrateUserResponse.MessageAction = "SUPPRESS"
+	return ev, nil
+}